@@ -1,47 +1,79 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"zinc/catalog"
+	"zinc/jobs"
+	"zinc/scrape"
+	"zinc/tranche"
 )
 
 // Struct to store user input
 type InputData struct {
-	Conditions []Condition
-	Message    string
+	Message string
 }
 
 type Condition struct {
 	LogP            string
 	MolecularWeight string
-	ZincIDs         []string
-	FileName        string
+	Quantity        string
 }
 
 var tpl = template.Must(template.ParseFiles("index.html"))
 
+// 所有请求共用同一个 scraper，对 zinc20.docking.org 的同时请求数有上限；
+// 地址可以用 -base-url 指向本地的假 ZINC 服务器（zinc/cmd/fakezinc）做离线测试
+var scraper *scrape.Scraper
+
+// 抓取在后台任务中进行，完成的任务保留在列表中
+var manager = jobs.NewManager()
+
+// 抓取失败的页面记录在这个文件中，可以通过 /retry 重新抓取
+const failedPagesFile = "failed_pages.json"
+
+// failedMu 保护 failed_pages.json，多个任务可能同时更新它
+var failedMu sync.Mutex
+
+// 抓取到的 ZINC ID 记录在各项目共用的数据库中（可用环境变量 ZINC_CATALOG 指定位置），
+// 同一个进程同时只能打开一次，由 catalogMu 保护
+var catalogPath = catalog.Path(catalog.DefaultPath)
+var catalogMu sync.Mutex
+
 func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	baseURL := flag.String("base-url", scrape.DefaultBaseURL, "ZINC20 server to scrape")
+	flag.Parse()
+	scraper = scrape.New(scrape.Options{BaseURL: *baseURL, Logf: log.Printf})
+
 	http.HandleFunc("/", homePage)
 	http.HandleFunc("/fetch", fetchZincIDs)
-	fmt.Println("Server started at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	http.HandleFunc("/retry", retryFailedPages)
+	// 任务列表、进度、SSE、取消和输出文件下载
+	manager.Handle(http.DefaultServeMux)
+	fmt.Printf("Server started at http://localhost%s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
 }
 
 func homePage(w http.ResponseWriter, r *http.Request) {
-	data := InputData{}
+	// 不使用 JavaScript 提交表单时，抓取的说明（例如被排除的区间）通过 note 参数带过来
+	data := InputData{Message: r.FormValue("note")}
 	tpl.Execute(w, data)
 }
 
-// fetchZincIDs 处理抓取 ZINC IDs
+// fetchZincIDs 创建抓取 ZINC IDs 的后台任务，立即返回任务编号
 func fetchZincIDs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -70,96 +102,247 @@ func fetchZincIDs(w http.ResponseWriter, r *http.Request) {
 			conditions = append(conditions, Condition{
 				LogP:            logP,
 				MolecularWeight: molecularWeight,
+				Quantity:        r.FormValue(fmt.Sprintf("quantity%d", i+1)),
 			})
 		}
 	}
 
 	if len(conditions) == 0 {
-		data := InputData{Message: "至少需要输入一组条件。"}
-		tpl.Execute(w, data)
+		rejectRequest(w, r, "至少需要输入一组条件。")
+		return
+	}
+
+	// 映射输入为ZINC20网址字母：单个值（原来下拉菜单中的值）对应一个 tranche，
+	// 范围（例如分子量 300-400、logP 1-3）对应范围内的所有 tranche
+	var names, notes []string
+	for _, cond := range conditions {
+		var q tranche.Query
+		var err error
+		if q.MolecularWeight, err = tranche.ParseRange(cond.MolecularWeight); err != nil {
+			rejectRequest(w, r, fmt.Sprintf("无效的分子量: %v", err))
+			return
+		}
+		if q.LogP, err = tranche.ParseRange(cond.LogP); err != nil {
+			rejectRequest(w, r, fmt.Sprintf("无效的 LogP: %v", err))
+			return
+		}
+		for _, name := range q.Names() {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		// 范围下限刚好是某个区间的上限时，那个区间不会被抓取，告诉用户
+		for _, axis := range []struct {
+			name string
+			r    tranche.Range
+			bins []tranche.Bin
+		}{{"分子量", q.MolecularWeight, tranche.MolecularWeight}, {"LogP", q.LogP, tranche.LogP}} {
+			for _, b := range axis.r.Touching(axis.bins) {
+				note := fmt.Sprintf("%s %s 不包含区间 %s，%s刚好等于 %g 的分子不会被抓取", axis.name, axis.r, b, axis.name, axis.r.Min)
+				if !slices.Contains(notes, note) {
+					notes = append(notes, note)
+				}
+			}
+		}
+	}
+
+	job := manager.Start("fetch", names, func(ctx context.Context, j *jobs.Job) error {
+		results := scrapeTranches(ctx, j, len(names), func(i int, progress func(scrape.Progress)) (*scrape.Result, error) {
+			return scraper.Tranche(ctx, names[i], progress)
+		})
+		var failed []scrape.PageError
+		for _, res := range results {
+			if res != nil {
+				failed = append(failed, res.Failed...)
+			}
+		}
+		if err := updateFailedPages(names, failed); err != nil {
+			log.Printf("Error saving %s: %v", failedPagesFile, err)
+		}
+		return ctx.Err()
+	})
+	acceptJob(w, r, job, strings.Join(notes, "；"))
+}
+
+// retryFailedPages 创建后台任务，重新抓取 failed_pages.json 中的页面，并把结果合并到数据库和对应的 txt 文件
+func retryFailedPages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	failedMu.Lock()
+	failed, err := loadFailedPages()
+	failedMu.Unlock()
+	if err != nil || len(failed) == 0 {
+		rejectRequest(w, r, "没有需要重试的页面。")
 		return
 	}
 
-	// 抓取ZINC ID
+	// 按 tranche 分组，每组是任务中的一项
+	byTranche := make(map[string][]scrape.PageError)
+	var names []string
+	for _, f := range failed {
+		if byTranche[f.Tranche] == nil {
+			names = append(names, f.Tranche)
+		}
+		byTranche[f.Tranche] = append(byTranche[f.Tranche], f)
+	}
+
+	job := manager.Start("retry", names, func(ctx context.Context, j *jobs.Job) error {
+		results := scrapeTranches(ctx, j, len(names), func(i int, progress func(scrape.Progress)) (*scrape.Result, error) {
+			if _, err := tranche.Parse(names[i]); err != nil {
+				return nil, err
+			}
+			// 之前抓到的 ID 已在数据库中，这里只需要重试的页面
+			res := &scrape.Result{Tranche: names[i], Failed: byTranche[names[i]]}
+			j.Update(i, func(task *jobs.Task) { task.Total = len(res.Failed) })
+			return res, scraper.Retry(ctx, res, progress)
+		})
+		var still []scrape.PageError
+		for _, res := range results {
+			if res != nil {
+				still = append(still, res.Failed...)
+			}
+		}
+		if err := updateFailedPages(names, still); err != nil {
+			log.Printf("Error saving %s: %v", failedPagesFile, err)
+		}
+		return ctx.Err()
+	})
+	acceptJob(w, r, job, "")
+}
+
+// scrapeTranches 同时抓取 n 个 tranche（第 i 个对应任务的第 i 项），更新进度并把结果保存到数据库和 txt 文件。
+// 每个 goroutine 只写入 results[i]。
+func scrapeTranches(ctx context.Context, j *jobs.Job, n int, scrapeOne func(i int, progress func(scrape.Progress)) (*scrape.Result, error)) []*scrape.Result {
+	results := make([]*scrape.Result, n)
 	var wg sync.WaitGroup
-	for i, cond := range conditions {
+	for i := 0; i < n; i++ {
 		wg.Add(1)
-		go func(i int, cond Condition) {
+		go func(i int) {
 			defer wg.Done()
+			progress := func(p scrape.Progress) {
+				j.Update(i, func(task *jobs.Task) {
+					task.Done++
+					if p.LastPage > task.Total {
+						task.Total = p.LastPage
+					}
+					if p.Err != nil {
+						task.Errors = append(task.Errors, fmt.Sprintf("第 %d 页: %v", p.Page, p.Err))
+					}
+				})
+			}
 
-			// 映射输入为ZINC20网址字母
-			logPMap := map[string]string{"-1": "A", "0": "B", "1": "C", "2": "D", "2.5": "E", "3": "F", "3.5": "G", "4": "H", "4.5": "I", "5": "J", ">5": "K"}
-			mwMap := map[string]string{"200": "A", "250": "B", "300": "C", "325": "D", "350": "E", "375": "F", "400": "G", "425": "H", "450": "I", "500": "J", ">500": "K"}
-
-			logPLetter := logPMap[cond.LogP]
-			mwLetter := mwMap[cond.MolecularWeight]
-
-			if logPLetter == "" || mwLetter == "" {
+			// 被取消时 res 仍包含已抓取的页面
+			res, scrapeErr := scrapeOne(i, progress)
+			if res == nil {
+				j.Update(i, func(task *jobs.Task) {
+					task.Errors = append(task.Errors, scrapeErr.Error())
+					task.Finished = true
+				})
 				return
 			}
 
-			// 生成正确的基础URL
-			baseURL := fmt.Sprintf("https://zinc20.docking.org/substances/subsets/%s%s/", mwLetter, logPLetter)
-			fmt.Println("URL = ", baseURL)
-
-			// 抓取ZINC ID
-			var zincIDs []string
-			var pageWg sync.WaitGroup
-			// 使用 goroutine 同时抓取多个页面
-			for page := 1; page <= 50; page++ {
-				pageWg.Add(1)
-				go func(page int) {
-					defer pageWg.Done()
-					pageURL := fmt.Sprintf("%s?page=%d", baseURL, page)
-					fmt.Println("URL = ", pageURL)
-					ids, err := scrapeZincIDs(pageURL)
+			// 保存ZINC ID（已补足12位并按数字排序）
+			fileName, count, saveErr := saveTranche(res.Tranche, res.IDs)
+			j.Update(i, func(task *jobs.Task) {
+				for _, err := range []error{scrapeErr, saveErr} {
 					if err != nil {
-						log.Printf("Error scraping page %d for %s_%s: %v", page, cond.MolecularWeight, cond.LogP, err)
-						return
+						task.Errors = append(task.Errors, err.Error())
 					}
-					zincIDs = append(zincIDs, ids...)
-				}(page)
-			}
-			pageWg.Wait()
-
-			// 格式化ZINC IDs（去除前导零并确保12位）
-			formattedZincIDs := make([]string, 0)
-			for _, id := range zincIDs {
-				formattedID := formatZincID(id)
-				if formattedID != "" {
-					formattedZincIDs = append(formattedZincIDs, formattedID)
 				}
-			}
-
-			// 对ZINC ID按照数字排序
-			sort.Slice(formattedZincIDs, func(i, j int) bool {
-				numI := extractNumericPart(formattedZincIDs[i])
-				numJ := extractNumericPart(formattedZincIDs[j])
-				return numI < numJ
+				if saveErr == nil {
+					task.Output, task.Count = fileName, count
+				}
+				task.Total = task.Done
+				task.Finished = true
 			})
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
 
-			// 保存ZINC ID到文件
-			err := saveToFileWithLetters(logPLetter, mwLetter, formattedZincIDs)
-			if err != nil {
-				log.Printf("Error saving to file %s%s: %v", mwLetter, logPLetter, err)
-				return
-			}
+// acceptJob 返回新任务的编号：JSON 请求得到 202 和任务地址，浏览器表单则回到首页显示进度；
+// note 不为空时一并告诉用户（例如被排除的区间）
+func acceptJob(w http.ResponseWriter, r *http.Request, job *jobs.Job, note string) {
+	if !wantsJSON(r) {
+		target := "/?job=" + job.ID()
+		if note != "" {
+			target += "&note=" + url.QueryEscape(note)
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID())
+	w.WriteHeader(http.StatusAccepted)
+	resp := map[string]string{
+		"id":     job.ID(),
+		"status": "/jobs/" + job.ID(),
+		"events": "/jobs/" + job.ID() + "/events",
+	}
+	if note != "" {
+		resp["note"] = note
+	}
+	json.NewEncoder(w).Encode(resp)
+}
 
-			// 更新条件的ZincIDs
-			cond.ZincIDs = formattedZincIDs
-			conditions[i] = cond
-		}(i, cond)
+// rejectRequest 回报无法创建任务的原因
+func rejectRequest(w http.ResponseWriter, r *http.Request, message string) {
+	if wantsJSON(r) {
+		http.Error(w, message, http.StatusBadRequest)
+		return
 	}
+	tpl.Execute(w, InputData{Message: message})
+}
 
-	// 等待所有goroutine完成
-	wg.Wait()
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
 
-	// 显示抓取结果
-	data := InputData{
-		Conditions: conditions,
-		Message:    "抓取完成，ZINC ID 已保存至对应文件。",
+// updateFailedPages 用这次抓取的结果替换 tranches 之前记录的失败页面，其他 tranche 的记录保留
+func updateFailedPages(tranches []string, failed []scrape.PageError) error {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	replaced := make(map[string]bool, len(tranches))
+	for _, t := range tranches {
+		replaced[t] = true
 	}
-	tpl.Execute(w, data)
+	previous, _ := loadFailedPages()
+	for _, f := range previous {
+		if !replaced[f.Tranche] {
+			failed = append(failed, f)
+		}
+	}
+	return saveFailedPages(failed)
+}
+
+// saveFailedPages 把失败的页面写入 failed_pages.json；没有失败时删除该文件
+func saveFailedPages(failed []scrape.PageError) error {
+	if len(failed) == 0 {
+		if err := os.Remove(failedPagesFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(failed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(failedPagesFile, data, 0o644)
+}
+
+// loadFailedPages 读取 failed_pages.json
+func loadFailedPages() ([]scrape.PageError, error) {
+	data, err := os.ReadFile(failedPagesFile)
+	if err != nil {
+		return nil, err
+	}
+	var failed []scrape.PageError
+	err = json.Unmarshal(data, &failed)
+	return failed, err
 }
 
 // 删除旧的txt文件
@@ -183,94 +366,31 @@ func fetchZincIDs(w http.ResponseWriter, r *http.Request) {
 	return nil
 }*/
 
-// 将抓取到的ZINC IDs保存到文件，文件名使用字母表示 LogP 和 Molecular Weight
-func saveToFileWithLetters(logPLetter, mwLetter string, zincIDs []string) error {
-	fileName := fmt.Sprintf("zinc_ids_%s%s.txt", mwLetter, logPLetter)
-	file, err := os.Create(fileName)
+// saveTranche 把抓取到的 ZINC IDs 记录到数据库，再用数据库中这个 tranche 的全部 ID 重写 zinc_ids_XX.txt，
+// 之前抓到、这次没抓到的 ID 不会丢失。返回文件名和文件中的 ID 数。
+func saveTranche(name string, zincIDs []string) (string, int, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	cat, err := catalog.Open(catalogPath)
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %v", err)
+		return "", 0, err
 	}
-	defer file.Close()
-
-	// 写入ZINC IDs
-	for _, id := range zincIDs {
-		_, err := file.WriteString(id + "\n")
-		if err != nil {
-			return fmt.Errorf("写入文件失败: %v", err)
-		}
-	}
-
-	return nil
-}
-
-// scrapeZincIDs 从网页中抓取ZINC ID
-func scrapeZincIDs(url string) ([]string, error) {
-	// 请求页面内容
-	res, err := http.Get(url)
+	defer cat.Close()
+	added, err := cat.Observe(name, zincIDs, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("获取页面失败: %v", err)
+		return "", 0, fmt.Errorf("写入数据库失败: %v", err)
 	}
-	defer res.Body.Close()
+	log.Printf("%s: %d ZINC IDs scraped, %d new", name, len(zincIDs), added)
 
-	// 使用 goquery 解析HTML
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	fileName := fmt.Sprintf("zinc_ids_%s.txt", name)
+	file, err := os.Create(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("解析HTML失败: %v", err)
+		return "", 0, fmt.Errorf("创建文件失败: %v", err)
 	}
-
-	// 抓取所有ZINC ID
-	var zincIDs []string
-	doc.Find(".zinc-id.caption").Each(func(i int, s *goquery.Selection) {
-		// 获取ZINC ID的文本
-		id := s.Text()
-		id = strings.TrimSpace(id)
-
-		// 确保只包含ZINC ID，不包括其他内容
-		if strings.HasPrefix(id, "ZINC") {
-			// 去除后面的描述信息，只保留ZINC ID部分
-			id = strings.Split(id, " ")[0]
-			zincIDs = append(zincIDs, id)
-		}
-	})
-
-	return zincIDs, nil
-}
-
-// 格式化ZINC ID：去除前导零并确保12位
-func formatZincID(id string) string {
-	// Trim whitespace
-	id = strings.TrimSpace(id)
-
-	// Ensure the ID starts with "ZINC"
-	if strings.HasPrefix(id, "ZINC") {
-		// Get the number part after "ZINC"
-		numPart := id[4:]
-
-		// 如果是 7 位数字，补充为 12 位
-		if len(numPart) < 12 {
-			for len(numPart) < 12 {
-				numPart = "0" + numPart
-			}
-		}
-
-		// Return the properly formatted ID
-		return "ZINC" + numPart
-	}
-	return ""
-}
-
-// 提取ZINC ID中的数字部分
-func extractNumericPart(id string) int {
-	// 从 ZINC ID 提取数字部分并转为整数
-	var numericPart string
-	for _, char := range id[4:] {
-		if char >= '0' && char <= '9' {
-			numericPart += string(char)
-		}
-	}
-	num, err := strconv.Atoi(numericPart)
+	defer file.Close()
+	count, err := cat.WriteTranche(name, file)
 	if err != nil {
-		return 0
+		return "", 0, fmt.Errorf("写入文件失败: %v", err)
 	}
-	return num
+	return fileName, count, nil
 }
@@ -2,8 +2,14 @@ module project
 
 go 1.23.2
 
+require zinc v0.0.0
+
 require (
 	github.com/PuerkitoBio/goquery v1.10.0 // indirect
 	github.com/andybalholm/cascadia v1.3.2 // indirect
+	go.etcd.io/bbolt v1.3.11 // indirect
 	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 )
+
+replace zinc => ../zinc
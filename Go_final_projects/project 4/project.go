@@ -1,42 +1,129 @@
 package main
 
 import (
-	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"zinc/catalog"
+	"zinc/fingerprint"
+	"zinc/jobs"
+	"zinc/merge"
+	"zinc/sample"
+	"zinc/smarts"
 )
 
 // 設定Zinc ID檔案目錄
 const zincIDsDir = `zinc_ids`
 const resultFileName = "zinc_ids.txt" // 結果檔案名稱
 
+// 每次提交的結果放在 jobs/<工作編號> 中，兩個人同時使用表單也不會覆寫彼此的清單
+const jobsDir = "jobs"
+
+// 下載流程（project）存放配體 SD 檔的目錄
+const ligandDir = "../project/set_1"
+
+// 各專案共用的 ZINC ID 資料庫，可以用環境變數 ZINC_CATALOG 指定位置
+var catalogPath = catalog.Path(catalog.DefaultPath)
+
+// store 保存每個工作的結果與提交它的瀏覽器工作階段
+var store *jobs.Store
+
 func main() {
-	// 刪除舊的 zinc_ids.txt 檔案（如果存在）
-	if err := os.Remove(resultFileName); err != nil && !os.IsNotExist(err) {
-		log.Fatalf("Failed to remove old result file: %v", err)
+	retention := flag.Duration("retention", jobs.DefaultRetention, "how long selection results are kept (negative keeps them forever)")
+	flag.Parse()
+
+	var err error
+	if store, err = jobs.OpenStore(jobsDir, *retention); err != nil {
+		log.Fatalf("Failed to open %s: %v", jobsDir, err)
+	}
+	// 啟動時與之後每小時刪除過期的工作
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			if n, err := store.Cleanup(time.Now()); err != nil {
+				log.Printf("Failed to remove expired jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d expired jobs from %s", n, jobsDir)
+			}
+		}
+	}()
+
+	// 把 zinc_ids 中的 tranche 檔匯入資料庫，已匯入的 ID 不會重複
+	if err := importTranches(); err != nil {
+		log.Printf("Failed to import %s into %s: %v", zincIDsDir, catalogPath, err)
 	}
 
 	// 設定路由
 	http.HandleFunc("/", serveForm)
 	http.HandleFunc("/process", processRequest)
+	http.HandleFunc("/search", searchRequest)
+	http.HandleFunc("GET /jobs", listJobs)
+	http.HandleFunc("GET /jobs/{id}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		store.ServeFile(w, r, r.PathValue("id"), r.PathValue("file"))
+	})
 
 	// 啟動伺服器
 	fmt.Println("Server started at http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
-// 伺服器主頁，提供HTML表單
+// pageData 是 index.html 與 completion.html 的內容；History 是這個瀏覽器工作階段的工作，最新的在前
+type pageData struct {
+	JobID        string
+	FilePath     string
+	ManifestPath string
+	Seed         int64
+	History      []jobs.Record
+	Retention    string
+}
+
+// history 回傳工作階段中已完成的工作
+func history(session string) []jobs.Record {
+	all, err := store.List(session)
+	if err != nil {
+		log.Printf("Failed to list jobs: %v", err)
+	}
+	var done []jobs.Record
+	for _, rec := range all {
+		if len(rec.Files) > 0 {
+			done = append(done, rec)
+		}
+	}
+	return done
+}
+
+// render 以 history.html 中的歷史記錄區塊渲染頁面
+func render(w http.ResponseWriter, page string, data pageData) {
+	if days := store.Retention().Hours() / 24; days >= 1 {
+		data.Retention = fmt.Sprintf("%g days", days)
+	} else if store.Retention() > 0 {
+		data.Retention = store.Retention().String()
+	}
+	tmpl := template.Must(template.ParseFiles(page, "history.html"))
+	tmpl.Execute(w, data)
+}
+
+// 伺服器主頁，提供HTML表單與這個瀏覽器的挑選記錄
 func serveForm(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("index.html"))
-	tmpl.Execute(w, nil)
+	render(w, "index.html", pageData{History: history(jobs.Session(w, r))})
+}
+
+// listJobs 以 JSON 回傳這個瀏覽器工作階段的工作
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	list := history(jobs.Session(w, r))
+	if list == nil {
+		list = []jobs.Record{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
 }
 
 // 處理用戶提交的表單
@@ -57,64 +144,185 @@ func processRequest(w http.ResponseWriter, r *http.Request) {
 	logPValues := r.Form["logP[]"]
 	molecularWeights := r.Form["molecularWeight[]"]
 	quantities := r.Form["quantity[]"]
+	selections := r.Form["selection[]"]
 
 	if len(logPValues) == 0 || len(logPValues) > 5 {
 		http.Error(w, "Conditions must be between 1 and 5", http.StatusBadRequest)
 		return
 	}
-
-	// 準備輸出結果檔案
-	output, err := os.Create(resultFileName)
-	if err != nil {
-		http.Error(w, "Failed to create result file", http.StatusInternalServerError)
+	if len(molecularWeights) != len(logPValues) || len(quantities) != len(logPValues) {
+		http.Error(w, "Every condition needs a logP, molecular weight and quantity", http.StatusBadRequest)
 		return
 	}
-	defer output.Close()
-
-	// 處理每組條件
-	for i := range logPValues {
-		logP := logPValues[i]
-		molecularWeight := molecularWeights[i]
-		quantity, _ := strconv.Atoi(quantities[i])
-
-		// 構造文件名稱
-		fileName := fmt.Sprintf("zinc_ids_%s%s.txt", molecularWeight, logP)
-		filePath := filepath.Join(zincIDsDir, fileName)
 
-		// 打開對應檔案
-		file, err := os.Open(filePath)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to open file: %s", fileName), http.StatusInternalServerError)
+	// 種子可以省略，省略時產生一個新的並記錄在 manifest 中
+	seed := sample.NewSeed()
+	if v := strings.TrimSpace(r.FormValue("seed")); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Seed must be an integer", http.StatusBadRequest)
 			return
 		}
-		defer file.Close()
-
-		// 讀取Zinc ID
-		var zincIDs []string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			zincIDs = append(zincIDs, scanner.Text())
-		}
+	}
 
-		if len(zincIDs) < quantity {
-			http.Error(w, fmt.Sprintf("Not enough Zinc IDs in file: %s", fileName), http.StatusInternalServerError)
+	// 解析每組條件（舊的表單沒有挑選方式欄位，一律視為隨機）
+	conds := make([]sample.Condition, len(logPValues))
+	for i := range conds {
+		quantity, err := strconv.Atoi(quantities[i])
+		if err != nil || quantity < 1 {
+			http.Error(w, "Quantity must be a positive integer", http.StatusBadRequest)
 			return
 		}
+		method := fingerprint.Random
+		if i < len(selections) {
+			if method, err = fingerprint.ParseSelection(selections[i]); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid selection method: %s", selections[i]), http.StatusBadRequest)
+				return
+			}
+		}
+		conds[i] = sample.Condition{
+			MolecularWeight: molecularWeights[i],
+			LogP:            logPValues[i],
+			Quantity:        quantity,
+			Selection:       method,
+		}
+	}
 
-		// 隨機選取Zinc ID
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(zincIDs), func(i, j int) { zincIDs[i], zincIDs[j] = zincIDs[j], zincIDs[i] })
+	// 依種子挑選；已下載結構不足的 tranche 會退回隨機挑選
+	sampler := &sample.Sampler{
+		TrancheDir:   zincIDsDir,
+		LigandDir:    ligandDir,
+		Fingerprints: downloadedFingerprints,
+		Logf:         log.Printf,
+	}
+	// tranche 優先從資料庫讀取；資料庫無法開啟時只讀 zinc_ids 中的檔案
+	if cat, err := catalog.Open(catalogPath); err != nil {
+		log.Printf("Reading tranches from %s only: %v", zincIDsDir, err)
+	} else {
+		defer cat.Close()
+		sampler.Catalog = cat
+	}
+	manifest, err := sampler.Run(seed, conds)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("Failed to open file: %v", err), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		selected := zincIDs[:quantity]
-		output.WriteString(strings.Join(selected, "\n") + "\n")
+	// 結果檔案與 manifest 寫到這次提交自己的工作目錄
+	session := jobs.Session(w, r)
+	job, err := store.Create(session, "sample")
+	if err != nil {
+		http.Error(w, "Failed to create job", http.StatusInternalServerError)
+		return
+	}
+	manifestName := sample.ManifestPath(resultFileName)
+	if err := writeResult(job.ID, manifestName, manifest); err != nil {
+		log.Printf("Failed to write job %s: %v", job.ID, err)
+		store.Remove(job.ID)
+		http.Error(w, "Failed to write result file", http.StatusInternalServerError)
+		return
+	}
+	job.Files = []string{resultFileName, manifestName}
+	job.Summary = fmt.Sprintf("%d ZINC IDs, seed %d", len(manifest.IDs()), manifest.Seed)
+	if err := store.Save(job); err != nil {
+		store.Remove(job.ID)
+		http.Error(w, "Failed to save job", http.StatusInternalServerError)
+		return
+	}
+	jobURL := "/jobs/" + job.ID + "/"
+
+	// API 用戶端直接取得 manifest；Content-Location 是它在工作目錄中的網址
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Location", jobURL+manifestName)
+		json.NewEncoder(w).Encode(manifest)
+		return
 	}
 
 	// 使用模板渲染結果頁面
-	tmpl := template.Must(template.ParseFiles("completion.html"))
-	data := struct {
-		FilePath string
-	}{
-		FilePath: resultFileName, // 假設輸出的文件名是 zinc_ids.txt
+	render(w, "completion.html", pageData{
+		JobID:        job.ID,
+		FilePath:     jobURL + resultFileName,
+		ManifestPath: jobURL + manifestName,
+		Seed:         manifest.Seed,
+		History:      history(session),
+	})
+}
+
+// writeResult 在工作目錄中寫出 ID 清單與 manifest
+func writeResult(id, manifestName string, manifest *sample.Manifest) error {
+	output, err := os.Create(store.Path(id, resultFileName))
+	if err != nil {
+		return err
 	}
-	tmpl.Execute(w, data)
+	err = manifest.WriteIDs(output)
+	if cerr := output.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return sample.WriteManifest(store.Path(id, manifestName), manifest)
+}
+
+// importTranches 把 zinc_ids 目錄中的 zinc_ids_XX.txt 匯入資料庫
+func importTranches() error {
+	cat, err := catalog.Open(catalogPath)
+	if err != nil {
+		return err
+	}
+	defer cat.Close()
+	added, err := cat.ImportDir(zincIDsDir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d new ZINC IDs from %s into %s", added, zincIDsDir, catalogPath)
+	return nil
+}
+
+// 讀取已下載配體的 Morgan 指紋，以 ZINC ID 為索引；讀取失敗時回傳空的表，所有條件都會改用隨機挑選
+func downloadedFingerprints() map[string]fingerprint.Fingerprint {
+	lib, err := fingerprint.LoadLibrary(ligandDir)
+	if err != nil {
+		log.Printf("Failed to load ligand fingerprints: %v", err)
+		return map[string]fingerprint.Fingerprint{}
+	}
+	return lib.Index(fingerprint.Morgan)
+}
+
+// 以 SMARTS 在已下載的配體中做子結構搜尋，回傳命中的 ZINC ID 與原子對應（JSON）
+func searchRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	query, err := smarts.Parse(r.FormValue("smarts"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid SMARTS: %v", err), http.StatusBadRequest)
+		return
+	}
+	maxMatches := 100
+	if v := r.FormValue("max"); v != "" {
+		if maxMatches, err = strconv.Atoi(v); err != nil || maxMatches < 0 {
+			http.Error(w, "max must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	files, err := merge.ListSDFFiles(ligandDir)
+	if err != nil {
+		http.Error(w, "Failed to list ligand files", http.StatusInternalServerError)
+		return
+	}
+	result := smarts.SearchFiles(query, files, maxMatches)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
@@ -2,6 +2,15 @@ module project
 
 go 1.23.2
 
-require github.com/fsnotify/fsnotify v1.8.0
+require zinc v0.0.0
 
-require golang.org/x/sys v0.25.0 // indirect
+require (
+	github.com/PuerkitoBio/goquery v1.10.0 // indirect
+	github.com/andybalholm/cascadia v1.3.2 // indirect
+	github.com/fsnotify/fsnotify v1.8.0 // indirect
+	go.etcd.io/bbolt v1.3.11 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+)
+
+replace zinc => ../zinc
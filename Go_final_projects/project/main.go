@@ -1,150 +1,617 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
+	"io"
 	"log"
+	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"time"
+	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/fsnotify/fsnotify"
+	"zinc/catalog"
+	"zinc/depict"
+	"zinc/download"
+	"zinc/embed"
+	"zinc/export"
+	"zinc/filter"
+	"zinc/merge"
+	"zinc/pipeline"
+	"zinc/prep"
+	"zinc/sample"
 )
 
-// runProjectGo 用來執行 project.go，並將其作為後台進程運行
-func runProjectGo() {
-	cmd := exec.Command("go", "run", "step1/project.go")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// 以同一個行程執行「挑選 → 下載 → 合併」的管線。先前的做法是用 go run 啟動 step1，
+// 監看 zinc_ids.txt 的寫入事件並等待兩秒後再用 go run 執行 step2，
+// 檔案分段寫入或以改名方式取代時會在寫完之前觸發，或根本不觸發。
+// 現在每一步都是 Go 函式，結果直接交給下一步，並記錄在 pipeline_checkpoint.json，
+// 失敗後再次執行會從最後一個成功的步驟之後繼續。step1 與 step2 仍可單獨執行。
 
-	// 開始執行並讓它在背景運行
-	err := cmd.Start()
-	if err != nil {
-		log.Fatalf("執行 project.go 失敗: %v", err)
+const (
+	zincIDsDir     = "step1/zinc_ids"           // tranche 清單目錄
+	resultFileName = "zinc_ids.txt"             // 挑選結果
+	checkpointPath = "pipeline_checkpoint.json" // 各步驟的檢查點
+)
+
+// sampleRequest 是表單送出的條件
+type sampleRequest struct {
+	Seed       int64              `json:"seed"`
+	Conditions []sample.Condition `json:"conditions"`
+}
+
+// idList 是挑選的結果，也是下載的輸入
+type idList struct {
+	Path string   `json:"path"`
+	IDs  []string `json:"ids"`
+}
+
+// downloaded 是下載的結果：每種格式的輸出目錄與報告。
+// 目錄中可能還有先前清單留下的檔案，之後的步驟只使用 Files 中這份清單的 sdf 檔（篩選後為通過的檔案）。
+type downloaded struct {
+	Dirs    map[string]string           `json:"dirs"`
+	Reports map[string]*download.Report `json:"reports"`
+	Files   []string                    `json:"files"`
+}
+
+// sdfFiles 回傳這份清單的 sdf 檔；舊版的檢查點沒有記錄檔案，要以 -restart 重新執行
+func (d downloaded) sdfFiles() ([]string, error) {
+	if d.Files == nil {
+		return nil, fmt.Errorf("checkpoint does not list the downloaded files; run again with -restart")
 	}
+	return d.Files, nil
+}
 
-	// 顯示訊息並提示 project.go 正在運行
-	fmt.Println("project.go 正在運行，等待 zinc_ids.txt 被生成...")
+// merged 是合併 sdf 的結果；沒有下載 sdf 時 Path 是空字串
+type merged struct {
+	Path       string `json:"path,omitempty"`
+	Records    int    `json:"records"`
+	Written    int    `json:"written"`
+	Duplicates int    `json:"duplicates"`
+	Rejected   int    `json:"rejected"`
 }
 
-// runProject1Go 用來執行 project1.go 將 ID 轉換為 sdf 檔案
-func runProject1Go() {
-	// 每次運行 project1.go 前，清空 set_1 資料夾
-	clearOutputDir("set_1")
+// embedded 是產生三維構形的結果；沒有合併出 sdf 時 Path 是空字串
+type embedded struct {
+	Path     string `json:"path,omitempty"`   // 三維的 sd 檔
+	Merged   string `json:"merged,omitempty"` // 作為輸入的二維 sd 檔
+	Embedded int    `json:"embedded"`
+	Failed   int    `json:"failed"`
+}
+
+// prepared 是準備對接檔案的結果；沒有合併出 sdf 時 Dir 是空字串
+type prepared struct {
+	Dir      string `json:"dir,omitempty"`
+	Prepared int    `json:"prepared"`
+	Flat     int    `json:"flat"`
+}
+
+// runner 保存管線的設定；同一時間只執行一次管線
+type runner struct {
+	source      download.Source
+	catalogPath string
+	cache       *download.Cache // nil 時不使用共用的下載快取
+	rules       *filter.Rules   // nil 時不篩選
+	embed       bool            // 是否產生三維構形；準備對接檔案時一定為 true
+	formats     []prep.Format   // 空白時不準備對接檔案
+	mu          sync.Mutex
+}
 
-	cmd := exec.Command("go", "run", "step2/project1.go")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+// stages 回傳管線的步驟；withSample 為 false 時從現有的 zinc_ids.txt 開始下載
+func (r *runner) stages(withSample bool) []pipeline.Stage {
+	stages := []pipeline.Stage{pipeline.NewStage("download", r.download)}
+	if r.rules != nil {
+		stages = append(stages, pipeline.NewStage("filter", r.filter))
+	}
+	stages = append(stages, pipeline.NewStage("merge", r.merge))
+	if r.embed {
+		stages = append(stages, pipeline.NewStage("embed", r.embed3D))
+	}
+	if len(r.formats) > 0 {
+		stages = append(stages, pipeline.NewStage("prepare", r.prepare))
+	}
+	if withSample {
+		stages = append([]pipeline.Stage{pipeline.NewStage("sample", r.sample)}, stages...)
+	}
+	return stages
+}
+
+// run 等待前一次執行結束後執行管線，每個步驟的狀態寫入記錄；notify 不為 nil 時也會收到每個事件
+func (r *runner) run(ctx context.Context, input any, notify func(pipeline.Event)) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runLocked(ctx, input, notify)
+}
+
+// start 在沒有其他執行時於背景執行管線，結束時以管線的錯誤呼叫 done；
+// 已經有執行在進行時回傳 false。檢查與取得鎖是同一個動作，兩個同時的請求只有一個會開始。
+func (r *runner) start(ctx context.Context, input any, notify func(pipeline.Event), done func(error)) bool {
+	if !r.mu.TryLock() {
+		return false
+	}
+	go func() {
+		defer r.mu.Unlock()
+		_, err := r.runLocked(ctx, input, notify)
+		done(err)
+	}()
+	return true
+}
+
+// runLocked 執行管線；呼叫端必須持有 r.mu
+func (r *runner) runLocked(ctx context.Context, input any, notify func(pipeline.Event)) (any, error) {
+	_, withSample := input.(sampleRequest)
+	p, err := pipeline.New(checkpointPath, r.stages(withSample)...)
 	if err != nil {
-		log.Fatalf("執行 project1.go 失敗: %v", err)
+		return nil, err
+	}
+	p.Notify = func(e pipeline.Event) {
+		switch e.Kind {
+		case pipeline.Failed:
+			log.Printf("步驟 %s 失敗: %v", e.Stage, e.Err)
+		case pipeline.Resumed:
+			log.Printf("步驟 %s 已於先前完成，沿用檢查點的結果", e.Stage)
+		default:
+			log.Printf("步驟 %s %s", e.Stage, e.Kind)
+		}
+		if notify != nil {
+			notify(e)
+		}
 	}
-	fmt.Println("project1.go 運行完成！")
+	return p.Run(ctx, input)
 }
 
-// clearOutputDir 清空 set_1 資料夾
-func clearOutputDir(outputDir string) {
-	files, err := os.ReadDir(outputDir)
+// sample 依條件從 tranche 挑選 ID，以改名的方式寫出 zinc_ids.txt 與 manifest
+func (r *runner) sample(ctx context.Context, req sampleRequest) (idList, error) {
+	s := &sample.Sampler{TrancheDir: zincIDsDir, Logf: log.Printf}
+	if cat, err := catalog.Open(r.catalogPath); err != nil {
+		log.Printf("無法開啟資料庫 %s，改為讀取 %s: %v", r.catalogPath, zincIDsDir, err)
+	} else {
+		defer cat.Close()
+		s.Catalog = cat
+	}
+	m, err := s.Run(req.Seed, req.Conditions)
 	if err != nil {
-		fmt.Printf("無法讀取資料夾 %s: %v\n", outputDir, err)
-		return
+		return idList{}, err
+	}
+	if err := pipeline.WriteAtomic(resultFileName, m.WriteIDs); err != nil {
+		return idList{}, err
+	}
+	if err := sample.WriteManifest(sample.ManifestPath(resultFileName), m); err != nil {
+		return idList{}, err
+	}
+	return idList{Path: resultFileName, IDs: m.IDs()}, nil
+}
+
+// download 下載清單中的分子；已完成的分子會略過，結果寫入資料庫
+func (r *runner) download(ctx context.Context, list idList) (downloaded, error) {
+	log.Printf("從 ZINC%s (%s) 下載 %d 個分子的 %s", r.source.Version, r.source.Host(), len(list.IDs), strings.Join(r.source.Formats, ", "))
+	reports, err := r.source.Run(ctx, list.IDs, download.Options{Cache: r.cache, Logf: log.Printf})
+	if r.catalogPath != "" && reports != nil {
+		if cerr := r.recordDownloads(reports); cerr != nil {
+			log.Printf("無法把下載結果寫入 %s: %v", r.catalogPath, cerr)
+		}
 	}
+	if err != nil {
+		return downloaded{}, err
+	}
+	out := downloaded{Dirs: map[string]string{}, Reports: reports, Files: []string{}}
+	if report, ok := reports["sdf"]; ok {
+		out.Files = report.Files
+	}
+	failed := 0
+	for format, report := range reports {
+		out.Dirs[format] = r.source.Dir(format)
+		for _, f := range report.Failed {
+			log.Printf("無法下載 %s.%s: %s", f.ZincID, format, f.Error)
+		}
+		failed += len(report.Failed)
+		log.Printf("%s: 下載 %d 個，取自快取 %d 個，已存在 %d 個，失敗 %d 個 (%s)",
+			format, report.Downloaded, report.Cached, report.Skipped, len(report.Failed), out.Dirs[format])
+	}
+	// 有分子下載失敗時不記錄檢查點，再次執行時只重新下載失敗的分子
+	if failed > 0 {
+		return downloaded{}, fmt.Errorf("%d downloads failed; run again to retry them", failed)
+	}
+	return out, nil
+}
 
-	for _, file := range files {
-		filePath := filepath.Join(outputDir, file.Name())
-		err := os.RemoveAll(filePath)
+// recordDownloads 把各格式狀態檔中的結果寫入資料庫
+func (r *runner) recordDownloads(reports map[string]*download.Report) error {
+	cat, err := catalog.Open(r.catalogPath)
+	if err != nil {
+		return err
+	}
+	defer cat.Close()
+	for format := range reports {
+		dir := r.source.Dir(format)
+		st, err := download.LoadState(download.StatePath(dir))
 		if err != nil {
-			fmt.Printf("無法刪除檔案 %s: %v\n", filePath, err)
-		} else {
-			fmt.Printf("已刪除 %s\n", filePath)
+			return err
+		}
+		if err := cat.RecordDownloads(format, dir, st); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// filter 依規則篩選下載的 sdf，通過的寫到 <目錄>_filtered，每個分子的結果寫到 <目錄>_filter_report.json；
+// 之後的合併只使用通過的分子。規則檔改變時要以 -restart 重新執行，檢查點只比對下載的結果。
+func (r *runner) filter(ctx context.Context, in downloaded) (downloaded, error) {
+	dir, ok := in.Dirs["sdf"]
+	if !ok {
+		return in, nil
+	}
+	files, err := in.sdfFiles()
+	if err != nil {
+		return downloaded{}, err
+	}
+	report, err := r.rules.Run(files, dir+"_filtered")
+	if err != nil {
+		return downloaded{}, err
+	}
+	if err := pipeline.WriteAtomic(dir+"_filter_report.json", report.WriteJSON); err != nil {
+		return downloaded{}, err
+	}
+	for _, res := range report.Molecules {
+		for _, v := range res.Violations {
+			log.Printf("%s 未通過 %s: %s", res.ZincID, v.RuleSet, v.Detail)
+		}
+	}
+	log.Printf("%d / %d 個分子通過篩選 (%s)", report.Passed, report.Checked, report.Output)
+
+	out := downloaded{Dirs: map[string]string{}, Reports: in.Reports}
+	for format, d := range in.Dirs {
+		out.Dirs[format] = d
+	}
+	out.Dirs["sdf"] = report.Output
+	// 篩選的輸出目錄每次都重新建立，其中只有這份清單通過的檔案
+	if out.Files, err = merge.ListSDFFiles(report.Output); err != nil {
+		return downloaded{}, err
+	}
+	return out, nil
+}
+
+// merge 把這份清單的 sdf 合併成 <目錄>.sdf，並寫出 <目錄>_report.json
+func (r *runner) merge(ctx context.Context, in downloaded) (merged, error) {
+	dir, ok := in.Dirs["sdf"]
+	if !ok {
+		return merged{}, nil
+	}
+	files, err := in.sdfFiles()
+	if err != nil {
+		return merged{}, err
+	}
+	out := merged{Path: dir + ".sdf"}
+	var report *merge.Report
+	err = pipeline.WriteAtomic(out.Path, func(w io.Writer) error {
+		var err error
+		report, err = merge.Files(files, w)
+		return err
+	})
+	if err != nil {
+		return merged{}, err
+	}
+	err = pipeline.WriteAtomic(dir+"_report.json", report.WriteJSON)
+	if err != nil {
+		return merged{}, err
+	}
+	for _, rej := range report.Rejected {
+		log.Printf("略過 %s: %s", rej.File, rej.Reason)
+	}
+	out.Records, out.Written = report.Records, report.Written
+	out.Duplicates, out.Rejected = len(report.Duplicates), len(report.Rejected)
+	log.Printf("已合併 %d / %d 筆到 %s（重複 %d 筆，略過 %d 個檔案）",
+		out.Written, out.Records, out.Path, out.Duplicates, out.Rejected)
+	return out, nil
+}
+
+// embed3D 為合併後的 sd 檔產生含氫原子的三維構形，寫成 <目錄>_3d.sdf
+func (r *runner) embed3D(ctx context.Context, in merged) (embedded, error) {
+	if in.Path == "" {
+		return embedded{}, nil
+	}
+	out := embedded{Path: strings.TrimSuffix(in.Path, ".sdf") + "_3d.sdf", Merged: in.Path}
+	report, err := embed.Run(ctx, []string{in.Path}, out.Path, embed.Options{})
+	if err != nil {
+		return embedded{}, err
+	}
+	for _, rej := range report.Failed {
+		log.Printf("無法產生 %s 第 %d 筆的三維構形: %s", rej.File, rej.Record, rej.Reason)
+	}
+	out.Embedded, out.Failed = report.Embedded, len(report.Failed)
+	log.Printf("已產生 %d 個三維構形到 %s", out.Embedded, out.Path)
+	return out, nil
 }
 
-// watchZincIdsFile 用來監控 zinc_ids.txt 檔案的變動
-func watchZincIdsFile(fileName string) {
-	watcher, err := fsnotify.NewWatcher()
+// prepare 把三維構形寫成對接使用的格式，每個分子每種格式一個檔案，放在 <目錄>_docking；
+// 與篩選一樣，改變 -prepare 之後要以 -restart 重新執行
+func (r *runner) prepare(ctx context.Context, in embedded) (prepared, error) {
+	if in.Path == "" {
+		return prepared{}, nil
+	}
+	out := prepared{Dir: strings.TrimSuffix(in.Merged, ".sdf") + "_docking"}
+	report, err := prep.Run([]string{in.Path}, out.Dir, r.formats)
 	if err != nil {
-		log.Fatalf("無法建立文件監視器: %v", err)
+		return prepared{}, err
+	}
+	for _, rej := range report.Rejected {
+		log.Printf("無法準備 %s 的第 %d 筆: %s", rej.File, rej.Record, rej.Reason)
+	}
+	out.Prepared, out.Flat = report.Prepared, len(report.Flat)
+	log.Printf("已準備 %d 個配體到 %s", out.Prepared, out.Dir)
+	if out.Flat > 0 {
+		log.Printf("注意：%d 個配體只有二維座標，對接前需要先產生三維構形", out.Flat)
 	}
-	defer watcher.Close()
+	return out, nil
+}
 
-	// 開始監控 zinc_ids.txt 所在的目錄
-	dirPath := "./"
-	err = watcher.Add(dirPath)
+// resume 在 zinc_ids.txt 存在時從它開始執行管線：上次失敗的步驟會重新執行，已完成的步驟沿用檢查點
+func (r *runner) resume(ctx context.Context) {
+	ids, err := readIDList(resultFileName)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Printf("無法讀取 %s: %v", resultFileName, err)
+		return
+	}
+	if _, err := r.run(ctx, idList{Path: resultFileName, IDs: ids}, nil); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("管線執行失敗: %v", err)
+	}
+}
+
+// readIDList 讀取每行一個 ZINC ID 的清單，略過其他的行
+func readIDList(path string) ([]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("無法監控目錄: %v", err)
+		return nil, err
 	}
+	defer file.Close()
 
-	fmt.Printf("正在監控 %s 目錄中的 %s 檔案...\n", dirPath, fileName)
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "ZINC") {
+			ids = append(ids, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no valid ZINC IDs found in %s", path)
+	}
+	return ids, nil
+}
 
-	// 避免重複執行，可以設置檔案變動的冷卻時間
-	var lastWriteTime time.Time
+// serveForm 提供 HTML 表單
+func serveForm(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("index.html"))
+	tmpl.Execute(w, nil)
+}
 
-	// 無窮迴圈監視文件變動
-	for {
+// export 把下載的 sdf 匯出成 CSV、JSON Lines 或 .smi（查詢參數 format 與 columns），
+// tranche 與 condition 欄位取自這次挑選的 manifest
+func (r *runner) export(w http.ResponseWriter, req *http.Request) {
+	dir := r.source.Dir("sdf")
+	ids, err := readIDList(resultFileName)
+	if err != nil {
+		http.Error(w, "No ligands have been selected yet", http.StatusNotFound)
+		return
+	}
+	// 只匯出這次挑選的分子，下載目錄中先前清單留下的檔案不算
+	files, err := download.ListFiles(dir, ids)
+	if err != nil {
+		http.Error(w, "No downloaded ligands yet", http.StatusNotFound)
+		return
+	}
+	lib := &export.Library{Files: files}
+	if m, err := sample.ReadManifest(sample.ManifestPath(resultFileName)); err == nil {
+		lib.Manifest = m
+	}
+	if cat, err := catalog.Open(r.catalogPath); err == nil {
+		defer cat.Close()
+		lib.Catalog = cat
+	}
+	export.Serve(w, req, lib, filepath.Base(dir))
+}
+
+// gallery 以格狀顯示這次挑選的分子與 ZINC ID，還沒下載完成的分子顯示為空格
+func (r *runner) gallery(w http.ResponseWriter, req *http.Request) {
+	ids, err := readIDList(resultFileName)
+	if err != nil {
+		http.Error(w, "No ligands have been selected yet", http.StatusNotFound)
+		return
+	}
+	captions := make(map[string]string)
+	if m, err := sample.ReadManifest(sample.ManifestPath(resultFileName)); err == nil {
+		for _, p := range m.Picks {
+			for _, id := range p.Selected {
+				captions[id] = p.Condition.String()
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	depict.WriteGallery(w, "Selected ligands", depict.LoadItems(r.source.Dir("sdf"), ids, captions), depict.Options{})
+}
+
+// processRequest 解析表單條件並在背景執行整個管線；挑選完成後就回應完成頁面，下載與合併繼續在背景進行
+func (r *runner) processRequest(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		logPValues := req.Form["logP[]"]
+		molecularWeights := req.Form["molecularWeight[]"]
+		quantities := req.Form["quantity[]"]
+		if len(logPValues) == 0 || len(logPValues) > 5 || len(molecularWeights) != len(logPValues) || len(quantities) != len(logPValues) {
+			http.Error(w, "Conditions must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+		in := sampleRequest{Seed: sample.NewSeed()}
+		for i := range logPValues {
+			quantity, err := strconv.Atoi(quantities[i])
+			if err != nil || quantity < 1 {
+				http.Error(w, "Quantity must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			in.Conditions = append(in.Conditions, sample.Condition{
+				MolecularWeight: molecularWeights[i],
+				LogP:            logPValues[i],
+				Quantity:        quantity,
+			})
+		}
+		// 挑選步驟結束、沿用檢查點，或管線在那之前結束時回應；只有第一個結果會被送出
+		sampled := make(chan error, 1)
+		signal := func(err error) {
+			select {
+			case sampled <- err:
+			default:
+			}
+		}
+		started := r.start(ctx, in, func(e pipeline.Event) {
+			if e.Stage == "sample" && (e.Kind == pipeline.Finished || e.Kind == pipeline.Failed || e.Kind == pipeline.Resumed) {
+				signal(e.Err)
+			}
+		}, func(err error) {
+			if err != nil {
+				log.Printf("管線執行失敗: %v", err)
+			}
+			signal(err)
+		})
+		if !started {
+			http.Error(w, "The previous selection is still being downloaded", http.StatusConflict)
+			return
+		}
 		select {
-		case event := <-watcher.Events:
-			// 顯示事件操作
-			fmt.Printf("檢測到事件: %v\n", event)
-
-			// 只處理與檔案相關的事件
-			if event.Name == fileName { // 改為只比對檔案名稱
-				// 檔案被刪除
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					fmt.Printf("檔案已刪除: %s\n", event.Name)
-					// 等待檔案被重新創建
-					fmt.Println("等待檔案重建...")
-					continue // 這會讓程式進入等待狀態，繼續監控檔案創建
-				}
-
-				// 檔案被創建
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					fmt.Printf("檔案已創建: %s\n", event.Name)
-
-					// 等待檔案創建完成後，稍微延遲，確保檔案已經有內容
-					time.Sleep(2 * time.Second)
-
-					// 確保檔案已經有內容，再執行 project1.go
-					if _, err := os.Stat(fileName); err == nil {
-						// 檢查檔案大小來確認是否有內容
-						fileInfo, err := os.Stat(fileName)
-						if err == nil && fileInfo.Size() > 0 {
-							fmt.Println("檔案有內容，開始執行 project1.go")
-						} else {
-							fmt.Println("檔案沒有內容，等待檔案填充...")
-						}
-					}
-				}
-
-				// 檔案被修改
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					// 如果文件在冷卻期內，跳過此次事件
-					if time.Since(lastWriteTime) < 2*time.Second {
-						// 不處理過於頻繁的寫入事件
-						fmt.Println("檔案寫入過於頻繁，等待下次處理...")
-						continue
-					}
-					// 更新最後的寫入時間
-					lastWriteTime = time.Now()
-
-					// 可以選擇在檔案變動時處理
-					fmt.Printf("檔案已修改: %s\n", event.Name)
-					runProject1Go()
-				}
+		case err := <-sampled:
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
-		case err := <-watcher.Errors:
-			log.Printf("監控錯誤: %v", err)
+		case <-req.Context().Done():
+			return // 瀏覽器離開了；管線繼續在背景執行
 		}
+
+		tmpl := template.Must(template.ParseFiles("completion.html"))
+		tmpl.Execute(w, struct{ FilePath string }{FilePath: "/" + resultFileName})
 	}
 }
 
+// loadSource 讀取設定檔（-config，或目前目錄中的 zinc_source.json），沒有設定檔時使用預設值
+func loadSource(configPath string) (download.Source, error) {
+	explicit := configPath != ""
+	if !explicit {
+		configPath = "zinc_source.json"
+	}
+	src, err := download.LoadSource(configPath)
+	if err == nil {
+		return src, src.Check()
+	} else if explicit || !os.IsNotExist(err) {
+		return src, err
+	}
+	return download.DefaultSource(), nil
+}
+
+// loadFilters 讀取篩選規則（-filters，或目前目錄中的 filters.json）；沒有規則檔時回傳 nil，管線不篩選
+func loadFilters(path string) (*filter.Rules, error) {
+	switch path {
+	case "builtin":
+		return filter.Load("")
+	case "":
+		if _, err := os.Stat("filters.json"); err != nil {
+			return nil, nil
+		}
+		path = "filters.json"
+	}
+	return filter.Load(path)
+}
+
 func main() {
-	// 先運行 project.go 抓取資料，並讓它在背景執行
-	runProjectGo()
+	addr := flag.String("addr", ":8080", "address to listen on")
+	watch := flag.Bool("watch", false, "do not serve the form; run the download and merge stages whenever zinc_ids.txt is completely written (renamed into place or followed by zinc_ids.txt.done)")
+	restart := flag.Bool("restart", false, "discard the checkpoints and run every stage again")
+	configPath := flag.String("config", "", "JSON source configuration (default: zinc_source.json if present)")
+	catalogPath := flag.String("catalog", catalog.Path(catalog.DefaultPath), "catalog database shared with the other projects")
+	cachePath := flag.String("cache", download.CachePath(download.DefaultCachePath), "download cache shared with the other projects (empty to skip)")
+	embed3D := flag.Bool("embed", false, "generate 3D coordinates with hydrogens for the merged SD file (always on with -prepare)")
+	prepareFormats := flag.String("prepare", "", "comma-separated docking formats (pdbqt, mol2, pdb) written from the 3D SD file; empty skips the stage")
+	filtersPath := flag.String("filters", "", "JSON filter rules applied before merging, or \"builtin\" for Lipinski, Veber and structural alerts (default: filters.json if present, otherwise no filtering)")
+	flag.Parse()
 
-	// 監控 zinc_ids.txt 檔案
-	fileName := "zinc_ids.txt"
-	// 開始監控檔案變動
-	watchZincIdsFile(fileName)
+	src, err := loadSource(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *restart {
+		if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+	}
+	rules, err := loadFilters(*filtersPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := &runner{source: src, catalogPath: *catalogPath, rules: rules, embed: *embed3D}
+	if *cachePath != "" {
+		if r.cache, err = download.OpenCache(*cachePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *prepareFormats != "" {
+		if r.formats, err = prep.ParseFormats(*prepareFormats); err != nil {
+			log.Fatal(err)
+		}
+		r.embed = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// 上次的管線若在下載或合併時失敗，從失敗的步驟繼續
+	if *watch {
+		r.resume(ctx)
+		fmt.Printf("正在監控 %s，檔案完整寫入後開始下載...\n", resultFileName)
+		err := pipeline.Watch(ctx, resultFileName, func() { r.resume(ctx) })
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatalf("無法監控 %s: %v", resultFileName, err)
+		}
+		return
+	}
+
+	// 把 step1/zinc_ids 中的 tranche 檔匯入資料庫
+	if cat, err := catalog.Open(r.catalogPath); err != nil {
+		log.Printf("無法開啟資料庫 %s: %v", r.catalogPath, err)
+	} else {
+		if _, err := cat.ImportDir(zincIDsDir); err != nil {
+			log.Printf("無法匯入 %s: %v", zincIDsDir, err)
+		}
+		cat.Close()
+	}
+	go r.resume(ctx)
+
+	http.HandleFunc("/", serveForm)
+	http.HandleFunc("/process", r.processRequest(ctx))
+	http.HandleFunc("/"+resultFileName, func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, resultFileName)
+	})
+	http.HandleFunc("/export", r.export)
+	http.HandleFunc("/gallery", r.gallery)
+	server := &http.Server{Addr: *addr}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Printf("Server started at http://localhost%s\n", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
 }
@@ -12,18 +12,34 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"zinc/catalog"
+	"zinc/pipeline"
 )
 
 // 設定Zinc ID檔案目錄
 const zincIDsDir = `step1/zinc_ids`
 const resultFileName = "zinc_ids.txt" // 結果檔案名稱
 
+// 各專案共用的 ZINC ID 資料庫，可以用環境變數 ZINC_CATALOG 指定位置
+var catalogPath = catalog.Path(catalog.DefaultPath)
+
 func main() {
 	// 刪除舊的 zinc_ids.txt 檔案（如果存在）
 	if err := os.Remove(resultFileName); err != nil && !os.IsNotExist(err) {
 		log.Fatalf("Failed to remove old result file: %v", err)
 	}
 
+	// 把 step1/zinc_ids 中的 tranche 檔匯入資料庫
+	if cat, err := catalog.Open(catalogPath); err != nil {
+		log.Printf("Failed to open %s: %v", catalogPath, err)
+	} else {
+		if _, err := cat.ImportDir(zincIDsDir); err != nil {
+			log.Printf("Failed to import %s: %v", zincIDsDir, err)
+		}
+		cat.Close()
+	}
+
 	// 設定路由
 	http.HandleFunc("/", serveForm)
 	http.HandleFunc("/process", processRequest)
@@ -63,13 +79,9 @@ func processRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 準備輸出結果檔案
-	output, err := os.Create(resultFileName)
-	if err != nil {
-		http.Error(w, "Failed to create result file", http.StatusInternalServerError)
-		return
-	}
-	defer output.Close()
+	// 先在記憶體中組出結果，最後一次以改名的方式寫出，
+	// 監看 zinc_ids.txt 的 main.go -watch 不會讀到寫到一半的檔案
+	var output strings.Builder
 
 	// 處理每組條件
 	for i := range logPValues {
@@ -79,23 +91,13 @@ func processRequest(w http.ResponseWriter, r *http.Request) {
 
 		// 構造文件名稱
 		fileName := fmt.Sprintf("zinc_ids_%s%s.txt", molecularWeight, logP)
-		filePath := filepath.Join(zincIDsDir, fileName)
-
-		// 打開對應檔案
-		file, err := os.Open(filePath)
 
+		// 讀取Zinc ID：優先從資料庫讀取，資料庫中沒有這個 tranche 時讀取檔案
+		zincIDs, err := readTranche(molecularWeight+logP, fileName)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to open file: %s", fileName), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
-
-		// 讀取Zinc ID
-		var zincIDs []string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			zincIDs = append(zincIDs, scanner.Text())
-		}
 
 		if len(zincIDs) < quantity {
 			http.Error(w, fmt.Sprintf("Not enough Zinc IDs in file: %s", fileName), http.StatusInternalServerError)
@@ -110,6 +112,11 @@ func processRequest(w http.ResponseWriter, r *http.Request) {
 		output.WriteString(strings.Join(selected, "\n") + "\n")
 	}
 
+	if err := pipeline.WriteFile(resultFileName, []byte(output.String())); err != nil {
+		http.Error(w, "Failed to create result file", http.StatusInternalServerError)
+		return
+	}
+
 	// 使用模板渲染結果頁面
 	tmpl := template.Must(template.ParseFiles("completion.html"))
 	data := struct {
@@ -119,3 +126,27 @@ func processRequest(w http.ResponseWriter, r *http.Request) {
 	}
 	tmpl.Execute(w, data)
 }
+
+// readTranche 讀取 tranche 的 Zinc ID，資料庫無法開啟或沒有這個 tranche 時讀取 step1/zinc_ids 中的檔案
+func readTranche(name, fileName string) ([]string, error) {
+	if cat, err := catalog.Open(catalogPath); err == nil {
+		ids, err := cat.TrancheIDs(name)
+		cat.Close()
+		if err == nil && len(ids) > 0 {
+			return ids, nil
+		}
+	}
+
+	file, err := os.Open(filepath.Join(zincIDsDir, fileName))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var zincIDs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		zincIDs = append(zincIDs, scanner.Text())
+	}
+	return zincIDs, scanner.Err()
+}
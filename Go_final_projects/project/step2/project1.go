@@ -2,50 +2,18 @@ package main
 
 import (
 	"bufio"
-	//"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
-	"sync"
-)
-
-func downloadMolecule(zincID, zincVersion, zincFileType, outputDir string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	url := fmt.Sprintf("https://zinc%s.docking.org/substances/%s.%s", zincVersion, zincID, zincFileType)
-	filePath := filepath.Join(outputDir, fmt.Sprintf("%s.%s", zincID, zincFileType))
-
-	// Check if the file already exists
-	if _, err := os.Stat(filePath); err == nil {
-		fmt.Printf("Skipping %s.%s (already downloaded)\n", zincID, zincFileType)
-		return
-	}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		fmt.Printf("Error downloading %s.%s: %v\n", zincID, zincFileType, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		file, err := os.Create(filePath)
-		if err != nil {
-			fmt.Printf("Error creating file %s: %v\n", filePath, err)
-			return
-		}
-		defer file.Close()
-
-		_, err = io.Copy(file, resp.Body)
-		if err != nil {
-			fmt.Printf("Error writing to file %s: %v\n", filePath, err)
-		}
-	} else {
-		fmt.Printf("Failed to download %s.%s\n", zincID, zincFileType)
-	}
-}
+	"zinc/catalog"
+	"zinc/download"
+	"zinc/merge"
+)
 
 func listOpener(inputIDList string) ([]string, error) {
 	file, err := os.Open(inputIDList)
@@ -69,13 +37,10 @@ func listOpener(inputIDList string) ([]string, error) {
 	return validZincIDs, nil
 }
 
-func downloadLigands(inputIDList, outputDir string) {
-	var zincVersion string
-	fmt.Println("Zinc version: (choose between 15 & 20)")
-	fmt.Scanln(&zincVersion)
-
-	zincFileType := "sdf"
-
+// downloadLigands 依 src 下載清單中的分子，每種格式放在各自的目錄；進度記錄在 <目錄>.download.json，
+// 中斷（Ctrl-C）後再次執行會略過已完成的分子。每個分子的下載結果也寫入 catalogPath 的資料庫。
+// 回傳每種格式的報告，其中的 Files 是這份清單的檔案。
+func downloadLigands(inputIDList string, src download.Source, opt download.Options, catalogPath string) map[string]*download.Report {
 	zincIDList, err := listOpener(inputIDList)
 	if err != nil {
 		fmt.Println(err)
@@ -83,64 +48,142 @@ func downloadLigands(inputIDList, outputDir string) {
 	}
 
 	fmt.Printf("Your chosen list contains %d molecules.\n", len(zincIDList))
+	fmt.Printf("Downloading %s from ZINC%s (%s).\n", strings.Join(src.Formats, ", "), src.Version, src.Host())
 
-	var wg sync.WaitGroup
-	for _, zincID := range zincIDList {
-		wg.Add(1)
-		go downloadMolecule(zincID, zincVersion, zincFileType, outputDir, &wg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opt.Logf = func(format string, args ...any) { fmt.Printf(format+"\n", args...) }
+	reports, err := src.Run(ctx, zincIDList, opt)
+	if catalogPath != "" {
+		if cerr := recordDownloads(catalogPath, src, reports); cerr != nil {
+			fmt.Printf("Error recording downloads in %s: %v\n", catalogPath, cerr)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Download interrupted; progress saved, run again to resume.")
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Printf("Error downloading ligands: %v\n", err)
+		os.Exit(1)
 	}
-	wg.Wait()
 
-	fmt.Println("Download job finished.")
+	for _, format := range src.Formats {
+		report := reports[format]
+		for _, path := range report.Removed {
+			fmt.Printf("Removed %s (not in the current list)\n", path)
+		}
+		for _, f := range report.Failed {
+			fmt.Printf("Failed to download %s.%s: %s\n", f.ZincID, format, f.Error)
+		}
+		fmt.Printf("Download job finished for %s: %d downloaded, %d from the cache, %d already present, %d failed (%s).\n",
+			format, report.Downloaded, report.Cached, report.Skipped, len(report.Failed), src.Dir(format))
+	}
+	return reports
 }
 
-/*
-	func mergeSDFFiles(inputFolder, outputFileName string) {
-		files, err := os.ReadDir(inputFolder)
+// recordDownloads 把各格式狀態檔中的結果（檔案、大小、SHA-256 或錯誤）寫入資料庫
+func recordDownloads(catalogPath string, src download.Source, reports map[string]*download.Report) error {
+	cat, err := catalog.Open(catalogPath)
+	if err != nil {
+		return err
+	}
+	defer cat.Close()
+	for format := range reports {
+		dir := src.Dir(format)
+		st, err := download.LoadState(download.StatePath(dir))
 		if err != nil {
-			fmt.Printf("The folder %s does not exist.\n", inputFolder)
-			return
+			return err
 		}
-
-		var sdfFiles []string
-		for _, file := range files {
-			if strings.HasSuffix(file.Name(), ".sdf") {
-				sdfFiles = append(sdfFiles, file.Name())
-			}
+		if err := cat.RecordDownloads(format, dir, st); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if len(sdfFiles) == 0 {
-			fmt.Println("No SDF files found in the specified folder.")
-			return
-		}
+// mergeSDFFiles 合併這份清單下載的檔案；目錄中先前清單留下的檔案不會合併
+func mergeSDFFiles(files []string, outputFileName string) {
+	outputFile, err := os.Create(outputFileName)
+	if err != nil {
+		fmt.Printf("Error creating output file %s: %v\n", outputFileName, err)
+		return
+	}
+	defer outputFile.Close()
 
-		outputFile, err := os.Create(outputFileName)
-		if err != nil {
-			fmt.Printf("Error creating output file %s: %v\n", outputFileName, err)
-			return
+	report, err := merge.Files(files, outputFile)
+	if err != nil {
+		fmt.Printf("Error merging into %s: %v\n", outputFileName, err)
+		return
+	}
+
+	reportFile, err := os.Create(strings.TrimSuffix(outputFileName, ".sdf") + "_report.json")
+	if err == nil {
+		report.WriteJSON(reportFile)
+		reportFile.Close()
+	}
+
+	for _, rej := range report.Rejected {
+		fmt.Printf("Rejected %s: %s\n", rej.File, rej.Reason)
+	}
+	fmt.Printf("%d of %d records have been merged into %s (%d duplicates, %d rejected files)\n",
+		report.Written, report.Records, outputFileName, len(report.Duplicates), len(report.Rejected))
+}
+
+// loadSource 讀取設定檔（-config，或目前目錄中的 zinc_source.json），再以命令列上有指定的旗標覆寫
+func loadSource(configPath, version, formats, outputDir string) (download.Source, error) {
+	src := download.DefaultSource()
+	explicit := configPath != ""
+	if !explicit {
+		configPath = "zinc_source.json"
+	}
+	if loaded, err := download.LoadSource(configPath); err == nil {
+		src = loaded
+	} else if explicit || !os.IsNotExist(err) {
+		return src, err
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "zinc-version":
+			src.Version = version
+		case "formats":
+			src.Formats = strings.Split(formats, ",")
+		case "out":
+			src.OutputDir = outputDir
 		}
-		defer outputFile.Close()
-
-		for _, sdfFile := range sdfFiles {
-			filePath := filepath.Join(inputFolder, sdfFile)
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				fmt.Printf("Error reading file %s: %v\n", sdfFile, err)
-				continue
-			}
-
-			lines := bytes.Split(content, []byte("\n"))
-			if string(lines[len(lines)-1]) == "$$$$" {
-				lines = lines[:len(lines)-1]
-			}
-			outputFile.Write(bytes.Join(lines, []byte("\n")))
-			outputFile.Write([]byte("$$$$\n"))
+	})
+	return src, src.Check()
+}
+
+func main() {
+	var opt download.Options
+	configPath := flag.String("config", "", "JSON source configuration (default: zinc_source.json if present)")
+	version := flag.String("zinc-version", "20", "ZINC version to download from: 15 or 20")
+	formats := flag.String("formats", "sdf", "comma-separated file formats: "+strings.Join(download.Formats, ", "))
+	outputDir := flag.String("out", "set_1", "output directory for sdf files; other formats go to <out>_<format>")
+	flag.IntVar(&opt.Workers, "workers", download.DefaultWorkers, "number of concurrent downloads")
+	flag.DurationVar(&opt.Timeout, "timeout", download.DefaultTimeout, "timeout for a single request")
+	flag.IntVar(&opt.MaxRetries, "retries", download.DefaultMaxRetries, "retries for 429/5xx responses and network errors")
+	flag.BoolVar(&opt.Prune, "prune", false, "delete files downloaded for a previous ID list that are not in this one")
+	catalogPath := flag.String("catalog", catalog.Path(catalog.DefaultPath), "catalog database to record downloads in (empty to skip)")
+	cachePath := flag.String("cache", download.CachePath(download.DefaultCachePath), "download cache shared with the other projects (empty to skip)")
+	flag.Parse()
+
+	src, err := loadSource(*configPath, *version, *formats, *outputDir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *cachePath != "" {
+		if opt.Cache, err = download.OpenCache(*cachePath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+	}
 
-		fmt.Printf("All SDF files have been merged into %s\n", outputFileName)
+	reports := downloadLigands("zinc_ids.txt", src, opt, *catalogPath)
+	if report, ok := reports["sdf"]; ok {
+		mergeSDFFiles(report.Files, src.Dir("sdf")+".sdf")
 	}
-*/
-func main() {
-	downloadLigands("zinc_ids.txt", "set_1")
-	//mergeSDFFiles("set_1", "../../3_Ligand_Preprocess/set_1/set_1.sdf")
 }
@@ -0,0 +1,387 @@
+// Package catalog 是內嵌在單一檔案中的 ZINC ID 資料庫（bbolt，不需要另外的伺服器）。
+// 每個 ID 記錄它的 tranche、第一次與最後一次被抓取到的時間、各格式的下載狀態與檔案
+// 雜湊，以及計算出的描述符。抓取、挑選與下載都透過它讀寫，原本的 zinc_ids_XX.txt
+// 可以用 ImportFile 匯入，也可以用 WriteTranche 重新產生。
+//
+// 資料庫檔案同時只能被一個行程開啟，Open 會等待其他行程關閉；
+// 長時間執行的伺服器應該在每次使用時開啟、用完立刻關閉。
+package catalog
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"zinc/descriptor"
+	"zinc/download"
+	"zinc/scrape"
+	"zinc/tranche"
+)
+
+// DefaultPath 是各專案共用的資料庫位置（相對於專案目錄），可以用環境變數 ZINC_CATALOG 覆寫
+const DefaultPath = "../zinc_catalog.db"
+
+// OpenTimeout 是等待其他行程釋放資料庫的時間上限
+var OpenTimeout = 10 * time.Second
+
+var (
+	ligandsBucket  = []byte("ligands")
+	tranchesBucket = []byte("tranches") // tranche 代碼 → 子 bucket（ZINC ID → 空值）
+)
+
+// Path 回傳資料庫位置：環境變數 ZINC_CATALOG，沒有設定時為 fallback
+func Path(fallback string) string {
+	if p := os.Getenv("ZINC_CATALOG"); p != "" {
+		return p
+	}
+	return fallback
+}
+
+// Download 是一個 ID 某種格式的下載結果
+type Download struct {
+	Status download.Status `json:"status"`
+	File   string          `json:"file,omitempty"` // 下載檔案的路徑
+	Size   int64           `json:"size,omitempty"`
+	SHA256 string          `json:"sha256,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// Ligand 是資料庫中的一筆記錄
+type Ligand struct {
+	ID        string    `json:"id"`
+	Tranche   string    `json:"tranche,omitempty"` // 未知時為空，例如只被下載過的 ID
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Downloads 以格式（sdf、mol2……）為索引
+	Downloads  map[string]Download     `json:"downloads,omitempty"`
+	Properties *descriptor.Descriptors `json:"properties,omitempty"`
+}
+
+// Catalog 是開啟中的資料庫
+type Catalog struct {
+	db *bolt.DB
+}
+
+// Open 開啟（必要時建立）path 的資料庫
+func Open(path string) (*Catalog, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: OpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open catalog %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{ligandsBucket, tranchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Catalog{db: db}, nil
+}
+
+// Close 關閉資料庫
+func (c *Catalog) Close() error { return c.db.Close() }
+
+// Path 回傳資料庫檔案的位置
+func (c *Catalog) Path() string { return c.db.Path() }
+
+func get(b *bolt.Bucket, id string) (*Ligand, error) {
+	data := b.Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	var l Ligand
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", id, err)
+	}
+	return &l, nil
+}
+
+func put(b *bolt.Bucket, l *Ligand) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(l.ID), data)
+}
+
+// Get 取得一筆記錄，不存在時回傳 nil
+func (c *Catalog) Get(id string) (*Ligand, error) {
+	var l *Ligand
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		l, err = get(tx.Bucket(ligandsBucket), id)
+		return err
+	})
+	return l, err
+}
+
+// Observe 記錄在 tranche 中看到了 ids（在 at 時），回傳新加入的 ID 數。
+// 已存在的 ID 會更新第一次與最後一次看到的時間；tranche 改變時移到新的 tranche。
+func (c *Catalog) Observe(name string, ids []string, at time.Time) (int, error) {
+	t, err := tranche.Parse(name)
+	if err != nil {
+		return 0, err
+	}
+	name = t.Name()
+	at = at.UTC()
+	added := 0
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		ligands := tx.Bucket(ligandsBucket)
+		tranches := tx.Bucket(tranchesBucket)
+		members, err := tranches.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id = scrape.FormatZincID(id); id == "" {
+				continue
+			}
+			l, err := get(ligands, id)
+			if err != nil {
+				return err
+			}
+			changed := l == nil
+			if l == nil {
+				l = &Ligand{ID: id, FirstSeen: at, LastSeen: at}
+				added++
+			}
+			if l.FirstSeen.IsZero() || at.Before(l.FirstSeen) {
+				l.FirstSeen, changed = at, true
+			}
+			if at.After(l.LastSeen) {
+				l.LastSeen, changed = at, true
+			}
+			if l.Tranche != name {
+				changed = true
+				if old := tranches.Bucket([]byte(l.Tranche)); l.Tranche != "" && old != nil {
+					if err := old.Delete([]byte(id)); err != nil {
+						return err
+					}
+				}
+				l.Tranche = name
+			}
+			// 重複匯入同一個檔案時不需要寫入
+			if !changed {
+				continue
+			}
+			if err := members.Put([]byte(id), []byte{}); err != nil {
+				return err
+			}
+			if err := put(ligands, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// update 讀取（不存在時建立）一筆記錄，交給 fn 修改後寫回
+func (c *Catalog) update(ids []string, fn func(l *Ligand)) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		ligands := tx.Bucket(ligandsBucket)
+		for _, id := range ids {
+			l, err := get(ligands, id)
+			if err != nil {
+				return err
+			}
+			if l == nil {
+				l = &Ligand{ID: id}
+			}
+			fn(l)
+			if err := put(ligands, l); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetDownload 記錄 id 以 format 格式下載的結果
+func (c *Catalog) SetDownload(id, format string, d Download) error {
+	return c.update([]string{id}, func(l *Ligand) {
+		if l.Downloads == nil {
+			l.Downloads = make(map[string]Download)
+		}
+		l.Downloads[format] = d
+	})
+}
+
+// RecordDownloads 把下載狀態檔中的結果一次寫入資料庫；dir 是該格式的輸出目錄
+func (c *Catalog) RecordDownloads(format, dir string, st *download.State) error {
+	ids := make([]string, 0, len(st.Items))
+	for id := range st.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := time.Now().UTC()
+	return c.update(ids, func(l *Ligand) {
+		it := st.Items[l.ID]
+		d := Download{Status: it.Status, Size: it.Size, SHA256: it.SHA256, Error: it.Error, Time: now}
+		if it.Status == download.Done {
+			d.File = filepath.Join(dir, it.File)
+		}
+		if l.Downloads == nil {
+			l.Downloads = make(map[string]Download)
+		}
+		l.Downloads[format] = d
+	})
+}
+
+// SetProperties 記錄描述符，props 以 ZINC ID 為索引
+func (c *Catalog) SetProperties(props map[string]descriptor.Descriptors) error {
+	ids := make([]string, 0, len(props))
+	for id := range props {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return c.update(ids, func(l *Ligand) {
+		d := props[l.ID]
+		l.Properties = &d
+	})
+}
+
+// TrancheIDs 依數字順序回傳 tranche 中的所有 ID
+func (c *Catalog) TrancheIDs(name string) ([]string, error) {
+	t, err := tranche.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	err = c.db.View(func(tx *bolt.Tx) error {
+		members := tx.Bucket(tranchesBucket).Bucket([]byte(t.Name()))
+		if members == nil {
+			return nil
+		}
+		// bbolt 依鍵值排序，補足 12 位數的 ID 字串順序即數字順序
+		return members.ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// TrancheSHA256 回傳 tranche 的 ID 清單以每行一個 ID 寫成檔案時的 SHA-256，
+// 與 WriteTranche 寫出的檔案雜湊相同
+func TrancheSHA256(ids []string) string {
+	h := sha256.New()
+	for _, id := range ids {
+		io.WriteString(h, id+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteTranche 以 zinc_ids_XX.txt 的格式（每行一個 ID）寫出 tranche 中的所有 ID
+func (c *Catalog) WriteTranche(name string, w io.Writer) (int, error) {
+	ids, err := c.TrancheIDs(name)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	for _, id := range ids {
+		bw.WriteString(id + "\n")
+	}
+	return len(ids), bw.Flush()
+}
+
+// ForEach 依 ID 順序走訪所有記錄
+func (c *Catalog) ForEach(fn func(l *Ligand) error) error {
+	return c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(ligandsBucket).ForEach(func(k, v []byte) error {
+			var l Ligand
+			if err := json.Unmarshal(v, &l); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+			return fn(&l)
+		})
+	})
+}
+
+// Stats 是資料庫內容的摘要
+type Stats struct {
+	Ligands    int            `json:"ligands"`
+	Tranches   map[string]int `json:"tranches"`   // tranche → ID 數
+	Downloaded map[string]int `json:"downloaded"` // 格式 → 已下載的 ID 數
+	Annotated  int            `json:"annotated"`  // 有描述符的 ID 數
+}
+
+// Stats 計算資料庫內容的摘要
+func (c *Catalog) Stats() (*Stats, error) {
+	s := &Stats{Tranches: make(map[string]int), Downloaded: make(map[string]int)}
+	err := c.ForEach(func(l *Ligand) error {
+		s.Ligands++
+		if l.Tranche != "" {
+			s.Tranches[l.Tranche]++
+		}
+		for format, d := range l.Downloads {
+			if d.Status == download.Done {
+				s.Downloaded[format]++
+			}
+		}
+		if l.Properties != nil {
+			s.Annotated++
+		}
+		return nil
+	})
+	return s, err
+}
+
+// ImportFile 匯入一個 zinc_ids_XX.txt，tranche 由檔名決定，看到的時間為檔案的修改時間。
+// 回傳新加入的 ID 數。
+func (c *Catalog) ImportFile(path string) (int, error) {
+	t, err := tranche.FromFileName(path)
+	if err != nil {
+		return 0, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return c.Observe(t.Name(), strings.Fields(string(data)), st.ModTime())
+}
+
+// ImportDir 匯入 dir 中所有的 zinc_ids_XX.txt，回傳新加入的 ID 數
+func (c *Catalog) ImportDir(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "zinc_ids_*.txt"))
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, path := range paths {
+		if _, err := tranche.FromFileName(path); err != nil {
+			continue
+		}
+		n, err := c.ImportFile(path)
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", path, err)
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,142 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zinc/descriptor"
+	"zinc/download"
+)
+
+func open(t *testing.T) (*Catalog, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "zinc.db")
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, path
+}
+
+func TestObserve(t *testing.T) {
+	c, _ := open(t)
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+
+	added, err := c.Observe("ab", []string{"ZINC42", "ZINC000000000007", "not an id"}, t2)
+	if err != nil || added != 2 {
+		t.Fatalf("Observe = %d, %v; want 2 new IDs", added, err)
+	}
+	// 補抓到較早的清單時只更新 FirstSeen
+	added, err = c.Observe("AB", []string{"ZINC000000000042", "ZINC000000000100"}, t1)
+	if err != nil || added != 1 {
+		t.Fatalf("second Observe = %d, %v; want 1 new ID", added, err)
+	}
+
+	ids, err := c.TrancheIDs("AB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ZINC000000000007 ZINC000000000042 ZINC000000000100"
+	if got := strings.Join(ids, " "); got != want {
+		t.Errorf("TrancheIDs = %s, want %s", got, want)
+	}
+	l, err := c.Get("ZINC000000000042")
+	if err != nil || l == nil {
+		t.Fatalf("Get = %v, %v", l, err)
+	}
+	if !l.FirstSeen.Equal(t1) || !l.LastSeen.Equal(t2) || l.Tranche != "AB" {
+		t.Errorf("ZINC000000000042 = %+v, want AB seen from %v to %v", l, t1, t2)
+	}
+
+	// 換到另一個 tranche 時從原本的 tranche 移除
+	if _, err := c.Observe("AC", []string{"ZINC000000000100"}, t2); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := c.TrancheIDs("AB"); len(ids) != 2 {
+		t.Errorf("AB after move = %v, want 2 IDs", ids)
+	}
+	if ids, _ := c.TrancheIDs("AC"); len(ids) != 1 {
+		t.Errorf("AC after move = %v, want 1 ID", ids)
+	}
+	if _, err := c.Observe("ZZ", []string{"ZINC1"}, t1); err == nil {
+		t.Error("Observe accepted an invalid tranche")
+	}
+}
+
+func TestWriteTrancheMatchesSHA256(t *testing.T) {
+	c, _ := open(t)
+	if _, err := c.Observe("AG", []string{"ZINC3", "ZINC1", "ZINC2"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := c.WriteTranche("AG", &buf)
+	if err != nil || n != 3 {
+		t.Fatalf("WriteTranche = %d, %v", n, err)
+	}
+	ids, _ := c.TrancheIDs("AG")
+	sum := sha256.Sum256(buf.Bytes())
+	if got := TrancheSHA256(ids); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("TrancheSHA256 = %s, want the SHA-256 of the written file", got)
+	}
+}
+
+func TestImportAndRecord(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "zinc_ids_AB.txt"), []byte("ZINC000000000001\nZINC000000000002\n\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "zinc_ids_KK.txt"), []byte("ZINC000000000003\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "zinc_ids.txt"), []byte("ZINC000000000009\n"), 0o644)
+
+	c, path := open(t)
+	added, err := c.ImportDir(dir)
+	if err != nil || added != 3 {
+		t.Fatalf("ImportDir = %d, %v; want 3", added, err)
+	}
+	if added, _ := c.ImportDir(dir); added != 0 {
+		t.Errorf("second ImportDir added %d IDs", added)
+	}
+
+	st := &download.State{Items: map[string]*download.Item{
+		"ZINC000000000001": {File: "ZINC000000000001.sdf", Status: download.Done, Size: 10, SHA256: "abc"},
+		"ZINC000000000004": {File: "ZINC000000000004.sdf", Status: download.Failed, Error: "404 Not Found"},
+	}}
+	if err := c.RecordDownloads("sdf", "set_1", st); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetProperties(map[string]descriptor.Descriptors{"ZINC000000000001": {Formula: "C6H6", MolecularWeight: 78.11}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新開啟後資料仍在
+	c.Close()
+	c, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	l, _ := c.Get("ZINC000000000001")
+	if d := l.Downloads["sdf"]; d.Status != download.Done || d.File != filepath.Join("set_1", "ZINC000000000001.sdf") || d.SHA256 != "abc" {
+		t.Errorf("sdf download = %+v", d)
+	}
+	if l.Properties == nil || l.Properties.Formula != "C6H6" {
+		t.Errorf("properties = %+v", l.Properties)
+	}
+	if l, _ := c.Get("ZINC000000000004"); l == nil || l.Tranche != "" || l.Downloads["sdf"].Error == "" {
+		t.Errorf("failed download of an unscraped ID = %+v", l)
+	}
+
+	s, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Ligands != 4 || s.Tranches["AB"] != 2 || s.Tranches["KK"] != 1 || s.Downloaded["sdf"] != 1 || s.Annotated != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+}
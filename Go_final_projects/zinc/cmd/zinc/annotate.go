@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/descriptor"
+	"zinc/merge"
+	"zinc/sdf"
+	"zinc/tranche"
+)
+
+// runAnnotate 計算 set_1 中每個分子的描述符並寫回 SD 檔，
+// 同時檢查分子是否落在它被抓取時所屬的 tranche 內
+func runAnnotate(args []string) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files")
+	tranches := fs.String("tranches", "step1/zinc_ids", "directory with zinc_ids_XX.txt tranche lists")
+	tolerance := fs.Float64("logp-tolerance", 0.5, "allowed difference between computed logP and the tranche bounds")
+	reportPath := fs.String("report", "", "write a CSV report of all molecules to this file")
+	dryRun := fs.Bool("dry-run", false, "compute and report without rewriting the .sdf files")
+	catalogPath := fs.String("catalog", "", "also record the descriptors in this catalog database")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	parseFlags(fs, args)
+
+	membership, err := loadTranches(*tranches)
+	if err != nil {
+		return err
+	}
+	files, err := merge.ListSDFFiles(*in)
+	if err != nil {
+		return err
+	}
+
+	var report *csv.Writer
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		report = csv.NewWriter(rf)
+		defer report.Flush()
+		report.Write([]string{"zinc_id", "file", "formula", "mw", "logp", "hbd", "hba", "rotatable_bonds", "rings", "tpsa", "tranche", "status"})
+	}
+
+	props := make(map[string]descriptor.Descriptors)
+	res := annotateResult{Files: len(files), Flagged: []annotateFlag{}, Skipped: []merge.Rejection{}}
+	for _, path := range files {
+		mols, err := sdf.ReadFile(path)
+		if err != nil {
+			res.Skipped = append(res.Skipped, merge.Rejection{File: path, Reason: err.Error()})
+			if !*asJSON {
+				fmt.Printf("Skipping %s: %v\n", path, err)
+			}
+			continue
+		}
+		for _, m := range mols {
+			d := descriptor.Compute(m)
+			for _, f := range d.Fields() {
+				m.SetField(f.Name, f.Value)
+			}
+
+			id := m.ZincID()
+			if id == "" {
+				id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			props[id] = d
+			status, name := "unknown tranche", ""
+			if t, ok := membership[id]; ok {
+				name = t.Name()
+				status = "ok"
+				mwOK, logPOK := t.Check(d.MolecularWeight, d.LogP, *tolerance)
+				switch {
+				case !mwOK && !logPOK:
+					status = "mw and logp outside tranche"
+				case !mwOK:
+					status = "mw outside tranche"
+				case !logPOK:
+					status = "logp outside tranche"
+				}
+				m.SetField("tranche", name)
+				m.SetField("tranche_check", status)
+				if status != "ok" {
+					res.Flagged = append(res.Flagged, annotateFlag{id, name, status, d.MolecularWeight, d.LogP})
+					if !*asJSON {
+						fmt.Printf("%s: %s (tranche %s, mw %.2f, logP %.2f)\n", id, status, name, d.MolecularWeight, d.LogP)
+					}
+				}
+			}
+			if report != nil {
+				report.Write([]string{id, path, d.Formula,
+					strconv.FormatFloat(d.MolecularWeight, 'f', 2, 64), strconv.FormatFloat(d.LogP, 'f', 2, 64),
+					strconv.Itoa(d.HBondDonors), strconv.Itoa(d.HBondAcceptors), strconv.Itoa(d.RotatableBonds),
+					strconv.Itoa(d.Rings), strconv.FormatFloat(d.TPSA, 'f', 2, 64), name, status})
+			}
+			res.Annotated++
+		}
+		if !*dryRun {
+			if err := rewriteSDF(path, mols); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *catalogPath != "" {
+		cat, err := catalog.Open(*catalogPath)
+		if err != nil {
+			return err
+		}
+		defer cat.Close()
+		if err := cat.SetProperties(props); err != nil {
+			return err
+		}
+		res.Recorded = len(props)
+	}
+	if *asJSON {
+		return printJSON(res)
+	}
+	fmt.Printf("Annotated %d molecules in %d files, %d outside their tranche.\n", res.Annotated, res.Files, len(res.Flagged))
+	if *catalogPath != "" {
+		fmt.Printf("Recorded descriptors for %d ligands in %s.\n", res.Recorded, *catalogPath)
+	}
+	return nil
+}
+
+// annotateResult 是 -json 輸出的內容
+type annotateResult struct {
+	Files     int               `json:"files"`
+	Annotated int               `json:"annotated"`
+	Flagged   []annotateFlag    `json:"flagged"` // 不在所屬 tranche 範圍內的分子
+	Skipped   []merge.Rejection `json:"skipped"` // 無法讀取的檔案
+	Recorded  int               `json:"recorded,omitempty"`
+}
+
+type annotateFlag struct {
+	ZincID          string  `json:"zinc_id"`
+	Tranche         string  `json:"tranche"`
+	Status          string  `json:"status"`
+	MolecularWeight float64 `json:"mw"`
+	LogP            float64 `json:"logp"`
+}
+
+// loadTranches 讀取 zinc_ids_XX.txt，建立 ZINC ID 到 tranche 的對應
+func loadTranches(dir string) (map[string]tranche.Tranche, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "zinc_ids_*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	membership := make(map[string]tranche.Tranche)
+	for _, path := range paths {
+		t, err := tranche.FromFileName(path)
+		if err != nil {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if id := strings.TrimSpace(scanner.Text()); strings.HasPrefix(id, "ZINC") {
+				membership[id] = t
+			}
+		}
+		file.Close()
+	}
+	return membership, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"zinc/download"
+)
+
+// runCache 檢查共用的下載快取，或從快取重建下載目錄
+func runCache(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	dir := fs.String("dir", download.CachePath("zinc_cache"), "download cache directory (default $ZINC_CACHE or zinc_cache)")
+	keep := fs.Bool("keep", false, "verify: only report corrupt entries instead of evicting them")
+	version := fs.String("zinc-version", "20", "materialize: ZINC version of the cached files")
+	format := fs.String("format", "sdf", "materialize: file format of the cached files")
+	copyFiles := fs.Bool("copy", false, "materialize: copy files instead of hardlinking them")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: zinc cache [flags] verify | materialize <id list> <dir>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cache, err := download.OpenCache(*dir)
+	if err != nil {
+		return err
+	}
+	switch fs.Arg(0) {
+	case "verify":
+		report, err := cache.Verify(!*keep)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(report)
+		}
+		for _, c := range report.Corrupt {
+			fmt.Printf("Corrupt %s: %s\n", c.Key, c.Reason)
+		}
+		action := "evicted"
+		if !report.Evicted {
+			action = "kept (-keep)"
+		}
+		fmt.Printf("%d of %d cached files are intact; %d corrupt %s, %d unreferenced files removed.\n",
+			report.OK, report.Checked, len(report.Corrupt), action, report.Orphans)
+	case "materialize":
+		if fs.NArg() != 3 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		ids, err := readIDList(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		report, err := cache.MaterializeAll(ids, *version, *format, fs.Arg(2), !*copyFiles)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(report)
+		}
+		for _, id := range report.Missing {
+			fmt.Printf("Not cached: %s\n", id)
+		}
+		fmt.Printf("%d hardlinked, %d copied, %d missing in %s.\n", report.Linked, report.Copied, len(report.Missing), report.Dir)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
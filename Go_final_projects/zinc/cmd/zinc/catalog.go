@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"zinc/catalog"
+)
+
+// runCatalog 管理 ZINC ID 資料庫：匯入舊的 zinc_ids_XX.txt、顯示摘要與記錄、匯出 tranche 清單
+func runCatalog(args []string) error {
+	fs := flag.NewFlagSet("catalog", flag.ExitOnError)
+	dbPath := fs.String("db", catalog.Path("zinc_catalog.db"), "catalog database (default $ZINC_CATALOG or zinc_catalog.db)")
+	out := fs.String("o", ".", "directory for exported zinc_ids_XX.txt files")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: zinc catalog [flags] import <dir|file>... | stats | show <zinc id>... | export <tranche>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cat, err := catalog.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer cat.Close()
+
+	rest := fs.Args()[1:]
+	switch fs.Arg(0) {
+	case "import":
+		written := []catalogWrite{}
+		for _, path := range rest {
+			st, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			var added int
+			if st.IsDir() {
+				added, err = cat.ImportDir(path)
+			} else {
+				added, err = cat.ImportFile(path)
+			}
+			if err != nil {
+				return err
+			}
+			written = append(written, catalogWrite{Path: path, IDs: added})
+			if !*asJSON {
+				fmt.Printf("Imported %s: %d new ZINC IDs\n", path, added)
+			}
+		}
+		if *asJSON {
+			return printJSON(written)
+		}
+	case "stats":
+		s, err := cat.Stats()
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(s)
+		}
+		fmt.Printf("%d ZINC IDs, %d with descriptors\n", s.Ligands, s.Annotated)
+		for _, format := range sortedKeys(s.Downloaded) {
+			fmt.Printf("downloaded %-5s %d\n", format, s.Downloaded[format])
+		}
+		for _, name := range sortedKeys(s.Tranches) {
+			fmt.Printf("tranche %s %d\n", name, s.Tranches[name])
+		}
+	case "show":
+		// show 本來就輸出 JSON；-json 時把所有記錄放在一個陣列中
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		list := []*catalog.Ligand{}
+		for _, id := range rest {
+			l, err := cat.Get(id)
+			if err != nil {
+				return err
+			}
+			if l == nil {
+				return fmt.Errorf("%s is not in %s", id, *dbPath)
+			}
+			if *asJSON {
+				list = append(list, l)
+				continue
+			}
+			enc.Encode(l)
+		}
+		if *asJSON {
+			return printJSON(list)
+		}
+	case "export":
+		written := []catalogWrite{}
+		for _, name := range rest {
+			path := filepath.Join(*out, fmt.Sprintf("zinc_ids_%s.txt", name))
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			n, err := cat.WriteTranche(name, f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+			written = append(written, catalogWrite{Tranche: name, Path: path, IDs: n})
+			if !*asJSON {
+				fmt.Printf("Wrote %d ZINC IDs to %s\n", n, path)
+			}
+		}
+		if *asJSON {
+			return printJSON(written)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// catalogWrite 是 import 與 export 的 -json 輸出中的一個檔案
+type catalogWrite struct {
+	Tranche string `json:"tranche,omitempty"`
+	Path    string `json:"path"`
+	IDs     int    `json:"ids"` // 匯入的新 ID 數，或匯出的 ID 數
+}
+
+// catalogMu 讓同一個行程中的工作輪流開啟資料庫（serve 可能同時執行多個工作）
+var catalogMu sync.Mutex
+
+// withCatalog 開啟 path 的資料庫交給 fn，用完立刻關閉，讓其他行程也能使用。
+// path 為空，或 create 為 false 且資料庫還不存在時，以 nil 呼叫 fn。
+func withCatalog(path string, create bool, fn func(cat *catalog.Catalog) error) error {
+	if path == "" {
+		return fn(nil)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) && !create {
+		return fn(nil)
+	}
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	cat, err := catalog.Open(path)
+	if err != nil {
+		return err
+	}
+	defer cat.Close()
+	return fn(cat)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zinc/sdf"
+)
+
+// runConvert 在 V2000 與 V3000 之間轉換 SD 檔
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	in := fs.String("in", "-", "input SD file (- for stdin)")
+	out := fs.String("out", "-", "output SD file (- for stdout)")
+	format := fs.String("format", "v3000", "output format: auto, v2000 or v3000")
+	asJSON := fs.Bool("json", false, "print the result as JSON (requires -out)")
+	parseFlags(fs, args)
+	if *asJSON && *out == "-" {
+		return fmt.Errorf("-json needs -out: the converted records go to stdout")
+	}
+
+	f, err := sdf.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var src io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		src = file
+	}
+
+	var dst io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		dst = file
+	}
+
+	n, err := sdf.Convert(dst, src, f)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(map[string]any{"output": *out, "records": n, "format": f.String()})
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d records to %s.\n", n, f)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"zinc/depict"
+	"zinc/sdf"
+)
+
+// runDepict 依 2D 座標把 SD 檔中的分子畫成 SVG，每個分子一個檔案，或合成一頁 HTML 藝廊
+func runDepict(args []string) error {
+	fs := flag.NewFlagSet("depict", flag.ExitOnError)
+	in := fs.String("in", "-", "input SD file (- for stdin)")
+	out := fs.String("out", "depictions", "directory for one <zinc_id>.svg per record")
+	gallery := fs.String("gallery", "", "write a single HTML gallery to this file instead of SVG files")
+	size := fs.Int("size", 300, "width and height of each drawing in pixels")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	parseFlags(fs, args)
+
+	var src io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		src = file
+	}
+	mols, err := sdf.NewReader(src).ReadAll()
+	if err != nil {
+		return err
+	}
+	opt := depict.Options{Width: *size, Height: *size}
+
+	if *gallery != "" {
+		items := make([]depict.Item, len(mols))
+		for i, m := range mols {
+			items[i] = depict.Item{ID: m.ZincID(), Molecule: m}
+		}
+		file, err := os.Create(*gallery)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := depict.WriteGallery(file, filepath.Base(*in), items, opt); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(depictResult{Output: *gallery, Molecules: len(mols), Files: []string{*gallery}})
+		}
+		fmt.Printf("Wrote a gallery of %d molecules to %s.\n", len(mols), *gallery)
+		return nil
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	res := depictResult{Output: *out, Molecules: len(mols), Files: []string{}}
+	for i, m := range mols {
+		name := m.ZincID()
+		if name == "" {
+			name = fmt.Sprintf("record_%d", i+1)
+		}
+		path := filepath.Join(*out, name+".svg")
+		if err := os.WriteFile(path, []byte(depict.SVG(m, opt)), 0o644); err != nil {
+			return err
+		}
+		res.Files = append(res.Files, path)
+	}
+	if *asJSON {
+		return printJSON(res)
+	}
+	fmt.Printf("Wrote %d SVG files to %s.\n", len(mols), *out)
+	return nil
+}
+
+// depictResult 是 -json 輸出的內容
+type depictResult struct {
+	Output    string   `json:"output"`
+	Molecules int      `json:"molecules"`
+	Files     []string `json:"files"`
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/download"
+)
+
+// downloadSummary 是一種格式的下載結果
+type downloadSummary struct {
+	Format string `json:"format"`
+	Dir    string `json:"dir"`
+	*download.Report
+}
+
+// runDownload 下載 ID 清單中的分子（project/step2 的流程），中斷後再次執行會從中斷處繼續
+func runDownload(args []string) error {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	in := fs.String("in", "zinc_ids.txt", "ID list, one ZINC ID per line")
+	out := fs.String("out", "set_1", "output directory for sdf files; other formats go to <out>_<format>")
+	configPath := fs.String("config", "", "JSON source configuration; flags given on the command line override it")
+	version := fs.String("zinc-version", "20", "ZINC version to download from: 15 or 20")
+	formats := fs.String("formats", "sdf", "comma-separated file formats: "+strings.Join(download.Formats, ", "))
+	catalogPath := fs.String("catalog", catalog.Path("zinc_catalog.db"), "catalog database to record downloads in (empty to skip)")
+	cachePath := fs.String("cache", download.CachePath("zinc_cache"), "shared download cache, checked before downloading (empty to skip)")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	var opt download.Options
+	fs.IntVar(&opt.Workers, "workers", download.DefaultWorkers, "number of concurrent downloads")
+	fs.DurationVar(&opt.Timeout, "timeout", download.DefaultTimeout, "timeout for a single request")
+	fs.IntVar(&opt.MaxRetries, "retries", download.DefaultMaxRetries, "retries for 429/5xx responses and network errors")
+	fs.BoolVar(&opt.Prune, "prune", false, "delete files downloaded for a previous ID list that are not in this one")
+	parseFlags(fs, args)
+
+	src := download.DefaultSource()
+	if *configPath != "" {
+		loaded, err := download.LoadSource(*configPath)
+		if err != nil {
+			return err
+		}
+		src = loaded
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "zinc-version":
+			src.Version = *version
+		case "formats":
+			src.Formats = strings.Split(*formats, ",")
+		case "out":
+			src.OutputDir = *out
+		}
+	})
+	if err := src.Check(); err != nil {
+		return err
+	}
+	ids, err := readIDList(*in)
+	if err != nil {
+		return err
+	}
+	if opt.Cache, err = openCache(*cachePath); err != nil {
+		return err
+	}
+
+	if !*asJSON {
+		fmt.Printf("Downloading %d molecules as %s from ZINC%s (%s).\n", len(ids), strings.Join(src.Formats, ", "), src.Version, src.Host())
+		opt.Logf = func(format string, args ...any) { fmt.Printf(format+"\n", args...) }
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	summaries, err := downloadIDs(ctx, src, ids, opt, *catalogPath)
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("interrupted; progress saved, run again to resume")
+	} else if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(summaries)
+	}
+	for _, s := range summaries {
+		for _, path := range s.Removed {
+			fmt.Printf("Removed %s (not in the current list)\n", path)
+		}
+		for _, f := range s.Failed {
+			fmt.Printf("Failed to download %s.%s: %s\n", f.ZincID, s.Format, f.Error)
+		}
+		fmt.Printf("%s: %d downloaded, %d from the cache, %d already present, %d failed (%s).\n",
+			s.Format, s.Downloaded, s.Cached, s.Skipped, len(s.Failed), s.Dir)
+	}
+	return nil
+}
+
+// openCache 開啟 path 的下載快取；path 為空時回傳 nil，不使用快取
+func openCache(path string) (*download.Cache, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return download.OpenCache(path)
+}
+
+// downloadIDs 依 src 下載 ids，並把每個分子的結果寫入資料庫；被中斷時仍會記錄已完成的部分
+func downloadIDs(ctx context.Context, src download.Source, ids []string, opt download.Options, catalogPath string) ([]downloadSummary, error) {
+	reports, err := src.Run(ctx, ids, opt)
+	var summaries []downloadSummary
+	for _, format := range src.Formats {
+		if r := reports[format]; r != nil {
+			summaries = append(summaries, downloadSummary{Format: format, Dir: src.Dir(format), Report: r})
+		}
+	}
+	cerr := withCatalog(catalogPath, true, func(cat *catalog.Catalog) error {
+		if cat == nil {
+			return nil
+		}
+		for _, s := range summaries {
+			st, err := download.LoadState(download.StatePath(s.Dir))
+			if err != nil {
+				return err
+			}
+			if err := cat.RecordDownloads(s.Format, s.Dir, st); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = cerr
+	}
+	return summaries, err
+}
+
+// listedFiles 回傳 dir 中 idsPath 清單已下載完成的檔案；目錄中先前清單留下的檔案不列入
+func listedFiles(dir, idsPath string) ([]string, error) {
+	ids, err := readIDList(idsPath)
+	if err != nil {
+		return nil, err
+	}
+	return download.ListFiles(dir, ids)
+}
+
+// readIDList 讀取每行一個 ZINC ID 的清單，略過其他的行與重複的 ID
+func readIDList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ids []string
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); strings.HasPrefix(line, "ZINC") && !seen[line] {
+			seen[line] = true
+			ids = append(ids, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no ZINC IDs in %s", path)
+	}
+	return ids, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"zinc/embed"
+	"zinc/merge"
+)
+
+// runEmbed 為下載的配體產生三維構形，寫成新的目錄或 SD 檔
+func runEmbed(args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files, or a single SD file")
+	out := fs.String("out", "set_1_3d", "output directory for 3D molecules, or an SD file if it ends in .sdf")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of molecules embedded in parallel")
+	seed := fs.Int64("seed", 0, "random seed; the same seed and input give the same coordinates")
+	iterations := fs.Int("iterations", embed.DefaultMaxIters, "maximum force-field iterations per attempt")
+	attempts := fs.Int("attempts", embed.DefaultAttempts, "starting geometries per molecule; the lowest-energy result is kept")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	parseFlags(fs, args)
+
+	files := []string{*in}
+	if st, err := os.Stat(*in); err != nil {
+		return err
+	} else if st.IsDir() {
+		if files, err = merge.ListSDFFiles(*in); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	opt := embed.Options{Seed: *seed, MaxIters: *iterations, Attempts: *attempts, Workers: *workers}
+	report, err := embed.Run(ctx, files, *out, opt)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(report)
+	}
+	for _, rej := range report.Failed {
+		fmt.Printf("Skipping %s: %s\n", rej.File, rej.Reason)
+	}
+	fmt.Printf("Embedded %d molecules in 3D, written to %s.\n", report.Embedded, *out)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/export"
+	"zinc/sample"
+)
+
+// runExport 把下載的配體庫串流轉成 CSV、JSON Lines 或 .smi 檔
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files, or a merged SD file")
+	out := fs.String("out", "-", "output file (- for stdout); the extension selects the format when -format is empty")
+	format := fs.String("format", "", "output format: csv, jsonl or smi (default csv, or from the -out extension)")
+	cols := fs.String("columns", strings.Join(export.DefaultColumns, ","), "comma-separated columns, or all: "+strings.Join(export.Columns(), ", "))
+	manifestPath := fs.String("manifest", sample.ManifestPath("zinc_ids.txt"), "sampling manifest providing the tranche and condition columns (ignored if missing)")
+	catalogPath := fs.String("catalog", "", "look up tranches and recorded descriptors in this catalog database")
+	idsPath := fs.String("ids", "", "export only the files downloaded for this ID list (default: every .sdf file in -in)")
+	asJSON := fs.Bool("json", false, "print the summary as JSON (requires -out)")
+	parseFlags(fs, args)
+	if *asJSON && *out == "-" {
+		return fmt.Errorf("-json needs -out: the export itself goes to stdout")
+	}
+
+	f := export.CSV
+	var err error
+	switch {
+	case *format != "":
+		f, err = export.ParseFormat(*format)
+	case *out != "-":
+		f, err = export.FromFileName(*out)
+	}
+	if err != nil {
+		return err
+	}
+	names, err := export.ParseColumns(*cols)
+	if err != nil {
+		return err
+	}
+
+	var lib *export.Library
+	if *idsPath != "" {
+		files, err := listedFiles(*in, *idsPath)
+		if err != nil {
+			return err
+		}
+		lib = &export.Library{Files: files}
+	} else if lib, err = export.Open(*in); err != nil {
+		return err
+	}
+	if m, err := sample.ReadManifest(*manifestPath); err == nil {
+		lib.Manifest = m
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if *catalogPath != "" {
+		cat, err := catalog.Open(*catalogPath)
+		if err != nil {
+			return err
+		}
+		defer cat.Close()
+		lib.Catalog = cat
+	}
+
+	var dst io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		dst = file
+	}
+	w, err := export.NewWriter(dst, f, names)
+	if err != nil {
+		return err
+	}
+	sum, err := lib.Export(w)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(sum)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d molecules from %d files as %s, %d duplicates skipped, %d records rejected.\n",
+		sum.Rows, sum.Files, f, sum.Duplicates, len(sum.Rejected))
+	for _, rej := range sum.Rejected {
+		fmt.Fprintf(os.Stderr, "  rejected %s: %s\n", rej.File, rej.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+// rewriteSDF 先寫到同目錄的暫存檔再改名，避免寫到一半的檔案取代原檔
+func rewriteSDF(path string, mols []*mol.Molecule) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*.sdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := sdf.NewWriter(tmp)
+	for _, m := range mols {
+		if err := w.Write(m); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
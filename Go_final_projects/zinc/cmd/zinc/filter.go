@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zinc/filter"
+	"zinc/merge"
+)
+
+// runFilter 依規則檔篩選下載的配體，通過的寫到新的目錄或 SD 檔，並輸出每個分子的篩選報告
+func runFilter(args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files, or a single SD file")
+	rulesPath := fs.String("rules", "", "JSON rule file (default: built-in Lipinski, Veber and structural alerts)")
+	out := fs.String("out", "set_1_filtered", "output directory for passing molecules, or an SD file if it ends in .sdf")
+	reportPath := fs.String("report", "", "write the per-molecule report to this file (.csv for CSV, JSON otherwise)")
+	printRules := fs.Bool("print-rules", false, "print the built-in rule file and exit")
+	idsPath := fs.String("ids", "", "filter only the files downloaded for this ID list (default: every .sdf file in -in)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	parseFlags(fs, args)
+
+	if *printRules {
+		_, err := os.Stdout.Write(filter.DefaultRules())
+		return err
+	}
+	rules, err := filter.Load(*rulesPath)
+	if err != nil {
+		return err
+	}
+	files := []string{*in}
+	if st, err := os.Stat(*in); err != nil {
+		return err
+	} else if st.IsDir() && *idsPath != "" {
+		if files, err = listedFiles(*in, *idsPath); err != nil {
+			return err
+		}
+	} else if st.IsDir() {
+		if files, err = merge.ListSDFFiles(*in); err != nil {
+			return err
+		}
+	}
+
+	report, err := rules.Run(files, *out)
+	if err != nil {
+		return err
+	}
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		if strings.EqualFold(filepath.Ext(*reportPath), ".csv") {
+			err = report.WriteCSV(rf)
+		} else {
+			err = report.WriteJSON(rf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		return report.WriteJSON(os.Stdout)
+	}
+	for _, res := range report.Molecules {
+		for _, v := range res.Violations {
+			fmt.Printf("%s: rejected by %s (%s)\n", res.ZincID, v.RuleSet, v.Detail)
+		}
+	}
+	for _, rej := range report.Rejected {
+		fmt.Printf("Skipping %s: %s\n", rej.File, rej.Reason)
+	}
+	fmt.Printf("%d of %d molecules passed, written to %s.\n", report.Passed, report.Checked, *out)
+	return nil
+}
@@ -0,0 +1,91 @@
+// zinc 是 ZINC 配體處理流程的命令列工具。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+// command 是一個子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"scrape", "scrape ZINC IDs of tranches into the catalog and zinc_ids_XX.txt", runScrape},
+	{"tranches", "list the tranches covered by a range query such as \"MW 300-400, logP 1-3\"", runTranches},
+	{"sample", "pick ligands from tranches by seed and write zinc_ids.txt with a manifest", runSample},
+	{"download", "download the ligands of an ID list, resuming interrupted runs", runDownload},
+	{"filter", "drop ligands that break drug-likeness rules or contain structural alerts", runFilter},
+	{"embed", "generate 3D coordinates with hydrogens for ligands that only have a 2D layout", runEmbed},
+	{"prepare", "write ligands as PDBQT, MOL2 or PDB with atom types, charges and torsion trees", runPrepare},
+	{"merge", "merge a directory of .sdf files into one validated SD file", runMerge},
+	{"export", "export the downloaded library as CSV, JSON Lines or SMILES", runExport},
+	{"serve", "run the web interface for scraping, sampling and downloading", runServe},
+	{"catalog", "import, inspect and export the ZINC ID catalog database", runCatalog},
+	{"cache", "verify the shared download cache or rebuild a download directory from it", runCache},
+	{"convert", "convert SD files between V2000 and V3000 molfiles", runConvert},
+	{"annotate", "compute descriptors for downloaded ligands and check their tranche", runAnnotate},
+	{"replay", "rebuild a sampled zinc_ids.txt from its manifest", runReplay},
+	{"search", "find ligands containing a SMARTS substructure", runSearch},
+	{"similar", "rank ligands by fingerprint similarity to a reference", runSimilar},
+	{"depict", "draw ligands from their 2D coordinates as SVG files or an HTML gallery", runDepict},
+	{"smiles", "print canonical SMILES for SD records and check their <smiles> field", runSMILES},
+}
+
+// printJSON 把 v 以縮排的 JSON 寫到標準輸出，供 -json 旗標使用。
+// 除了持續執行的 serve 之外，每個子命令都有 -json；資料本身寫到標準輸出的命令要求指定輸出檔。
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// parseFlags 解析只接受旗標的子命令；多出的位置參數（例如把路徑寫成 zinc convert in.sdf out.sdf）
+// 會被默默忽略而改讀預設的輸入，因此視為用法錯誤
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "zinc %s: unexpected argument %q; paths are given with flags\n", fs.Name(), fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// interruptContext 回傳在 Ctrl-C 時取消的 context，讓長時間的步驟可以保存進度後結束
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: zinc <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "zinc %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "zinc: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"zinc/merge"
+)
+
+// runMerge 把下載目錄中的 .sdf 檔合併成一個 SD 檔，並輸出被拒絕檔案的報告
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files")
+	out := fs.String("out", "set_1.sdf", "merged SD file")
+	reportPath := fs.String("report", "", "write the merge report as JSON to this file")
+	idsPath := fs.String("ids", "", "merge only the files downloaded for this ID list (default: every .sdf file in -in)")
+	asJSON := fs.Bool("json", false, "print the merge report as JSON")
+	parseFlags(fs, args)
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var report *merge.Report
+	if *idsPath != "" {
+		files, err := listedFiles(*in, *idsPath)
+		if err != nil {
+			return err
+		}
+		report, err = merge.Files(files, file)
+	} else {
+		report, err = merge.Directory(*in, file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		if err := report.WriteJSON(rf); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		return report.WriteJSON(os.Stdout)
+	}
+	fmt.Printf("Merged %d of %d records from %d files into %s.\n", report.Written, report.Records, report.Files, *out)
+	fmt.Printf("%d duplicates skipped, %d files rejected.\n", len(report.Duplicates), len(report.Rejected))
+	for _, rej := range report.Rejected {
+		fmt.Printf("  rejected %s: %s\n", rej.File, rej.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"zinc/merge"
+	"zinc/prep"
+)
+
+// runPrepare 把下載的配體寫成對接程式使用的 PDBQT、MOL2 或 PDB，每個分子每種格式一個檔案
+func runPrepare(args []string) error {
+	fs := flag.NewFlagSet("prepare", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files, or a single SD file")
+	out := fs.String("out", "set_1_docking", "output directory for one <zinc_id>.<format> per ligand and format")
+	formats := fs.String("formats", "pdbqt", "comma-separated output formats: pdbqt, mol2, pdb")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	parseFlags(fs, args)
+
+	fmts, err := prep.ParseFormats(*formats)
+	if err != nil {
+		return err
+	}
+	files := []string{*in}
+	if st, err := os.Stat(*in); err != nil {
+		return err
+	} else if st.IsDir() {
+		if files, err = merge.ListSDFFiles(*in); err != nil {
+			return err
+		}
+	}
+
+	report, err := prep.Run(files, *out, fmts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(report)
+	}
+	for _, rej := range report.Rejected {
+		fmt.Printf("Skipping %s: %s\n", rej.File, rej.Reason)
+	}
+	if len(report.Flat) > 0 {
+		fmt.Printf("Warning: %d ligands have only 2D coordinates; embed them in 3D before docking.\n", len(report.Flat))
+	}
+	fmt.Printf("Prepared %d ligands in %s.\n", report.Prepared, *out)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"zinc/catalog"
+	"zinc/fingerprint"
+	"zinc/sample"
+)
+
+// runReplay 依 manifest 重建 zinc_ids.txt，並確認結果與 manifest 記錄的完全相同
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "zinc_ids.manifest.json", "manifest written by the sampler")
+	tranches := fs.String("tranches", "", "directory with zinc_ids_XX.txt tranche lists (default: tranche_dir from the manifest)")
+	catalogPath := fs.String("catalog", "", "catalog database to read tranches from (default: catalog from the manifest)")
+	ligands := fs.String("ligands", "", "directory with downloaded .sdf files for diversity picks (default: ligand_dir from the manifest)")
+	out := fs.String("o", "zinc_ids.txt", "write the rebuilt ID list to this file (- for stdout)")
+	asJSON := fs.Bool("json", false, "print the rebuilt manifest as JSON (requires -o)")
+	parseFlags(fs, args)
+	if *asJSON && *out == "-" {
+		return fmt.Errorf("-json needs -o: the ID list itself goes to stdout")
+	}
+
+	m, err := sample.ReadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	// manifest 中的相對路徑以 manifest 所在目錄為準
+	base := filepath.Dir(*manifestPath)
+	resolve := func(flagValue, recorded string) string {
+		if flagValue != "" {
+			return flagValue
+		}
+		if recorded == "" || filepath.IsAbs(recorded) {
+			return recorded
+		}
+		return filepath.Join(base, recorded)
+	}
+	s := &sample.Sampler{
+		TrancheDir: resolve(*tranches, m.TrancheDir),
+		LigandDir:  resolve(*ligands, m.LigandDir),
+	}
+	s.Fingerprints = func() map[string]fingerprint.Fingerprint {
+		lib, err := fingerprint.LoadLibrary(s.LigandDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load ligand fingerprints: %v\n", err)
+			return map[string]fingerprint.Fingerprint{}
+		}
+		return lib.Index(fingerprint.Morgan)
+	}
+	if path := resolve(*catalogPath, m.Catalog); path != "" {
+		cat, err := catalog.Open(path)
+		if err != nil {
+			return err
+		}
+		defer cat.Close()
+		s.Catalog = cat
+	}
+
+	replayed, err := s.Replay(m)
+	if err != nil {
+		return err
+	}
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := replayed.WriteIDs(w); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(replayed)
+	}
+	fmt.Fprintf(os.Stderr, "Rebuilt %d ZINC IDs from %d conditions (seed %d).\n", len(replayed.IDs()), len(replayed.Picks), replayed.Seed)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/fingerprint"
+	"zinc/sample"
+	"zinc/tranche"
+)
+
+// runSample 依條件從 tranche 清單挑選配體，寫出 zinc_ids.txt 與 manifest（project 4 的流程）
+func runSample(args []string) error {
+	fs := flag.NewFlagSet("sample", flag.ExitOnError)
+	tranches := fs.String("tranches", "zinc_ids", "directory with zinc_ids_XX.txt tranche lists")
+	catalogPath := fs.String("catalog", catalog.Path("zinc_catalog.db"), "catalog database to read tranches from, if it exists")
+	ligands := fs.String("ligands", "set_1", "directory with downloaded .sdf files for maxmin and sphere selection")
+	seed := fs.Int64("seed", 0, "random seed (default: a new seed, recorded in the manifest)")
+	out := fs.String("out", "zinc_ids.txt", "selected ID list; the manifest is written next to it")
+	asJSON := fs.Bool("json", false, "print the manifest as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: zinc sample [flags] TRANCHE:QUANTITY[:random|maxmin|sphere]...   (e.g. AG:10 BH:5:maxmin)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conds := make([]sample.Condition, fs.NArg())
+	for i, arg := range fs.Args() {
+		c, err := parseCondition(arg)
+		if err != nil {
+			return err
+		}
+		conds[i] = c
+	}
+	useSeed := sample.NewSeed()
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			useSeed = *seed
+		}
+	})
+
+	m, err := sampleIDs(*tranches, *ligands, *catalogPath, *out, useSeed, conds)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(m)
+	}
+	for _, p := range m.Picks {
+		fmt.Printf("%s: %d of %d requested ZINC IDs (%s)\n", p.File, len(p.Selected), p.Quantity, p.Method)
+	}
+	fmt.Printf("Wrote %d ZINC IDs to %s (seed %d, manifest %s).\n", len(m.IDs()), *out, m.Seed, sample.ManifestPath(*out))
+	return nil
+}
+
+// parseCondition 解析 "AG:10" 或 "AG:10:maxmin" 形式的條件
+func parseCondition(s string) (sample.Condition, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return sample.Condition{}, fmt.Errorf("condition %q: want TRANCHE:QUANTITY[:SELECTION]", s)
+	}
+	t, err := tranche.Parse(parts[0])
+	if err != nil {
+		return sample.Condition{}, fmt.Errorf("condition %q: %v", s, err)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 1 {
+		return sample.Condition{}, fmt.Errorf("condition %q: quantity must be a positive integer", s)
+	}
+	c := sample.Condition{
+		MolecularWeight: string(t.MolecularWeight.Letter),
+		LogP:            string(t.LogP.Letter),
+		Quantity:        n,
+	}
+	if len(parts) == 3 {
+		if c.Selection, err = fingerprint.ParseSelection(parts[2]); err != nil {
+			return sample.Condition{}, fmt.Errorf("condition %q: %v", s, err)
+		}
+	}
+	return c, nil
+}
+
+// sampleIDs 以 seed 挑選 conds，寫出 out 與旁邊的 manifest。資料庫存在時 tranche 從資料庫讀取。
+func sampleIDs(trancheDir, ligandDir, catalogPath, out string, seed int64, conds []sample.Condition) (*sample.Manifest, error) {
+	s := &sample.Sampler{
+		TrancheDir: trancheDir,
+		LigandDir:  ligandDir,
+		Logf:       func(format string, args ...any) { fmt.Fprintf(os.Stderr, format+"\n", args...) },
+	}
+	s.Fingerprints = func() map[string]fingerprint.Fingerprint {
+		lib, err := fingerprint.LoadLibrary(ligandDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load ligand fingerprints: %v\n", err)
+			return map[string]fingerprint.Fingerprint{}
+		}
+		return lib.Index(fingerprint.Morgan)
+	}
+
+	var m *sample.Manifest
+	err := withCatalog(catalogPath, false, func(cat *catalog.Catalog) error {
+		s.Catalog = cat
+		var err error
+		m, err = s.Run(seed, conds)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	err = m.WriteIDs(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, sample.WriteManifest(sample.ManifestPath(out), m)
+}
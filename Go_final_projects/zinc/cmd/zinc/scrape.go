@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zinc/catalog"
+	"zinc/scrape"
+	"zinc/tranche"
+)
+
+// scrapeSummary 是一個 tranche 的抓取結果
+type scrapeSummary struct {
+	Tranche string             `json:"tranche"`
+	File    string             `json:"file,omitempty"` // 寫出的 zinc_ids_XX.txt
+	Scraped int                `json:"scraped"`        // 這次抓到的 ID 數
+	New     int                `json:"new"`            // 資料庫中新加入的 ID 數
+	Total   int                `json:"total"`          // 檔案中的 ID 數
+	Pages   int                `json:"pages"`
+	Failed  []scrape.PageError `json:"failed,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// runScrape 從 ZINC20 抓取 tranche 的 ZINC ID，記錄到資料庫並寫出 zinc_ids_XX.txt（project 3 的流程）
+func runScrape(args []string) error {
+	fs := flag.NewFlagSet("scrape", flag.ExitOnError)
+	out := fs.String("out", ".", "directory for zinc_ids_XX.txt tranche lists")
+	catalogPath := fs.String("catalog", catalog.Path("zinc_catalog.db"), "catalog database to record the IDs in (empty to write only the scraped IDs)")
+	failedPath := fs.String("failed", "", "JSON file of failed pages (default <out>/failed_pages.json)")
+	retry := fs.Bool("retry", false, "only re-fetch the pages recorded in the failed pages file")
+	baseURL := fs.String("base-url", scrape.DefaultBaseURL, "ZINC20 server")
+	perHost := fs.Int("per-host", scrape.DefaultPerHost, "concurrent requests to the server")
+	timeout := fs.Duration("timeout", scrape.DefaultTimeout, "timeout for a single page")
+	maxPages := fs.Int("max-pages", scrape.DefaultMaxPages, "pages to probe when the listing has no pagination links")
+	query := fs.String("query", "", `range query selecting the tranches, e.g. "MW 300-400, logP 1-3" (see zinc tranches)`)
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: zinc scrape [flags] TRANCHE...   (e.g. AG BH; with -query or -retry no tranches are needed)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *failedPath == "" {
+		*failedPath = filepath.Join(*out, "failed_pages.json")
+	}
+
+	var names []string
+	var failed map[string][]scrape.PageError
+	if *retry {
+		pages, err := loadFailedPages(*failedPath)
+		if err != nil {
+			return err
+		}
+		names, failed = groupFailedPages(pages)
+		if len(names) == 0 {
+			return fmt.Errorf("no failed pages in %s", *failedPath)
+		}
+	} else {
+		if fs.NArg() == 0 && *query == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *query != "" {
+			q, err := tranche.ParseQuery(*query)
+			if err != nil {
+				return err
+			}
+			names = q.Names()
+		}
+		for _, arg := range fs.Args() {
+			t, err := tranche.Parse(arg)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(names, t.Name()) {
+				names = append(names, t.Name())
+			}
+		}
+	}
+
+	logf := func(format string, args ...any) {}
+	if !*asJSON {
+		logf = func(format string, args ...any) { fmt.Fprintf(os.Stderr, format+"\n", args...) }
+	}
+	scraper := scrape.New(scrape.Options{BaseURL: *baseURL, PerHost: *perHost, Timeout: *timeout, MaxPages: *maxPages, Logf: logf})
+	ctx, stop := interruptContext()
+	defer stop()
+
+	summaries := scrapeTranches(ctx, scraper, names, failed, *catalogPath, *out, nil)
+	var stillFailed []scrape.PageError
+	for _, s := range summaries {
+		stillFailed = append(stillFailed, s.Failed...)
+	}
+	if err := updateFailedPages(*failedPath, names, stillFailed); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := printJSON(summaries); err != nil {
+			return err
+		}
+	} else {
+		for _, s := range summaries {
+			if s.Error != "" {
+				fmt.Printf("%s: %s\n", s.Tranche, s.Error)
+				continue
+			}
+			fmt.Printf("%s: scraped %d ZINC IDs (%d new) from %d pages, %d failed pages; %d IDs in %s\n",
+				s.Tranche, s.Scraped, s.New, s.Pages, len(s.Failed), s.Total, s.File)
+		}
+		if len(stillFailed) > 0 {
+			fmt.Printf("%d pages failed; run \"zinc scrape -retry\" to fetch them again.\n", len(stillFailed))
+		}
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("interrupted; scraped pages were saved")
+	}
+	return nil
+}
+
+// scrapeTranches 同時抓取 names 中的 tranche，並以 saveTranche 保存結果。
+// retry 不為 nil 時只重抓其中記錄的頁面。progress 不為 nil 時回報第 i 個 tranche 的每一頁。
+// 被取消時已抓到的頁面仍會保存。
+func scrapeTranches(ctx context.Context, s *scrape.Scraper, names []string, retry map[string][]scrape.PageError,
+	catalogPath, outDir string, progress func(i int, p scrape.Progress)) []scrapeSummary {
+	summaries := make([]scrapeSummary, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			var report func(scrape.Progress)
+			if progress != nil {
+				report = func(p scrape.Progress) { progress(i, p) }
+			}
+			var res *scrape.Result
+			if retry != nil {
+				res = &scrape.Result{Tranche: name, Failed: retry[name]}
+				s.Retry(ctx, res, report)
+			} else {
+				res, _ = s.Tranche(ctx, name, report)
+			}
+
+			sum := scrapeSummary{Tranche: name, Scraped: len(res.IDs), Pages: res.Pages, Failed: res.Failed}
+			file, added, total, err := saveTranche(catalogPath, outDir, name, res.IDs)
+			if err != nil {
+				sum.Error = err.Error()
+			} else {
+				sum.File, sum.New, sum.Total = file, added, total
+			}
+			summaries[i] = sum
+		}(i, name)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// saveTranche 把 ids 記錄到資料庫，再用資料庫中這個 tranche 的全部 ID 寫出 <outDir>/zinc_ids_XX.txt，
+// 之前抓到、這次沒抓到的 ID 不會遺失。沒有資料庫時只寫出 ids（與舊的 txt 合併）。
+// 回傳檔案路徑、新加入的 ID 數與檔案中的 ID 數。
+func saveTranche(catalogPath, outDir, name string, ids []string) (string, int, int, error) {
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return "", 0, 0, err
+	}
+	path := filepath.Join(outDir, fmt.Sprintf("zinc_ids_%s.txt", name))
+	var added, total int
+	err := withCatalog(catalogPath, true, func(cat *catalog.Catalog) error {
+		var err error
+		if cat == nil {
+			added, total, err = mergeTrancheFile(path, ids)
+			return err
+		}
+		if added, err = cat.Observe(name, ids, time.Now()); err != nil {
+			return err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		total, err = cat.WriteTranche(name, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	return path, added, total, err
+}
+
+// mergeTrancheFile 把 ids 併入 path 中已有的 ID，依數字順序寫回
+func mergeTrancheFile(path string, ids []string) (int, int, error) {
+	seen := make(map[string]bool)
+	if data, err := os.ReadFile(path); err == nil {
+		for _, id := range strings.Fields(string(data)) {
+			seen[id] = true
+		}
+	}
+	added := 0
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			added++
+		}
+	}
+	all := make([]string, 0, len(seen))
+	for id := range seen {
+		all = append(all, id)
+	}
+	sort.Strings(all)
+	var b strings.Builder
+	for _, id := range all {
+		b.WriteString(id + "\n")
+	}
+	return added, len(all), os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// failedPagesMu 保護失敗頁面檔，serve 中的多個工作可能同時更新它
+var failedPagesMu sync.Mutex
+
+func loadFailedPages(path string) ([]scrape.PageError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pages []scrape.PageError
+	if err := json.Unmarshal(data, &pages); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return pages, nil
+}
+
+// groupFailedPages 依 tranche 分組，回傳依出現順序排列的 tranche
+func groupFailedPages(pages []scrape.PageError) ([]string, map[string][]scrape.PageError) {
+	var names []string
+	byTranche := make(map[string][]scrape.PageError)
+	for _, p := range pages {
+		if byTranche[p.Tranche] == nil {
+			names = append(names, p.Tranche)
+		}
+		byTranche[p.Tranche] = append(byTranche[p.Tranche], p)
+	}
+	return names, byTranche
+}
+
+// updateFailedPages 用這次的結果取代 tranches 先前的失敗頁面，其他 tranche 的記錄保留；沒有任何失敗頁面時刪除檔案
+func updateFailedPages(path string, tranches []string, failed []scrape.PageError) error {
+	failedPagesMu.Lock()
+	defer failedPagesMu.Unlock()
+	replaced := make(map[string]bool, len(tranches))
+	for _, t := range tranches {
+		replaced[t] = true
+	}
+	old, err := loadFailedPages(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var pages []scrape.PageError
+	for _, p := range old {
+		if !replaced[p.Tranche] {
+			pages = append(pages, p)
+		}
+	}
+	pages = append(pages, failed...)
+	if len(pages) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(pages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
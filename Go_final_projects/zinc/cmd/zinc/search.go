@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"zinc/merge"
+	"zinc/smarts"
+)
+
+// runSearch 以 SMARTS 在已下載的配體中做子結構搜尋，列出命中的 ZINC ID 與原子對應
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with .sdf files, or a single .sdf file")
+	query := fs.String("smarts", "", "SMARTS substructure query (required)")
+	maxMatches := fs.Int("max-matches", 100, "maximum atom mappings reported per molecule (0 for no limit)")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	parseFlags(fs, args)
+
+	if *query == "" {
+		return fmt.Errorf("-smarts is required")
+	}
+	q, err := smarts.Parse(*query)
+	if err != nil {
+		return err
+	}
+	files := []string{*in}
+	if st, err := os.Stat(*in); err != nil {
+		return err
+	} else if st.IsDir() {
+		if files, err = merge.ListSDFFiles(*in); err != nil {
+			return err
+		}
+	}
+
+	res := smarts.SearchFiles(q, files, *maxMatches)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", e.File, e.Err)
+	}
+	for _, h := range res.Hits {
+		var maps []string
+		for _, m := range h.Matches {
+			atoms := make([]string, len(m))
+			for k, a := range m {
+				atoms[k] = strconv.Itoa(a)
+			}
+			maps = append(maps, "("+strings.Join(atoms, ",")+")")
+		}
+		fmt.Printf("%s\t%s\t%s\n", h.ZincID, h.File, strings.Join(maps, " "))
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d molecules match %s.\n", len(res.Hits), res.Searched, q)
+	return nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/depict"
+	"zinc/download"
+	"zinc/export"
+	"zinc/jobs"
+	"zinc/merge"
+	"zinc/sample"
+	"zinc/scrape"
+	"zinc/tranche"
+)
+
+//go:embed web/index.html
+var serveIndex []byte
+
+// server 是 serve 命令的網頁介面：抓取與下載以背景工作執行，挑選直接回傳 manifest
+type server struct {
+	trancheDir  string
+	ligandDir   string
+	idsPath     string
+	catalogPath string
+	cache       *download.Cache // nil 時不使用下載快取
+	failedPath  string
+	source      download.Source
+	scraper     *scrape.Scraper
+	manager     *jobs.Manager
+}
+
+// runServe 啟動整合抓取、挑選與下載的網頁介面
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	tranches := fs.String("tranches", "zinc_ids", "directory for zinc_ids_XX.txt tranche lists")
+	ligands := fs.String("ligands", "set_1", "output directory for downloaded sdf files")
+	ids := fs.String("ids", "zinc_ids.txt", "sampled ID list, also the download input")
+	catalogPath := fs.String("catalog", catalog.Path("zinc_catalog.db"), "catalog database (empty to use only the text files)")
+	cachePath := fs.String("cache", download.CachePath("zinc_cache"), "shared download cache (empty to skip)")
+	configPath := fs.String("config", "", "JSON download source configuration (default: ZINC20 sdf into -ligands)")
+	baseURL := fs.String("base-url", scrape.DefaultBaseURL, "ZINC20 server to scrape")
+	parseFlags(fs, args)
+
+	src := download.DefaultSource()
+	src.OutputDir = *ligands
+	if *configPath != "" {
+		loaded, err := download.LoadSource(*configPath)
+		if err != nil {
+			return err
+		}
+		src = loaded
+	}
+	cache, err := openCache(*cachePath)
+	if err != nil {
+		return err
+	}
+	s := &server{
+		trancheDir:  *tranches,
+		ligandDir:   src.Dir("sdf"),
+		idsPath:     *ids,
+		catalogPath: *catalogPath,
+		cache:       cache,
+		failedPath:  filepath.Join(*tranches, "failed_pages.json"),
+		source:      src,
+		scraper:     scrape.New(scrape.Options{BaseURL: *baseURL, Logf: log.Printf}),
+		manager:     jobs.NewManager(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(serveIndex)
+	})
+	mux.HandleFunc("POST /scrape", s.scrape)
+	mux.HandleFunc("POST /sample", s.sample)
+	mux.HandleFunc("POST /download", s.download)
+	mux.HandleFunc("GET /export", s.export)
+	mux.HandleFunc("GET /gallery", s.gallery)
+	s.manager.Handle(mux)
+
+	fmt.Printf("Server started at http://localhost%s\n", *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// scrape 建立抓取工作：表單欄位 tranche 可以重複或以空白、逗號分隔，query 是範圍查詢
+// （例如 "MW 300-400, logP 1-3"）；retry=1 時只重抓失敗的頁面
+func (s *server) scrape(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	var failed map[string][]scrape.PageError
+	kind := "scrape"
+	if r.FormValue("retry") != "" {
+		kind = "retry"
+		pages, err := loadFailedPages(s.failedPath)
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		names, failed = groupFailedPages(pages)
+		if len(names) == 0 {
+			http.Error(w, "No failed pages to retry", http.StatusBadRequest)
+			return
+		}
+	} else {
+		r.ParseForm()
+		if v := strings.TrimSpace(r.FormValue("query")); v != "" {
+			q, err := tranche.ParseQuery(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			names = q.Names()
+		}
+		for _, v := range r.Form["tranche"] {
+			for _, code := range strings.FieldsFunc(v, func(c rune) bool { return c == ',' || c == ' ' }) {
+				t, err := tranche.Parse(code)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if !slices.Contains(names, t.Name()) {
+					names = append(names, t.Name())
+				}
+			}
+		}
+		if len(names) == 0 {
+			http.Error(w, "At least one tranche or a query is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	job := s.manager.Start(kind, names, func(ctx context.Context, j *jobs.Job) error {
+		progress := func(i int, p scrape.Progress) {
+			j.Update(i, func(task *jobs.Task) {
+				task.Done++
+				if p.LastPage > task.Total {
+					task.Total = p.LastPage
+				}
+				if p.Err != nil {
+					task.Errors = append(task.Errors, fmt.Sprintf("page %d: %v", p.Page, p.Err))
+				}
+			})
+		}
+		if failed != nil {
+			for i, name := range names {
+				j.Update(i, func(task *jobs.Task) { task.Total = len(failed[name]) })
+			}
+		}
+		summaries := scrapeTranches(ctx, s.scraper, names, failed, s.catalogPath, s.trancheDir, progress)
+		var stillFailed []scrape.PageError
+		for i, sum := range summaries {
+			stillFailed = append(stillFailed, sum.Failed...)
+			j.Update(i, func(task *jobs.Task) {
+				if sum.Error != "" {
+					task.Errors = append(task.Errors, sum.Error)
+				} else {
+					task.Output, task.Count = sum.File, sum.Total
+				}
+				task.Total = task.Done
+				task.Finished = true
+			})
+		}
+		if err := updateFailedPages(s.failedPath, names, stillFailed); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+	acceptJob(w, job)
+}
+
+// sample 依表單欄位 condition（可以重複，例如 AG:10:maxmin）與 seed 挑選，回傳 manifest
+func (s *server) sample(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	var conds []sample.Condition
+	for _, v := range r.Form["condition"] {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		c, err := parseCondition(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conds = append(conds, c)
+	}
+	if len(conds) == 0 {
+		http.Error(w, "At least one condition is required", http.StatusBadRequest)
+		return
+	}
+	seed := sample.NewSeed()
+	if v := strings.TrimSpace(r.FormValue("seed")); v != "" {
+		var err error
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Seed must be an integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	m, err := sampleIDs(s.trancheDir, s.ligandDir, s.catalogPath, s.idsPath, seed, conds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// download 建立下載工作，每種格式是工作中的一項；sdf 下載完成後把這份清單的分子合併成 <ligands>.sdf
+func (s *server) download(w http.ResponseWriter, r *http.Request) {
+	ids, err := readIDList(s.idsPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	formats := s.source.Formats
+	job := s.manager.Start("download", formats, func(ctx context.Context, j *jobs.Job) error {
+		index := make(map[string]int, len(formats))
+		for i, f := range formats {
+			index[f] = i
+			j.Update(i, func(task *jobs.Task) { task.Total = len(ids) })
+		}
+		opt := download.Options{
+			Cache: s.cache,
+			Logf:  log.Printf,
+			Progress: func(format, id string, it download.Item) {
+				j.Update(index[format], func(task *jobs.Task) {
+					task.Done++
+					if it.Status == download.Failed {
+						task.Errors = append(task.Errors, fmt.Sprintf("%s: %s", id, it.Error))
+					}
+				})
+			},
+		}
+		summaries, err := downloadIDs(ctx, s.source, ids, opt, s.catalogPath)
+		for _, sum := range summaries {
+			output := ""
+			if sum.Format == "sdf" && err == nil {
+				output = sum.Dir + ".sdf"
+				if merr := mergeFiles(sum.Files, output); merr != nil {
+					j.Update(index["sdf"], func(task *jobs.Task) { task.Errors = append(task.Errors, merr.Error()) })
+					output = ""
+				}
+			}
+			j.Update(index[sum.Format], func(task *jobs.Task) {
+				task.Output, task.Count = output, sum.Downloaded+sum.Skipped
+				task.Finished = true
+			})
+		}
+		return err
+	})
+	acceptJob(w, job)
+}
+
+// export 以查詢參數 format 與 columns 串流匯出目前 ID 清單已下載的配體，tranche 與 condition 取自挑選的 manifest。
+// 下載目錄中先前清單留下的檔案不會匯出。
+func (s *server) export(w http.ResponseWriter, r *http.Request) {
+	ids, err := readIDList(s.idsPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	files, err := download.ListFiles(s.ligandDir, ids)
+	if err != nil {
+		http.Error(w, "No downloaded ligands yet", http.StatusNotFound)
+		return
+	}
+	lib := &export.Library{Files: files}
+	if m, err := sample.ReadManifest(sample.ManifestPath(s.idsPath)); err == nil {
+		lib.Manifest = m
+	}
+	if s.catalogPath != "" {
+		if cat, err := catalog.Open(s.catalogPath); err == nil {
+			defer cat.Close()
+			lib.Catalog = cat
+		} else {
+			log.Printf("export without catalog: %v", err)
+		}
+	}
+	export.Serve(w, r, lib, filepath.Base(s.ligandDir))
+}
+
+// gallery 以格狀顯示挑選出的配體結構，每格標示 ZINC ID 與挑選時的條件
+func (s *server) gallery(w http.ResponseWriter, r *http.Request) {
+	ids, err := readIDList(s.idsPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	captions := make(map[string]string)
+	if m, err := sample.ReadManifest(sample.ManifestPath(s.idsPath)); err == nil {
+		for _, p := range m.Picks {
+			for _, id := range p.Selected {
+				captions[id] = p.Condition.String()
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	depict.WriteGallery(w, "Sampled ligands", depict.LoadItems(s.ligandDir, ids, captions), depict.Options{})
+}
+
+// mergeFiles 把 files 合併成 out
+func mergeFiles(files []string, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	_, err = merge.Files(files, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// acceptJob 回應 202 與新工作的位址
+func acceptJob(w http.ResponseWriter, job *jobs.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":     job.ID(),
+		"status": "/jobs/" + job.ID(),
+		"events": "/jobs/" + job.ID() + "/events",
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"zinc/fingerprint"
+	"zinc/mol"
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+// runSimilar 依 Tanimoto 相似度列出最接近參考配體的分子；指紋快取在 set_1 旁邊
+func runSimilar(args []string) error {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	in := fs.String("in", "set_1", "directory with downloaded .sdf files")
+	querySMILES := fs.String("smiles", "", "reference ligand as SMILES")
+	querySDF := fs.String("sdf", "", "reference ligand as an SD/mol file (first record is used)")
+	k := fs.Int("k", 10, "number of results (0 for all)")
+	kindName := fs.String("fp", "morgan", "fingerprint: morgan or path")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	parseFlags(fs, args)
+
+	kind, err := fingerprint.ParseKind(*kindName)
+	if err != nil {
+		return err
+	}
+	query, err := loadQuery(*querySMILES, *querySDF)
+	if err != nil {
+		return err
+	}
+	lib, err := fingerprint.LoadLibrary(*in)
+	if err != nil {
+		return err
+	}
+	for _, f := range lib.Failed {
+		fmt.Fprintf(os.Stderr, "Skipping %s: cannot be read\n", f)
+	}
+	scores := lib.Search(query, kind, *k)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(scores)
+	}
+	for i, s := range scores {
+		fmt.Printf("%d\t%s\t%.4f\t%s\n", i+1, s.ZincID, s.Similarity, s.File)
+	}
+	fmt.Fprintf(os.Stderr, "Compared against %d molecules (%d files cached, %d fingerprinted).\n",
+		len(lib.Entries), lib.Reused, lib.Computed)
+	return nil
+}
+
+// loadQuery 從 SMILES 或 SD 檔讀取參考分子，兩者必須擇一
+func loadQuery(smi, path string) (*mol.Molecule, error) {
+	switch {
+	case smi != "" && path != "":
+		return nil, fmt.Errorf("use either -smiles or -sdf, not both")
+	case smi != "":
+		return smiles.Parse(smi)
+	case path != "":
+		mols, err := sdf.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(mols) == 0 {
+			return nil, fmt.Errorf("%s: no molecules", path)
+		}
+		return mols[0], nil
+	}
+	return nil, fmt.Errorf("a reference ligand is required (-smiles or -sdf)")
+}
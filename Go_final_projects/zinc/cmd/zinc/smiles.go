@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+// runSMILES 輸出 SD 檔中每個分子的正規 SMILES；加上 -check 時
+// 與 <smiles> 欄位的正規形式比對，回報結構與欄位不一致的分子
+func runSMILES(args []string) error {
+	fs := flag.NewFlagSet("smiles", flag.ExitOnError)
+	in := fs.String("in", "-", "input SD file (- for stdin)")
+	check := fs.Bool("check", false, "compare each structure with its <smiles> data field")
+	asJSON := fs.Bool("json", false, "print the records as a JSON array")
+	parseFlags(fs, args)
+
+	var src io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		src = file
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	r := sdf.NewReader(src)
+	records, mismatches := 0, 0
+	list := []smilesRecord{}
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		records++
+		rec := smilesRecord{ZincID: m.ZincID(), SMILES: smiles.Canonical(m)}
+		if *check {
+			if field, ok := m.Field("smiles"); ok {
+				if fm, err := smiles.Parse(field); err != nil {
+					rec.Mismatch = fmt.Sprintf("<smiles> field: %v", err)
+				} else if c := smiles.Canonical(fm); c != rec.SMILES {
+					rec.Mismatch = fmt.Sprintf("structure is %s but <smiles> field is %s", rec.SMILES, c)
+				}
+			}
+		}
+		if rec.Mismatch != "" {
+			mismatches++
+		}
+		if *asJSON {
+			list = append(list, rec)
+			continue
+		}
+		fmt.Fprintf(out, "%s\t%s\n", rec.SMILES, rec.ZincID)
+		if rec.Mismatch != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", rec.ZincID, rec.Mismatch)
+		}
+	}
+	if *asJSON {
+		out.Flush()
+		if err := printJSON(list); err != nil {
+			return err
+		}
+	}
+	if *check && mismatches > 0 {
+		return fmt.Errorf("%d of %d records do not match their <smiles> field", mismatches, records)
+	}
+	return nil
+}
+
+// smilesRecord 是 -json 輸出中的一筆紀錄；Mismatch 只在 -check 發現不一致時出現
+type smilesRecord struct {
+	ZincID   string `json:"zinc_id"`
+	SMILES   string `json:"smiles"`
+	Mismatch string `json:"mismatch,omitempty"`
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"zinc/tranche"
+)
+
+// runTranches 列出範圍查詢涵蓋的 tranche，例如 zinc tranches "MW 300-400, logP 1-3"
+func runTranches(args []string) error {
+	fs := flag.NewFlagSet("tranches", flag.ExitOnError)
+	codes := fs.Bool("codes", false, "list the full six-letter codes instead of the molecular weight × logP tranches")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `usage: zinc tranches [flags] QUERY   (e.g. "MW 300-400, logP 1-3, reactivity A C, charge 0")`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	q, err := tranche.ParseQuery(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	if *codes {
+		list := q.Codes()
+		names := make([]string, len(list))
+		for i, c := range list {
+			names[i] = c.String()
+		}
+		if *asJSON {
+			return printJSON(names)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		fmt.Fprintf(os.Stderr, "%d tranche codes for %s\n", len(names), q)
+		return nil
+	}
+
+	if *asJSON {
+		return printJSON(q.Names())
+	}
+	for _, t := range q.Tranches() {
+		fmt.Printf("%s  MW %v  logP %v\n", t.Name(), t.MolecularWeight, t.LogP)
+	}
+	fmt.Fprintf(os.Stderr, "%d tranches for %s\n", len(q.Tranches()), q)
+	return nil
+}
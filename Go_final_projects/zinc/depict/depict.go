@@ -0,0 +1,440 @@
+// Package depict 依 SD 檔中的 2D 座標把分子畫成 SVG：鍵級、楔形/虛線立體鍵、
+// 雜原子與帶電原子的標籤（含氫數與電荷），以及以格狀排列多個分子的 HTML 藝廊。
+// 座標只做縮放與置中，不重新排版，因此沒有 2D 座標的分子（例如從 SMILES 讀入）無法繪製。
+package depict
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"zinc/mol"
+)
+
+// Options 控制圖的大小，零值欄位使用預設值
+type Options struct {
+	Width, Height int     // 圖的大小（像素），預設 300×300
+	BondLength    float64 // 鍵長的上限（像素），小分子不會被放大到超過它，預設 40
+	FontSize      float64 // 原子標籤的字級（像素），預設 14
+}
+
+func (o Options) withDefaults() Options {
+	if o.Width <= 0 {
+		o.Width = 300
+	}
+	if o.Height <= 0 {
+		o.Height = 300
+	}
+	if o.BondLength <= 0 {
+		o.BondLength = 40
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = 14
+	}
+	return o
+}
+
+// colors 是原子標籤與鍵端的顏色（CPK 配色），其他元素為黑色
+var colors = map[string]string{
+	"N":  "#3050f8",
+	"O":  "#e00000",
+	"S":  "#b8a000",
+	"P":  "#ff8000",
+	"F":  "#2a9d2a",
+	"Cl": "#1e9e1e",
+	"Br": "#a52a2a",
+	"I":  "#940094",
+	"B":  "#c08060",
+	"Si": "#808060",
+}
+
+func color(symbol string) string {
+	if c, ok := colors[symbol]; ok {
+		return c
+	}
+	return "#000000"
+}
+
+type point struct{ x, y float64 }
+
+func (p point) add(q point) point             { return point{p.x + q.x, p.y + q.y} }
+func (p point) sub(q point) point             { return point{p.x - q.x, p.y - q.y} }
+func (p point) scale(f float64) point         { return point{p.x * f, p.y * f} }
+func (p point) length() float64               { return math.Hypot(p.x, p.y) }
+func (p point) lerp(q point, t float64) point { return p.add(q.sub(p).scale(t)) }
+
+// drawing 保存繪製一個分子時需要的資訊
+type drawing struct {
+	m       *mol.Molecule
+	opt     Options
+	pos     []point // 畫布座標（y 向下）
+	bondPx  float64 // 畫布上的典型鍵長
+	labeled []bool
+	adj     [][]mol.Edge
+	rings   [][]int
+	sb      strings.Builder
+}
+
+// SVG 回傳分子的 SVG 圖
+func SVG(m *mol.Molecule, opt Options) string {
+	var sb strings.Builder
+	Write(&sb, m, opt)
+	return sb.String()
+}
+
+// Write 把分子的 SVG 圖寫到 w
+func Write(w io.Writer, m *mol.Molecule, opt Options) error {
+	d := &drawing{m: m, opt: opt.withDefaults()}
+	d.header()
+	if msg := d.layout(); msg != "" {
+		d.message(msg)
+	} else {
+		for i := range m.Bonds {
+			d.bond(i)
+		}
+		for i := range m.Atoms {
+			if d.labeled[i] {
+				d.label(i)
+			}
+		}
+	}
+	d.sb.WriteString("</svg>\n")
+	_, err := io.WriteString(w, d.sb.String())
+	return err
+}
+
+func (d *drawing) header() {
+	fmt.Fprintf(&d.sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img">`,
+		d.opt.Width, d.opt.Height, d.opt.Width, d.opt.Height)
+	if id := d.m.ZincID(); id != "" {
+		fmt.Fprintf(&d.sb, "<title>%s</title>", html.EscapeString(id))
+	}
+	fmt.Fprintf(&d.sb, `<rect width="100%%" height="100%%" fill="#ffffff"/>`)
+}
+
+// message 在圖的中央寫一行文字，取代無法繪製的分子
+func (d *drawing) message(text string) {
+	fmt.Fprintf(&d.sb, `<text x="%d" y="%d" font-family="sans-serif" font-size="%.0f" text-anchor="middle" fill="#808080">%s</text>`,
+		d.opt.Width/2, d.opt.Height/2, d.opt.FontSize, html.EscapeString(text))
+}
+
+// layout 把分子座標縮放、置中到畫布上；無法繪製時回傳原因
+func (d *drawing) layout() string {
+	m := d.m
+	if len(m.Atoms) == 0 {
+		return "no atoms"
+	}
+	d.pos = make([]point, len(m.Atoms))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, a := range m.Atoms {
+		// molfile 的 y 軸向上，SVG 向下
+		d.pos[i] = point{a.X, -a.Y}
+		minX, maxX = math.Min(minX, a.X), math.Max(maxX, a.X)
+		minY, maxY = math.Min(minY, -a.Y), math.Max(maxY, -a.Y)
+	}
+
+	var lengths []float64
+	for _, b := range m.Bonds {
+		if l := d.pos[b.Begin].sub(d.pos[b.End]).length(); l > 1e-6 {
+			lengths = append(lengths, l)
+		}
+	}
+	if len(m.Atoms) > 1 && len(lengths) == 0 {
+		return "no 2D coordinates"
+	}
+	median := 1.0
+	if len(lengths) > 0 {
+		sort.Float64s(lengths)
+		median = lengths[len(lengths)/2]
+	}
+
+	pad := d.opt.FontSize * 1.5
+	scale := d.opt.BondLength / median
+	if w := maxX - minX; w > 0 {
+		scale = math.Min(scale, (float64(d.opt.Width)-2*pad)/w)
+	}
+	if h := maxY - minY; h > 0 {
+		scale = math.Min(scale, (float64(d.opt.Height)-2*pad)/h)
+	}
+	d.bondPx = median * scale
+	center := point{(minX + maxX) / 2, (minY + maxY) / 2}
+	mid := point{float64(d.opt.Width) / 2, float64(d.opt.Height) / 2}
+	for i := range d.pos {
+		d.pos[i] = d.pos[i].sub(center).scale(scale).add(mid)
+	}
+
+	d.adj = m.Adjacency()
+	d.labeled = make([]bool, len(m.Atoms))
+	for i, a := range m.Atoms {
+		d.labeled[i] = a.Symbol != "C" || len(d.adj[i]) == 0 || a.Charge != 0 || a.Isotope != 0
+	}
+	return ""
+}
+
+// ends 回傳鍵在畫布上的兩端，有標籤的一端縮短，讓線不會壓到文字
+func (d *drawing) ends(b mol.Bond) (point, point) {
+	p, q := d.pos[b.Begin], d.pos[b.End]
+	dir := q.sub(p)
+	l := dir.length()
+	if l < 1e-6 {
+		return p, q
+	}
+	gap := d.opt.FontSize * 0.6 / l
+	if gap > 0.4 {
+		gap = 0.4
+	}
+	p1, q1 := p, q
+	if d.labeled[b.Begin] {
+		p1 = p.lerp(q, gap)
+	}
+	if d.labeled[b.End] {
+		q1 = q.lerp(p, gap)
+	}
+	return p1, q1
+}
+
+func (d *drawing) line(p, q point, stroke, extra string) {
+	fmt.Fprintf(&d.sb, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f" stroke-linecap="round"%s/>`,
+		p.x, p.y, q.x, q.y, stroke, d.strokeWidth(), extra)
+}
+
+func (d *drawing) strokeWidth() float64 {
+	return math.Max(1, d.bondPx/20)
+}
+
+// segment 畫出 p 到 q 的線，前半段用 Begin 原子的顏色、後半段用 End 原子的顏色
+func (d *drawing) segment(b mol.Bond, p, q point, extra string) {
+	c1, c2 := d.atomColor(b.Begin), d.atomColor(b.End)
+	if c1 == c2 {
+		d.line(p, q, c1, extra)
+		return
+	}
+	mid := p.lerp(q, 0.5)
+	d.line(p, mid, c1, extra)
+	d.line(mid, q, c2, extra)
+}
+
+func (d *drawing) atomColor(i int) string {
+	if !d.labeled[i] {
+		return "#000000"
+	}
+	return color(d.m.Atoms[i].Symbol)
+}
+
+func (d *drawing) bond(i int) {
+	b := d.m.Bonds[i]
+	p, q := d.ends(b)
+	dir := q.sub(p)
+	l := dir.length()
+	if l < 1e-6 {
+		return
+	}
+	normal := point{-dir.y / l, dir.x / l}
+	offset := d.bondPx * 0.18
+
+	switch b.Order {
+	case mol.Double, mol.Aromatic:
+		if b.Order == mol.Double && b.Stereo == mol.StereoCisTrans {
+			// 幾何未定的雙鍵畫成交叉線
+			o := normal.scale(offset / 2)
+			d.segment(b, p.add(o), q.sub(o), "")
+			d.segment(b, p.sub(o), q.add(o), "")
+			return
+		}
+		dash := ""
+		if b.Order == mol.Aromatic {
+			dash = fmt.Sprintf(` stroke-dasharray="%.1f,%.1f"`, d.bondPx/10, d.bondPx/10)
+		}
+		side := d.doubleSide(i, normal)
+		if side == 0 {
+			o := normal.scale(offset / 2)
+			d.segment(b, p.add(o), q.add(o), "")
+			d.segment(b, p.sub(o), q.sub(o), dash)
+			return
+		}
+		d.segment(b, p, q, "")
+		o := normal.scale(offset * side)
+		// 內側的線兩端縮短，與相鄰的鍵分開
+		d.segment(b, p.lerp(q, 0.12).add(o), q.lerp(p, 0.12).add(o), dash)
+	case mol.Triple:
+		o := normal.scale(offset)
+		d.segment(b, p, q, "")
+		d.segment(b, p.add(o), q.add(o), "")
+		d.segment(b, p.sub(o), q.sub(o), "")
+	default:
+		switch b.Stereo {
+		case mol.StereoUp:
+			d.wedge(b, p, q, normal)
+		case mol.StereoDown:
+			d.hash(b, p, q, normal)
+		case mol.StereoEither:
+			d.wavy(b, p, q, normal)
+		default:
+			d.segment(b, p, q, "")
+		}
+	}
+}
+
+// doubleSide 決定雙鍵第二條線畫在哪一側：環上的雙鍵畫在環內，其他的畫在取代基較多的一側；
+// 一端是末端原子（例如 C=O）時回傳 0，兩條線對稱畫在鍵的兩側
+func (d *drawing) doubleSide(bond int, normal point) float64 {
+	b := d.m.Bonds[bond]
+	p := d.pos[b.Begin]
+	if ring := d.ringOf(b.Begin, b.End); ring != nil {
+		var c point
+		for _, a := range ring {
+			c = c.add(d.pos[a])
+		}
+		c = c.scale(1 / float64(len(ring)))
+		return sign(dot(c.sub(p), normal))
+	}
+	if len(d.adj[b.Begin]) == 1 || len(d.adj[b.End]) == 1 {
+		return 0
+	}
+	var sum float64
+	for _, end := range []int{b.Begin, b.End} {
+		for _, e := range d.adj[end] {
+			if e.Bond != bond {
+				sum += sign(dot(d.pos[e.Atom].sub(d.pos[end]), normal))
+			}
+		}
+	}
+	return sign(sum)
+}
+
+// ringOf 回傳包含 a–b 鍵的最小環，沒有時回傳 nil
+func (d *drawing) ringOf(a, b int) []int {
+	if d.rings == nil {
+		d.rings = d.m.Rings()
+		if d.rings == nil {
+			d.rings = [][]int{}
+		}
+	}
+	for _, ring := range d.rings {
+		for k, x := range ring {
+			y := ring[(k+1)%len(ring)]
+			if (x == a && y == b) || (x == b && y == a) {
+				return ring
+			}
+		}
+	}
+	return nil
+}
+
+func dot(p, q point) float64 { return p.x*q.x + p.y*q.y }
+
+func sign(v float64) float64 {
+	switch {
+	case v > 1e-9:
+		return 1
+	case v < -1e-9:
+		return -1
+	}
+	return 0
+}
+
+// wedge 畫出實心楔形：Begin 端（立體中心）是尖端
+func (d *drawing) wedge(b mol.Bond, p, q, normal point) {
+	w := normal.scale(d.bondPx * 0.12)
+	q1, q2 := q.add(w), q.sub(w)
+	fmt.Fprintf(&d.sb, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="%s"/>`,
+		p.x, p.y, q1.x, q1.y, q2.x, q2.y, d.atomColor(b.Begin))
+}
+
+// hash 畫出虛線楔形：一組由 Begin 端往 End 端逐漸變長的橫線
+func (d *drawing) hash(b mol.Bond, p, q, normal point) {
+	const n = 7
+	for k := 1; k <= n; k++ {
+		t := float64(k) / n
+		c := p.lerp(q, t)
+		w := normal.scale(d.bondPx * 0.12 * t)
+		stroke := d.atomColor(b.Begin)
+		if t > 0.5 {
+			stroke = d.atomColor(b.End)
+		}
+		d.line(c.add(w), c.sub(w), stroke, "")
+	}
+}
+
+// wavy 畫出立體未定（either）的波浪線
+func (d *drawing) wavy(b mol.Bond, p, q, normal point) {
+	const n = 8
+	w := normal.scale(d.bondPx * 0.08)
+	var pts []string
+	for k := 0; k <= n; k++ {
+		c := p.lerp(q, float64(k)/n)
+		switch {
+		case k == 0 || k == n:
+		case k%2 == 1:
+			c = c.add(w)
+		default:
+			c = c.sub(w)
+		}
+		pts = append(pts, fmt.Sprintf("%.1f,%.1f", c.x, c.y))
+	}
+	fmt.Fprintf(&d.sb, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%.1f" stroke-linejoin="round"/>`,
+		strings.Join(pts, " "), d.atomColor(b.Begin), d.strokeWidth())
+}
+
+// label 畫出原子標籤：同位素、元素符號、氫數（放在沒有鍵的一側）與電荷
+func (d *drawing) label(i int) {
+	a := d.m.Atoms[i]
+	p := d.pos[i]
+	fs := d.opt.FontSize
+	charW := fs * 0.6
+	c := color(a.Symbol)
+
+	hs := d.m.ImplicitHydrogens(i) + a.ExplicitH
+	hLeft := false
+	if hs > 0 && len(d.adj[i]) > 0 {
+		var dx float64
+		for _, e := range d.adj[i] {
+			dx += d.pos[e.Atom].x - p.x
+		}
+		hLeft = dx > 0
+	}
+	font := fmt.Sprintf(`font-family="sans-serif" font-size="%.0f" fill="%s" dominant-baseline="central"`, fs, c)
+	symW := charW * float64(len(a.Symbol))
+
+	fmt.Fprintf(&d.sb, `<text x="%.1f" y="%.1f" %s text-anchor="middle">`, p.x, p.y, font)
+	if a.Isotope != 0 {
+		fmt.Fprintf(&d.sb, `<tspan dy="-0.4em" font-size="70%%">%d</tspan><tspan dy="0.4em">%s</tspan>`, a.Isotope, html.EscapeString(a.Symbol))
+	} else {
+		d.sb.WriteString(html.EscapeString(a.Symbol))
+	}
+	d.sb.WriteString("</text>")
+
+	var right strings.Builder
+	if hs > 0 {
+		h := "H"
+		if hs > 1 {
+			h += fmt.Sprintf(`<tspan dy="0.3em" font-size="70%%">%d</tspan><tspan dy="-0.3em"></tspan>`, hs)
+		}
+		if hLeft {
+			fmt.Fprintf(&d.sb, `<text x="%.1f" y="%.1f" %s text-anchor="end">%s</text>`, p.x-symW/2, p.y, font, h)
+		} else {
+			right.WriteString(h)
+		}
+	}
+	if a.Charge != 0 {
+		fmt.Fprintf(&right, `<tspan dy="-0.4em" font-size="70%%">%s</tspan>`, charge(a.Charge))
+	}
+	if right.Len() > 0 {
+		fmt.Fprintf(&d.sb, `<text x="%.1f" y="%.1f" %s text-anchor="start">%s</text>`, p.x+symW/2, p.y, font, right.String())
+	}
+}
+
+// charge 回傳電荷的標示，例如 +、2−
+func charge(q int) string {
+	s := "+"
+	if q < 0 {
+		s, q = "−", -q
+	}
+	if q > 1 {
+		return fmt.Sprint(q) + s
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package depict
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+func TestSVGZincFixture(t *testing.T) {
+	mols, err := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := SVG(mols[0], Options{})
+	if !strings.HasPrefix(svg, "<svg ") || !strings.Contains(svg, "<title>ZINC000014418328</title>") {
+		t.Fatalf("svg = %s", svg)
+	}
+	// 兩個楔形鍵、三個虛線鍵（每個 7 條橫線），碳原子不加標籤
+	if n := strings.Count(svg, "<polygon"); n != 2 {
+		t.Errorf("%d wedges, want 2", n)
+	}
+	if n := strings.Count(svg, ">N</text>"); n != 1 {
+		t.Errorf("%d N labels", n)
+	}
+	if n := strings.Count(svg, ">O</text>"); n != 5 {
+		t.Errorf("%d O labels", n)
+	}
+	if strings.Contains(svg, ">C</text>") {
+		t.Error("carbon atoms are labelled")
+	}
+	if !strings.Contains(svg, `H<tspan dy="0.3em" font-size="70%">2</tspan>`) {
+		t.Error("NH2 label missing")
+	}
+	if n := strings.Count(svg, "<line"); n < 3*7 {
+		t.Errorf("%d lines", n)
+	}
+}
+
+// hexagon 建立一個邊長 1.5 的正六邊形環，第 0–1 個鍵為雙鍵
+func hexagon() *mol.Molecule {
+	m := &mol.Molecule{}
+	for k := 0; k < 6; k++ {
+		a := float64(k) * math.Pi / 3
+		m.Atoms = append(m.Atoms, mol.Atom{Symbol: "C", X: 1.5 * math.Cos(a), Y: 1.5 * math.Sin(a)})
+		m.Bonds = append(m.Bonds, mol.Bond{Begin: k, End: (k + 1) % 6, Order: mol.Single})
+	}
+	m.Bonds[0].Order = mol.Double
+	return m
+}
+
+func TestDoubleBondInsideRing(t *testing.T) {
+	m := hexagon()
+	d := &drawing{m: m, opt: Options{}.withDefaults()}
+	if msg := d.layout(); msg != "" {
+		t.Fatal(msg)
+	}
+	b := m.Bonds[0]
+	p, q := d.pos[b.Begin], d.pos[b.End]
+	dir := q.sub(p)
+	normal := point{-dir.y / dir.length(), dir.x / dir.length()}
+	side := d.doubleSide(0, normal)
+	center := point{float64(d.opt.Width) / 2, float64(d.opt.Height) / 2}
+	if side == 0 || dot(center.sub(p), normal.scale(side)) <= 0 {
+		t.Errorf("second line of a ring double bond is drawn outside the ring (side %v)", side)
+	}
+	// 鍵長上限：小分子不會被放大到填滿整張圖
+	if math.Abs(d.bondPx-d.opt.BondLength) > 1e-6 {
+		t.Errorf("bond length %.2f px, want %.2f", d.bondPx, d.opt.BondLength)
+	}
+
+	// 末端的 C=O 對稱畫在兩側
+	m.Atoms = append(m.Atoms, mol.Atom{Symbol: "O", X: 3, Y: 0})
+	m.Bonds = append(m.Bonds, mol.Bond{Begin: 0, End: 6, Order: mol.Double})
+	m.Bonds[0].Order = mol.Single
+	d = &drawing{m: m, opt: Options{}.withDefaults()}
+	d.layout()
+	if side := d.doubleSide(6, point{0, 1}); side != 0 {
+		t.Errorf("terminal C=O drawn on side %v", side)
+	}
+}
+
+func TestChargeAndNoCoordinates(t *testing.T) {
+	// 甲基銨：N 帶一個正電荷與三個氫
+	m := &mol.Molecule{
+		Atoms: []mol.Atom{{Symbol: "C"}, {Symbol: "N", X: 1.5, Charge: 1}},
+		Bonds: []mol.Bond{{Begin: 0, End: 1, Order: mol.Single}},
+	}
+	svg := SVG(m, Options{})
+	if !strings.Contains(svg, `font-size="70%">3</tspan>`) || !strings.Contains(svg, `font-size="70%">+</tspan>`) {
+		t.Errorf("NH3+ label missing: %s", svg)
+	}
+	if !strings.Contains(svg, ">N</text>") || strings.Contains(svg, ">C</text>") {
+		t.Errorf("labels: %s", svg)
+	}
+	if charge(-2) != "2−" || charge(1) != "+" {
+		t.Errorf("charge labels %q %q", charge(-2), charge(1))
+	}
+
+	m.Atoms[1].X = 0
+	if svg := SVG(m, Options{}); !strings.Contains(svg, "no 2D coordinates") {
+		t.Errorf("svg without coordinates = %s", svg)
+	}
+}
+
+func TestWriteGallery(t *testing.T) {
+	items := []Item{
+		{ID: "ZINC000000000001", Caption: "AA:2 <maxmin>", Molecule: hexagon()},
+		{ID: "ZINC000000000002"},
+	}
+	var b bytes.Buffer
+	if err := WriteGallery(&b, "Sampled", items, Options{Width: 200, Height: 200}); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, want := range []string{"<svg ", "ZINC000000000001", "AA:2 &lt;maxmin&gt;", "not downloaded", "2 molecules, 1 without a structure", "minmax(200px"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("gallery lacks %q", want)
+		}
+	}
+}
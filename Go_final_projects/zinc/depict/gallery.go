@@ -0,0 +1,90 @@
+package depict
+
+import (
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+// Item 是藝廊中的一格
+type Item struct {
+	ID       string
+	Caption  string        // 顯示在 ID 下方，例如挑選時的條件
+	Molecule *mol.Molecule // nil 表示還沒有結構（尚未下載或下載失敗）
+}
+
+// LoadItems 從下載目錄讀取每個 ID 的 <id>.sdf；captions 以 ID 為索引，可以為 nil。
+// 讀不到的檔案留下沒有結構的格子，不會中斷整個藝廊。
+func LoadItems(dir string, ids []string, captions map[string]string) []Item {
+	items := make([]Item, len(ids))
+	for i, id := range ids {
+		items[i] = Item{ID: id, Caption: captions[id]}
+		if mols, err := sdf.ReadFile(filepath.Join(dir, id+".sdf")); err == nil && len(mols) > 0 {
+			items[i].Molecule = mols[0]
+		} else if err != nil && !os.IsNotExist(err) {
+			items[i].Caption += " (unreadable)"
+		}
+	}
+	return items
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        h1 { text-align: center; }
+        .grid { display: grid; grid-template-columns: repeat(auto-fill, minmax({{.Width}}px, 1fr)); gap: 12px; }
+        figure { margin: 0; padding: 6px; border: 1px solid #ccc; text-align: center; }
+        figcaption { font-size: 14px; }
+        .caption { color: #666; font-size: 12px; }
+        .missing { display: flex; align-items: center; justify-content: center; height: {{.Height}}px; color: #999; }
+    </style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Items}} molecules, {{.Missing}} without a structure.</p>
+<div class="grid">
+{{- range .Items}}
+    <figure>
+        {{if .SVG}}{{.SVG}}{{else}}<div class="missing">not downloaded</div>{{end}}
+        <figcaption>{{.ID}}{{if .Caption}}<br><span class="caption">{{.Caption}}</span>{{end}}</figcaption>
+    </figure>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// WriteGallery 把 items 寫成以格狀排列的 HTML 頁面，每格是分子的 SVG 與 ZINC ID
+func WriteGallery(w io.Writer, title string, items []Item, opt Options) error {
+	opt = opt.withDefaults()
+	type cell struct {
+		ID, Caption string
+		SVG         template.HTML
+	}
+	data := struct {
+		Title         string
+		Width, Height int
+		Missing       int
+		Items         []cell
+	}{Title: title, Width: opt.Width, Height: opt.Height}
+	for _, it := range items {
+		c := cell{ID: it.ID, Caption: it.Caption}
+		if it.Molecule != nil {
+			// SVG 中的文字都已經跳脫過
+			c.SVG = template.HTML(SVG(it.Molecule, opt))
+		} else {
+			data.Missing++
+		}
+		data.Items = append(data.Items, c)
+	}
+	return galleryTemplate.Execute(w, data)
+}
@@ -0,0 +1,341 @@
+package descriptor
+
+import "zinc/mol"
+
+// Wildman 與 Crippen（1999）原子類型的 logP 貢獻值。
+// 這裡實作 ZINC 類藥分子常見的類型，少見的類型歸到各元素的預設類型（CS、NS、OS），
+// 所以結果是 Crippen 風格的近似值。
+var crippenLogP = map[string]float64{
+	"C1": 0.1441, "C2": 0.0000, "C3": -0.2035, "C4": -0.2051, "C5": -0.2783,
+	"C6": 0.1551, "C7": 0.00170, "C8": 0.08452, "C9": -0.1444, "C10": -0.0516,
+	"C11": 0.1193, "C12": -0.0967, "C13": -0.5443, "C14": 0.0000, "C15": 0.2450,
+	"C16": 0.1980, "C17": 0.0000, "C18": 0.1581, "C19": 0.2955, "C20": 0.2713,
+	"C21": 0.1360, "C22": 0.4619, "C23": 0.5437, "C24": 0.1893, "C25": -0.8186,
+	"C26": 0.2640, "C27": 0.2148, "CS": 0.08129,
+	"H1": 0.1230, "H2": -0.2677, "H3": 0.2142, "H4": 0.2980, "HS": 0.1125,
+	"N1": -1.0190, "N2": -0.7096, "N3": -1.0270, "N4": -0.5188, "N5": 0.08387,
+	"N6": -0.3187, "N7": -0.4458, "N8": 0.2578, "N9": 0.01508, "N10": -1.9500,
+	"N11": -0.3239, "N12": -0.1060, "N13": -0.3396, "N14": 0.2887, "NS": -0.4806,
+	"O1": 0.1552, "O2": -0.2893, "O3": -0.0684, "O4": -0.4195, "O5": 0.0335,
+	"O6": -0.3339, "O7": -1.1890, "O8": 0.1788, "O9": -0.1526, "O10": 0.1129,
+	"O11": 0.4833, "O12": -1.3260, "OS": -0.1188,
+	"F": 0.4202, "Cl": 0.6895, "Br": 0.8456, "I": 0.8857, "Hal": -2.9960,
+	"P": 0.8612, "S1": 0.6482, "S2": -0.0024, "S3": 0.6237,
+	"Me1": -0.3808, "Me2": -0.0025,
+}
+
+// crippenLogP 加總每個原子與其氫的貢獻
+func (c *context) crippenLogP() float64 {
+	total := 0.0
+	for i, a := range c.m.Atoms {
+		if a.Symbol == "H" {
+			// 圖中的氫原子由相連的重原子決定類型
+			continue
+		}
+		total += crippenLogP[c.atomType(i)]
+		total += float64(c.hcount[i]) * crippenLogP[c.hydrogenType(i)]
+	}
+	return total
+}
+
+// neighborInfo 整理原子 i 的重原子鄰居
+type neighborInfo struct {
+	aromatic   int // 芳香鄰居數
+	aliphaticC int // 脂肪族碳鄰居數
+	hetero     int // 脂肪族 N、O、P、S 或鹵素鄰居數
+	other      int // 其他脂肪族鄰居（B、Si、Se...）
+	double     []int
+	triple     bool
+	exoDouble  []int // 芳香原子的環外雙鍵鄰居
+}
+
+func (c *context) neighbors(i int) neighborInfo {
+	var n neighborInfo
+	for _, e := range c.heavyNeighbors(i) {
+		other := c.m.Atoms[e.Atom]
+		order := c.order(e.Bond)
+		switch order {
+		case mol.Double:
+			n.double = append(n.double, e.Atom)
+			if c.aromatic[i] {
+				n.exoDouble = append(n.exoDouble, e.Atom)
+			}
+		case mol.Triple:
+			n.triple = true
+		}
+		switch {
+		case c.aromatic[e.Atom]:
+			n.aromatic++
+		case other.Symbol == "C":
+			n.aliphaticC++
+		case isCrippenHetero(other.Symbol):
+			n.hetero++
+		default:
+			n.other++
+		}
+	}
+	return n
+}
+
+func isCrippenHetero(symbol string) bool {
+	switch symbol {
+	case "N", "O", "P", "S", "F", "Cl", "Br", "I":
+		return true
+	}
+	return false
+}
+
+// atomType 回傳重原子 i 的 Crippen 類型
+func (c *context) atomType(i int) string {
+	a := c.m.Atoms[i]
+	h := c.hcount[i]
+	n := c.neighbors(i)
+
+	switch a.Symbol {
+	case "C":
+		if c.aromatic[i] {
+			return c.aromaticCarbonType(i, n)
+		}
+		switch {
+		case n.triple:
+			return "C7"
+		case len(n.double) > 0:
+			for _, j := range n.double {
+				if c.m.Atoms[j].Symbol != "C" {
+					return "C5"
+				}
+			}
+			if n.aromatic > 0 {
+				return "C26"
+			}
+			return "C6"
+		case n.aromatic > 0:
+			switch h {
+			case 3:
+				for _, e := range c.heavyNeighbors(i) {
+					if c.m.Atoms[e.Atom].Symbol != "C" {
+						return "C9"
+					}
+				}
+				return "C8"
+			case 2:
+				return "C10"
+			case 1:
+				return "C11"
+			}
+			return "C12"
+		case n.hetero > 0:
+			if h >= 2 {
+				return "C3"
+			}
+			return "C4"
+		case n.other > 0:
+			return "C27"
+		case h >= 2:
+			return "C1"
+		}
+		return "C2"
+
+	case "N":
+		if c.aromatic[i] {
+			if a.Charge == 0 {
+				return "N11"
+			}
+			return "N12"
+		}
+		if a.Charge > 0 {
+			if h > 0 {
+				return "N10"
+			}
+			return "N13"
+		}
+		if a.Charge < 0 {
+			return "N14"
+		}
+		if n.triple {
+			return "N9"
+		}
+		if len(n.double) > 0 {
+			return "NS"
+		}
+		switch h {
+		case 2:
+			if n.aromatic > 0 {
+				return "N3"
+			}
+			return "N1"
+		case 1:
+			switch n.aromatic {
+			case 0:
+				return "N2"
+			case 1:
+				return "N4"
+			}
+			return "N5"
+		case 0:
+			switch n.aromatic {
+			case 0:
+				return "N6"
+			case 1:
+				return "N7"
+			}
+			return "N8"
+		}
+		return "NS"
+
+	case "O":
+		if c.aromatic[i] {
+			return "O1"
+		}
+		if a.Charge < 0 {
+			for _, e := range c.heavyNeighbors(i) {
+				switch c.m.Atoms[e.Atom].Symbol {
+				case "N":
+					return "O5"
+				case "S":
+					return "O6"
+				case "C":
+					if c.doubleTo(e.Atom, "O") >= 0 {
+						return "O12"
+					}
+				}
+			}
+			return "O7"
+		}
+		if h > 0 {
+			return "O2"
+		}
+		if len(n.double) == 1 {
+			j := n.double[0]
+			switch {
+			case c.m.Atoms[j].Symbol == "N" || c.m.Atoms[j].Symbol == "O":
+				return "O5"
+			case c.m.Atoms[j].Symbol != "C":
+				return "OS"
+			case c.aromatic[j]:
+				return "O8"
+			}
+			jn := c.neighbors(j)
+			switch {
+			case jn.aromatic > 0:
+				return "O10"
+			case jn.aliphaticC > 0 || c.hcount[j] > 0:
+				return "O9"
+			}
+			return "O11"
+		}
+		if n.aromatic > 0 {
+			return "O4"
+		}
+		return "O3"
+
+	case "S":
+		switch {
+		case c.aromatic[i]:
+			return "S3"
+		case a.Charge != 0:
+			return "S2"
+		}
+		return "S1"
+
+	case "F", "Cl", "Br", "I":
+		if a.Charge != 0 {
+			return "Hal"
+		}
+		return a.Symbol
+
+	case "P":
+		return "P"
+
+	case "B", "Si", "Se", "As", "Te", "Ge":
+		return "Me2"
+	}
+	return "Me1"
+}
+
+func (c *context) aromaticCarbonType(i int, n neighborInfo) string {
+	for _, e := range c.heavyNeighbors(i) {
+		if c.aroBond[e.Bond] {
+			continue
+		}
+		switch c.m.Atoms[e.Atom].Symbol {
+		case "F":
+			return "C14"
+		case "Cl":
+			return "C15"
+		case "Br":
+			return "C16"
+		case "I":
+			return "C17"
+		}
+	}
+	if c.hcount[i] > 0 {
+		return "C18"
+	}
+	aromaticBonds := 0
+	for _, e := range c.heavyNeighbors(i) {
+		if c.aroBond[e.Bond] {
+			aromaticBonds++
+		}
+	}
+	if aromaticBonds >= 3 {
+		return "C19"
+	}
+	if len(n.exoDouble) > 0 {
+		return "C25"
+	}
+	for _, e := range c.heavyNeighbors(i) {
+		if c.aroBond[e.Bond] {
+			continue
+		}
+		other := c.m.Atoms[e.Atom]
+		switch {
+		case c.aromatic[e.Atom]:
+			return "C20"
+		case other.Symbol == "C":
+			return "C21"
+		case other.Symbol == "N":
+			return "C22"
+		case other.Symbol == "O":
+			return "C23"
+		case other.Symbol == "S":
+			return "C24"
+		default:
+			return "C13"
+		}
+	}
+	return "CS"
+}
+
+// hydrogenType 回傳連在原子 i 上的氫的 Crippen 類型
+func (c *context) hydrogenType(i int) string {
+	switch c.m.Atoms[i].Symbol {
+	case "C":
+		return "H1"
+	case "N":
+		return "H3"
+	case "O":
+		for _, e := range c.heavyNeighbors(i) {
+			other := c.m.Atoms[e.Atom]
+			switch other.Symbol {
+			case "N":
+				return "H3"
+			case "O", "S":
+				return "H4"
+			case "C":
+				// 羧酸與烯醇的 O-H
+				if !c.aromatic[e.Atom] {
+					for _, e2 := range c.adj[e.Atom] {
+						if c.order(e2.Bond) == mol.Double {
+							return "H4"
+						}
+					}
+				}
+			}
+		}
+		return "H2"
+	case "H":
+		return "H1"
+	}
+	return "H2"
+}
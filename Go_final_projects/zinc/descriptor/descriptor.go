@@ -0,0 +1,268 @@
+// Package descriptor 計算分子描述符：分子式、分子量、氫鍵供體/受體、
+// 可旋轉鍵、環數、TPSA 與 Crippen logP。
+package descriptor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zinc/mol"
+)
+
+// Descriptors 是一個分子的描述符
+type Descriptors struct {
+	Formula          string  `json:"formula"`
+	MolecularWeight  float64 `json:"mw"`         // 平均分子量
+	MonoisotopicMass float64 `json:"exact_mass"` // 單一同位素質量
+	HeavyAtoms       int     `json:"heavy_atoms"`
+	HBondDonors      int     `json:"hbd"` // Lipinski：N-H 與 O-H 的氫數
+	HBondAcceptors   int     `json:"hba"` // Lipinski：N 與 O 原子數
+	RotatableBonds   int     `json:"rotatable_bonds"`
+	Rings            int     `json:"rings"`
+	TPSA             float64 `json:"tpsa"`
+	LogP             float64 `json:"logp"`
+}
+
+// Compute 計算分子的所有描述符，不會修改 m
+func Compute(m *mol.Molecule) Descriptors {
+	c := newContext(m)
+	var d Descriptors
+	d.Formula = Formula(m)
+	d.MolecularWeight, d.MonoisotopicMass = masses(m)
+	for i, a := range m.Atoms {
+		if a.IsHeavy() {
+			d.HeavyAtoms++
+		}
+		switch a.Symbol {
+		case "N", "O":
+			d.HBondAcceptors++
+			d.HBondDonors += c.hcount[i]
+		}
+	}
+	d.RotatableBonds = c.rotatableBonds()
+	d.Rings = m.NumRings()
+	d.TPSA = c.tpsa()
+	d.LogP = c.crippenLogP()
+	return d
+}
+
+// context 保存計算過程中會重複用到的圖資訊
+type context struct {
+	m         *mol.Molecule
+	adj       [][]mol.Edge
+	hcount    []int
+	aromatic  []bool // 原子是否芳香
+	aroBond   []bool // 鍵是否芳香
+	ringBond  []bool
+	ring3Atom []bool // 原子是否在三元環上
+}
+
+func newContext(m *mol.Molecule) *context {
+	c := &context{m: m, adj: m.Adjacency(), ringBond: m.RingBonds()}
+	c.aromatic, c.aroBond = m.Aromaticity()
+	c.hcount = make([]int, len(m.Atoms))
+	c.ring3Atom = make([]bool, len(m.Atoms))
+	for i := range m.Atoms {
+		c.hcount[i] = m.HydrogenCount(i)
+		for _, e1 := range c.adj[i] {
+			for _, e2 := range c.adj[i] {
+				if e1.Atom < e2.Atom && m.BondBetween(e1.Atom, e2.Atom) >= 0 {
+					c.ring3Atom[i] = true
+				}
+			}
+		}
+	}
+	return c
+}
+
+// order 回傳鍵級，芳香鍵回傳 mol.Aromatic
+func (c *context) order(bond int) int {
+	if c.aroBond[bond] {
+		return mol.Aromatic
+	}
+	return c.m.Bonds[bond].Order
+}
+
+// Formula 以 Hill 順序回傳分子式，帶電時在最後加上淨電荷
+func Formula(m *mol.Molecule) string {
+	counts := make(map[string]int)
+	charge := 0
+	for i, a := range m.Atoms {
+		counts[a.Symbol]++
+		counts["H"] += m.ImplicitHydrogens(i) + a.ExplicitH
+		charge += a.Charge
+	}
+	if counts["H"] == 0 {
+		delete(counts, "H")
+	}
+
+	var symbols []string
+	for s := range counts {
+		if _, hasC := counts["C"]; hasC && (s == "C" || s == "H") {
+			continue
+		}
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	if _, hasC := counts["C"]; hasC {
+		symbols = append([]string{"C", "H"}, symbols...)
+	}
+
+	var sb strings.Builder
+	for _, s := range symbols {
+		n, ok := counts[s]
+		if !ok {
+			continue
+		}
+		sb.WriteString(s)
+		if n > 1 {
+			fmt.Fprint(&sb, n)
+		}
+	}
+	switch {
+	case charge == 1:
+		sb.WriteString("+")
+	case charge == -1:
+		sb.WriteString("-")
+	case charge > 1:
+		fmt.Fprintf(&sb, "+%d", charge)
+	case charge < -1:
+		fmt.Fprintf(&sb, "-%d", -charge)
+	}
+	return sb.String()
+}
+
+// masses 回傳平均分子量與單一同位素質量
+func masses(m *mol.Molecule) (average, mono float64) {
+	h, _ := mol.LookupElement("H")
+	for i, a := range m.Atoms {
+		e, ok := mol.LookupElement(a.Symbol)
+		if ok {
+			if a.Isotope != 0 {
+				average += mol.IsotopeMass(a.Symbol, a.Isotope)
+				mono += mol.IsotopeMass(a.Symbol, a.Isotope)
+			} else {
+				average += e.Mass
+				mono += e.MonoMass
+			}
+		}
+		nh := float64(m.ImplicitHydrogens(i) + a.ExplicitH)
+		average += nh * h.Mass
+		mono += nh * h.MonoMass
+	}
+	// 每個正電荷少一個電子
+	const electron = 0.000548579909
+	charge := 0
+	for _, a := range m.Atoms {
+		charge += a.Charge
+	}
+	mono -= float64(charge) * electron
+	return average, mono
+}
+
+// rotatableBonds 計算可旋轉鍵：不在環上的單鍵，兩端都至少有兩個重原子鄰居，
+// 不含醯胺 C-N 鍵與連到三鍵原子的鍵
+func (c *context) rotatableBonds() int {
+	n := 0
+	for bi, b := range c.m.Bonds {
+		if c.order(bi) != mol.Single || c.ringBond[bi] {
+			continue
+		}
+		if c.m.HeavyDegree(b.Begin) < 2 || c.m.HeavyDegree(b.End) < 2 {
+			continue
+		}
+		if c.hasTriple(b.Begin) || c.hasTriple(b.End) {
+			continue
+		}
+		if c.isAmide(b.Begin, b.End) || c.isAmide(b.End, b.Begin) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func (c *context) hasTriple(i int) bool {
+	for _, e := range c.adj[i] {
+		if c.order(e.Bond) == mol.Triple {
+			return true
+		}
+	}
+	return false
+}
+
+// isAmide 判斷 carbon-nitrogen 是否為醯胺鍵 C(=O)-N
+func (c *context) isAmide(carbon, nitrogen int) bool {
+	if c.m.Atoms[carbon].Symbol != "C" || c.m.Atoms[nitrogen].Symbol != "N" {
+		return false
+	}
+	return c.doubleTo(carbon, "O") >= 0
+}
+
+// doubleTo 回傳以雙鍵連到原子 i 的指定元素原子，沒有則回傳 -1
+func (c *context) doubleTo(i int, symbol string) int {
+	for _, e := range c.adj[i] {
+		if c.order(e.Bond) == mol.Double && c.m.Atoms[e.Atom].Symbol == symbol {
+			return e.Atom
+		}
+	}
+	return -1
+}
+
+// heavyNeighbors 回傳原子 i 的重原子鄰居
+func (c *context) heavyNeighbors(i int) []mol.Edge {
+	var out []mol.Edge
+	for _, e := range c.adj[i] {
+		if c.m.Atoms[e.Atom].IsHeavy() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Fields 把描述符轉成 SD 資料欄位
+func (d Descriptors) Fields() []mol.Field {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	return []mol.Field{
+		{Name: "formula", Value: d.Formula},
+		{Name: "mw", Value: f(d.MolecularWeight)},
+		{Name: "exact_mass", Value: f(d.MonoisotopicMass)},
+		{Name: "heavy_atoms", Value: strconv.Itoa(d.HeavyAtoms)},
+		{Name: "hbd", Value: strconv.Itoa(d.HBondDonors)},
+		{Name: "hba", Value: strconv.Itoa(d.HBondAcceptors)},
+		{Name: "rotatable_bonds", Value: strconv.Itoa(d.RotatableBonds)},
+		{Name: "rings", Value: strconv.Itoa(d.Rings)},
+		{Name: "tpsa", Value: f(d.TPSA)},
+		{Name: "logp", Value: f(d.LogP)},
+	}
+}
+
+// Names 是 Value 可以查詢的數值描述符名稱，與 JSON 欄位名稱相同
+var Names = []string{"mw", "exact_mass", "heavy_atoms", "hbd", "hba", "rotatable_bonds", "rings", "tpsa", "logp"}
+
+// Value 依名稱（JSON 欄位名稱，例如 mw、logp）回傳數值描述符
+func (d Descriptors) Value(name string) (float64, bool) {
+	switch name {
+	case "mw":
+		return d.MolecularWeight, true
+	case "exact_mass":
+		return d.MonoisotopicMass, true
+	case "heavy_atoms":
+		return float64(d.HeavyAtoms), true
+	case "hbd":
+		return float64(d.HBondDonors), true
+	case "hba":
+		return float64(d.HBondAcceptors), true
+	case "rotatable_bonds":
+		return float64(d.RotatableBonds), true
+	case "rings":
+		return float64(d.Rings), true
+	case "tpsa":
+		return d.TPSA, true
+	case "logp":
+		return d.LogP, true
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package descriptor
+
+import (
+	"math"
+	"testing"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+// build 以元素清單與 (begin, end, order) 鍵清單建立分子，省略氫原子
+func build(symbols []string, bonds [][3]int) *mol.Molecule {
+	m := &mol.Molecule{}
+	for _, s := range symbols {
+		m.Atoms = append(m.Atoms, mol.Atom{Symbol: s})
+	}
+	for _, b := range bonds {
+		m.Bonds = append(m.Bonds, mol.Bond{Begin: b[0], End: b[1], Order: b[2]})
+	}
+	return m
+}
+
+func near(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol
+}
+
+func TestComputeZincFixture(t *testing.T) {
+	mols, err := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Compute(mols[0])
+	if d.Formula != "C6H13NO5" {
+		t.Errorf("formula = %s", d.Formula)
+	}
+	if !near(d.MolecularWeight, 179.172, 0.001) || !near(d.MonoisotopicMass, 179.0794, 0.0001) {
+		t.Errorf("masses = %.4f / %.4f", d.MolecularWeight, d.MonoisotopicMass)
+	}
+	if d.HeavyAtoms != 12 || d.HBondDonors != 6 || d.HBondAcceptors != 6 || d.Rings != 1 || d.RotatableBonds != 2 {
+		t.Errorf("counts = %+v", d)
+	}
+	if !near(d.TPSA, 116.17, 0.005) {
+		t.Errorf("TPSA = %.2f, want 116.17", d.TPSA)
+	}
+}
+
+func TestAromaticDescriptors(t *testing.T) {
+	benzene := build([]string{"C", "C", "C", "C", "C", "C"},
+		[][3]int{{0, 1, 2}, {1, 2, 1}, {2, 3, 2}, {3, 4, 1}, {4, 5, 2}, {5, 0, 1}})
+	pyridine := build([]string{"N", "C", "C", "C", "C", "C"},
+		[][3]int{{0, 1, 2}, {1, 2, 1}, {2, 3, 2}, {3, 4, 1}, {4, 5, 2}, {5, 0, 1}})
+	pyrrole := build([]string{"N", "C", "C", "C", "C"},
+		[][3]int{{0, 1, 1}, {1, 2, 2}, {2, 3, 1}, {3, 4, 2}, {4, 0, 1}})
+
+	tests := []struct {
+		name    string
+		m       *mol.Molecule
+		formula string
+		logP    float64
+		tpsa    float64
+	}{
+		{"benzene", benzene, "C6H6", 1.6866, 0},
+		{"pyridine", pyridine, "C5H5N", 1.0816, 12.89},
+		{"pyrrole", pyrrole, "C4H5N", 1.0147, 15.79},
+	}
+	for _, tt := range tests {
+		d := Compute(tt.m)
+		if d.Formula != tt.formula {
+			t.Errorf("%s: formula = %s, want %s", tt.name, d.Formula, tt.formula)
+		}
+		if !near(d.LogP, tt.logP, 0.001) {
+			t.Errorf("%s: logP = %.4f, want %.4f", tt.name, d.LogP, tt.logP)
+		}
+		if !near(d.TPSA, tt.tpsa, 0.001) {
+			t.Errorf("%s: TPSA = %.2f, want %.2f", tt.name, d.TPSA, tt.tpsa)
+		}
+	}
+}
+
+func TestAliphaticLogP(t *testing.T) {
+	ethanol := build([]string{"C", "C", "O"}, [][3]int{{0, 1, 1}, {1, 2, 1}})
+	aceticAcid := build([]string{"C", "C", "O", "O"}, [][3]int{{0, 1, 1}, {1, 2, 2}, {1, 3, 1}})
+	acetonitrile := build([]string{"C", "C", "N"}, [][3]int{{0, 1, 1}, {1, 2, 3}})
+
+	for name, want := range map[*mol.Molecule]float64{ethanol: -0.0014, aceticAcid: 0.0909, acetonitrile: 0.5299} {
+		if got := Compute(name).LogP; !near(got, want, 0.001) {
+			t.Errorf("logP of %s = %.4f, want %.4f", Formula(name), got, want)
+		}
+	}
+}
+
+func TestChargedFormula(t *testing.T) {
+	ammonium := build([]string{"N"}, nil)
+	ammonium.Atoms[0].Charge = 1
+	if got := Formula(ammonium); got != "H4N+" {
+		t.Errorf("formula = %s, want H4N+", got)
+	}
+}
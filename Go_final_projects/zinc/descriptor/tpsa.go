@@ -0,0 +1,157 @@
+package descriptor
+
+import "zinc/mol"
+
+// bondPattern 統計一個原子連到重原子的各種鍵
+type bondPattern struct {
+	single, double, triple, aromatic int
+}
+
+func (c *context) pattern(i int) bondPattern {
+	var p bondPattern
+	for _, e := range c.heavyNeighbors(i) {
+		switch c.order(e.Bond) {
+		case mol.Double:
+			p.double++
+		case mol.Triple:
+			p.triple++
+		case mol.Aromatic:
+			p.aromatic++
+		default:
+			p.single++
+		}
+	}
+	return p
+}
+
+// tpsa 依 Ertl 等人（2000）的片段貢獻計算拓撲極性表面積，只計入 N 與 O
+func (c *context) tpsa() float64 {
+	total := 0.0
+	for i, a := range c.m.Atoms {
+		switch a.Symbol {
+		case "N":
+			total += c.nitrogenPSA(i)
+		case "O":
+			total += c.oxygenPSA(i)
+		}
+	}
+	return total
+}
+
+func (c *context) nitrogenPSA(i int) float64 {
+	a := c.m.Atoms[i]
+	p := c.pattern(i)
+	h := c.hcount[i]
+
+	if p.aromatic > 0 {
+		switch {
+		case a.Charge == 0 && h == 0 && p.aromatic == 2 && p.single == 0 && p.double == 0:
+			return 12.89
+		case a.Charge == 0 && h == 0 && p.aromatic == 3:
+			return 4.41
+		case a.Charge == 0 && h == 0 && p.aromatic == 2 && p.single == 1:
+			return 4.93
+		case a.Charge == 0 && h == 0 && p.aromatic == 2 && p.double == 1:
+			return 8.39
+		case a.Charge == 0 && h == 1 && p.aromatic == 2:
+			return 15.79
+		case a.Charge == 1 && h == 0 && p.aromatic == 3:
+			return 4.10
+		case a.Charge == 1 && h == 0 && p.aromatic == 2 && p.single == 1:
+			return 3.88
+		case a.Charge == 1 && h == 1 && p.aromatic == 2:
+			return 14.14
+		case a.Charge == 1 && h == 0 && p.aromatic == 2 && p.double == 1:
+			return 1.52
+		}
+		return 0
+	}
+
+	switch a.Charge {
+	case 0:
+		switch {
+		case h == 0 && p.single == 3:
+			if c.ring3Atom[i] {
+				return 3.01
+			}
+			return 3.24
+		case h == 0 && p.single == 1 && p.double == 1:
+			return 12.36
+		case h == 0 && p.triple == 1:
+			return 23.79
+		case h == 0 && p.single == 1 && p.double == 2:
+			return 11.68
+		case h == 0 && p.double == 1 && p.triple == 1:
+			return 13.60
+		case h == 1 && p.single == 2:
+			if c.ring3Atom[i] {
+				return 21.94
+			}
+			return 12.03
+		case h == 1 && p.double == 1:
+			return 23.85
+		case h == 2 && p.single == 1:
+			return 26.02
+		case h == 3 && p.single == 0:
+			return 23.79 // 氨
+		}
+	case 1:
+		switch {
+		case h == 0 && p.single == 4:
+			return 0.00
+		case h == 0 && p.single == 2 && p.double == 1:
+			return 3.01
+		case h == 0 && p.single == 1 && p.triple == 1:
+			return 4.36
+		case h == 1 && p.single == 3:
+			return 4.44
+		case h == 1 && p.single == 1 && p.double == 1:
+			return 13.97
+		case h == 2 && p.single == 2:
+			return 16.61
+		case h == 2 && p.double == 1:
+			return 25.59
+		case h == 3 && p.single == 1:
+			return 27.64
+		case h == 0 && p.double == 2:
+			return 4.36 // 疊氮中間的 N
+		}
+	case -1:
+		switch {
+		case h == 0 && p.double == 1:
+			return 14.01 // 疊氮末端的 N-
+		case h == 0 && p.single == 2:
+			return 14.01
+		}
+	}
+	return 0
+}
+
+func (c *context) oxygenPSA(i int) float64 {
+	a := c.m.Atoms[i]
+	p := c.pattern(i)
+	h := c.hcount[i]
+
+	if p.aromatic > 0 {
+		if a.Charge == 0 && h == 0 && p.aromatic == 2 {
+			return 13.14
+		}
+		return 0
+	}
+	switch {
+	case a.Charge == 0 && h == 0 && p.single == 2:
+		if c.ring3Atom[i] {
+			return 12.53
+		}
+		return 9.23
+	case a.Charge == 0 && h == 0 && p.double == 1:
+		return 17.07
+	case a.Charge == 0 && h == 1 && p.single == 1:
+		return 20.23
+	case a.Charge == 0 && h == 2 && p.single == 0:
+		return 20.23 // 水
+	case a.Charge == -1 && h == 0 && p.single == 1:
+		return 23.06
+	}
+	return 0
+}
@@ -0,0 +1,311 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultCachePath 是各專案共用的下載快取（相對於專案目錄），可以用環境變數 ZINC_CACHE 覆寫
+const DefaultCachePath = "../zinc_cache"
+
+// CachePath 回傳快取位置：環境變數 ZINC_CACHE，沒有設定時為 fallback
+func CachePath(fallback string) string {
+	if p := os.Getenv("ZINC_CACHE"); p != "" {
+		return p
+	}
+	return fallback
+}
+
+// ErrNotCached 表示快取中沒有這個檔案，或記錄的內容檔已經不存在
+var ErrNotCached = errors.New("not in cache")
+
+// Key 識別快取中的一個檔案
+type Key struct {
+	ZincID  string `json:"zinc_id"`
+	Version string `json:"version"`
+	Format  string `json:"format"`
+}
+
+func (k Key) String() string { return fmt.Sprintf("%s.%s (ZINC%s)", k.ZincID, k.Format, k.Version) }
+
+// Entry 是快取中一個檔案的記錄。內容依 SHA-256 存在 objects 目錄中，相同的內容只存一份。
+type Entry struct {
+	Key
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// Cache 是以內容定址的下載快取，目錄結構為
+//
+//	<dir>/entries/<version>/<format>/<zinc_id>.json  記錄
+//	<dir>/objects/<sha256 前兩碼>/<sha256>           內容（唯讀）
+//
+// 每個記錄與內容檔都以暫存檔改名寫入，多個專案或行程可以同時使用同一個快取。
+type Cache struct {
+	dir string
+}
+
+// OpenCache 開啟（必要時建立）dir 中的快取
+func OpenCache(dir string) (*Cache, error) {
+	for _, sub := range []string{"entries", "objects"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir 回傳快取的目錄
+func (c *Cache) Dir() string { return c.dir }
+
+func (c *Cache) entryPath(k Key) string {
+	return filepath.Join(c.dir, "entries", k.Version, k.Format, k.ZincID+".json")
+}
+
+func (c *Cache) objectPath(sum string) string {
+	return filepath.Join(c.dir, "objects", sum[:2], sum)
+}
+
+// Lookup 回傳 k 的記錄；沒有記錄、記錄損毀或內容檔的大小不符時回傳 ErrNotCached。
+// 完整的雜湊檢查由 Verify 進行。
+func (c *Cache) Lookup(k Key) (*Entry, error) {
+	data, err := os.ReadFile(c.entryPath(k))
+	if os.IsNotExist(err) {
+		return nil, ErrNotCached
+	} else if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if json.Unmarshal(data, &e) != nil || e.Key != k || len(e.SHA256) != sha256.Size*2 {
+		return nil, ErrNotCached
+	}
+	st, err := os.Stat(c.objectPath(e.SHA256))
+	if err != nil || st.Size() != e.Size {
+		return nil, ErrNotCached
+	}
+	return &e, nil
+}
+
+// Put 檢查 data 是否為 e.Format 格式的有效內容（見 ValidatePayload），通過後存入快取。
+// e 的 SHA256 與 Size 由 data 計算；FetchedAt 為零值時設為現在的時間。
+func (c *Cache) Put(e Entry, data []byte) (*Entry, error) {
+	if e.ZincID == "" || e.Version == "" || e.Format == "" || strings.ContainsAny(e.ZincID+e.Version+e.Format, `/\`) {
+		return nil, fmt.Errorf("invalid cache key %v", e.Key)
+	}
+	if err := ValidatePayload(e.Format, data); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	e.SHA256, e.Size = hex.EncodeToString(sum[:]), int64(len(data))
+	if e.FetchedAt.IsZero() {
+		e.FetchedAt = time.Now().UTC()
+	}
+
+	obj := c.objectPath(e.SHA256)
+	if st, err := os.Stat(obj); err != nil || st.Size() != e.Size {
+		if err := os.MkdirAll(filepath.Dir(obj), 0o755); err != nil {
+			return nil, err
+		}
+		if _, err := writeAtomic(obj, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		// 內容檔會被硬連結到各專案的下載目錄，設為唯讀避免在那裡被修改
+		os.Chmod(obj, 0o444)
+	}
+
+	path := c.entryPath(e.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writeAtomic(path, strings.NewReader(string(meta)+"\n")); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Materialize 把 k 的內容放到 path。link 為 true 時先嘗試硬連結（不佔額外空間），
+// 失敗時（例如跨檔案系統）改為複製；回傳的 linked 表示是否使用了硬連結。
+func (c *Cache) Materialize(k Key, path string, link bool) (e *Entry, linked bool, err error) {
+	if e, err = c.Lookup(k); err != nil {
+		return nil, false, err
+	}
+	obj := c.objectPath(e.SHA256)
+	if link {
+		tmp := fmt.Sprintf("%s.%d.link.tmp", path, time.Now().UnixNano())
+		if os.Link(obj, tmp) == nil {
+			os.Remove(path) // Windows 無法以改名取代唯讀的檔案
+			if err = os.Rename(tmp, path); err == nil {
+				return e, true, nil
+			}
+			os.Remove(tmp)
+		}
+	}
+	f, err := os.Open(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	os.Remove(path)
+	_, err = writeAtomic(path, f)
+	return e, false, err
+}
+
+// MaterializeReport 是一次 MaterializeAll 的結果
+type MaterializeReport struct {
+	Dir     string   `json:"dir"`
+	Linked  int      `json:"linked"`
+	Copied  int      `json:"copied"`
+	Missing []string `json:"missing"` // 快取中沒有的 ID
+}
+
+// MaterializeAll 在 dir 中為 ids 的每個分子放一個 <zinc_id>.<format>，版面與 Run 下載的目錄相同，
+// 讓實驗不需要連線就能重建 set_1。快取中沒有的 ID 列在報告中。
+func (c *Cache) MaterializeAll(ids []string, version, format, dir string, link bool) (*MaterializeReport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	report := &MaterializeReport{Dir: dir, Missing: []string{}}
+	for _, id := range ids {
+		_, linked, err := c.Materialize(Key{id, version, format}, filepath.Join(dir, fileName(id, format)), link)
+		switch {
+		case errors.Is(err, ErrNotCached):
+			report.Missing = append(report.Missing, id)
+		case err != nil:
+			return report, err
+		case linked:
+			report.Linked++
+		default:
+			report.Copied++
+		}
+	}
+	return report, nil
+}
+
+// Eviction 是 Verify 找到的損毀記錄
+type Eviction struct {
+	Key
+	Reason string `json:"reason"`
+}
+
+// VerifyReport 是一次 Verify 的結果
+type VerifyReport struct {
+	Checked int        `json:"checked"`
+	OK      int        `json:"ok"`
+	Corrupt []Eviction `json:"corrupt"`
+	Evicted bool       `json:"evicted"` // 損毀的記錄是否已移除
+	Orphans int        `json:"orphans"` // 不再被任何記錄引用、已刪除的內容檔
+}
+
+// Verify 重新計算每個內容檔的 SHA-256 與大小，並再次檢查內容的格式。
+// evict 為 true 時移除損毀的記錄，以及不再被引用的內容檔與中斷時留下的暫存檔，
+// 之後的下載會重新取得被移除的分子。移除時其他行程不應同時寫入快取，
+// 否則剛寫入、還沒有記錄的內容檔會被當成不再被引用。
+func (c *Cache) Verify(evict bool) (*VerifyReport, error) {
+	report := &VerifyReport{Corrupt: []Eviction{}, Evicted: evict}
+	used := make(map[string]bool)
+	root := filepath.Join(c.dir, "entries")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			if evict {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		report.Checked++
+		e, reason := c.check(root, path)
+		if reason == "" {
+			report.OK++
+			used[e.SHA256] = true
+			return nil
+		}
+		report.Corrupt = append(report.Corrupt, Eviction{Key: e.Key, Reason: reason})
+		if evict {
+			return os.Remove(path)
+		}
+		used[e.SHA256] = true // 只回報時保留內容檔，方便檢查
+		return nil
+	})
+	if err != nil || !evict {
+		return report, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(c.dir, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !used[d.Name()] {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			if !strings.HasSuffix(path, ".tmp") {
+				report.Orphans++
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// check 檢查一個記錄檔；回傳記錄（無法解析時只有由路徑推得的 Key）與損毀的原因
+func (c *Cache) check(root, path string) (*Entry, string) {
+	rel, _ := filepath.Rel(root, path)
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	e := &Entry{}
+	if len(parts) == 3 {
+		e.Key = Key{strings.TrimSuffix(parts[2], ".json"), parts[0], parts[1]}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return e, err.Error()
+	}
+	want := e.Key
+	if err := json.Unmarshal(data, e); err != nil {
+		return e, "unreadable entry: " + err.Error()
+	}
+	if e.Key != want {
+		return e, fmt.Sprintf("entry describes %v but is stored as %v", e.Key, want)
+	}
+	if len(e.SHA256) != sha256.Size*2 {
+		return e, "entry has no SHA-256"
+	}
+	content, err := os.ReadFile(c.objectPath(e.SHA256))
+	if os.IsNotExist(err) {
+		return e, "content missing"
+	} else if err != nil {
+		return e, err.Error()
+	}
+	if int64(len(content)) != e.Size {
+		return e, fmt.Sprintf("content is %d bytes, entry says %d", len(content), e.Size)
+	}
+	if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != e.SHA256 {
+		return e, "SHA-256 mismatch: content hashes to " + hex.EncodeToString(sum[:])
+	}
+	if err := ValidatePayload(e.Format, content); err != nil {
+		return e, err.Error()
+	}
+	return e, ""
+}
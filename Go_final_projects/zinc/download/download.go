@@ -0,0 +1,535 @@
+// Package download 從 ZINC 網站下載分子檔案。下載以固定數量的 worker 進行，每個請求有逾時，
+// 遇到 429 或 5xx 回應時以指數退避重試；檔案先寫入暫存檔再改名，並以狀態檔記錄進度，
+// 中斷後再次執行會從中斷處繼續。各專案可以共用以內容定址的下載快取（見 Cache），
+// 已下載過的分子不必再次連線。
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 預設參數
+const (
+	DefaultWorkers    = 8
+	DefaultTimeout    = 60 * time.Second
+	DefaultMaxRetries = 5
+	DefaultBaseDelay  = time.Second
+	DefaultMaxDelay   = time.Minute
+)
+
+// stateVersion 是狀態檔格式的版本
+const stateVersion = 1
+
+// Options 設定一次下載
+type Options struct {
+	Version string // ZINC 版本，"15" 或 "20"
+	Format  string // 副檔名，例如 "sdf"
+
+	// BaseURL 預設為 https://zinc<Version>.docking.org，測試時可以指向本機伺服器
+	BaseURL string
+	Client  *http.Client
+
+	Workers    int           // 同時進行的下載數
+	Timeout    time.Duration // 單一請求（含讀取內容）的逾時
+	MaxRetries int           // 暫時性錯誤的重試次數，不含第一次嘗試
+	BaseDelay  time.Duration // 第一次重試前的等待時間，之後每次加倍
+	MaxDelay   time.Duration // 單次等待的上限
+
+	// Validate 檢查下載內容是否符合要求的格式，不符合時不寫入檔案並記為失敗；可以為 nil
+	Validate func(data []byte) error
+	// Cache 是共用的下載快取，可以為 nil。快取中已有的分子直接從快取硬連結或複製，
+	// 不發出請求；新下載的內容先存入快取再放到輸出目錄。
+	Cache *Cache
+
+	// Prune 為 true 時，清單改變後刪除上一份清單下載、但不在新清單中的檔案，並列在 Report.Removed。
+	// 預設保留這些檔案（例如上一次挑選的 set_1），之後的清單再包含它們時不需重新下載。
+	Prune bool
+
+	// StatePath 是進度狀態檔，預設為與輸出目錄並排的 <dir>.download.json
+	StatePath string
+	// Logf 記錄每個分子的結果，可以為 nil
+	Logf func(format string, args ...any)
+	// Progress 在每個分子完成、失敗或因先前已完成而略過時依序呼叫一次；中斷時未下載的分子不會呼叫。
+	// 可以為 nil。
+	Progress func(format, id string, it Item)
+}
+
+func (o *Options) setDefaults(outputDir string) {
+	if o.Format == "" {
+		o.Format = "sdf"
+	}
+	if o.BaseURL == "" {
+		o.BaseURL = fmt.Sprintf("https://zinc%s.docking.org", o.Version)
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultBaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultMaxDelay
+	}
+	if o.StatePath == "" {
+		o.StatePath = StatePath(outputDir)
+	}
+	if o.Logf == nil {
+		o.Logf = func(string, ...any) {}
+	}
+}
+
+// StatePath 回傳輸出目錄 dir 的狀態檔位置，例如 set_1 的狀態檔是 set_1.download.json
+func StatePath(dir string) string {
+	dir = filepath.Clean(dir)
+	return filepath.Join(filepath.Dir(dir), filepath.Base(dir)+".download.json")
+}
+
+// Status 是一個分子的下載狀態
+type Status string
+
+const (
+	Pending Status = "pending"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+// Item 是狀態檔中的一個分子
+type Item struct {
+	File     string `json:"file"`
+	Status   Status `json:"status"`
+	Size     int64  `json:"size,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// State 是狀態檔的內容。ListSHA256 是 ID 清單的雜湊，清單改變時會開始新的工作。
+type State struct {
+	Version    int              `json:"version"`
+	ListSHA256 string           `json:"list_sha256"`
+	Items      map[string]*Item `json:"items"`
+}
+
+// Failure 是下載失敗的分子
+type Failure struct {
+	ZincID string `json:"zinc_id"`
+	Error  string `json:"error"`
+}
+
+// Report 是一次下載的結果摘要
+type Report struct {
+	Total      int       `json:"total"`
+	Downloaded int       `json:"downloaded"`
+	Cached     int       `json:"cached"`  // 從快取取得、沒有發出請求的分子
+	Skipped    int       `json:"skipped"` // 先前已完成的分子
+	Failed     []Failure `json:"failed"`
+	Removed    []string  `json:"removed,omitempty"` // 上一份清單留下、已刪除的檔案（只在 Options.Prune 時）
+	// Files 是這份清單已完成的檔案，依清單的順序。輸出目錄中可能還有先前清單留下的檔案，
+	// 合併、篩選與匯出應該只使用這些檔案，而不是整個目錄。
+	Files []string `json:"files"`
+}
+
+// Run 把 ids 中的分子下載到 outputDir。ctx 被取消時停止派發新的下載、
+// 寫回目前的進度並回傳 ctx.Err()；再次以同一份清單呼叫 Run 會略過已完成的分子。
+func Run(ctx context.Context, ids []string, outputDir string, opt Options) (*Report, error) {
+	opt.setDefaults(outputDir)
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	j := &job{opt: opt, dir: outputDir, report: &Report{Total: len(ids)}}
+	j.state = readState(opt.StatePath)
+	if sum := listSHA256(ids); j.state.ListSHA256 != sum {
+		j.startOver(ids, sum)
+	}
+
+	var todo []string
+	queued := make(map[string]bool)
+	for _, id := range ids {
+		if queued[id] {
+			continue
+		}
+		queued[id] = true
+		it := j.state.Items[id]
+		if it == nil {
+			it = &Item{File: fileName(id, opt.Format)}
+			j.state.Items[id] = it
+		}
+		if it.Status == Done && j.complete(it) {
+			j.report.Skipped++
+			if opt.Progress != nil {
+				opt.Progress(opt.Format, id, *it)
+			}
+			continue
+		}
+		it.Status, it.Error = Pending, ""
+		todo = append(todo, id)
+	}
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < opt.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				j.fetch(ctx, id)
+			}
+		}()
+	}
+dispatch:
+	for _, id := range todo {
+		select {
+		case queue <- id:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := j.save(); err != nil {
+		return j.report, err
+	}
+	sort.Slice(j.report.Failed, func(a, b int) bool { return j.report.Failed[a].ZincID < j.report.Failed[b].ZincID })
+	j.mu.Lock()
+	j.report.Files = j.state.Files(outputDir, ids)
+	j.mu.Unlock()
+	return j.report, ctx.Err()
+}
+
+// job 是一次執行的共用狀態，mu 保護 state 與 report
+type job struct {
+	opt    Options
+	dir    string
+	mu     sync.Mutex
+	state  *State
+	report *Report
+	saved  time.Time
+}
+
+// startOver 在清單改變時開始新的工作。上一份清單已完成、但不在新清單中的分子預設保留檔案與記錄，
+// opt.Prune 時刪除檔案；未完成的記錄一律捨棄。
+func (j *job) startOver(ids []string, sum string) {
+	keep := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	items := make(map[string]*Item)
+	for id, it := range j.state.Items {
+		switch {
+		case keep[id]:
+			items[id] = it
+		case it.Status != Done:
+		case j.opt.Prune:
+			path := filepath.Join(j.dir, it.File)
+			if err := os.Remove(path); err == nil {
+				j.report.Removed = append(j.report.Removed, path)
+			}
+		default:
+			items[id] = it
+		}
+	}
+	sort.Strings(j.report.Removed)
+	j.state = &State{Version: stateVersion, ListSHA256: sum, Items: items}
+}
+
+// complete 判斷標記為完成的檔案是否仍然存在，且大小與 SHA-256 都與下載時相同
+func (j *job) complete(it *Item) bool {
+	data, err := os.ReadFile(filepath.Join(j.dir, it.File))
+	if err != nil || int64(len(data)) != it.Size {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return it.SHA256 == "" || hex.EncodeToString(sum[:]) == it.SHA256
+}
+
+// fetch 下載一個分子，暫時性錯誤以指數退避重試
+func (j *job) fetch(ctx context.Context, id string) {
+	url := fmt.Sprintf("%s/substances/%s.%s", strings.TrimRight(j.opt.BaseURL, "/"), id, j.opt.Format)
+	path := filepath.Join(j.dir, fileName(id, j.opt.Format))
+	key := Key{ZincID: id, Version: j.opt.Version, Format: j.opt.Format}
+	if j.opt.Cache != nil {
+		if e, _, err := j.opt.Cache.Materialize(key, path, true); err == nil {
+			j.finish(id, Done, e.Size, e.SHA256, 0, nil)
+			j.opt.Logf("Using cached %s", filepath.Base(path))
+			return
+		}
+	}
+
+	var err error
+	attempts := 0
+	for attempt := 0; attempt <= j.opt.MaxRetries; attempt++ {
+		attempts++
+		var data []byte
+		var meta Entry
+		var retryAfter time.Duration
+		data, meta, retryAfter, err = j.get(ctx, url)
+		if err == nil {
+			meta.Key = key
+			var size int64
+			var sum string
+			if size, sum, err = j.store(path, data, meta); err != nil {
+				break
+			}
+			j.finish(id, Done, size, sum, attempts, nil)
+			j.opt.Logf("Downloaded %s", filepath.Base(path))
+			return
+		}
+		var te *transientError
+		if !errors.As(err, &te) || attempt == j.opt.MaxRetries || ctx.Err() != nil {
+			break
+		}
+		delay := j.backoff(attempt)
+		if retryAfter > delay {
+			delay = min(retryAfter, j.opt.MaxDelay)
+		}
+		j.opt.Logf("Retrying %s in %v: %v", id, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		// 被中斷的分子維持 pending，下次執行再下載
+		j.finish(id, Pending, 0, "", attempts, nil)
+		return
+	}
+	j.finish(id, Failed, 0, "", attempts, err)
+	j.opt.Logf("Failed to download %s: %v", id, err)
+}
+
+// transientError 是值得重試的錯誤：網路錯誤、逾時、429 與 5xx
+type transientError struct{ err error }
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// get 執行一次請求，回傳通過檢查的內容、回應的中繼資料（供快取記錄）與伺服器要求的等待時間（Retry-After）
+func (j *job) get(ctx context.Context, url string) ([]byte, Entry, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, j.opt.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, Entry{}, 0, err
+	}
+	resp, err := j.opt.Client.Do(req)
+	if err != nil {
+		return nil, Entry{}, 0, &transientError{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, Entry{}, retryAfter(resp), &transientError{fmt.Errorf("%s: %s", url, resp.Status)}
+	default:
+		return nil, Entry{}, 0, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		// 讀取內容時逾時或連線中斷也視為暫時性錯誤
+		return nil, Entry{}, 0, &transientError{err}
+	}
+	if j.opt.Validate != nil {
+		if err := j.opt.Validate(data); err != nil {
+			return nil, Entry{}, 0, fmt.Errorf("%s: %v", url, err)
+		}
+	}
+	meta := Entry{
+		URL:          url,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}
+	return data, meta, 0, nil
+}
+
+// store 把下載的內容放到 path，回傳大小與 SHA-256。有快取時先存入快取再硬連結到 path；
+// 快取無法寫入或拒絕內容時記錄原因，仍直接寫到 path。
+func (j *job) store(path string, data []byte, meta Entry) (int64, string, error) {
+	if j.opt.Cache != nil {
+		e, err := j.opt.Cache.Put(meta, data)
+		if err == nil {
+			_, _, err = j.opt.Cache.Materialize(e.Key, path, true)
+		}
+		if err == nil {
+			return e.Size, e.SHA256, nil
+		}
+		j.opt.Logf("Not caching %s: %v", filepath.Base(path), err)
+	}
+	size, err := writeAtomic(path, bytes.NewReader(data))
+	sum := sha256.Sum256(data)
+	return size, hex.EncodeToString(sum[:]), err
+}
+
+// backoff 回傳第 attempt 次失敗後的等待時間：BaseDelay·2^attempt，不超過 MaxDelay
+func (j *job) backoff(attempt int) time.Duration {
+	d := j.opt.BaseDelay
+	for i := 0; i < attempt && d < j.opt.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > j.opt.MaxDelay {
+		d = j.opt.MaxDelay
+	}
+	return d
+}
+
+// retryAfter 解析以秒數表示的 Retry-After 標頭
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// writeAtomic 先寫入同目錄的暫存檔，完整寫完才改名，中斷時不會留下半個檔案
+func writeAtomic(path string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+// finish 記錄一個分子的結果；狀態檔最多每秒寫一次，最後由 Run 寫入完整結果
+func (j *job) finish(id string, status Status, size int64, sum string, attempts int, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	it := j.state.Items[id]
+	it.Status, it.Size, it.SHA256, it.Attempts, it.Error = status, size, sum, attempts, ""
+	switch status {
+	case Done:
+		if attempts == 0 {
+			j.report.Cached++ // 沒有發出請求：內容來自快取
+		} else {
+			j.report.Downloaded++
+		}
+	case Failed:
+		it.Error = err.Error()
+		j.report.Failed = append(j.report.Failed, Failure{ZincID: id, Error: it.Error})
+	}
+	if status != Pending && j.opt.Progress != nil {
+		j.opt.Progress(j.opt.Format, id, *it)
+	}
+	if time.Since(j.saved) >= time.Second {
+		j.saveLocked()
+	}
+}
+
+func (j *job) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.saveLocked()
+}
+
+func (j *job) saveLocked() error {
+	j.saved = time.Now()
+	data, err := json.Marshal(j.state)
+	if err != nil {
+		return err
+	}
+	_, err = writeAtomic(j.opt.StatePath, strings.NewReader(string(data)+"\n"))
+	return err
+}
+
+// LoadState 讀取 Run 寫出的狀態檔
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("%s: unsupported state version %d", path, s.Version)
+	}
+	return &s, nil
+}
+
+// Files 回傳 ids 中已下載完成的分子在 dir 中的檔案，依 ids 的順序，重複的 ID 只列一次
+func (s *State) Files(dir string, ids []string) []string {
+	files := []string{}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if it := s.Items[id]; it != nil && it.Status == Done && !seen[id] {
+			seen[id] = true
+			files = append(files, filepath.Join(dir, it.File))
+		}
+	}
+	return files
+}
+
+// ListFiles 讀取 dir 的狀態檔，回傳 ids 中已下載完成的檔案（見 State.Files）
+func ListFiles(dir string, ids []string) ([]string, error) {
+	s, err := LoadState(StatePath(dir))
+	if err != nil {
+		return nil, err
+	}
+	return s.Files(dir, ids), nil
+}
+
+// readState 讀取狀態檔；檔案不存在、損毀或版本不符時回傳空的狀態
+func readState(path string) *State {
+	var s State
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &s) != nil || s.Version != stateVersion || s.Items == nil {
+		return &State{Version: stateVersion, Items: make(map[string]*Item)}
+	}
+	return &s
+}
+
+func listSHA256(ids []string) string {
+	h := sha256.New()
+	for _, id := range ids {
+		io.WriteString(h, id+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fileName(id, format string) string {
+	return fmt.Sprintf("%s.%s", id, format)
+}
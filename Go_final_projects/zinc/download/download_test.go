@@ -0,0 +1,348 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeZinc 是假的 ZINC 伺服器：flaky 中的 ID 前兩次回應 503/429，missing 中的 ID 回應 404
+type fakeZinc struct {
+	mu       sync.Mutex
+	requests map[string]int
+	inFlight int32
+	peak     int32
+	flaky    map[string]bool
+	missing  map[string]bool
+}
+
+func (f *fakeZinc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		p := atomic.LoadInt32(&f.peak)
+		if n <= p || atomic.CompareAndSwapInt32(&f.peak, p, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/substances/"), ".sdf")
+	f.mu.Lock()
+	f.requests[id]++
+	count := f.requests[id]
+	f.mu.Unlock()
+
+	switch {
+	case f.missing[id]:
+		http.NotFound(w, r)
+	case f.flaky[id] && count == 1:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case f.flaky[id] && count == 2:
+		w.WriteHeader(http.StatusTooManyRequests)
+	default:
+		w.Write([]byte(id + "\n  molfile\n$$$$\n"))
+	}
+}
+
+func testOptions(url string) Options {
+	return Options{BaseURL: url, Workers: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, MaxRetries: 3}
+}
+
+func TestRun(t *testing.T) {
+	f := &fakeZinc{
+		requests: map[string]int{},
+		flaky:    map[string]bool{"ZINC2": true},
+		missing:  map[string]bool{"ZINC3": true},
+	}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "set_1")
+	ids := []string{"ZINC1", "ZINC2", "ZINC3", "ZINC4", "ZINC5", "ZINC6", "ZINC7", "ZINC8"}
+	report, err := Run(context.Background(), ids, dir, testOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 7 || len(report.Failed) != 1 || report.Failed[0].ZincID != "ZINC3" {
+		t.Fatalf("report = %+v", report)
+	}
+	if f.requests["ZINC2"] != 3 || f.requests["ZINC3"] != 1 {
+		t.Errorf("requests = %v; want 3 for the flaky ID and no retry for 404", f.requests)
+	}
+	if f.peak > 3 {
+		t.Errorf("%d concurrent requests, want at most 3 workers", f.peak)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "ZINC2.sdf")); err != nil || !strings.HasPrefix(string(data), "ZINC2") {
+		t.Errorf("ZINC2.sdf = %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+
+	// 第二次執行只重試失敗的分子；被截斷的檔案會重新下載
+	os.WriteFile(filepath.Join(dir, "ZINC5.sdf"), []byte("ZIN"), 0o644)
+	f.requests = map[string]int{}
+	opt := testOptions(srv.URL)
+	progress := map[string]Item{}
+	opt.Progress = func(format, id string, it Item) { progress[id] = it }
+	report, err = Run(context.Background(), ids, dir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 6 || report.Downloaded != 1 || f.requests["ZINC3"] != 1 || f.requests["ZINC5"] != 1 || len(f.requests) != 2 {
+		t.Errorf("resume: report %+v, requests %v", report, f.requests)
+	}
+	if len(progress) != len(ids) || progress["ZINC3"].Status != Failed || progress["ZINC5"].SHA256 == "" {
+		t.Errorf("progress = %+v", progress)
+	}
+
+	// 換一份清單時預設保留舊清單的檔案，之後的清單再包含它們時不重新下載
+	report, err = Run(context.Background(), []string{"ZINC1", "ZINC9"}, dir, testOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 1 || report.Downloaded != 1 || len(report.Removed) != 0 {
+		t.Errorf("new list: report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ZINC4.sdf")); err != nil {
+		t.Errorf("ZINC4.sdf from the previous list: %v", err)
+	}
+	// 舊清單的檔案留在目錄中，但不列在這份清單的檔案裡
+	if want := []string{filepath.Join(dir, "ZINC1.sdf"), filepath.Join(dir, "ZINC9.sdf")}; !reflect.DeepEqual(report.Files, want) {
+		t.Errorf("files = %v, want %v", report.Files, want)
+	}
+	report, err = Run(context.Background(), []string{"ZINC4", "ZINC9"}, dir, testOptions(srv.URL))
+	if err != nil || report.Skipped != 2 || report.Downloaded != 0 {
+		t.Errorf("list with a kept ID: report %+v, %v", report, err)
+	}
+
+	// Prune 時刪除不在新清單中的檔案
+	opt = testOptions(srv.URL)
+	opt.Prune = true
+	report, err = Run(context.Background(), []string{"ZINC9"}, dir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 1 || len(report.Removed) != 7 {
+		t.Errorf("pruned list: report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ZINC4.sdf")); !os.IsNotExist(err) {
+		t.Errorf("ZINC4.sdf was not pruned")
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	var served int32
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&served, 1) == 3 {
+			cancel()
+		}
+		w.Write([]byte("x\n$$$$\n"))
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "set_1")
+	var ids []string
+	for i := 0; i < 50; i++ {
+		ids = append(ids, "ZINC"+strings.Repeat("1", i+1))
+	}
+	opt := testOptions(srv.URL)
+	opt.Workers = 1
+	if _, err := Run(ctx, ids, dir, opt); err != context.Canceled {
+		t.Fatalf("interrupted run returned %v", err)
+	}
+
+	report, err := Run(context.Background(), ids, dir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped == 0 || report.Skipped+report.Downloaded != len(ids) {
+		t.Errorf("resumed run: %+v", report)
+	}
+	if int(served) != len(ids)+1 && int(served) != len(ids) {
+		t.Errorf("server saw %d requests for %d molecules", served, len(ids))
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	fixture, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mol2 := "@<TRIPOS>MOLECULE\nZINC1\n 2 1 0 0 0\nSMALL\n@<TRIPOS>ATOM\n1 C1 0 0 0 C.3\n"
+	pdbqt := "REMARK  Name = ZINC1\nROOT\nATOM      1  C   LIG     1       0.000   0.000   0.000  0.00  0.00    +0.000 C\nENDROOT\nTORSDOF 0\n"
+	for _, tc := range []struct {
+		format, data string
+		ok           bool
+	}{
+		{"sdf", string(fixture), true},
+		{"sdf", "<!DOCTYPE html><html>Service unavailable</html>", false},
+		{"sdf", mol2, false},
+		{"mol2", mol2, true},
+		{"mol2", string(fixture), false},
+		{"smi", "N[C@H](CO)[C@H]1O[C@@H](O)[C@@H](O)[C@@H]1O ZINC000014418328\n", true},
+		{"smi", "not a (smiles\n", false},
+		{"pdbqt", pdbqt, true},
+		{"pdbqt", mol2, false},
+		{"csv", "zinc_id,smiles\nZINC1,CCO\n", true},
+		{"csv", "zinc_id\n", false},
+		{"sdf", "", false},
+		{"xyz", "3\n\nC 0 0 0\n", false},
+	} {
+		if err := ValidatePayload(tc.format, []byte(tc.data)); (err == nil) != tc.ok {
+			t.Errorf("ValidatePayload(%s, %.20q) = %v, want ok=%v", tc.format, tc.data, err, tc.ok)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	fixture, _ := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sdf") {
+			w.Write(fixture)
+			return
+		}
+		// 其他格式回應錯誤頁面，狀態碼仍是 200
+		w.Write([]byte("<html>format not available</html>"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "zinc_source.json")
+	os.WriteFile(config, []byte(`{"version": "15", "formats": ["sdf", "mol2"], "base_url": "`+srv.URL+`", "output_dir": "`+filepath.Join(dir, "set_1")+`"}`), 0o644)
+	src, err := LoadSource(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.Dir("mol2"); got != filepath.Join(dir, "set_1_mol2") {
+		t.Errorf("Dir(mol2) = %s", got)
+	}
+
+	opt := testOptions("")
+	reports, err := src.Run(context.Background(), []string{"ZINC000014418328"}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reports["sdf"].Downloaded != 1 || len(reports["mol2"].Failed) != 1 {
+		t.Errorf("reports: sdf %+v, mol2 %+v", reports["sdf"], reports["mol2"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "set_1_mol2", "ZINC000014418328.mol2")); !os.IsNotExist(err) {
+		t.Errorf("invalid mol2 payload was written to disk")
+	}
+
+	for _, bad := range []Source{
+		{Version: "12", Formats: []string{"sdf"}, OutputDir: "set_1"},
+		{Version: "20", Formats: []string{"xyz"}, OutputDir: "set_1"},
+		{Version: "20", OutputDir: "set_1"},
+	} {
+		if bad.Check() == nil {
+			t.Errorf("Check accepted %+v", bad)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	fixture, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var served int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/substances/"), ".sdf")
+		w.Header().Set("ETag", `"`+id+`"`)
+		w.Write([]byte(strings.Replace(string(fixture), "ZINC000014418328", id, -1)))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cache, err := OpenCache(filepath.Join(dir, "zinc_cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := testOptions(srv.URL)
+	opt.Version, opt.Cache = "20", cache
+	opt.Validate = func(data []byte) error { return ValidatePayload("sdf", data) }
+	ids := []string{"ZINC1", "ZINC2"}
+
+	projectA := filepath.Join(dir, "project", "set_1")
+	report, err := Run(context.Background(), ids, projectA, opt)
+	if err != nil || report.Downloaded != 2 || report.Cached != 0 {
+		t.Fatalf("first download: %+v, %v", report, err)
+	}
+	e, err := cache.Lookup(Key{"ZINC1", "20", "sdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ETag != `"ZINC1"` || e.URL != srv.URL+"/substances/ZINC1.sdf" || len(e.SHA256) != 64 || e.FetchedAt.IsZero() {
+		t.Errorf("entry = %+v", e)
+	}
+
+	// 另一個專案的下載直接使用快取，不發出請求
+	projectB := filepath.Join(dir, "project 4", "set_1")
+	report, err = Run(context.Background(), ids, projectB, opt)
+	if err != nil || report.Cached != 2 || report.Downloaded != 0 || served != 2 {
+		t.Fatalf("cached download: %+v, %v, %d requests", report, err, served)
+	}
+	a, _ := os.Stat(filepath.Join(projectA, "ZINC1.sdf"))
+	b, _ := os.Stat(filepath.Join(projectB, "ZINC1.sdf"))
+	if !os.SameFile(a, b) {
+		t.Error("cached file was not hardlinked")
+	}
+
+	m, err := cache.MaterializeAll([]string{"ZINC1", "ZINC2", "ZINC9"}, "20", "sdf", filepath.Join(dir, "copy"), false)
+	if err != nil || m.Copied != 2 || m.Linked != 0 || len(m.Missing) != 1 || m.Missing[0] != "ZINC9" {
+		t.Errorf("materialize: %+v, %v", m, err)
+	}
+
+	if _, err := cache.Put(Entry{Key: Key{"ZINC3", "20", "sdf"}}, []byte("<html>Service unavailable</html>")); err == nil {
+		t.Error("Put accepted an HTML page")
+	}
+	// 損毀一個內容檔（所有硬連結一起改變）與一個記錄
+	e2, _ := cache.Lookup(Key{"ZINC2", "20", "sdf"})
+	obj := cache.objectPath(e2.SHA256)
+	os.Chmod(obj, 0o644)
+	os.WriteFile(obj, []byte("<html>oops</html>"), 0o644)
+	os.MkdirAll(filepath.Dir(cache.entryPath(Key{"ZINC4", "20", "sdf"})), 0o755)
+	os.WriteFile(cache.entryPath(Key{"ZINC4", "20", "sdf"}), []byte("{"), 0o644)
+
+	v, err := cache.Verify(false)
+	if err != nil || v.Checked != 3 || v.OK != 1 || len(v.Corrupt) != 2 {
+		t.Fatalf("verify: %+v, %v", v, err)
+	}
+	if _, err := cache.Lookup(Key{"ZINC4", "20", "sdf"}); err != ErrNotCached {
+		t.Errorf("Lookup of a broken entry: %v", err)
+	}
+	v, err = cache.Verify(true)
+	if err != nil || len(v.Corrupt) != 2 || v.Orphans != 1 {
+		t.Fatalf("verify and evict: %+v, %v", v, err)
+	}
+	if _, err := cache.Lookup(Key{"ZINC2", "20", "sdf"}); err != ErrNotCached {
+		t.Errorf("corrupt entry still cached: %v", err)
+	}
+	if v, _ := cache.Verify(false); v.Checked != 1 || v.OK != 1 {
+		t.Errorf("after eviction: %+v", v)
+	}
+
+	// 下載目錄中的檔案也已損毀：雜湊不符，重新下載並再次存入快取
+	report, err = Run(context.Background(), ids, projectA, opt)
+	if err != nil || report.Skipped != 1 || report.Downloaded != 1 || served != 3 {
+		t.Errorf("download after eviction: %+v, %v, %d requests", report, err, served)
+	}
+	if _, err := cache.Lookup(Key{"ZINC2", "20", "sdf"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,185 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+// Formats 是 ZINC 提供的單一分子檔案格式
+var Formats = []string{"sdf", "mol2", "smi", "pdbqt", "csv"}
+
+// hostTemplates 是各版本 ZINC 的主機網址
+var hostTemplates = map[string]string{
+	"15": "https://zinc15.docking.org",
+	"20": "https://zinc20.docking.org",
+}
+
+// Source 描述要從哪個 ZINC 版本下載哪些格式，以及各格式的輸出目錄。
+// 可以由旗標或 JSON 設定檔（見 LoadSource）設定，不需要互動輸入。
+type Source struct {
+	Version string   `json:"version"` // "15" 或 "20"
+	Formats []string `json:"formats"`
+	// BaseURL 覆寫版本對應的主機，例如指向鏡像站或測試伺服器
+	BaseURL string `json:"base_url,omitempty"`
+	// OutputDir 是 sdf 的輸出目錄；其他格式預設放在 <OutputDir>_<format>，例如 set_1_mol2
+	OutputDir string `json:"output_dir"`
+	// Dirs 個別指定格式的輸出目錄，優先於預設值
+	Dirs map[string]string `json:"dirs,omitempty"`
+}
+
+// DefaultSource 是 project 下載流程原本的設定：ZINC20 的 sdf，輸出到 set_1
+func DefaultSource() Source {
+	return Source{Version: "20", Formats: []string{"sdf"}, OutputDir: "set_1"}
+}
+
+// LoadSource 讀取 JSON 設定檔，檔案中沒有的欄位沿用 DefaultSource
+func LoadSource(path string) (Source, error) {
+	src := DefaultSource()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return src, err
+	}
+	if err := json.Unmarshal(data, &src); err != nil {
+		return src, fmt.Errorf("%s: %v", path, err)
+	}
+	return src, src.Check()
+}
+
+// Check 檢查版本與格式是否受支援
+func (s Source) Check() error {
+	if _, ok := hostTemplates[s.Version]; !ok && s.BaseURL == "" {
+		return fmt.Errorf("unknown ZINC version %q (want 15 or 20)", s.Version)
+	}
+	if len(s.Formats) == 0 {
+		return fmt.Errorf("no file formats selected")
+	}
+	for _, f := range s.Formats {
+		if !knownFormat(f) {
+			return fmt.Errorf("unknown file format %q (want one of %s)", f, strings.Join(Formats, ", "))
+		}
+	}
+	if s.OutputDir == "" {
+		return fmt.Errorf("no output directory")
+	}
+	return nil
+}
+
+func knownFormat(f string) bool {
+	for _, k := range Formats {
+		if f == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Host 回傳下載用的主機網址
+func (s Source) Host() string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	return hostTemplates[s.Version]
+}
+
+// Dir 回傳格式 format 的輸出目錄
+func (s Source) Dir(format string) string {
+	if d := s.Dirs[format]; d != "" {
+		return d
+	}
+	if format == "sdf" {
+		return s.OutputDir
+	}
+	return s.OutputDir + "_" + format
+}
+
+// Run 依序下載每一種格式到各自的目錄，opt 中的連線設定套用到所有格式。
+// 回傳的報告以格式為索引；ctx 被取消時停止並回傳已完成格式的報告。
+func (s Source) Run(ctx context.Context, ids []string, opt Options) (map[string]*Report, error) {
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*Report)
+	for _, format := range s.Formats {
+		o := opt
+		o.Version, o.Format, o.BaseURL = s.Version, format, s.Host()
+		o.StatePath = ""
+		o.Validate = func(data []byte) error { return ValidatePayload(format, data) }
+		report, err := Run(ctx, ids, s.Dir(format), o)
+		if report != nil {
+			reports[format] = report
+		}
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// ValidatePayload 檢查下載內容是否真的是 format 格式，
+// 避免把錯誤頁面或其他格式的回應存成分子檔
+func ValidatePayload(format string, data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return fmt.Errorf("empty %s payload", format)
+	}
+	if trimmed[0] == '<' {
+		return fmt.Errorf("got an HTML page instead of %s", format)
+	}
+	switch format {
+	case "sdf":
+		mols, err := sdf.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return fmt.Errorf("invalid sdf: %v", err)
+		}
+		if len(mols) == 0 {
+			return fmt.Errorf("invalid sdf: no molecules")
+		}
+	case "mol2":
+		if !bytes.Contains(data, []byte("@<TRIPOS>MOLECULE")) || !bytes.Contains(data, []byte("@<TRIPOS>ATOM")) {
+			return fmt.Errorf("invalid mol2: missing @<TRIPOS>MOLECULE or @<TRIPOS>ATOM section")
+		}
+	case "smi":
+		line := firstLine(trimmed)
+		if _, err := smiles.Parse(strings.Fields(line)[0]); err != nil {
+			return fmt.Errorf("invalid smi: %v", err)
+		}
+	case "pdbqt":
+		atoms := 0
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			if l := sc.Text(); strings.HasPrefix(l, "ATOM") || strings.HasPrefix(l, "HETATM") {
+				atoms++
+			}
+		}
+		if atoms == 0 {
+			return fmt.Errorf("invalid pdbqt: no ATOM or HETATM records")
+		}
+	case "csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return fmt.Errorf("invalid csv: %v", err)
+		}
+		if len(records) < 2 || len(records[0]) < 2 {
+			return fmt.Errorf("invalid csv: want a header and at least one row")
+		}
+	default:
+		return fmt.Errorf("unknown file format %q", format)
+	}
+	return nil
+}
+
+func firstLine(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimSpace(string(data))
+}
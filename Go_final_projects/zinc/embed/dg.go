@@ -0,0 +1,227 @@
+package embed
+
+import (
+	"math"
+	"math/rand"
+)
+
+// bounds 是距離幾何的上下界矩陣
+type bounds struct {
+	n          int
+	lower, upp []float64
+}
+
+func (b *bounds) at(i, j int) (float64, float64) { return b.lower[i*b.n+j], b.upp[i*b.n+j] }
+
+func (b *bounds) set(i, j int, lo, hi float64) {
+	b.lower[i*b.n+j], b.lower[j*b.n+i] = lo, lo
+	b.upp[i*b.n+j], b.upp[j*b.n+i] = hi, hi
+}
+
+// distanceBounds 由力場的理想鍵長、鍵角與扭轉建立距離上下界：
+// 1–2 與 1–3 距離幾乎固定，1–4 距離介於 cis 與 trans 之間（雙鍵的立體參考原子固定在其中一端），
+// 其餘原子對的下界是 van der Waals 半徑和的一部分，上界由三角不等式推得
+func (t *topology) distanceBounds(ff *forceField) *bounds {
+	n := len(t.m.Atoms)
+	b := &bounds{n: n, lower: make([]float64, n*n), upp: make([]float64, n*n)}
+	const far = 1000.0
+	fixed := make([]bool, n*n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			b.set(i, j, 0, far)
+		}
+	}
+	for _, p := range ff.pairs {
+		b.set(p.i, p.j, p.rmin, far)
+	}
+
+	length := make(map[[2]int]float64)
+	for _, bt := range ff.bonds {
+		length[[2]int{bt.i, bt.j}], length[[2]int{bt.j, bt.i}] = bt.r0, bt.r0
+		b.set(bt.i, bt.j, bt.r0-0.01, bt.r0+0.01)
+		fixed[bt.i*n+bt.j], fixed[bt.j*n+bt.i] = true, true
+	}
+	angle := make(map[[3]int]float64)
+	for _, a := range ff.angles {
+		angle[[3]int{a.i, a.j, a.k}], angle[[3]int{a.k, a.j, a.i}] = a.cos0, a.cos0
+		if fixed[a.i*n+a.k] {
+			continue
+		}
+		r1, r2 := length[[2]int{a.i, a.j}], length[[2]int{a.j, a.k}]
+		d := math.Sqrt(math.Max(r1*r1+r2*r2-2*r1*r2*a.cos0, 0))
+		b.set(a.i, a.k, d-0.04, d+0.04)
+		fixed[a.i*n+a.k], fixed[a.k*n+a.i] = true, true
+	}
+
+	// 1–4：所有經過 j–k 的 i–j–k–l，扭轉項指定了角度時只允許對應的距離
+	torsion := make(map[[4]int]torsionTerm)
+	for _, tt := range ff.torsions {
+		torsion[[4]int{tt.i, tt.j, tt.k, tt.l}] = tt
+	}
+	for _, bt := range ff.bonds {
+		j, k := bt.i, bt.j
+		for _, ei := range t.adj[j] {
+			for _, el := range t.adj[k] {
+				i, l := ei.Atom, el.Atom
+				if i == k || l == j || i == l || fixed[i*n+l] {
+					continue
+				}
+				r1, r2, r3 := length[[2]int{i, j}], bt.r0, length[[2]int{k, l}]
+				c1, ok1 := angle[[3]int{i, j, k}]
+				c2, ok2 := angle[[3]int{j, k, l}]
+				if !ok1 || !ok2 {
+					continue
+				}
+				cis, trans := distance14(r1, r2, r3, c1, c2, 0), distance14(r1, r2, r3, c1, c2, math.Pi)
+				lo, hi := cis, trans
+				if tt, ok := torsion[[4]int{i, j, k, l}]; ok && tt.n == 1 {
+					lo = distance14(r1, r2, r3, c1, c2, tt.phi0)
+					hi = lo
+				}
+				curLo, curHi := b.at(i, l)
+				if curHi < far {
+					// 環中同一對原子有多條 1–4 路徑：取交集，不相容時保留較寬的範圍
+					if l2, h2 := math.Max(lo, curLo), math.Min(hi, curHi); l2 <= h2 {
+						lo, hi = l2, h2
+					} else {
+						lo, hi = math.Min(lo, curLo), math.Max(hi, curHi)
+					}
+				}
+				b.set(i, l, lo-0.05, hi+0.05)
+			}
+		}
+	}
+	b.smooth()
+	return b
+}
+
+// distance14 回傳鍵長 r1、r2、r3，鍵角餘弦 c1、c2，二面角 phi 的 i–l 距離
+func distance14(r1, r2, r3, c1, c2, phi float64) float64 {
+	s1, s2 := math.Sqrt(math.Max(1-c1*c1, 0)), math.Sqrt(math.Max(1-c2*c2, 0))
+	i := vec{r1 * c1, r1 * s1, 0}
+	l := vec{r2 - r3*c2, r3 * s2 * math.Cos(phi), r3 * s2 * math.Sin(phi)}
+	return norm(add(l, scale(i, -1)))
+}
+
+// smooth 以 Floyd–Warshall 把上下界收緊到滿足三角不等式
+func (b *bounds) smooth() {
+	n := b.n
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if i == k {
+				continue
+			}
+			lik, uik := b.at(i, k)
+			for j := i + 1; j < n; j++ {
+				if j == k {
+					continue
+				}
+				lkj, ukj := b.at(k, j)
+				lij, uij := b.at(i, j)
+				if s := uik + ukj; s < uij {
+					uij = s
+				}
+				if d := lik - ukj; d > lij {
+					lij = d
+				}
+				if d := lkj - uik; d > lij {
+					lij = d
+				}
+				if lij > uij {
+					lij = uij // 上下界矛盾：以上界為準
+				}
+				b.set(i, j, lij, uij)
+			}
+		}
+	}
+}
+
+// embedDistances 在上下界之間隨機取距離，以度量矩陣的前三個特徵向量得到座標
+func (b *bounds) embedDistances(rng *rand.Rand) []float64 {
+	n := b.n
+	d2 := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			lo, hi := b.at(i, j)
+			d := lo + rng.Float64()*(hi-lo)
+			d2[i*n+j], d2[j*n+i] = d*d, d*d
+		}
+	}
+	// 每個原子到質心距離的平方
+	total := 0.0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			total += d2[i*n+j]
+		}
+	}
+	total /= float64(n * n)
+	d0 := make([]float64, n)
+	for i := 0; i < n; i++ {
+		s := 0.0
+		for j := 0; j < n; j++ {
+			s += d2[i*n+j]
+		}
+		d0[i] = s/float64(n) - total
+	}
+	metric := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			metric[i*n+j] = (d0[i] + d0[j] - d2[i*n+j]) / 2
+		}
+	}
+
+	x := make([]float64, 3*n)
+	for axis := 0; axis < 3; axis++ {
+		lambda, v := largestEigen(metric, n, rng)
+		if lambda <= 1e-6 {
+			for i := 0; i < n; i++ {
+				x[3*i+axis] = (rng.Float64() - 0.5) * 0.5
+			}
+			continue
+		}
+		s := math.Sqrt(lambda)
+		for i := 0; i < n; i++ {
+			x[3*i+axis] = s * v[i]
+		}
+		// 移除這個特徵向量，下一次取得次大的
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				metric[i*n+j] -= lambda * v[i] * v[j]
+			}
+		}
+	}
+	return x
+}
+
+// largestEigen 以冪次法求對稱矩陣最大的特徵值與單位特徵向量
+func largestEigen(a []float64, n int, rng *rand.Rand) (float64, []float64) {
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = rng.Float64() - 0.5
+	}
+	w := make([]float64, n)
+	lambda := 0.0
+	for iter := 0; iter < 500; iter++ {
+		for i := 0; i < n; i++ {
+			s := 0.0
+			for j := 0; j < n; j++ {
+				s += a[i*n+j] * v[j]
+			}
+			w[i] = s
+		}
+		nw := math.Sqrt(dotN(w, w))
+		if nw == 0 {
+			return 0, v
+		}
+		next := dotN(v, w) / dotN(v, v)
+		for i := range v {
+			v[i] = w[i] / nw
+		}
+		if math.Abs(next-lambda) < 1e-9*math.Max(1, math.Abs(next)) {
+			lambda = next
+			break
+		}
+		lambda = next
+	}
+	return lambda, v
+}
@@ -0,0 +1,194 @@
+// Package embed 從 ZINC SD 檔的二維座標（或 SMILES 這種沒有座標的輸入）產生配體的三維構形：
+// 補上氫原子，以標準鍵長、鍵角建立的簡單力場最佳化座標，並保留 SD 檔的楔形鍵/parity
+// 與 SMILES @/@@ 指定的立體化學。對接程式無法使用 z 全為 0 的結構。
+package embed
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"zinc/mol"
+)
+
+const (
+	DefaultMaxIters = 2000
+	DefaultAttempts = 4
+)
+
+// Options 控制構形的產生
+type Options struct {
+	Seed     int64 // 亂數種子；相同的種子與輸入得到相同的座標
+	MaxIters int   // 每次嘗試的最大迭代次數，0 表示 DefaultMaxIters
+	Attempts int   // 起點的數目，保留能量最低且通過檢查的構形；0 表示 DefaultAttempts
+	Workers  int   // Run 同時處理的分子數，0 表示 runtime.NumCPU()
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxIters <= 0 {
+		o.MaxIters = DefaultMaxIters
+	}
+	if o.Attempts <= 0 {
+		o.Attempts = DefaultAttempts
+	}
+	return o
+}
+
+// bondTolerance 是最佳化之後鍵長與理想值可以相差的最大值（Å），超過表示構形糾結在一起
+const bondTolerance = 0.25
+
+// Embed 回傳帶有三維座標與明確氫原子的複本。
+// 分子還沒有立體化學資訊時先由二維座標的楔形鍵或 parity 推得；
+// 有二維座標時以它為起點（加上少量的 z 擾動），否則以距離幾何產生起點。
+// 每次嘗試之後檢查立體中心的方向、雙鍵的 cis/trans 與鍵長，在通過檢查的構形中保留能量最低的一個。
+func Embed(m *mol.Molecule, opt Options) (*mol.Molecule, error) {
+	opt = opt.withDefaults()
+	if len(m.Atoms) == 0 {
+		return nil, fmt.Errorf("molecule has no atoms")
+	}
+	c := m.Clone()
+	if !c.HasStereo() {
+		c.PerceiveStereo()
+	}
+	layout := has2D(c)
+	c.AddHydrogens()
+	t := newTopology(c)
+	ff := t.build()
+
+	var dg *bounds
+	if !layout {
+		dg = t.distanceBounds(ff)
+	}
+
+	var (
+		best   []float64
+		bestE  = math.Inf(1)
+		reason string
+	)
+	for attempt := 0; attempt < opt.Attempts; attempt++ {
+		rng := rand.New(rand.NewSource(opt.Seed*1000003 + int64(attempt)))
+		var x []float64
+		if layout {
+			x = initialCoords(c, rng)
+		} else {
+			x = dg.embedDistances(rng)
+			ff.orient(x)
+		}
+		e := minimize(ff.energy, x, opt.MaxIters, 1e-3)
+		if r := ff.check(x); r != "" {
+			reason = r
+			continue
+		}
+		if e < bestE {
+			best, bestE = x, e
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no 3D conformation after %d attempts: %s", opt.Attempts, reason)
+	}
+	finish(c, best)
+	return c, nil
+}
+
+// has2D 判斷分子是否有可以當作起點的座標（至少兩個原子不在同一點）
+func has2D(m *mol.Molecule) bool {
+	for _, a := range m.Atoms[1:] {
+		if a.X != m.Atoms[0].X || a.Y != m.Atoms[0].Y || a.Z != m.Atoms[0].Z {
+			return true
+		}
+	}
+	return false
+}
+
+// initialCoords 以二維座標建立最佳化的起點。座標縮放到鍵長中位數 1.5 Å，
+// 楔形鍵與虛線鍵的末端原子往 z 的正、負方向移動，所有原子再加上少量隨機的 z。
+func initialCoords(m *mol.Molecule, rng *rand.Rand) []float64 {
+	x := make([]float64, 3*len(m.Atoms))
+	var lengths []float64
+	for _, b := range m.Bonds {
+		p, q := m.Atoms[b.Begin], m.Atoms[b.End]
+		if p.IsHeavy() && q.IsHeavy() {
+			lengths = append(lengths, math.Hypot(math.Hypot(p.X-q.X, p.Y-q.Y), p.Z-q.Z))
+		}
+	}
+	f := 1.0
+	if len(lengths) > 0 {
+		sort.Float64s(lengths)
+		if median := lengths[len(lengths)/2]; median > 1e-6 {
+			f = 1.5 / median
+		}
+	}
+	for i, a := range m.Atoms {
+		x[3*i], x[3*i+1], x[3*i+2] = a.X*f, a.Y*f, a.Z*f+rng.NormFloat64()*0.3
+	}
+	for _, b := range m.Bonds {
+		switch b.Stereo {
+		case mol.StereoUp:
+			x[3*b.End+2] += 0.8
+		case mol.StereoDown:
+			x[3*b.End+2] -= 0.8
+		}
+	}
+	return x
+}
+
+// orient 在多數立體中心方向相反時把座標鏡射（距離幾何無法分辨鏡像）
+func (ff *forceField) orient(x []float64) {
+	wrong := 0
+	for _, c := range ff.chirals {
+		if v, _, _, _, _ := tripleProduct(x, c.a, c.b, c.c, c.d); c.sign*v < 0 {
+			wrong++
+		}
+	}
+	if 2*wrong > len(ff.chirals) {
+		for i := 2; i < len(x); i += 3 {
+			x[i] = -x[i]
+		}
+	}
+}
+
+// check 回傳構形不符合要求的原因；符合時回傳空字串
+func (ff *forceField) check(x []float64) string {
+	for _, c := range ff.chirals {
+		if v, _, _, _, _ := tripleProduct(x, c.a, c.b, c.c, c.d); c.sign*v <= 0 {
+			return fmt.Sprintf("stereocentre with neighbour %d is inverted", c.a+1)
+		}
+	}
+	for _, t := range ff.torsions {
+		if t.n != 1 {
+			continue
+		}
+		phi, _, _, _, _, ok := dihedral(x, t.i, t.j, t.k, t.l, false)
+		if !ok || math.Cos(phi-t.phi0) <= 0 {
+			return fmt.Sprintf("double bond %d=%d has the wrong geometry", t.j+1, t.k+1)
+		}
+	}
+	for _, b := range ff.bonds {
+		if d := norm(sub(x, b.j, b.i)); math.Abs(d-b.r0) > bondTolerance {
+			return fmt.Sprintf("bond %d-%d is %.2f Å instead of %.2f Å", b.i+1, b.j+1, d, b.r0)
+		}
+	}
+	return ""
+}
+
+// finish 把座標寫回分子，移除只在二維圖中有意義的楔形/虛線標記，並把標頭的維度改成 3D
+func finish(m *mol.Molecule, x []float64) {
+	for i := range m.Atoms {
+		m.Atoms[i].X, m.Atoms[i].Y, m.Atoms[i].Z = x[3*i], x[3*i+1], x[3*i+2]
+	}
+	for k := range m.Bonds {
+		if s := m.Bonds[k].Stereo; s == mol.StereoUp || s == mol.StereoDown {
+			m.Bonds[k].Stereo = mol.StereoNone
+		}
+	}
+	m.Program = programLine(m.Program)
+}
+
+// programLine 把 molfile 標頭第二行的維度欄位（第 21–22 欄）設為 3D，程式名稱改成 zinc
+func programLine(line string) string {
+	b := []byte(fmt.Sprintf("%-22s", line))
+	copy(b[2:10], fmt.Sprintf("%-8s", "zinc"))
+	copy(b[20:22], "3D")
+	return string(b)
+}
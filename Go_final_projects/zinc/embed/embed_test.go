@@ -0,0 +1,208 @@
+package embed
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+// fromCoords 清除立體化學，讓 smiles.Canonical 只能由三維座標重新推得
+func fromCoords(m *mol.Molecule) string {
+	c := m.Clone()
+	for i := range c.Atoms {
+		c.Atoms[i].Chirality = mol.ChiralNone
+	}
+	for i := range c.Bonds {
+		c.Bonds[i].CisTrans = mol.CisTransNone
+	}
+	return smiles.Canonical(c)
+}
+
+func TestGradient(t *testing.T) {
+	m := smiles.MustParse("C[C@H](N)C(=O)O/C=C/c1ccccc1")
+	m.AddHydrogens()
+	top := newTopology(m)
+	ff := top.build()
+	x := top.distanceBounds(ff).embedDistances(rand.New(rand.NewSource(1)))
+	g := make([]float64, len(x))
+	ff.energy(x, g)
+	for i := range x {
+		const h = 1e-6
+		x[i] += h
+		ep := ff.energy(x, nil)
+		x[i] -= 2 * h
+		em := ff.energy(x, nil)
+		x[i] += h
+		num := (ep - em) / (2 * h)
+		if math.Abs(num-g[i]) > 1e-4*(1+math.Abs(num)) {
+			t.Errorf("dE/dx[%d] = %g, numerical %g", i, g[i], num)
+		}
+	}
+}
+
+func TestEmbedKeepsStereo(t *testing.T) {
+	for _, s := range []string{
+		"C[C@H](N)C(=O)O",
+		"C[C@@H](N)C(=O)O",
+		"F/C=C/F",
+		"F/C=C\\F",
+		"O=C(NCC[C@@H]1CCCN1)c1ccccc1",
+		"C[C@H]1CC[C@@H](O)CC1",
+		"C/C=C/C(=O)N[C@H](C)c1ccccc1",
+	} {
+		want := smiles.Canonical(smiles.MustParse(s))
+		out, err := Embed(smiles.MustParse(s), Options{Seed: 7})
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got := fromCoords(out); got != want {
+			t.Errorf("%s: 3D structure is %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestEmbedGeometry(t *testing.T) {
+	tests := []struct {
+		smiles string
+		angle  float64 // 鍵角與理想值最大的差（度）
+	}{
+		{"C1CCCCC1", 2},
+		{"c1ccc2ccccc2c1", 2},
+		{"CC(C)(C)c1ccc(cc1)S(=O)(=O)N", 2},
+		{"CC#N", 2},
+		{"CC(=O)Nc1ccc(O)cc1", 5},
+	}
+	for _, tt := range tests {
+		out, err := Embed(smiles.MustParse(tt.smiles), Options{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.smiles, err)
+			continue
+		}
+		ff := newTopology(out).build()
+		x := coords(out)
+		for _, b := range ff.bonds {
+			if d := norm(sub(x, b.j, b.i)); math.Abs(d-b.r0) > 0.05 {
+				t.Errorf("%s: bond %d-%d is %.2f Å, want %.2f", tt.smiles, b.i, b.j, d, b.r0)
+			}
+		}
+		for _, a := range ff.angles {
+			u, v := sub(x, a.i, a.j), sub(x, a.k, a.j)
+			got := math.Acos(dot(u, v)/(norm(u)*norm(v))) * 180 / math.Pi
+			if want := math.Acos(a.cos0) * 180 / math.Pi; math.Abs(got-want) > tt.angle {
+				t.Errorf("%s: angle %d-%d-%d is %.1f°, want %.1f°", tt.smiles, a.i, a.j, a.k, got, want)
+			}
+		}
+	}
+}
+
+func coords(m *mol.Molecule) []float64 {
+	x := make([]float64, 3*len(m.Atoms))
+	for i, a := range m.Atoms {
+		x[3*i], x[3*i+1], x[3*i+2] = a.X, a.Y, a.Z
+	}
+	return x
+}
+
+func TestEmbedFixture(t *testing.T) {
+	mols, err := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := mols[0]
+	want := smiles.Canonical(in)
+	out, err := Embed(in, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Atoms) != 25 {
+		t.Errorf("%d atoms, want 25 with hydrogens", len(out.Atoms))
+	}
+	flat := true
+	for _, a := range out.Atoms {
+		if math.Abs(a.Z) > 0.5 {
+			flat = false
+		}
+	}
+	if flat {
+		t.Error("embedded fixture is still flat")
+	}
+	if got := fromCoords(out); got != want {
+		t.Errorf("stereo changed: %s, want %s", got, want)
+	}
+	if out.ZincID() != in.ZincID() || !strings.HasPrefix(out.Program[2:], "zinc") || out.Program[20:22] != "3D" {
+		t.Errorf("id %q, program line %q", out.ZincID(), out.Program)
+	}
+	for _, b := range out.Bonds {
+		if b.Stereo == mol.StereoUp || b.Stereo == mol.StereoDown {
+			t.Errorf("wedge kept on bond %d-%d", b.Begin, b.End)
+		}
+	}
+	again, _ := Embed(in, Options{Seed: 1})
+	if coords(again)[0] != coords(out)[0] {
+		t.Error("same seed gave different coordinates")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "set_1")
+	os.Mkdir(in, 0o755)
+	data, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(in, "ZINC000014418328.sdf"), data, 0o644)
+	os.WriteFile(filepath.Join(in, "broken.sdf"), []byte("not a molfile\n"), 0o644)
+	// 第二個檔案的分子改名，讓單一 SD 檔的輸出順序可以檢查
+	other := strings.Replace(string(data), "ZINC000014418328", "ZINC000000000001", -1)
+	os.WriteFile(filepath.Join(in, "ZINC000000000001.sdf"), []byte(other), 0o644)
+	files, _ := merge.ListSDFFiles(in)
+
+	out := filepath.Join(dir, "set_1_3d.sdf")
+	report, err := Run(context.Background(), files, out, Options{Workers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Embedded != 2 || len(report.Failed) != 1 || report.Failed[0].Line == 0 {
+		t.Errorf("report = %+v", report)
+	}
+	mols, err := sdf.ReadFile(out)
+	if err != nil || len(mols) != 2 {
+		t.Fatalf("%d molecules, %v", len(mols), err)
+	}
+	for i, m := range mols {
+		if id := strings.TrimSuffix(filepath.Base(files[i]), ".sdf"); m.ZincID() != id {
+			t.Errorf("molecule %d is %s, want %s", i, m.ZincID(), id)
+		}
+	}
+
+	outDir := filepath.Join(dir, "set_1_3d")
+	if _, err := Run(context.Background(), files, outDir, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "ZINC000014418328.sdf")); err != nil {
+		t.Error(err)
+	}
+	if _, err := Run(context.Background(), files, in, Options{}); err == nil {
+		t.Error("embedding into the input directory succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, files, filepath.Join(dir, "cancelled.sdf"), Options{}); err != context.Canceled {
+		t.Errorf("cancelled run returned %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cancelled.sdf")); !os.IsNotExist(err) {
+		t.Errorf("cancelled run left output: %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+package embed
+
+import (
+	"math"
+
+	"zinc/mol"
+)
+
+// 力場各項的力常數。單位不是真實的能量，只需要彼此的相對大小合理：
+// 鍵長與立體化學最硬，鍵角與平面次之，扭轉與排斥最軟。
+const (
+	kBond      = 200.0
+	kAngle     = 60.0
+	kPlane     = 20.0
+	kPlanar    = 5.0  // 雙鍵、芳香鍵與醯胺鍵的扭轉：0° 或 180°
+	kCisTrans  = 30.0 // 指定 cis/trans 的參考原子
+	kStaggered = 0.2  // sp3–sp3 單鍵偏好交錯構形
+	kChiral    = 50.0
+	kRepulsion = 10.0
+
+	// chiralVolume 是立體中心四個參考原子的三重積要達到的最小值（Å³），
+	// 遠小於理想四面體的值，只用來固定方向
+	chiralVolume = 1.0
+)
+
+type bondTerm struct {
+	i, j int
+	r0   float64
+}
+
+// angleTerm 以 cos θ 表示鍵角，sp 原子的 180° 也沒有奇異點
+type angleTerm struct {
+	i, j, k int
+	cos0    float64
+}
+
+// torsionTerm 是 E = k(1 − cos(n(φ − φ0)))，極小值在 φ0 + 2πm/n
+type torsionTerm struct {
+	i, j, k, l int
+	n          float64
+	phi0, k0   float64
+}
+
+// planeTerm 把 sp2 原子與它的三個鄰居拉到同一平面：三重積趨近 0
+type planeTerm struct {
+	center, a, b, c int
+}
+
+// chiralTerm 要求四個參考原子的三重積 (b−a)·((c−a)×(d−a)) 乘上 sign 至少為 chiralVolume，
+// 與 mol 由座標判斷方向時使用的公式相同：三重積為負是 ChiralCCW
+type chiralTerm struct {
+	a, b, c, d int
+	sign       float64
+}
+
+// pairTerm 是非鍵結原子之間的排斥：距離小於 rmin 時才有能量
+type pairTerm struct {
+	i, j int
+	rmin float64
+}
+
+// forceField 是一個分子的所有能量項
+type forceField struct {
+	bonds    []bondTerm
+	angles   []angleTerm
+	torsions []torsionTerm
+	planes   []planeTerm
+	chirals  []chiralTerm
+	pairs    []pairTerm
+}
+
+// 單鍵共價半徑（Å），兩者相加得到單鍵長度，例如 C–C 1.54、C–H 1.09、O–H 0.98
+var covalentRadius = map[string]float64{
+	"H": 0.32, "B": 0.82, "C": 0.77, "N": 0.70, "O": 0.66, "F": 0.58,
+	"Si": 1.11, "P": 1.07, "S": 1.05, "Cl": 1.00, "Se": 1.20, "Br": 1.17, "I": 1.37,
+}
+
+// van der Waals 半徑（Å），用於非鍵結排斥
+var vdwRadius = map[string]float64{
+	"H": 1.10, "B": 1.92, "C": 1.70, "N": 1.55, "O": 1.52, "F": 1.47,
+	"Si": 2.10, "P": 1.80, "S": 1.80, "Cl": 1.75, "Se": 1.90, "Br": 1.85, "I": 1.98,
+}
+
+func radius(table map[string]float64, symbol string, fallback float64) float64 {
+	if r, ok := table[symbol]; ok {
+		return r
+	}
+	return fallback
+}
+
+// bondLength 回傳理想鍵長：單鍵長度乘上鍵級的縮短比例（C=C 1.34、C≡C 1.20、芳香 1.40）
+func bondLength(m *mol.Molecule, b mol.Bond, aromatic bool) float64 {
+	r := radius(covalentRadius, m.Atoms[b.Begin].Symbol, 1.2) + radius(covalentRadius, m.Atoms[b.End].Symbol, 1.2)
+	switch {
+	case aromatic || b.Order == mol.Aromatic:
+		return r * 0.91
+	case b.Order == mol.Double:
+		return r * 0.87
+	case b.Order == mol.Triple:
+		return r * 0.78
+	}
+	return r
+}
+
+// topology 是建立力場時共用的分子資訊
+type topology struct {
+	m             *mol.Molecule
+	adj           [][]mol.Edge
+	aromaticBonds []bool
+	rings         [][]int
+	hyb           []int // 1 為 sp、2 為 sp2（平面）、3 為 sp3
+}
+
+func newTopology(m *mol.Molecule) *topology {
+	t := &topology{m: m, adj: m.Adjacency(), rings: m.Rings()}
+	_, t.aromaticBonds = m.Aromaticity()
+	t.hyb = make([]int, len(m.Atoms))
+	for i := range m.Atoms {
+		t.hyb[i] = t.hybridization(i)
+	}
+	return t
+}
+
+// hybridization 依鍵級決定幾何：參鍵或兩個雙鍵（丙二烯、疊氮）為直線形，雙鍵或芳香鍵為平面三角形，
+// 四配位的原子（包含磺醯基）為四面體；接在雙鍵或芳香環上的三配位氮（醯胺、苯胺）也視為平面
+func (t *topology) hybridization(i int) int {
+	double, triple := 0, 0
+	for _, e := range t.adj[i] {
+		switch {
+		case t.aromaticBonds[e.Bond]:
+			double++
+		case t.m.Bonds[e.Bond].Order == mol.Double:
+			double++
+		case t.m.Bonds[e.Bond].Order == mol.Triple:
+			triple++
+		}
+	}
+	degree := len(t.adj[i])
+	switch {
+	case degree >= 4:
+		return 3
+	case degree >= 3 && (t.m.Atoms[i].Symbol == "S" || t.m.Atoms[i].Symbol == "P" || t.m.Atoms[i].Symbol == "Se"):
+		return 3 // 亞碸、膦氧化物：有孤對電子或擴展價層，仍是四面體
+	case triple > 0 || (double >= 2 && degree == 2 && !t.aromaticAtom(i)):
+		return 1
+	case double > 0:
+		return 2
+	}
+	if t.m.Atoms[i].Symbol == "N" && len(t.adj[i]) == 3 && t.m.Atoms[i].Charge == 0 {
+		for _, e := range t.adj[i] {
+			if t.hasPiBond(e.Atom) {
+				return 2
+			}
+		}
+	}
+	return 3
+}
+
+func (t *topology) aromaticAtom(i int) bool {
+	for _, e := range t.adj[i] {
+		if t.aromaticBonds[e.Bond] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *topology) hasPiBond(i int) bool {
+	for _, e := range t.adj[i] {
+		if o := t.m.Bonds[e.Bond].Order; o == mol.Double || o == mol.Triple || t.aromaticBonds[e.Bond] {
+			return true
+		}
+	}
+	return false
+}
+
+// idealAngle 回傳 i–j–k 的理想鍵角：三、四、五元環中的角度依環的大小，其餘依 j 的混成
+func (t *topology) idealAngle(i, j, k int) float64 {
+	smallest := 0
+	for _, ring := range t.rings {
+		if len(ring) > 5 || (smallest > 0 && len(ring) >= smallest) {
+			continue
+		}
+		for p := range ring {
+			prev, next := ring[(p+len(ring)-1)%len(ring)], ring[(p+1)%len(ring)]
+			if ring[p] == j && ((prev == i && next == k) || (prev == k && next == i)) {
+				smallest = len(ring)
+			}
+		}
+	}
+	switch smallest {
+	case 3:
+		return 60
+	case 4:
+		return 90
+	case 5:
+		return 108
+	}
+	switch t.hyb[j] {
+	case 1:
+		return 180
+	case 2:
+		return 120
+	}
+	return 109.47
+}
+
+// build 依拓撲與立體化學建立力場
+func (t *topology) build() *forceField {
+	m := t.m
+	ff := &forceField{}
+	n := len(m.Atoms)
+	// sep 記錄 1–2 與 1–3 關係（不加排斥），1–4 關係的排斥距離較短
+	sep := make([]map[int]int, n)
+	for i := range sep {
+		sep[i] = make(map[int]int)
+	}
+	for k, b := range m.Bonds {
+		ff.bonds = append(ff.bonds, bondTerm{b.Begin, b.End, bondLength(m, b, t.aromaticBonds[k])})
+		sep[b.Begin][b.End], sep[b.End][b.Begin] = 1, 1
+	}
+
+	for j := range m.Atoms {
+		nbrs := t.adj[j]
+		if len(nbrs) > 4 {
+			continue // 五、六配位的原子沒有單一的理想鍵角，只靠排斥
+		}
+		for x := 0; x < len(nbrs); x++ {
+			for y := x + 1; y < len(nbrs); y++ {
+				i, k := nbrs[x].Atom, nbrs[y].Atom
+				ff.angles = append(ff.angles, angleTerm{i, j, k, math.Cos(t.idealAngle(i, j, k) * math.Pi / 180)})
+				if sep[i][k] == 0 {
+					sep[i][k], sep[k][i] = 2, 2
+				}
+			}
+		}
+		if t.hyb[j] == 2 && len(nbrs) == 3 {
+			ff.planes = append(ff.planes, planeTerm{j, nbrs[0].Atom, nbrs[1].Atom, nbrs[2].Atom})
+		}
+	}
+
+	for k, b := range m.Bonds {
+		j, l := b.Begin, b.End
+		planar := t.aromaticBonds[k] || b.Order == mol.Double || (t.hyb[j] == 2 && t.hyb[l] == 2 && (m.Atoms[j].Symbol == "N" || m.Atoms[l].Symbol == "N"))
+		staggered := b.Order == mol.Single && !t.aromaticBonds[k] && t.hyb[j] == 3 && t.hyb[l] == 3
+		for _, ei := range t.adj[j] {
+			if ei.Atom == l {
+				continue
+			}
+			for _, el := range t.adj[l] {
+				if el.Atom == j || el.Atom == ei.Atom {
+					continue
+				}
+				i, q := ei.Atom, el.Atom
+				if sep[i][q] == 0 {
+					sep[i][q], sep[q][i] = 3, 3
+				}
+				switch {
+				case b.CisTrans != mol.CisTransNone && b.Order == mol.Double && i == b.StereoRefs[0] && q == b.StereoRefs[1]:
+					phi0 := 0.0
+					if b.CisTrans == mol.Trans {
+						phi0 = math.Pi
+					}
+					ff.torsions = append(ff.torsions, torsionTerm{i, j, l, q, 1, phi0, kCisTrans})
+				case planar && t.hyb[j] != 1 && t.hyb[l] != 1:
+					ff.torsions = append(ff.torsions, torsionTerm{i, j, l, q, 2, 0, kPlanar})
+				case staggered:
+					ff.torsions = append(ff.torsions, torsionTerm{i, j, l, q, 3, math.Pi / 3, kStaggered})
+				}
+			}
+		}
+	}
+
+	for c, a := range m.Atoms {
+		if a.Chirality == mol.ChiralNone {
+			continue
+		}
+		refs := a.StereoRefs
+		for k, r := range refs {
+			if r < 0 {
+				// 孤對電子：中心原子與孤對電子在另外三個鄰居所在平面的同一側，三重積的符號相同
+				refs[k] = c
+			}
+		}
+		sign := 1.0
+		if a.Chirality == mol.ChiralCCW {
+			sign = -1
+		}
+		ff.chirals = append(ff.chirals, chiralTerm{refs[0], refs[1], refs[2], refs[3], sign})
+	}
+
+	for i := 0; i < n; i++ {
+		ri := radius(vdwRadius, m.Atoms[i].Symbol, 2.0)
+		for j := i + 1; j < n; j++ {
+			s := sep[i][j]
+			if s == 1 || s == 2 {
+				continue
+			}
+			scale := 0.75
+			if s == 3 {
+				scale = 0.6
+			}
+			ff.pairs = append(ff.pairs, pairTerm{i, j, scale * (ri + radius(vdwRadius, m.Atoms[j].Symbol, 2.0))})
+		}
+	}
+	return ff
+}
+
+// energy 計算座標 x（每個原子三個值）的能量；g 不為 nil 時同時把梯度寫入 g
+func (ff *forceField) energy(x, g []float64) float64 {
+	if g != nil {
+		for i := range g {
+			g[i] = 0
+		}
+	}
+	e := 0.0
+	for _, b := range ff.bonds {
+		d := sub(x, b.j, b.i)
+		r := norm(d)
+		diff := r - b.r0
+		e += kBond * diff * diff
+		if g != nil && r > 1e-12 {
+			addGrad(g, b.j, scale(d, 2*kBond*diff/r))
+			addGrad(g, b.i, scale(d, -2*kBond*diff/r))
+		}
+	}
+	for _, a := range ff.angles {
+		u, v := sub(x, a.i, a.j), sub(x, a.k, a.j)
+		lu, lv := norm(u), norm(v)
+		if lu < 1e-12 || lv < 1e-12 {
+			continue
+		}
+		cos := dot(u, v) / (lu * lv)
+		diff := cos - a.cos0
+		e += kAngle * diff * diff
+		if g != nil {
+			f := 2 * kAngle * diff
+			gi := scale(add(scale(v, 1/(lu*lv)), scale(u, -cos/(lu*lu))), f)
+			gk := scale(add(scale(u, 1/(lu*lv)), scale(v, -cos/(lv*lv))), f)
+			addGrad(g, a.i, gi)
+			addGrad(g, a.k, gk)
+			addGrad(g, a.j, scale(add(gi, gk), -1))
+		}
+	}
+	for _, t := range ff.torsions {
+		phi, gi, gj, gk, gl, ok := dihedral(x, t.i, t.j, t.k, t.l, g != nil)
+		if !ok {
+			continue
+		}
+		e += t.k0 * (1 - math.Cos(t.n*(phi-t.phi0)))
+		if g != nil {
+			f := t.k0 * t.n * math.Sin(t.n*(phi-t.phi0))
+			addGrad(g, t.i, scale(gi, f))
+			addGrad(g, t.j, scale(gj, f))
+			addGrad(g, t.k, scale(gk, f))
+			addGrad(g, t.l, scale(gl, f))
+		}
+	}
+	for _, p := range ff.planes {
+		v, ga, gb, gc, gd := tripleProduct(x, p.center, p.a, p.b, p.c)
+		e += kPlane * v * v
+		if g != nil {
+			f := 2 * kPlane * v
+			addGrad(g, p.center, scale(ga, f))
+			addGrad(g, p.a, scale(gb, f))
+			addGrad(g, p.b, scale(gc, f))
+			addGrad(g, p.c, scale(gd, f))
+		}
+	}
+	for _, c := range ff.chirals {
+		v, ga, gb, gc, gd := tripleProduct(x, c.a, c.b, c.c, c.d)
+		short := chiralVolume - c.sign*v
+		if short <= 0 {
+			continue
+		}
+		e += kChiral * short * short
+		if g != nil {
+			f := -2 * kChiral * short * c.sign
+			addGrad(g, c.a, scale(ga, f))
+			addGrad(g, c.b, scale(gb, f))
+			addGrad(g, c.c, scale(gc, f))
+			addGrad(g, c.d, scale(gd, f))
+		}
+	}
+	for _, p := range ff.pairs {
+		d := sub(x, p.j, p.i)
+		r2 := dot(d, d)
+		if r2 >= p.rmin*p.rmin {
+			continue
+		}
+		r := math.Sqrt(r2)
+		diff := p.rmin - r
+		e += kRepulsion * diff * diff
+		if g != nil && r > 1e-12 {
+			addGrad(g, p.j, scale(d, -2*kRepulsion*diff/r))
+			addGrad(g, p.i, scale(d, 2*kRepulsion*diff/r))
+		}
+	}
+	return e
+}
+
+// tripleProduct 回傳 (b−a)·((c−a)×(d−a)) 與它對 a、b、c、d 的梯度
+func tripleProduct(x []float64, a, b, c, d int) (v float64, ga, gb, gc, gd vec) {
+	ba, ca, da := sub(x, b, a), sub(x, c, a), sub(x, d, a)
+	gb = cross(ca, da)
+	gc = cross(da, ba)
+	gd = cross(ba, ca)
+	v = dot(ba, gb)
+	ga = scale(add(add(gb, gc), gd), -1)
+	return
+}
+
+// dihedral 回傳 i–j–k–l 的二面角（−π 到 π）；grad 為 true 時也回傳 φ 對四個原子的梯度
+// （Blondel 與 Karplus 的公式）。三個原子共線時回傳 false。
+func dihedral(x []float64, i, j, k, l int, grad bool) (phi float64, gi, gj, gk, gl vec, ok bool) {
+	b1, b2, b3 := sub(x, j, i), sub(x, k, j), sub(x, l, k)
+	n1, n2 := cross(b1, b2), cross(b2, b3)
+	lb2 := norm(b2)
+	nn1, nn2 := dot(n1, n1), dot(n2, n2)
+	if lb2 < 1e-12 || nn1 < 1e-12 || nn2 < 1e-12 {
+		return 0, vec{}, vec{}, vec{}, vec{}, false
+	}
+	phi = math.Atan2(lb2*dot(b1, n2), dot(n1, n2))
+	if !grad {
+		return phi, vec{}, vec{}, vec{}, vec{}, true
+	}
+	gi = scale(n1, -lb2/nn1)
+	gl = scale(n2, lb2/nn2)
+	f1 := dot(b1, b2) / (lb2 * lb2)
+	f3 := dot(b3, b2) / (lb2 * lb2)
+	gj = add(scale(gi, -1-f1), scale(gl, f3))
+	gk = add(scale(gi, f1), scale(gl, -1-f3))
+	return phi, gi, gj, gk, gl, true
+}
+
+// vec 是三維向量
+type vec [3]float64
+
+func sub(x []float64, i, j int) vec {
+	return vec{x[3*i] - x[3*j], x[3*i+1] - x[3*j+1], x[3*i+2] - x[3*j+2]}
+}
+
+func addGrad(g []float64, i int, v vec) {
+	g[3*i] += v[0]
+	g[3*i+1] += v[1]
+	g[3*i+2] += v[2]
+}
+
+func add(a, b vec) vec           { return vec{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func scale(a vec, f float64) vec { return vec{a[0] * f, a[1] * f, a[2] * f} }
+func dot(a, b vec) float64       { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func norm(a vec) float64         { return math.Sqrt(dot(a, a)) }
+func cross(a, b vec) vec {
+	return vec{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
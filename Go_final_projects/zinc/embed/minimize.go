@@ -0,0 +1,117 @@
+package embed
+
+import "math"
+
+// lbfgsHistory 是 L-BFGS 保留的修正對數
+const lbfgsHistory = 8
+
+// maxStep 是每次迭代單一座標的最大位移（Å），避免一開始的大梯度把原子甩開
+const maxStep = 0.3
+
+// minimize 以 L-BFGS 與回溯線搜尋最小化 f，x 會被原地更新；
+// 梯度的均方根小於 tol 或達到 maxIter 時停止，回傳最後的函數值
+func minimize(f func(x, g []float64) float64, x []float64, maxIter int, tol float64) float64 {
+	n := len(x)
+	g := make([]float64, n)
+	fx := f(x, g)
+	var s, y [][]float64
+	var rho []float64
+	d := make([]float64, n)
+	xNew := make([]float64, n)
+	gNew := make([]float64, n)
+	alpha := make([]float64, lbfgsHistory)
+
+	for iter := 0; iter < maxIter; iter++ {
+		if math.Sqrt(dotN(g, g)/float64(n)) < tol {
+			break
+		}
+		// two-loop recursion：d = −H·g
+		copy(d, g)
+		for k := len(s) - 1; k >= 0; k-- {
+			alpha[k] = rho[k] * dotN(s[k], d)
+			axpy(d, -alpha[k], y[k])
+		}
+		if k := len(s) - 1; k >= 0 {
+			gamma := dotN(s[k], y[k]) / dotN(y[k], y[k])
+			for i := range d {
+				d[i] *= gamma
+			}
+		}
+		for k := range s {
+			beta := rho[k] * dotN(y[k], d)
+			axpy(d, alpha[k]-beta, s[k])
+		}
+		for i := range d {
+			d[i] = -d[i]
+		}
+		slope := dotN(g, d)
+		if slope >= 0 {
+			// 不是下降方向：捨棄歷史，改用最陡下降
+			s, y, rho = s[:0], y[:0], rho[:0]
+			for i := range d {
+				d[i] = -g[i]
+			}
+			slope = dotN(g, d)
+		}
+
+		step := 1.0
+		largest := 0.0
+		for _, v := range d {
+			largest = max(largest, math.Abs(v))
+		}
+		if largest*step > maxStep {
+			step = maxStep / largest
+		}
+		accepted := false
+		var fNew float64
+		for try := 0; try < 30; try++ {
+			for i := range x {
+				xNew[i] = x[i] + step*d[i]
+			}
+			fNew = f(xNew, gNew)
+			if fNew <= fx+1e-4*step*slope {
+				accepted = true
+				break
+			}
+			step /= 2
+		}
+		if !accepted {
+			if len(s) == 0 {
+				break // 最陡下降也找不到更低的點
+			}
+			s, y, rho = s[:0], y[:0], rho[:0]
+			continue
+		}
+
+		sk, yk := make([]float64, n), make([]float64, n)
+		for i := range x {
+			sk[i] = xNew[i] - x[i]
+			yk[i] = gNew[i] - g[i]
+		}
+		if sy := dotN(sk, yk); sy > 1e-10 {
+			if len(s) == lbfgsHistory {
+				s, y, rho = s[1:], y[1:], rho[1:]
+			}
+			s, y, rho = append(s, sk), append(y, yk), append(rho, 1/sy)
+		}
+		copy(x, xNew)
+		copy(g, gNew)
+		fx = fNew
+	}
+	return fx
+}
+
+func dotN(a, b []float64) float64 {
+	s := 0.0
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+// axpy 計算 y += a·x
+func axpy(y []float64, a float64, x []float64) {
+	for i := range y {
+		y[i] += a * x[i]
+	}
+}
@@ -0,0 +1,225 @@
+package embed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/pipeline"
+	"zinc/sdf"
+)
+
+// Report 是一次產生構形的結果
+type Report struct {
+	Output   string            `json:"output"`
+	Embedded int               `json:"embedded"`
+	Failed   []merge.Rejection `json:"failed"` // 無法讀取、解析或產生構形的檔案與紀錄
+}
+
+// task 是一個待處理的分子；讀取失敗的紀錄也以 task 傳遞，才能依輸入順序回報
+type task struct {
+	path   string
+	record int
+	line   int // 解析錯誤所在的行
+	id     string
+	m      *mol.Molecule
+	done   chan result
+}
+
+type result struct {
+	m   *mol.Molecule
+	err error
+}
+
+// Run 以 opt.Workers 個 goroutine 為 files 中的每個分子產生三維構形，並依輸入的順序寫出：
+// out 以 .sdf 結尾時寫成一個 SD 檔，否則寫到 out 目錄中並沿用來源的檔名（與 filter.Run 相同）。
+// 兩種輸出都先寫到暫存位置，完成後才取代舊的輸出；ctx 取消時不會留下不完整的結果。
+func Run(ctx context.Context, files []string, out string, opt Options) (*Report, error) {
+	report := &Report{Output: out, Failed: []merge.Rejection{}}
+	if strings.EqualFold(filepath.Ext(out), ".sdf") {
+		err := pipeline.WriteAtomic(out, func(w io.Writer) error {
+			sw := sdf.NewWriter(w)
+			err := each(ctx, files, opt, report, func(path, id string, m *mol.Molecule) error { return sw.Write(m) })
+			if err != nil {
+				return err
+			}
+			return sw.Flush()
+		})
+		return report, err
+	}
+
+	for _, f := range files {
+		if filepath.Clean(filepath.Dir(f)) == filepath.Clean(out) {
+			return nil, fmt.Errorf("output directory %s is also the input directory", out)
+		}
+	}
+	tmp := out + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	err := each(ctx, files, opt, report, func(path, id string, m *mol.Molecule) error {
+		name := filepath.Base(path)
+		if used[name] {
+			name = id + ".sdf"
+		}
+		used[name] = true
+		f, err := os.Create(filepath.Join(tmp, name))
+		if err != nil {
+			return err
+		}
+		sw := sdf.NewWriter(f)
+		err = sw.Write(m)
+		if err == nil {
+			err = sw.Flush()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return report, err
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return report, err
+	}
+	return report, os.Rename(tmp, out)
+}
+
+// each 在背景讀取檔案、交給 worker 平行產生構形，再依讀取的順序把結果交給 emit。
+// order 的緩衝限制了同時在記憶體中的分子數；emit 失敗時取消其餘的工作並回傳該錯誤。
+func each(ctx context.Context, files []string, opt Options, report *Report, emit func(path, id string, m *mol.Molecule) error) error {
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tasks := make(chan *task)
+	order := make(chan *task, 4*workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				m, err := Embed(t.m, opt)
+				t.done <- result{m, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(order)
+		defer close(tasks)
+		read(ctx, files, func(t *task) bool {
+			select {
+			case order <- t:
+			case <-ctx.Done():
+				return false
+			}
+			if t.m == nil {
+				return true
+			}
+			select {
+			case tasks <- t:
+				return true
+			case <-ctx.Done():
+				t.done <- result{err: ctx.Err()}
+				return false
+			}
+		})
+	}()
+
+	var err error
+	for t := range order {
+		r := <-t.done
+		if err != nil {
+			continue // 已經失敗：只清空佇列
+		}
+		if r.err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			report.Failed = append(report.Failed, merge.Rejection{File: t.path, Record: t.record, Line: t.line, Reason: r.err.Error()})
+			continue
+		}
+		if err = emit(t.path, t.id, r.m); err != nil {
+			cancel()
+			continue
+		}
+		report.Embedded++
+	}
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// read 依序讀取每個檔案的紀錄，略過重複的 ZINC ID；send 回傳 false 時停止
+func read(ctx context.Context, files []string, send func(t *task) bool) {
+	seen := make(map[string]bool)
+	failed := func(path string, record, line int, reason string) bool {
+		t := &task{path: path, record: record, line: line, done: make(chan result, 1)}
+		t.done <- result{err: errors.New(reason)}
+		return send(t)
+	}
+	for _, path := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			if !failed(path, 0, 0, err.Error()) {
+				return
+			}
+			continue
+		}
+		sr := sdf.NewReader(file)
+		for record := 1; ; record++ {
+			m, err := sr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var perr *sdf.ParseError
+				if errors.As(err, &perr) {
+					if !failed(path, record, perr.Line, perr.Msg) {
+						file.Close()
+						return
+					}
+					continue
+				}
+				failed(path, record, 0, err.Error())
+				break
+			}
+			id := m.ZincID()
+			if id == "" {
+				id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if !send(&task{path: path, record: record, id: id, m: m, done: make(chan result, 1)}) {
+				file.Close()
+				return
+			}
+		}
+		file.Close()
+	}
+}
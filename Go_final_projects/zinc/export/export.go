@@ -0,0 +1,424 @@
+// Package export 把下載的配體庫轉成 CSV、JSON Lines 或 .smi 檔，欄位可以選擇：
+// ZINC ID、正規 SMILES、tranche、挑選時的條件與描述符。紀錄逐筆讀取、逐筆寫出，
+// 因此數十萬筆的配體庫也不需要整個放進記憶體。
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"zinc/catalog"
+	"zinc/descriptor"
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/sample"
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+// Format 是輸出格式
+type Format string
+
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+	SMI   Format = "smi" // SMILES 在第一欄，其餘欄位以 tab 分隔，沒有標題列
+)
+
+// ParseFormat 解析格式名稱，也接受 ndjson、smiles 與帶點的副檔名
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), ".")) {
+	case "csv":
+		return CSV, nil
+	case "jsonl", "ndjson":
+		return JSONL, nil
+	case "smi", "smiles":
+		return SMI, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want csv, jsonl or smi)", s)
+}
+
+// FromFileName 依副檔名決定格式，例如 library.jsonl
+func FromFileName(name string) (Format, error) {
+	return ParseFormat(filepath.Ext(name))
+}
+
+// ContentType 回傳 HTTP 回應使用的 Content-Type
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSONL:
+		return "application/x-ndjson"
+	}
+	return "chemical/x-daylight-smiles"
+}
+
+// Row 是一筆要匯出的分子，SMILES 與描述符在第一次需要時才計算
+type Row struct {
+	Molecule  *mol.Molecule
+	ZincID    string
+	File      string
+	Tranche   string
+	Condition string // 挑選時的條件，例如 AG:10:maxmin
+	// Properties 是已知的描述符（例如資料庫中記錄的），為 nil 時從結構計算
+	Properties *descriptor.Descriptors
+
+	smiles string
+}
+
+// SMILES 回傳分子的正規 SMILES
+func (r *Row) SMILES() string {
+	if r.smiles == "" {
+		r.smiles = smiles.Canonical(r.Molecule)
+	}
+	return r.smiles
+}
+
+// Descriptors 回傳分子的描述符
+func (r *Row) Descriptors() *descriptor.Descriptors {
+	if r.Properties == nil {
+		d := descriptor.Compute(r.Molecule)
+		r.Properties = &d
+	}
+	return r.Properties
+}
+
+// column 是一個可以匯出的欄位；value 回傳 JSON Lines 中的值，文字格式再轉成字串
+type column struct {
+	name  string
+	value func(r *Row) any
+}
+
+// round 把浮點數描述符取到小數第四位，避免輸出 179.17200000000003 之類的值
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+var columns = []column{
+	{"zinc_id", func(r *Row) any { return r.ZincID }},
+	{"smiles", func(r *Row) any { return r.SMILES() }},
+	{"tranche", func(r *Row) any { return r.Tranche }},
+	{"condition", func(r *Row) any { return r.Condition }},
+	{"file", func(r *Row) any { return r.File }},
+	{"formula", func(r *Row) any { return r.Descriptors().Formula }},
+	{"mw", func(r *Row) any { return round(r.Descriptors().MolecularWeight) }},
+	{"exact_mass", func(r *Row) any { return round(r.Descriptors().MonoisotopicMass) }},
+	{"heavy_atoms", func(r *Row) any { return r.Descriptors().HeavyAtoms }},
+	{"hbd", func(r *Row) any { return r.Descriptors().HBondDonors }},
+	{"hba", func(r *Row) any { return r.Descriptors().HBondAcceptors }},
+	{"rotatable_bonds", func(r *Row) any { return r.Descriptors().RotatableBonds }},
+	{"rings", func(r *Row) any { return r.Descriptors().Rings }},
+	{"tpsa", func(r *Row) any { return round(r.Descriptors().TPSA) }},
+	{"logp", func(r *Row) any { return round(r.Descriptors().LogP) }},
+}
+
+// DefaultColumns 是沒有指定欄位時匯出的欄位
+var DefaultColumns = []string{"zinc_id", "smiles", "tranche", "condition", "mw", "logp"}
+
+// Columns 回傳所有可以匯出的欄位名稱
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// ParseColumns 解析以逗號或空白分隔的欄位清單；空字串為 DefaultColumns，all 為所有欄位
+func ParseColumns(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' })
+	switch {
+	case len(fields) == 0:
+		return DefaultColumns, nil
+	case len(fields) == 1 && strings.EqualFold(fields[0], "all"):
+		return Columns(), nil
+	}
+	var names []string
+	for _, f := range fields {
+		name := strings.ToLower(f)
+		if _, ok := lookupColumn(name); !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", f, strings.Join(Columns(), ", "))
+		}
+		for _, n := range names {
+			if n == name {
+				return nil, fmt.Errorf("column %q listed twice", f)
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func lookupColumn(name string) (column, bool) {
+	for _, c := range columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// Writer 把 Row 逐筆寫成指定格式
+type Writer struct {
+	format  Format
+	columns []column
+	bw      *bufio.Writer
+	cw      *csv.Writer
+	record  []string
+}
+
+// NewWriter 建立寫到 w 的 Writer。CSV 會先寫出標題列；.smi 的第一欄一定是 SMILES，
+// names 中沒有 smiles 時會自動加上。
+func NewWriter(w io.Writer, format Format, names []string) (*Writer, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	ew := &Writer{format: format, bw: bufio.NewWriter(w)}
+	if format == SMI {
+		c, _ := lookupColumn("smiles")
+		ew.columns = append(ew.columns, c)
+	}
+	for _, name := range names {
+		c, ok := lookupColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if format != SMI || name != "smiles" {
+			ew.columns = append(ew.columns, c)
+		}
+	}
+	ew.record = make([]string, len(ew.columns))
+
+	switch format {
+	case CSV:
+		ew.cw = csv.NewWriter(ew.bw)
+		for i, c := range ew.columns {
+			ew.record[i] = c.name
+		}
+		ew.cw.Write(ew.record)
+	case JSONL, SMI:
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	return ew, nil
+}
+
+// Write 寫出一筆紀錄
+func (w *Writer) Write(r *Row) error {
+	if w.format == JSONL {
+		var b bytes.Buffer
+		b.WriteByte('{')
+		for i, c := range w.columns {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(c.name)
+			value, err := json.Marshal(c.value(r))
+			if err != nil {
+				return err
+			}
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(value)
+		}
+		b.WriteString("}\n")
+		_, err := w.bw.Write(b.Bytes())
+		return err
+	}
+
+	for i, c := range w.columns {
+		w.record[i] = text(c.value(r))
+	}
+	if w.format == CSV {
+		return w.cw.Write(w.record)
+	}
+	_, err := w.bw.WriteString(strings.Join(w.record, "\t") + "\n")
+	return err
+}
+
+// Flush 把緩衝區內容寫出
+func (w *Writer) Flush() error {
+	if w.cw != nil {
+		w.cw.Flush()
+		if err := w.cw.Error(); err != nil {
+			return err
+		}
+	}
+	return w.bw.Flush()
+}
+
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// Library 是要匯出的配體庫：下載目錄中的單一分子 SD 檔，或合併後的 SD 檔
+type Library struct {
+	Files []string
+	// Manifest 不為 nil 時，選出的 ID 的 tranche 與 condition 取自挑選時的條件
+	Manifest *sample.Manifest
+	// Catalog 不為 nil 時，manifest 中沒有的 ID 從資料庫查詢 tranche，並使用資料庫中記錄的描述符
+	Catalog *catalog.Catalog
+
+	picks map[string]*sample.Pick
+}
+
+// Open 建立 in 的配體庫：in 可以是下載目錄或單一 SD 檔
+func Open(in string) (*Library, error) {
+	info, err := os.Stat(in)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &Library{Files: []string{in}}, nil
+	}
+	files, err := merge.ListSDFFiles(in)
+	if err != nil {
+		return nil, err
+	}
+	return &Library{Files: files}, nil
+}
+
+// Summary 是一次匯出的結果
+type Summary struct {
+	Files      int               `json:"files"`
+	Rows       int               `json:"rows"`
+	Duplicates int               `json:"duplicates"`
+	Rejected   []merge.Rejection `json:"rejected"`
+}
+
+// Export 依序串流讀取每個檔案並寫到 w，每個 ZINC ID 只寫出第一次出現的紀錄。
+// 無法讀取或解析的紀錄記錄在 Summary 中並略過；寫入 w 失敗才會回傳 error。
+func (l *Library) Export(w *Writer) (*Summary, error) {
+	if l.Manifest != nil && l.picks == nil {
+		l.picks = make(map[string]*sample.Pick)
+		for i := range l.Manifest.Picks {
+			p := &l.Manifest.Picks[i]
+			for _, id := range p.Selected {
+				if _, ok := l.picks[id]; !ok {
+					l.picks[id] = p
+				}
+			}
+		}
+	}
+
+	sum := &Summary{Rejected: []merge.Rejection{}}
+	seen := make(map[string]bool)
+	for _, path := range l.Files {
+		sum.Files++
+		err := l.exportFile(path, w, sum, seen)
+		if err != nil {
+			return sum, err
+		}
+	}
+	return sum, w.Flush()
+}
+
+func (l *Library) exportFile(path string, w *Writer, sum *Summary, seen map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		sum.Rejected = append(sum.Rejected, merge.Rejection{File: path, Reason: err.Error()})
+		return nil
+	}
+	defer file.Close()
+
+	r := sdf.NewReader(file)
+	for record := 1; ; record++ {
+		m, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			rej := merge.Rejection{File: path, Record: record, Reason: err.Error()}
+			var perr *sdf.ParseError
+			if !errors.As(err, &perr) {
+				// 讀取錯誤，檔案剩下的部分無法再讀
+				sum.Rejected = append(sum.Rejected, rej)
+				return nil
+			}
+			rej.Line, rej.Reason = perr.Line, perr.Msg
+			sum.Rejected = append(sum.Rejected, rej)
+			continue
+		}
+
+		row := l.row(m, path)
+		if seen[row.ZincID] {
+			sum.Duplicates++
+			continue
+		}
+		seen[row.ZincID] = true
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		sum.Rows++
+	}
+}
+
+// row 從 manifest、紀錄的 <tranche> 欄位（zinc annotate 寫入）與資料庫補上 tranche 等欄位
+func (l *Library) row(m *mol.Molecule, path string) *Row {
+	row := &Row{Molecule: m, ZincID: m.ZincID(), File: path}
+	if row.ZincID == "" {
+		row.ZincID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if p, ok := l.picks[row.ZincID]; ok {
+		row.Tranche = p.MolecularWeight + p.LogP
+		row.Condition = p.Condition.String()
+	}
+	if row.Tranche == "" {
+		row.Tranche, _ = m.Field("tranche")
+	}
+	if l.Catalog != nil {
+		if lig, err := l.Catalog.Get(row.ZincID); err == nil && lig != nil {
+			if row.Tranche == "" {
+				row.Tranche = lig.Tranche
+			}
+			row.Properties = lig.Properties
+		}
+	}
+	return row
+}
+
+// Serve 把配體庫以查詢參數 format（預設 csv）與 columns 指定的格式串流回應，
+// 下載的檔名為 name 加上副檔名。開始寫出後發生的錯誤無法再回報給用戶端，只會讓回應提早結束。
+func Serve(w http.ResponseWriter, r *http.Request, lib *Library, name string) {
+	format := CSV
+	if v := r.FormValue("format"); v != "" {
+		var err error
+		if format, err = ParseFormat(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	names, err := ParseColumns(r.FormValue("columns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ew, err := NewWriter(w, format, names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+string(format)))
+	lib.Export(ew)
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zinc/sample"
+)
+
+const fixture = "../sdf/testdata/ZINC000014418328.sdf"
+
+func TestParseColumns(t *testing.T) {
+	if names, err := ParseColumns(""); err != nil || strings.Join(names, ",") != strings.Join(DefaultColumns, ",") {
+		t.Errorf("ParseColumns(\"\") = %v, %v", names, err)
+	}
+	if names, err := ParseColumns("all"); err != nil || len(names) != len(columns) {
+		t.Errorf("ParseColumns(all) = %v, %v", names, err)
+	}
+	if names, err := ParseColumns("ZINC_ID, logp,tpsa"); err != nil || strings.Join(names, ",") != "zinc_id,logp,tpsa" {
+		t.Errorf("ParseColumns = %v, %v", names, err)
+	}
+	for _, bad := range []string{"zinc_id,size", "mw,mw"} {
+		if _, err := ParseColumns(bad); err == nil {
+			t.Errorf("ParseColumns(%q) succeeded", bad)
+		}
+	}
+}
+
+// library 建立一個下載目錄：兩個分子、一個重複的檔案與一個損壞的檔案
+func library(t *testing.T) *Library {
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	other := bytes.ReplaceAll(data, []byte("ZINC000014418328"), []byte("ZINC000000000007"))
+	os.WriteFile(filepath.Join(dir, "ZINC000014418328.sdf"), data, 0o644)
+	os.WriteFile(filepath.Join(dir, "ZINC000000000007.sdf"), other, 0o644)
+	os.WriteFile(filepath.Join(dir, "copy.sdf"), data, 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.sdf"), []byte("broken\n\n\n  x\n$$$$\n"), 0o644)
+
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.Manifest = &sample.Manifest{Picks: []sample.Pick{
+		{Condition: sample.Condition{MolecularWeight: "A", LogP: "G", Quantity: 1, Selection: "maxmin"}, Selected: []string{"ZINC000014418328"}},
+	}}
+	return lib
+}
+
+func TestExportCSV(t *testing.T) {
+	lib := library(t)
+	var b bytes.Buffer
+	w, err := NewWriter(&b, CSV, []string{"zinc_id", "tranche", "condition", "formula", "mw", "hbd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := lib.Export(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Files != 4 || sum.Rows != 2 || sum.Duplicates != 1 || len(sum.Rejected) != 1 {
+		t.Errorf("summary = %+v", sum)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 檔名排序：ZINC000000000007.sdf、ZINC000014418328.sdf、broken.sdf、copy.sdf
+	want := [][]string{
+		{"zinc_id", "tranche", "condition", "formula", "mw", "hbd"},
+		{"ZINC000000000007", "", "", "C6H13NO5", "179.172", "6"},
+		{"ZINC000014418328", "AG", "AG:1:maxmin", "C6H13NO5", "179.172", "6"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %q", records)
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestExportJSONLAndSMI(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, JSONL, []string{"zinc_id", "smiles", "rings", "logp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library(t).Export(w); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"zinc_id":"ZINC000000000007","smiles":`) {
+		t.Fatalf("jsonl = %s", b.String())
+	}
+	var row struct {
+		ZincID string  `json:"zinc_id"`
+		SMILES string  `json:"smiles"`
+		Rings  int     `json:"rings"`
+		LogP   float64 `json:"logp"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row.ZincID != "ZINC000014418328" || row.SMILES == "" || row.Rings != 1 {
+		t.Errorf("row = %+v", row)
+	}
+	smiles := row.SMILES
+
+	// .smi：SMILES 一定在第一欄，沒有標題列
+	b.Reset()
+	if w, err = NewWriter(&b, SMI, []string{"zinc_id", "tranche"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library(t).Export(w); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || lines[1] != smiles+"\tZINC000014418328\tAG" {
+		t.Errorf("smi = %q", lines)
+	}
+}
@@ -0,0 +1,378 @@
+// Package fakezinc 是離線測試用的假 ZINC 伺服器。它提供 tranche 子集頁面
+// （/substances/subsets/XX/?page=N，與 ZINC20 相同的 .zinc-id.caption 標記與分頁連結）
+// 以及單一分子檔案（/substances/ZINC….sdf 與 .smi），並可以對指定的網址注入
+// 404、429、緩慢回應與被截斷的內容。測試中以 httptest.NewServer(fakezinc.New()) 使用，
+// 也可以用 cmd/fakezinc 單獨執行，再把各工具的 base URL 指向它。
+package fakezinc
+
+import (
+	_ "embed"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPageSize 是每一頁列出的 ID 數
+const DefaultPageSize = 20
+
+// substanceSDF 是沒有登錄檔案的分子使用的結構，標題與 <zinc_id> 會換成請求的 ID
+//
+//go:embed substance.sdf
+var substanceSDF string
+
+// Fault 是注入到某個網址的錯誤
+type Fault struct {
+	Status     int           // 回應的狀態碼，例如 404、429；0 表示正常回應內容
+	RetryAfter int           // Status 為 429 或 503 時的 Retry-After 秒數，0 表示不送
+	Delay      time.Duration // 回應前等待的時間
+	Truncate   bool          // 宣告完整的 Content-Length，只送出一半內容就中斷連線
+	Times      int           // 生效的次數，0 表示每一次
+}
+
+// ParseFault 解析以逗號分隔的錯誤描述，例如 "429,retry-after=1,times=2"、"delay=2s"、"truncate"
+func ParseFault(spec string) (Fault, error) {
+	var f Fault
+	for _, part := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch key {
+		case "truncate":
+			f.Truncate = true
+		case "delay":
+			f.Delay, err = time.ParseDuration(value)
+		case "retry-after":
+			f.RetryAfter, err = strconv.Atoi(value)
+		case "times":
+			f.Times, err = strconv.Atoi(value)
+		default:
+			if f.Status, err = strconv.Atoi(key); err == nil && (f.Status < 100 || f.Status > 599) {
+				err = fmt.Errorf("status %d out of range", f.Status)
+			}
+		}
+		if err != nil {
+			return Fault{}, fmt.Errorf("fault %q: %v", spec, err)
+		}
+	}
+	return f, nil
+}
+
+// injected 是一個注入的錯誤與它剩下的次數
+type injected struct {
+	pattern string
+	fault   Fault
+	left    int
+}
+
+// Server 是假的 ZINC 伺服器，實作 http.Handler
+type Server struct {
+	// PageSize 是每一頁的 ID 數，0 表示 DefaultPageSize
+	PageSize int
+
+	mu         sync.Mutex
+	tranches   map[string][]string       // tranche -> 補足 12 位數的 ID，依加入順序
+	pages      map[string]map[int][]byte // 登錄的頁面，原樣回應
+	substances map[string][]byte         // 登錄的 sdf 檔
+	owner      map[string]string         // ID -> tranche
+	faults     []*injected
+	requests   map[string]int
+}
+
+// New 建立沒有任何 tranche 的伺服器
+func New() *Server {
+	return &Server{
+		tranches:   make(map[string][]string),
+		pages:      make(map[string]map[int][]byte),
+		substances: make(map[string][]byte),
+		owner:      make(map[string]string),
+		requests:   make(map[string]int),
+	}
+}
+
+// AddTranche 把 ids 加入 tranche；頁面依加入順序分頁，這些 ID 的分子檔案可以下載
+func (s *Server) AddTranche(name string, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		id = formatID(id)
+		if _, ok := s.owner[id]; ok {
+			continue
+		}
+		s.owner[id] = name
+		s.tranches[name] = append(s.tranches[name], id)
+	}
+}
+
+// SetPage 登錄 tranche 第 page 頁的 HTML（例如從 ZINC20 存下的頁面），請求時原樣回應
+func (s *Server) SetPage(name string, page int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pages[name] == nil {
+		s.pages[name] = make(map[int][]byte)
+	}
+	s.pages[name][page] = body
+}
+
+// AddSubstance 登錄分子的 sdf 檔；沒有登錄的 tranche 成員使用內建的結構
+func (s *Server) AddSubstance(id string, sdf []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.substances[formatID(id)] = sdf
+}
+
+// Inject 讓符合 pattern 的請求回應錯誤。pattern 是請求的路徑，子集頁面包含頁碼，
+// 例如 "/substances/subsets/AG/?page=2" 或 "/substances/ZINC000000000001.sdf"；
+// 以 "*" 結尾時比對前綴。同一個請求符合多個錯誤時使用最早注入且還有剩餘次數的那一個。
+func (s *Server) Inject(pattern string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &injected{pattern: pattern, fault: f, left: f.Times})
+}
+
+// Requests 回傳路徑（格式與 Inject 的 pattern 相同）被請求的次數
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// SyntheticIDs 產生 tranche 的 n 個固定 ID，不同 tranche 的 ID 不會重複
+func SyntheticIDs(name string, n int) []string {
+	base := 0
+	for _, c := range strings.ToUpper(name) {
+		base = base*26 + int(c-'A'+1)
+	}
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("ZINC%012d", base*1000000+i+1)
+	}
+	return ids
+}
+
+// LoadDir 從目錄載入記錄的資料：subsets/XX.txt 是 tranche 的 ID 清單（每行一個），
+// subsets/XX/N.html 是原樣回應的第 N 頁，substances/ZINC….sdf 是分子檔案
+func (s *Server) LoadDir(dir string) error {
+	lists, err := filepath.Glob(filepath.Join(dir, "subsets", "*.txt"))
+	if err != nil {
+		return err
+	}
+	for _, path := range lists {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.AddTranche(strings.TrimSuffix(filepath.Base(path), ".txt"), strings.Fields(string(data))...)
+	}
+	pages, err := filepath.Glob(filepath.Join(dir, "subsets", "*", "*.html"))
+	if err != nil {
+		return err
+	}
+	for _, path := range pages {
+		n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".html"))
+		if err != nil {
+			return fmt.Errorf("%s: page file names must be page numbers", path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.SetPage(filepath.Base(filepath.Dir(path)), n, data)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "substances", "*.sdf"))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.AddSubstance(strings.TrimSuffix(filepath.Base(path), ".sdf"), data)
+	}
+	return nil
+}
+
+// ServeHTTP 回應子集頁面與分子檔案，先套用注入的錯誤
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path
+	if page := r.URL.Query().Get("page"); page != "" {
+		key += "?page=" + page
+	}
+	s.mu.Lock()
+	s.requests[key]++
+	fault := s.takeFault(key)
+	s.mu.Unlock()
+
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.Status != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+		}
+		http.Error(w, http.StatusText(fault.Status), fault.Status)
+		return
+	}
+
+	body, contentType, status := s.content(r)
+	w.Header().Set("Content-Type", contentType)
+	if fault.Truncate && status == http.StatusOK {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body[:len(body)/2])
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		// 中斷連線，用戶端讀到的內容比 Content-Length 短
+		panic(http.ErrAbortHandler)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// takeFault 回傳 key 目前生效的錯誤並扣掉一次；呼叫者須持有 s.mu
+func (s *Server) takeFault(key string) Fault {
+	for _, in := range s.faults {
+		match := in.pattern == key
+		if prefix, ok := strings.CutSuffix(in.pattern, "*"); ok {
+			match = strings.HasPrefix(key, prefix)
+		}
+		if !match || (in.fault.Times > 0 && in.left == 0) {
+			continue
+		}
+		if in.fault.Times > 0 {
+			in.left--
+		}
+		return in.fault
+	}
+	return Fault{}
+}
+
+// content 產生請求的內容
+func (s *Server) content(r *http.Request) ([]byte, string, int) {
+	if name, ok := strings.CutPrefix(r.URL.Path, "/substances/subsets/"); ok {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		return s.subsetPage(strings.Trim(name, "/"), page), "text/html; charset=utf-8", http.StatusOK
+	}
+	if file, ok := strings.CutPrefix(r.URL.Path, "/substances/"); ok {
+		id, ext, _ := strings.Cut(file, ".")
+		if body, ok := s.substance(formatID(id), ext); ok {
+			if ext == "sdf" {
+				return body, "chemical/x-mdl-sdfile", http.StatusOK
+			}
+			return body, "text/plain; charset=utf-8", http.StatusOK
+		}
+	}
+	return []byte("404 page not found\n"), "text/plain; charset=utf-8", http.StatusNotFound
+}
+
+// subsetPage 產生子集頁面：與 ZINC20 一樣 ID 不補零，分頁連結只列出前後兩頁；超過最後一頁時是空白頁
+func (s *Server) subsetPage(name string, page int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body, ok := s.pages[name][page]; ok {
+		return body
+	}
+	size := s.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	ids := s.tranches[name]
+	last := (len(ids) + size - 1) / size
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><title>Subset %s</title></head><body>\n", html.EscapeString(name))
+	b.WriteString("<div class=\"row\">\n")
+	for i := (page - 1) * size; i < page*size && i < len(ids); i++ {
+		short := "ZINC" + strings.TrimLeft(ids[i][4:], "0")
+		fmt.Fprintf(&b, "<div class=\"col-sm-2 zinc-tile\"><h4 class=\"zinc-id caption\"><a href=\"/substances/%s/\">%s</a> <small>in stock</small></h4></div>\n", short, short)
+	}
+	b.WriteString("</div>\n")
+	if page <= last {
+		b.WriteString("<ul class=\"pagination\">\n")
+		for p := page - 2; p <= page+2 && p <= last; p++ {
+			if p >= 1 {
+				fmt.Fprintf(&b, "<li><a href=\"?page=%d\">%d</a></li>\n", p, p)
+			}
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString("</body></html>\n")
+	return []byte(b.String())
+}
+
+// substance 回傳分子檔案；只有 tranche 成員或登錄過的分子存在
+func (s *Server) substance(id, ext string) ([]byte, bool) {
+	s.mu.Lock()
+	recorded, isRecorded := s.substances[id]
+	_, isMember := s.owner[id]
+	s.mu.Unlock()
+	if !isRecorded && !isMember {
+		return nil, false
+	}
+	switch ext {
+	case "sdf":
+		if isRecorded {
+			return recorded, true
+		}
+		return []byte(sdfFor(id)), true
+	case "smi":
+		return []byte(smilesOf(substanceSDF) + " " + id + "\n"), true
+	}
+	return nil, false
+}
+
+// sdfFor 把內建結構的標題與 <zinc_id> 換成 id
+func sdfFor(id string) string {
+	lines := strings.Split(substanceSDF, "\n")
+	lines[0] = id
+	for i := 1; i < len(lines); i++ {
+		if strings.Contains(lines[i-1], "<zinc_id>") {
+			lines[i] = id
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func smilesOf(sdf string) string {
+	lines := strings.Split(sdf, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.Contains(lines[i-1], "<smiles>") {
+			return strings.TrimSpace(lines[i])
+		}
+	}
+	return ""
+}
+
+// formatID 把 ID 的數字部分補足為 12 位數
+func formatID(id string) string {
+	num := strings.TrimPrefix(strings.TrimSpace(id), "ZINC")
+	if len(num) < 12 {
+		num = strings.Repeat("0", 12-len(num)) + num
+	}
+	return "ZINC" + num
+}
+
+// Tranches 回傳已加入的 tranche，依名稱排序
+func (s *Server) Tranches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.tranches))
+	for name := range s.tranches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
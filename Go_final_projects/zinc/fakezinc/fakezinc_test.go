@@ -0,0 +1,211 @@
+package fakezinc_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zinc/catalog"
+	"zinc/download"
+	"zinc/fakezinc"
+	"zinc/merge"
+	"zinc/sample"
+	"zinc/scrape"
+)
+
+func TestParseFault(t *testing.T) {
+	f, err := fakezinc.ParseFault("429,retry-after=2,times=3")
+	if err != nil || f.Status != 429 || f.RetryAfter != 2 || f.Times != 3 {
+		t.Errorf("ParseFault = %+v, %v", f, err)
+	}
+	f, err = fakezinc.ParseFault("delay=1500ms,truncate")
+	if err != nil || f.Delay != 1500*time.Millisecond || !f.Truncate {
+		t.Errorf("ParseFault = %+v, %v", f, err)
+	}
+	for _, bad := range []string{"slow", "42", "delay=soon", "times=x"} {
+		if _, err := fakezinc.ParseFault(bad); err == nil {
+			t.Errorf("ParseFault(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "subsets", "AG"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "substances"), 0o755)
+	os.WriteFile(filepath.Join(dir, "subsets", "AG.txt"), []byte("ZINC1\nZINC2\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "subsets", "AG", "3.html"), []byte(`<h4 class="zinc-id caption">ZINC99</h4>`), 0o644)
+	os.WriteFile(filepath.Join(dir, "substances", "ZINC000000000099.sdf"), []byte("recorded\n$$$$\n"), 0o644)
+
+	srv := fakezinc.New()
+	if err := srv.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	s := scrape.New(scrape.Options{BaseURL: ts.URL})
+	res, err := s.Tranche(context.Background(), "AG", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第 1 頁是產生的頁面，第 2 頁是空白頁，記錄的第 3 頁與它們同一批抓取，原樣回應
+	if got := strings.Join(res.IDs, " "); got != "ZINC000000000001 ZINC000000000002 ZINC000000000099" {
+		t.Errorf("IDs = %s", got)
+	}
+	resp, err := http.Get(ts.URL + "/substances/ZINC99.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "recorded\n$$$$\n" {
+		t.Errorf("recorded substance = %q", body)
+	}
+}
+
+// TestEndToEnd 對假伺服器執行抓取 → 挑選 → 下載 → 合併，途中注入 429、緩慢回應、截斷的內容與 404
+func TestEndToEnd(t *testing.T) {
+	dir := t.TempDir()
+	srv := fakezinc.New()
+	srv.PageSize = 10
+	srv.AddTranche("AA", fakezinc.SyntheticIDs("AA", 25)...)
+	srv.AddTranche("AB", fakezinc.SyntheticIDs("AB", 12)...)
+	srv.Inject("/substances/subsets/AA/?page=2", fakezinc.Fault{Status: 429, RetryAfter: 1, Times: 1})
+	srv.Inject("/substances/subsets/AB/?page=1", fakezinc.Fault{Delay: time.Second, Times: 1})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// 抓取：失敗的頁面記錄下來，重試後補齊
+	cat, err := catalog.Open(filepath.Join(dir, "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cat.Close()
+	trancheDir := filepath.Join(dir, "zinc_ids")
+	os.MkdirAll(trancheDir, 0o755)
+	s := scrape.New(scrape.Options{BaseURL: ts.URL, Timeout: 200 * time.Millisecond})
+	for name, want := range map[string]int{"AA": 25, "AB": 12} {
+		res, err := s.Tranche(context.Background(), name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Failed) != 1 {
+			t.Fatalf("%s: failed pages = %+v, want one", name, res.Failed)
+		}
+		if err := s.Retry(context.Background(), res, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.IDs) != want || len(res.Failed) != 0 {
+			t.Fatalf("%s: %d IDs, failed %+v after retry; want %d", name, len(res.IDs), res.Failed, want)
+		}
+		if _, err := cat.Observe(name, res.IDs, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if _, err := cat.WriteTranche(name, &b); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(trancheDir, fmt.Sprintf("zinc_ids_%s.txt", name)), b.Bytes(), 0o644)
+	}
+
+	// 挑選：從資料庫讀取 tranche
+	sampler := &sample.Sampler{TrancheDir: trancheDir, Catalog: cat}
+	m, err := sampler.Run(7, []sample.Condition{
+		{MolecularWeight: "A", LogP: "A", Quantity: 5},
+		{MolecularWeight: "A", LogP: "B", Quantity: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := m.IDs()
+	if len(ids) != 8 {
+		t.Fatalf("sampled %d IDs", len(ids))
+	}
+
+	// 下載：第一個 ID 的 sdf 第一次被截斷（重試後成功），第二個 ID 的所有格式都不存在
+	truncated, missing := ids[0], ids[1]
+	srv.Inject("/substances/"+truncated+".sdf", fakezinc.Fault{Truncate: true, Times: 1})
+	srv.Inject("/substances/"+missing+".*", fakezinc.Fault{Status: 404})
+	src := download.Source{Version: "20", Formats: []string{"sdf", "smi"}, BaseURL: ts.URL, OutputDir: filepath.Join(dir, "set_1")}
+	opt := download.Options{Workers: 3, MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	reports, err := src.Run(context.Background(), ids, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range src.Formats {
+		r := reports[format]
+		if r.Downloaded != 7 || len(r.Failed) != 1 || r.Failed[0].ZincID != missing {
+			t.Errorf("%s: %d downloaded, failed %+v", format, r.Downloaded, r.Failed)
+		}
+	}
+	if n := srv.Requests("/substances/" + truncated + ".sdf"); n != 2 {
+		t.Errorf("truncated file requested %d times, want 2", n)
+	}
+
+	// 合併：每個分子的 <zinc_id> 不同，全部寫入
+	var out bytes.Buffer
+	report, err := merge.Directory(src.Dir("sdf"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Written != 7 || len(report.Duplicates) != 0 || len(report.Rejected) != 0 {
+		t.Errorf("merge report = %+v", report)
+	}
+	if !strings.Contains(out.String(), truncated) {
+		t.Errorf("merged file lacks %s", truncated)
+	}
+}
+
+func TestSecondListMergesOnlyItsOwnFiles(t *testing.T) {
+	srv := fakezinc.New()
+	ids := fakezinc.SyntheticIDs("AA", 6)
+	srv.AddTranche("AA", ids...)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// 清單 A 與清單 B 下載到同一個目錄，沒有 Prune，A 的檔案留在目錄中
+	listA, listB := ids[:4], ids[2:]
+	src := download.Source{Version: "20", Formats: []string{"sdf"}, BaseURL: ts.URL, OutputDir: filepath.Join(t.TempDir(), "set_1")}
+	opt := download.Options{Workers: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	if _, err := src.Run(context.Background(), listA, opt); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := src.Run(context.Background(), listB, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range listA[:2] {
+		if _, err := os.Stat(filepath.Join(src.Dir("sdf"), id+".sdf")); err != nil {
+			t.Errorf("file from list A removed without Prune: %v", err)
+		}
+	}
+
+	// 合併：只有清單 B 的分子
+	var out bytes.Buffer
+	report, err := merge.Files(reports["sdf"].Files, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Written != len(listB) {
+		t.Errorf("merged %d records, want %d", report.Written, len(listB))
+	}
+	for _, id := range listB {
+		if !strings.Contains(out.String(), id) {
+			t.Errorf("merged file lacks %s from list B", id)
+		}
+	}
+	for _, id := range listA[:2] {
+		if strings.Contains(out.String(), id) {
+			t.Errorf("merged file contains %s from list A", id)
+		}
+	}
+}
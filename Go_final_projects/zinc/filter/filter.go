@@ -0,0 +1,333 @@
+// Package filter 在對接之前依規則集篩選配體：描述符門檻（例如 Lipinski、Veber）
+// 與 SMARTS 結構警示（PAINS 類與反應性基團）。規則集定義在 JSON 檔中，
+// 通過的分子寫到新的目錄或 SD 檔，每個分子被哪一條規則拒絕都記錄在報告中。
+package filter
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"zinc/descriptor"
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/pipeline"
+	"zinc/sdf"
+	"zinc/smarts"
+)
+
+//go:embed default_rules.json
+var defaultRules []byte
+
+// DefaultRules 回傳內建的規則集（Lipinski、Veber 與結構警示）的 JSON，可以作為自訂規則檔的起點
+func DefaultRules() []byte {
+	return append([]byte(nil), defaultRules...)
+}
+
+// Rule 是一個描述符門檻，Min 與 Max 都是包含在內的界限，nil 表示不限制
+type Rule struct {
+	Property string   `json:"property"` // descriptor.Names 中的名稱
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// String 回傳規則的可讀形式，例如 mw <= 500
+func (r Rule) String() string {
+	switch {
+	case r.Min != nil && r.Max != nil:
+		return fmt.Sprintf("%s in [%s, %s]", r.Property, num(*r.Min), num(*r.Max))
+	case r.Min != nil:
+		return fmt.Sprintf("%s >= %s", r.Property, num(*r.Min))
+	case r.Max != nil:
+		return fmt.Sprintf("%s <= %s", r.Property, num(*r.Max))
+	}
+	return r.Property
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Alert 是一個結構警示：分子中出現 SMARTS 子結構就被拒絕
+type Alert struct {
+	Name   string `json:"name"`
+	SMARTS string `json:"smarts"`
+	query  *smarts.Query
+}
+
+// RuleSet 是一組規則：描述符門檻違反超過 MaxViolations 條，或任何一個警示命中，分子就被拒絕
+type RuleSet struct {
+	Name          string  `json:"name"`
+	Description   string  `json:"description,omitempty"`
+	MaxViolations int     `json:"max_violations,omitempty"`
+	Rules         []Rule  `json:"rules,omitempty"`
+	Alerts        []Alert `json:"alerts,omitempty"`
+}
+
+// Rules 是規則檔的內容
+type Rules struct {
+	RuleSets []RuleSet `json:"rule_sets"`
+}
+
+// Parse 解析規則檔的 JSON，並檢查描述符名稱與 SMARTS
+func Parse(data []byte) (*Rules, error) {
+	var r Rules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if len(r.RuleSets) == 0 {
+		return nil, errors.New("no rule sets")
+	}
+	names := make(map[string]bool)
+	for i := range r.RuleSets {
+		rs := &r.RuleSets[i]
+		if rs.Name == "" {
+			return nil, fmt.Errorf("rule set %d has no name", i+1)
+		}
+		if names[rs.Name] {
+			return nil, fmt.Errorf("rule set %q is defined twice", rs.Name)
+		}
+		names[rs.Name] = true
+		if len(rs.Rules) == 0 && len(rs.Alerts) == 0 {
+			return nil, fmt.Errorf("rule set %s has no rules or alerts", rs.Name)
+		}
+		for _, rule := range rs.Rules {
+			if _, ok := (descriptor.Descriptors{}).Value(rule.Property); !ok {
+				return nil, fmt.Errorf("rule set %s: unknown property %q (available: %s)", rs.Name, rule.Property, strings.Join(descriptor.Names, ", "))
+			}
+			if rule.Min == nil && rule.Max == nil {
+				return nil, fmt.Errorf("rule set %s: rule for %s has neither min nor max", rs.Name, rule.Property)
+			}
+		}
+		for k := range rs.Alerts {
+			a := &rs.Alerts[k]
+			if a.Name == "" {
+				a.Name = a.SMARTS
+			}
+			q, err := smarts.Parse(a.SMARTS)
+			if err != nil {
+				return nil, fmt.Errorf("rule set %s: alert %s: %v", rs.Name, a.Name, err)
+			}
+			a.query = q
+		}
+	}
+	return &r, nil
+}
+
+// Load 讀取規則檔；path 為空字串時使用內建的規則集
+func Load(path string) (*Rules, error) {
+	if path == "" {
+		return Parse(defaultRules)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+// Violation 記錄分子違反的一條規則
+type Violation struct {
+	RuleSet string `json:"rule_set"`
+	Rule    string `json:"rule"`   // 描述符名稱或警示名稱
+	Detail  string `json:"detail"` // 例如 "mw 523.41 > 500" 或 "matches C(=O)[F,Cl,Br,I]"
+}
+
+// Check 回傳分子被拒絕的原因；通過所有規則集時回傳 nil。
+// 規則集允許的違規（MaxViolations）不會出現在結果中。
+func (r *Rules) Check(m *mol.Molecule) []Violation {
+	d := descriptor.Compute(m)
+	var target *smarts.Target
+	var out []Violation
+	for _, rs := range r.RuleSets {
+		var broken []Violation
+		for _, rule := range rs.Rules {
+			v, _ := d.Value(rule.Property)
+			switch {
+			case rule.Min != nil && v < *rule.Min:
+				broken = append(broken, Violation{rs.Name, rule.Property, fmt.Sprintf("%s %.2f < %s", rule.Property, v, num(*rule.Min))})
+			case rule.Max != nil && v > *rule.Max:
+				broken = append(broken, Violation{rs.Name, rule.Property, fmt.Sprintf("%s %.2f > %s", rule.Property, v, num(*rule.Max))})
+			}
+		}
+		if len(broken) > rs.MaxViolations {
+			out = append(out, broken...)
+		}
+		for _, a := range rs.Alerts {
+			if target == nil {
+				target = smarts.NewTarget(m)
+			}
+			if a.query.Matches(target) {
+				out = append(out, Violation{rs.Name, a.Name, "matches " + a.SMARTS})
+			}
+		}
+	}
+	return out
+}
+
+// Result 是一個分子的篩選結果
+type Result struct {
+	ZincID     string      `json:"zinc_id"`
+	File       string      `json:"file"`
+	Passed     bool        `json:"passed"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Report 是一次篩選的結果
+type Report struct {
+	Output    string            `json:"output"`
+	Checked   int               `json:"checked"`
+	Passed    int               `json:"passed"`
+	Molecules []Result          `json:"molecules"`
+	Rejected  []merge.Rejection `json:"unreadable"` // 無法讀取或解析的檔案與紀錄
+}
+
+// WriteJSON 把報告以縮排的 JSON 寫到 w
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV 以每個分子一行寫出報告：zinc_id、file、status 與拒絕它的規則
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"zinc_id", "file", "status", "rejected_by", "details"})
+	for _, res := range r.Molecules {
+		status := "passed"
+		if !res.Passed {
+			status = "rejected"
+		}
+		var rules, details []string
+		for _, v := range res.Violations {
+			rules = append(rules, v.RuleSet+":"+v.Rule)
+			details = append(details, v.Detail)
+		}
+		cw.Write([]string{res.ZincID, res.File, status, strings.Join(rules, " "), strings.Join(details, "; ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Run 檢查 files 中的每個分子，通過的寫到 out：out 以 .sdf 結尾時寫成一個 SD 檔，
+// 否則寫到 out 目錄中並沿用來源的檔名，與下載目錄的版面相同（同一個來源檔的其他紀錄寫成 <zinc_id>.sdf）。
+// 兩種輸出都先寫到暫存位置，完成後才取代舊的輸出，因此修改規則後重新執行不會留下上一次通過的分子。
+func (r *Rules) Run(files []string, out string) (*Report, error) {
+	report := &Report{Output: out, Molecules: []Result{}, Rejected: []merge.Rejection{}}
+	if strings.EqualFold(filepath.Ext(out), ".sdf") {
+		err := pipeline.WriteAtomic(out, func(w io.Writer) error {
+			sw := sdf.NewWriter(w)
+			err := r.each(files, report, func(path, id string, m *mol.Molecule) error { return sw.Write(m) })
+			if err != nil {
+				return err
+			}
+			return sw.Flush()
+		})
+		return report, err
+	}
+
+	for _, f := range files {
+		if filepath.Clean(filepath.Dir(f)) == filepath.Clean(out) {
+			return nil, fmt.Errorf("output directory %s is also the input directory", out)
+		}
+	}
+	tmp := out + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	err := r.each(files, report, func(path, id string, m *mol.Molecule) error {
+		name := filepath.Base(path)
+		if used[name] {
+			name = id + ".sdf"
+		}
+		used[name] = true
+		f, err := os.Create(filepath.Join(tmp, name))
+		if err != nil {
+			return err
+		}
+		sw := sdf.NewWriter(f)
+		err = sw.Write(m)
+		if err == nil {
+			err = sw.Flush()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return report, err
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return report, err
+	}
+	return report, os.Rename(tmp, out)
+}
+
+// each 串流讀取每個檔案，檢查每個分子並把通過的交給 pass
+func (r *Rules) each(files []string, report *Report, pass func(path, id string, m *mol.Molecule) error) error {
+	seen := make(map[string]bool)
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			report.Rejected = append(report.Rejected, merge.Rejection{File: path, Reason: err.Error()})
+			continue
+		}
+		sr := sdf.NewReader(file)
+		for record := 1; ; record++ {
+			m, err := sr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rej := merge.Rejection{File: path, Record: record, Reason: err.Error()}
+				var perr *sdf.ParseError
+				if errors.As(err, &perr) {
+					rej.Line, rej.Reason = perr.Line, perr.Msg
+					report.Rejected = append(report.Rejected, rej)
+					continue
+				}
+				report.Rejected = append(report.Rejected, rej)
+				break
+			}
+			id := m.ZincID()
+			if id == "" {
+				id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			res := Result{ZincID: id, File: path, Violations: r.Check(m)}
+			res.Passed = len(res.Violations) == 0
+			report.Checked++
+			report.Molecules = append(report.Molecules, res)
+			if res.Passed {
+				report.Passed++
+				if err := pass(path, id, m); err != nil {
+					file.Close()
+					return err
+				}
+			}
+		}
+		file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+func parseSMILES(t *testing.T, s, id string) *mol.Molecule {
+	t.Helper()
+	m, err := smiles.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Name = id
+	m.SetField("zinc_id", id)
+	return m
+}
+
+func rejectedBy(vs []Violation) string {
+	var names []string
+	for _, v := range vs {
+		names = append(names, v.RuleSet+":"+v.Rule)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestParse(t *testing.T) {
+	r, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.RuleSets) != 3 {
+		t.Errorf("%d built-in rule sets", len(r.RuleSets))
+	}
+	for _, bad := range []string{
+		`{}`,
+		`{"rule_sets": [{"name": "x"}]}`,
+		`{"rule_sets": [{"name": "x", "rules": [{"property": "size", "max": 1}]}]}`,
+		`{"rule_sets": [{"name": "x", "rules": [{"property": "mw"}]}]}`,
+		`{"rule_sets": [{"name": "x", "alerts": [{"name": "bad", "smarts": "C(("}]}]}`,
+		`{"rule_sets": [{"name": "x", "alerts": [{"smarts": "C"}]}, {"name": "x", "alerts": [{"smarts": "N"}]}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		smiles string
+		want   string
+	}{
+		{"CC(=O)Nc1ccc(O)cc1", ""}, // 乙醯胺酚
+		{"CC(=O)Cl", "alerts:acyl_halide"},
+		{"Oc1ccccc1O", "alerts:catechol"},
+		{"O=C1C=CC(=O)C=C1", "alerts:quinone"},
+		// 四十碳烷：分子量與 logP 兩條 Lipinski 規則，加上可旋轉鍵數
+		{strings.Repeat("C", 40), "lipinski:mw lipinski:logp veber:rotatable_bonds"},
+		// 只違反一條 Lipinski 規則（logP）時可以通過
+		{strings.Repeat("C", 12), ""},
+	}
+	for _, tt := range tests {
+		got := rejectedBy(r.Check(parseSMILES(t, tt.smiles, "ZINC1")))
+		if got != tt.want {
+			t.Errorf("%s rejected by %q, want %q", tt.smiles, got, tt.want)
+		}
+	}
+
+	min := 200.0
+	custom, err := Parse([]byte(`{"rule_sets": [{"name": "size", "rules": [{"property": "mw", "min": 200}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs := custom.Check(parseSMILES(t, "CCO", "ZINC1")); len(vs) != 1 || !strings.HasPrefix(vs[0].Detail, "mw 46.07 < 200") {
+		t.Errorf("violations = %+v", vs)
+	}
+	if s := (Rule{Property: "mw", Min: &min}).String(); s != "mw >= 200" {
+		t.Errorf("rule = %s", s)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "set_1")
+	os.Mkdir(in, 0o755)
+	for id, s := range map[string]string{"ZINC01": "CC(=O)Nc1ccc(O)cc1", "ZINC02": "CC(=O)Cl", "ZINC03": "CCN"} {
+		var b bytes.Buffer
+		w := sdf.NewWriter(&b)
+		w.Write(parseSMILES(t, s, id))
+		w.Flush()
+		os.WriteFile(filepath.Join(in, id+".sdf"), b.Bytes(), 0o644)
+	}
+	os.WriteFile(filepath.Join(in, "ZINC04.sdf"), []byte("not a molfile\n"), 0o644)
+	files, _ := merge.ListSDFFiles(in)
+	r, _ := Load("")
+
+	// 輸出到目錄：上一次留下的檔案會被取代
+	out := filepath.Join(dir, "set_1_filtered")
+	os.Mkdir(out, 0o755)
+	os.WriteFile(filepath.Join(out, "stale.sdf"), nil, 0o644)
+	report, err := r.Run(files, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || report.Passed != 2 || len(report.Rejected) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	passed, _ := merge.ListSDFFiles(out)
+	if len(passed) != 2 || filepath.Base(passed[0]) != "ZINC01.sdf" || filepath.Base(passed[1]) != "ZINC03.sdf" {
+		t.Errorf("passing files = %v", passed)
+	}
+	var csv bytes.Buffer
+	report.WriteCSV(&csv)
+	if !strings.Contains(csv.String(), "ZINC02,"+files[1]+",rejected,alerts:acyl_halide,\"matches C(=O)[F,Cl,Br,I]\"") {
+		t.Errorf("csv report:\n%s", csv.String())
+	}
+
+	// 輸出到 SD 檔
+	report, err = r.Run(files, filepath.Join(dir, "passed.sdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mols, err := sdf.ReadFile(filepath.Join(dir, "passed.sdf"))
+	if err != nil || len(mols) != 2 || mols[1].ZincID() != "ZINC03" {
+		t.Errorf("passed.sdf: %d molecules, %v", len(mols), err)
+	}
+
+	if _, err := r.Run(files, in); err == nil {
+		t.Error("filtering into the input directory succeeded")
+	}
+}
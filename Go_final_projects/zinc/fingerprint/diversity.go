@@ -0,0 +1,114 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// DefaultSphereSimilarity 是球面排除法預設的 Tanimoto 門檻：與已選分子相似度
+// 大於等於此值的分子會被排除（對 Morgan 半徑 2 指紋而言約是「同系列類似物」的界線）
+const DefaultSphereSimilarity = 0.4
+
+// Selection 是多樣性挑選的方法
+type Selection string
+
+const (
+	Random          Selection = "random"
+	MaxMin          Selection = "maxmin"
+	SphereExclusion Selection = "sphere"
+)
+
+// ParseSelection 解析挑選方法名稱，空字串視為 random
+func ParseSelection(s string) (Selection, error) {
+	switch Selection(s) {
+	case "":
+		return Random, nil
+	case Random, MaxMin, SphereExclusion:
+		return Selection(s), nil
+	}
+	return "", fmt.Errorf("unknown selection method %q (want random, maxmin or sphere)", s)
+}
+
+// PickMaxMin 以 MaxMin 演算法從 fps 挑出 n 個彼此差異最大的指紋，回傳其索引。
+// 第一個分子由 rng 隨機決定（rng 為 nil 時取第 0 個），之後每次挑選與已選集合
+// 最小距離（1 - Tanimoto）最大的分子，同分時取索引較小者。
+func PickMaxMin(fps []Fingerprint, n int, rng *rand.Rand) []int {
+	if n <= 0 || len(fps) == 0 {
+		return nil
+	}
+	first := 0
+	if rng != nil {
+		first = rng.Intn(len(fps))
+	}
+	return maxMinFrom(fps, []int{first}, n)
+}
+
+// PickSphereExclusion 以球面排除法挑選：依 rng 打亂的順序走訪（rng 為 nil 時依原順序），
+// 與所有已選分子的相似度都低於 threshold 的分子才會被選入。走訪完仍不足 n 個時，
+// 以 MaxMin 從剩下的分子補足。
+func PickSphereExclusion(fps []Fingerprint, n int, threshold float64, rng *rand.Rand) []int {
+	if n <= 0 || len(fps) == 0 {
+		return nil
+	}
+	order := make([]int, len(fps))
+	for i := range order {
+		order[i] = i
+	}
+	if rng != nil {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	var picked []int
+	for _, i := range order {
+		if len(picked) == n {
+			break
+		}
+		excluded := false
+		for _, p := range picked {
+			if Tanimoto(fps[i], fps[p]) >= threshold {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			picked = append(picked, i)
+		}
+	}
+	return maxMinFrom(fps, picked, n)
+}
+
+// maxMinFrom 從已選的 picked 出發，以 MaxMin 繼續挑到 n 個為止
+func maxMinFrom(fps []Fingerprint, picked []int, n int) []int {
+	if n > len(fps) {
+		n = len(fps)
+	}
+	chosen := make([]bool, len(fps))
+	minDist := make([]float64, len(fps))
+	for i := range minDist {
+		minDist[i] = 2
+	}
+	update := func(p int) {
+		chosen[p] = true
+		for i := range fps {
+			if !chosen[i] {
+				if d := 1 - Tanimoto(fps[i], fps[p]); d < minDist[i] {
+					minDist[i] = d
+				}
+			}
+		}
+	}
+	for _, p := range picked {
+		update(p)
+	}
+	for len(picked) < n {
+		best := -1
+		for i := range fps {
+			if !chosen[i] && (best < 0 || minDist[i] > minDist[best]) {
+				best = i
+			}
+		}
+		picked = append(picked, best)
+		update(best)
+	}
+	return picked
+}
@@ -0,0 +1,240 @@
+// Package fingerprint 計算分子的位元指紋（Morgan 圓形指紋與路徑指紋）與 Tanimoto 相似度，
+// 並提供以磁碟快取加速的相似度搜尋。
+package fingerprint
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+
+	"zinc/mol"
+)
+
+// 預設參數
+const (
+	Size         = 2048 // 位元數
+	MorganRadius = 2    // 半徑 2 相當於 ECFP4
+	MaxPathBonds = 7    // 路徑指紋的最長路徑（鍵數）
+)
+
+// Fingerprint 是固定長度的位元向量
+type Fingerprint []uint64
+
+// New 建立 n 位元的空指紋
+func New(n int) Fingerprint {
+	return make(Fingerprint, (n+63)/64)
+}
+
+// Len 回傳位元數
+func (f Fingerprint) Len() int { return len(f) * 64 }
+
+// Set 設定第 i 個位元
+func (f Fingerprint) Set(i int) { f[i/64] |= 1 << (i % 64) }
+
+// Has 判斷第 i 個位元是否為 1
+func (f Fingerprint) Has(i int) bool { return f[i/64]&(1<<(i%64)) != 0 }
+
+// Count 回傳為 1 的位元數
+func (f Fingerprint) Count() int {
+	n := 0
+	for _, w := range f {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Tanimoto 回傳兩個指紋的 Tanimoto 係數 |A∩B| / |A∪B|，兩者都是空指紋時回傳 0
+func Tanimoto(a, b Fingerprint) float64 {
+	and, or := 0, 0
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		and += bits.OnesCount64(a[i] & b[i])
+		or += bits.OnesCount64(a[i] | b[i])
+	}
+	if or == 0 {
+		return 0
+	}
+	return float64(and) / float64(or)
+}
+
+// MarshalText 以十六進位字串表示指紋，用於 JSON 快取
+func (f Fingerprint) MarshalText() ([]byte, error) {
+	buf := make([]byte, 8*len(f))
+	for i, w := range f {
+		binary.BigEndian.PutUint64(buf[8*i:], w)
+	}
+	return []byte(hex.EncodeToString(buf)), nil
+}
+
+// UnmarshalText 解析 MarshalText 的輸出
+func (f *Fingerprint) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(buf)%8 != 0 {
+		return fmt.Errorf("fingerprint: length %d is not a multiple of 64 bits", len(buf)*4)
+	}
+	*f = make(Fingerprint, len(buf)/8)
+	for i := range *f {
+		(*f)[i] = binary.BigEndian.Uint64(buf[8*i:])
+	}
+	return nil
+}
+
+// Kind 是指紋的種類
+type Kind string
+
+const (
+	Morgan Kind = "morgan"
+	Path   Kind = "path"
+)
+
+// ParseKind 解析指紋種類名稱
+func ParseKind(s string) (Kind, error) {
+	switch Kind(s) {
+	case Morgan, Path:
+		return Kind(s), nil
+	}
+	return "", fmt.Errorf("unknown fingerprint %q (want morgan or path)", s)
+}
+
+// Compute 以預設參數計算指定種類的指紋
+func Compute(m *mol.Molecule, kind Kind) Fingerprint {
+	if kind == Path {
+		return PathFingerprint(m, MaxPathBonds, Size)
+	}
+	return MorganFingerprint(m, MorganRadius, Size)
+}
+
+// prepare 複製分子、移除氫原子並標出芳香鍵，讓 Kekulé 結構與芳香寫法得到相同的指紋
+func prepare(m *mol.Molecule) *mol.Molecule {
+	c := m.Clone()
+	c.RemoveHydrogens()
+	c.Aromatize()
+	return c
+}
+
+func hashInts(xs ...uint64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, x := range xs {
+		binary.LittleEndian.PutUint64(buf[:], x)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// atomInvariant 是 ECFP 的初始原子不變量：原子序、重原子鄰居數、氫數、電荷、
+// 同位素、是否在環上與是否芳香
+func atomInvariant(m *mol.Molecule, i int, inRing []bool, aromatic bool) uint64 {
+	a := m.Atoms[i]
+	flags := uint64(0)
+	if inRing[i] {
+		flags |= 1
+	}
+	if aromatic {
+		flags |= 2
+	}
+	return hashInts(uint64(a.AtomicNumber()), uint64(m.HeavyDegree(i)),
+		uint64(m.HydrogenCount(i)), uint64(int64(a.Charge)), uint64(a.Isotope), flags)
+}
+
+// MorganFingerprint 計算半徑 radius 的 Morgan（ECFP 類）圓形指紋：
+// 每一輪以原子自身與各鄰居（鍵級、上一輪識別碼）更新識別碼，所有輪次的識別碼都雜湊進指紋
+func MorganFingerprint(m *mol.Molecule, radius, size int) Fingerprint {
+	c := prepare(m)
+	fp := New(size)
+	adj := c.Adjacency()
+	inRing := c.RingAtoms()
+	aromatic, _ := c.Aromaticity()
+
+	ids := make([]uint64, len(c.Atoms))
+	for i := range c.Atoms {
+		ids[i] = atomInvariant(c, i, inRing, aromatic[i])
+		fp.Set(int(ids[i] % uint64(fp.Len())))
+	}
+	for r := 1; r <= radius; r++ {
+		next := make([]uint64, len(ids))
+		for i := range c.Atoms {
+			var env []uint64
+			for _, e := range adj[i] {
+				env = append(env, uint64(c.Bonds[e.Bond].Order)<<56^ids[e.Atom])
+			}
+			sort.Slice(env, func(x, y int) bool { return env[x] < env[y] })
+			next[i] = hashInts(append([]uint64{uint64(r), ids[i]}, env...)...)
+			fp.Set(int(next[i] % uint64(fp.Len())))
+		}
+		ids = next
+	}
+	return fp
+}
+
+// PathFingerprint 計算路徑指紋：列舉長度 0 到 maxBonds 個鍵的所有簡單路徑，
+// 每條路徑取正反兩個方向中較小的標籤序列雜湊進指紋
+func PathFingerprint(m *mol.Molecule, maxBonds, size int) Fingerprint {
+	c := prepare(m)
+	fp := New(size)
+	adj := c.Adjacency()
+	labels := make([]uint64, len(c.Atoms))
+	for i, a := range c.Atoms {
+		labels[i] = uint64(a.AtomicNumber())<<8 | uint64(int8(a.Charge))&0xff
+	}
+
+	var atoms, bonds []int
+	onPath := make([]bool, len(c.Atoms))
+	var walk func(i int)
+	walk = func(i int) {
+		fp.Set(int(pathHash(c, atoms, bonds, labels) % uint64(fp.Len())))
+		if len(bonds) == maxBonds {
+			return
+		}
+		for _, e := range adj[i] {
+			if onPath[e.Atom] {
+				continue
+			}
+			onPath[e.Atom] = true
+			atoms, bonds = append(atoms, e.Atom), append(bonds, e.Bond)
+			walk(e.Atom)
+			atoms, bonds = atoms[:len(atoms)-1], bonds[:len(bonds)-1]
+			onPath[e.Atom] = false
+		}
+	}
+	for i := range c.Atoms {
+		atoms = append(atoms[:0], i)
+		bonds = bonds[:0]
+		onPath[i] = true
+		walk(i)
+		onPath[i] = false
+	}
+	return fp
+}
+
+// pathHash 回傳路徑與方向無關的雜湊值
+func pathHash(m *mol.Molecule, atoms, bonds []int, labels []uint64) uint64 {
+	n := len(atoms)
+	forward := make([]uint64, 0, 2*n)
+	backward := make([]uint64, 0, 2*n)
+	for k := 0; k < n; k++ {
+		forward = append(forward, labels[atoms[k]])
+		backward = append(backward, labels[atoms[n-1-k]])
+		if k < n-1 {
+			forward = append(forward, uint64(m.Bonds[bonds[k]].Order))
+			backward = append(backward, uint64(m.Bonds[bonds[n-2-k]].Order))
+		}
+	}
+	for k := range forward {
+		if forward[k] != backward[k] {
+			if backward[k] < forward[k] {
+				forward = backward
+			}
+			break
+		}
+	}
+	return hashInts(forward...)
+}
@@ -0,0 +1,124 @@
+package fingerprint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+func TestTanimoto(t *testing.T) {
+	a, b := New(128), New(128)
+	for _, i := range []int{1, 2, 3, 100} {
+		a.Set(i)
+	}
+	for _, i := range []int{2, 3, 4} {
+		b.Set(i)
+	}
+	if got := Tanimoto(a, b); got != 2.0/5.0 {
+		t.Errorf("Tanimoto = %v, want 0.4", got)
+	}
+	if got := Tanimoto(New(128), New(128)); got != 0 {
+		t.Errorf("Tanimoto of empty fingerprints = %v, want 0", got)
+	}
+
+	text, _ := a.MarshalText()
+	var back Fingerprint
+	if err := back.UnmarshalText(text); err != nil || Tanimoto(a, back) != 1 || back.Count() != 4 {
+		t.Errorf("text round trip: %v, %v", back, err)
+	}
+}
+
+func TestFingerprintsIgnoreRepresentation(t *testing.T) {
+	// Kekulé 與芳香寫法、不同的原子順序應得到相同指紋
+	for _, kind := range []Kind{Morgan, Path} {
+		a := Compute(smiles.MustParse("Oc1ccccc1C(=O)O"), kind)
+		b := Compute(smiles.MustParse("OC(=O)C1=CC=CC=C1O"), kind)
+		if Tanimoto(a, b) != 1 {
+			t.Errorf("%s: salicylic acid representations differ (%.3f)", kind, Tanimoto(a, b))
+		}
+	}
+}
+
+func TestSimilarityOrder(t *testing.T) {
+	ref := smiles.MustParse("CC(=O)Oc1ccccc1C(=O)O") // 阿斯匹靈
+	close := smiles.MustParse("Oc1ccccc1C(=O)O")     // 水楊酸
+	far := smiles.MustParse("CCCCCCCCCC")
+	for _, kind := range []Kind{Morgan, Path} {
+		r := Compute(ref, kind)
+		if Tanimoto(r, Compute(close, kind)) <= Tanimoto(r, Compute(far, kind)) {
+			t.Errorf("%s: salicylic acid should be closer to aspirin than decane", kind)
+		}
+	}
+}
+
+func TestLibraryCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "set_1")
+	os.Mkdir(dir, 0o755)
+	data, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "ZINC000014418328.sdf"), data, 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.sdf"), []byte("not a molfile\n$$$$\n"), 0o644)
+
+	lib, err := LoadLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lib.Computed != 1 || lib.Reused != 0 || len(lib.Failed) != 1 || len(lib.Entries) != 1 {
+		t.Fatalf("first load: computed %d, reused %d, failed %v, entries %d", lib.Computed, lib.Reused, lib.Failed, len(lib.Entries))
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "set_1.fingerprints.json")); err != nil {
+		t.Fatalf("cache not written next to set_1: %v", err)
+	}
+
+	again, err := LoadLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Computed != 0 || again.Reused != 1 {
+		t.Errorf("second load: computed %d, reused %d; want 0, 1", again.Computed, again.Reused)
+	}
+
+	mols, _ := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	hits := again.Search(mols[0], Morgan, 5)
+	if len(hits) != 1 || hits[0].ZincID != "ZINC000014418328" || hits[0].Similarity != 1 {
+		t.Errorf("search = %+v", hits)
+	}
+}
+
+func TestDiversityPicking(t *testing.T) {
+	// 三個幾乎相同的烷基苯與兩個結構差異很大的分子；挑 3 個時應該只選一個烷基苯
+	var fps []Fingerprint
+	for _, s := range []string{"CCc1ccccc1", "CCCc1ccccc1", "CCCCc1ccccc1", "OC(=O)CN", "FC(F)(F)Cl"} {
+		fps = append(fps, Compute(smiles.MustParse(s), Morgan))
+	}
+	for name, picked := range map[string][]int{
+		"maxmin": PickMaxMin(fps, 3, nil),
+		"sphere": PickSphereExclusion(fps, 3, DefaultSphereSimilarity, nil),
+	} {
+		if len(picked) != 3 {
+			t.Fatalf("%s: picked %v, want 3 molecules", name, picked)
+		}
+		benzenes := 0
+		for _, i := range picked {
+			if i < 3 {
+				benzenes++
+			}
+		}
+		if benzenes != 1 {
+			t.Errorf("%s: picked %v, want exactly one alkylbenzene", name, picked)
+		}
+	}
+
+	// 要求的數量超過可選分子時回傳全部
+	if got := PickSphereExclusion(fps, 10, DefaultSphereSimilarity, nil); len(got) != len(fps) {
+		t.Errorf("sphere exclusion with n > len: %v", got)
+	}
+	if _, err := ParseSelection("kmeans"); err == nil {
+		t.Error("ParseSelection accepted an unknown method")
+	}
+}
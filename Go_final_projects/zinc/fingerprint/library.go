@@ -0,0 +1,204 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+// cacheVersion 在指紋演算法或參數改變時遞增，舊的快取會整個重建
+const cacheVersion = 1
+
+// Entry 是指紋庫中的一個分子
+type Entry struct {
+	ZincID string      `json:"zinc_id"`
+	File   string      `json:"file"`
+	Record int         `json:"record"` // 檔案中的第幾筆紀錄，從 1 開始
+	Morgan Fingerprint `json:"morgan"`
+	Path   Fingerprint `json:"path"`
+}
+
+// Fingerprint 回傳指定種類的指紋
+func (e *Entry) Fingerprint(kind Kind) Fingerprint {
+	if kind == Path {
+		return e.Path
+	}
+	return e.Morgan
+}
+
+// fileStamp 用檔案大小與修改時間判斷快取是否過期
+type fileStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mod_time"`
+}
+
+// cacheFile 是快取檔的內容
+type cacheFile struct {
+	Version int                  `json:"version"`
+	Files   map[string]fileStamp `json:"files"`
+	Entries []Entry              `json:"entries"`
+}
+
+// Library 是一個目錄中所有配體的指紋
+type Library struct {
+	Dir       string
+	CachePath string
+	Entries   []Entry
+	Reused    int // 直接從快取取得指紋的檔案數
+	Computed  int // 重新計算指紋的檔案數
+	Failed    []string
+}
+
+// CachePath 回傳目錄 dir 的指紋快取位置：與目錄並排的 <dir>.fingerprints.json，
+// 例如 set_1 的快取是 set_1.fingerprints.json
+func CachePath(dir string) string {
+	dir = filepath.Clean(dir)
+	return filepath.Join(filepath.Dir(dir), filepath.Base(dir)+".fingerprints.json")
+}
+
+// LoadLibrary 讀取 dir 中所有 .sdf 檔的指紋。未變更的檔案沿用快取，
+// 新增或修改過的檔案重新計算，結束後更新快取；無法讀取的檔案記在 Failed。
+func LoadLibrary(dir string) (*Library, error) {
+	files, err := merge.ListSDFFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	lib := &Library{Dir: dir, CachePath: CachePath(dir)}
+	cache := readCache(lib.CachePath)
+	cached := make(map[string][]Entry)
+	for _, e := range cache.Entries {
+		cached[e.File] = append(cached[e.File], e)
+	}
+
+	next := cacheFile{Version: cacheVersion, Files: make(map[string]fileStamp)}
+	for _, path := range files {
+		st, err := os.Stat(path)
+		if err != nil {
+			lib.Failed = append(lib.Failed, path)
+			continue
+		}
+		stamp := fileStamp{Size: st.Size(), ModTime: st.ModTime().UnixNano()}
+		if old, ok := cache.Files[path]; ok && old == stamp {
+			next.Files[path] = stamp
+			next.Entries = append(next.Entries, cached[path]...)
+			lib.Reused++
+			continue
+		}
+		mols, err := sdf.ReadFile(path)
+		if err != nil {
+			lib.Failed = append(lib.Failed, path)
+			continue
+		}
+		for k, m := range mols {
+			next.Entries = append(next.Entries, newEntry(m, path, k+1))
+		}
+		next.Files[path] = stamp
+		lib.Computed++
+	}
+	lib.Entries = next.Entries
+
+	if lib.Computed > 0 || len(next.Files) != len(cache.Files) {
+		if err := writeCache(lib.CachePath, &next); err != nil {
+			return lib, err
+		}
+	}
+	return lib, nil
+}
+
+func newEntry(m *mol.Molecule, path string, record int) Entry {
+	id := m.ZincID()
+	if id == "" {
+		id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return Entry{
+		ZincID: id,
+		File:   path,
+		Record: record,
+		Morgan: Compute(m, Morgan),
+		Path:   Compute(m, Path),
+	}
+}
+
+// readCache 讀取快取；檔案不存在、損毀或版本不符時回傳空的快取
+func readCache(path string) cacheFile {
+	var c cacheFile
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Version != cacheVersion {
+		return cacheFile{}
+	}
+	return c
+}
+
+// writeCache 先寫暫存檔再改名，避免中斷時留下半個快取
+func writeCache(path string, c *cacheFile) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fingerprints-*.json")
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(tmp).Encode(c)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Score 是相似度搜尋的一筆結果
+type Score struct {
+	ZincID     string  `json:"zinc_id"`
+	File       string  `json:"file"`
+	Record     int     `json:"record"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Search 回傳與 query 最相似的前 k 個分子，依 Tanimoto 係數由高到低排序，
+// 同分時依 ZINC ID 排序。k 小於等於 0 時回傳全部。
+func (l *Library) Search(query *mol.Molecule, kind Kind, k int) []Score {
+	if query == nil || len(query.Atoms) == 0 {
+		return nil
+	}
+	q := Compute(query, kind)
+	scores := make([]Score, 0, len(l.Entries))
+	for i := range l.Entries {
+		e := &l.Entries[i]
+		scores = append(scores, Score{
+			ZincID:     e.ZincID,
+			File:       e.File,
+			Record:     e.Record,
+			Similarity: Tanimoto(q, e.Fingerprint(kind)),
+		})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Similarity != scores[j].Similarity {
+			return scores[i].Similarity > scores[j].Similarity
+		}
+		return scores[i].ZincID < scores[j].ZincID
+	})
+	if k > 0 && len(scores) > k {
+		scores = scores[:k]
+	}
+	return scores
+}
+
+// Index 回傳以 ZINC ID 為索引的指紋表；同一個 ID 出現多次時保留第一筆
+func (l *Library) Index(kind Kind) map[string]Fingerprint {
+	index := make(map[string]Fingerprint, len(l.Entries))
+	for i := range l.Entries {
+		e := &l.Entries[i]
+		if _, ok := index[e.ZincID]; !ok {
+			index[e.ZincID] = e.Fingerprint(kind)
+		}
+	}
+	return index
+}
@@ -0,0 +1,15 @@
+module zinc
+
+go 1.23.2
+
+require (
+	github.com/PuerkitoBio/goquery v1.10.0
+	github.com/fsnotify/fsnotify v1.8.0
+	go.etcd.io/bbolt v1.3.11
+)
+
+require (
+	github.com/andybalholm/cascadia v1.3.2 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+)
@@ -0,0 +1,323 @@
+// Package jobs 在背景執行長時間的工作（例如抓取 tranche 頁面），提供進度查詢、
+// Server-Sent Events 進度串流與取消。完成的工作會保留在清單中，連同它的輸出檔案。
+// Store 則把每次提交的輸出放在各自的目錄並依瀏覽器工作階段列出，過期的工作會被清除。
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State 是工作的狀態
+type State string
+
+const (
+	Running  State = "running"
+	Done     State = "done"
+	Failed   State = "failed"
+	Canceled State = "canceled"
+)
+
+// Task 是工作中的一個子項目，例如一組條件
+type Task struct {
+	Name     string   `json:"name"`
+	Done     int      `json:"done"`  // 已完成的單位數（例如頁數）
+	Total    int      `json:"total"` // 已知的總單位數，0 表示還不知道
+	Errors   []string `json:"errors,omitempty"`
+	Output   string   `json:"output,omitempty"` // 輸出檔案
+	Count    int      `json:"count,omitempty"`  // 輸出的項目數（例如 ZINC ID 數）
+	Finished bool     `json:"finished"`
+}
+
+// Snapshot 是某個時間點的工作內容，可以直接編碼成 JSON
+type Snapshot struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	State    State      `json:"state"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Tasks    []Task     `json:"tasks"`
+}
+
+// Job 是一個背景工作
+type Job struct {
+	mu     sync.Mutex
+	snap   Snapshot
+	cancel context.CancelFunc
+	done   chan struct{}
+	subs   map[chan Snapshot]bool
+	seq    int // 建立順序
+}
+
+// ID 回傳工作編號
+func (j *Job) ID() string { return j.snap.ID }
+
+// Snapshot 回傳目前的工作內容
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.copyLocked()
+}
+
+func (j *Job) copyLocked() Snapshot {
+	s := j.snap
+	s.Tasks = make([]Task, len(j.snap.Tasks))
+	for i, t := range j.snap.Tasks {
+		t.Errors = append([]string(nil), t.Errors...)
+		s.Tasks[i] = t
+	}
+	return s
+}
+
+// Update 修改第 i 個子項目並通知所有訂閱者
+func (j *Job) Update(i int, fn func(t *Task)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.snap.Tasks[i])
+	j.notifyLocked()
+}
+
+// notifyLocked 把最新內容送給訂閱者；來不及讀取的訂閱者只會錯過中間的更新
+func (j *Job) notifyLocked() {
+	s := j.copyLocked()
+	for c := range j.subs {
+		select {
+		case c <- s:
+		default:
+			// 丟掉舊的內容，改放最新的
+			select {
+			case <-c:
+			default:
+			}
+			c <- s
+		}
+	}
+}
+
+// Subscribe 回傳一個接收進度更新的 channel，工作結束後會收到最後的內容並關閉；
+// 呼叫回傳的函式可以提早取消訂閱
+func (j *Job) Subscribe() (<-chan Snapshot, func()) {
+	c := make(chan Snapshot, 1)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	c <- j.copyLocked()
+	if j.snap.State != Running {
+		close(c)
+		return c, func() {}
+	}
+	j.subs[c] = true
+	return c, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if j.subs[c] {
+			delete(j.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Cancel 取消工作；已結束的工作不受影響
+func (j *Job) Cancel() { j.cancel() }
+
+// Wait 等待工作結束並回傳最後的內容
+func (j *Job) Wait() Snapshot {
+	<-j.done
+	return j.Snapshot()
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.snap.Finished = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.snap.State = Canceled
+	case err != nil:
+		j.snap.State, j.snap.Error = Failed, err.Error()
+	default:
+		j.snap.State = Done
+	}
+	j.notifyLocked()
+	for c := range j.subs {
+		close(c)
+	}
+	j.subs = nil
+	close(j.done)
+}
+
+// Manager 保存所有工作，可以同時被多個 HTTP handler 使用
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	seq  int
+}
+
+// NewManager 建立空的 Manager
+func NewManager() *Manager {
+	return &Manager{jobs: make(map[string]*Job)}
+}
+
+// Start 以 tasks 中的子項目建立工作，並在新的 goroutine 中執行 run。
+// run 應該在 ctx 被取消時儘快回傳 ctx.Err()。
+func (m *Manager) Start(kind string, tasks []string, run func(ctx context.Context, j *Job) error) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		snap: Snapshot{
+			ID:      newID(),
+			Kind:    kind,
+			State:   Running,
+			Created: time.Now().UTC(),
+			Tasks:   make([]Task, len(tasks)),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+		subs:   make(map[chan Snapshot]bool),
+	}
+	for i, name := range tasks {
+		j.snap.Tasks[i].Name = name
+	}
+	m.mu.Lock()
+	m.seq++
+	j.seq = m.seq
+	m.jobs[j.snap.ID] = j
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		j.finish(run(ctx, j))
+	}()
+	return j
+}
+
+// Get 依編號取得工作
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// List 回傳所有工作的內容，最新的在前
+func (m *Manager) List() []Snapshot {
+	m.mu.Lock()
+	all := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		all = append(all, j)
+	}
+	m.mu.Unlock()
+	sort.Slice(all, func(a, b int) bool { return all[a].seq > all[b].seq })
+	list := make([]Snapshot, len(all))
+	for i, j := range all {
+		list[i] = j.Snapshot()
+	}
+	return list
+}
+
+// ServeEvents 以 Server-Sent Events 串流工作的進度：每次更新送出一個 "progress" 事件，
+// 工作結束時送出 "done" 事件後關閉連線
+func (j *Job) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	updates, stop := j.Subscribe()
+	defer stop()
+	var last Snapshot
+	for {
+		select {
+		case s, ok := <-updates:
+			if !ok {
+				writeEvent(w, "done", last)
+				flusher.Flush()
+				return
+			}
+			last = s
+			writeEvent(w, "progress", s)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Handle 在 mux 上註冊工作的 HTTP 介面：
+//
+//	GET  /jobs                      所有工作，最新的在前
+//	GET  /jobs/{id}                 工作的內容
+//	GET  /jobs/{id}/events          Server-Sent Events 進度串流
+//	POST /jobs/{id}/cancel          取消工作並回傳目前的內容
+//	GET  /jobs/{id}/output/{file}   下載工作產生的檔案，只允許子項目 Output 中記錄的檔案
+func (m *Manager) Handle(mux *http.ServeMux) {
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	job := func(w http.ResponseWriter, r *http.Request) (*Job, bool) {
+		j, ok := m.Get(r.PathValue("id"))
+		if !ok {
+			http.NotFound(w, r)
+		}
+		return j, ok
+	}
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, m.List())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if j, ok := job(w, r); ok {
+			writeJSON(w, j.Snapshot())
+		}
+	})
+	mux.HandleFunc("GET /jobs/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		if j, ok := job(w, r); ok {
+			j.ServeEvents(w, r)
+		}
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if j, ok := job(w, r); ok {
+			j.Cancel()
+			writeJSON(w, j.Snapshot())
+		}
+	})
+	mux.HandleFunc("GET /jobs/{id}/output/{file}", func(w http.ResponseWriter, r *http.Request) {
+		j, ok := job(w, r)
+		if !ok {
+			return
+		}
+		file := r.PathValue("file")
+		for _, task := range j.Snapshot().Tasks {
+			if task.Output != "" && filepath.Base(task.Output) == file {
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+				http.ServeFile(w, r, task.Output)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func writeEvent(w http.ResponseWriter, event string, s Snapshot) {
+	data, _ := json.Marshal(s)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func newID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	m := NewManager()
+	step := make(chan struct{})
+	j := m.Start("scrape", []string{"AG", "BH"}, func(ctx context.Context, j *Job) error {
+		for i := range 2 {
+			<-step
+			j.Update(i, func(t *Task) { t.Done, t.Total, t.Finished = 3, 3, true })
+		}
+		return nil
+	})
+
+	updates, stop := j.Subscribe()
+	defer stop()
+	if s := <-updates; s.State != Running || len(s.Tasks) != 2 || s.Tasks[0].Name != "AG" {
+		t.Fatalf("initial snapshot = %+v", s)
+	}
+	step <- struct{}{}
+	if s := <-updates; s.Tasks[0].Done != 3 || s.Tasks[1].Done != 0 {
+		t.Errorf("after first task: %+v", s.Tasks)
+	}
+	step <- struct{}{}
+
+	final := j.Wait()
+	if final.State != Done || final.Finished == nil || !final.Tasks[1].Finished {
+		t.Errorf("final snapshot = %+v", final)
+	}
+	for range updates {
+		// 工作結束後 channel 會被關閉
+	}
+	if got, ok := m.Get(j.ID()); !ok || got != j {
+		t.Errorf("Get(%s) = %v, %v", j.ID(), got, ok)
+	}
+}
+
+func TestCancelAndFailure(t *testing.T) {
+	m := NewManager()
+	started := make(chan struct{})
+	canceled := m.Start("scrape", []string{"AA"}, func(ctx context.Context, j *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	canceled.Cancel()
+	if s := canceled.Wait(); s.State != Canceled {
+		t.Errorf("canceled job state = %s", s.State)
+	}
+
+	failed := m.Start("retry", nil, func(ctx context.Context, j *Job) error {
+		return errors.New("no failed pages")
+	})
+	if s := failed.Wait(); s.State != Failed || s.Error != "no failed pages" {
+		t.Errorf("failed job = %+v", s)
+	}
+
+	// 已結束的工作仍然列出，最新的在前
+	list := m.List()
+	if len(list) != 2 || list[0].ID != failed.ID() {
+		t.Errorf("List = %+v", list)
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	m := NewManager()
+	release := make(chan struct{})
+	j := m.Start("scrape", []string{"AG"}, func(ctx context.Context, j *Job) error {
+		<-release
+		j.Update(0, func(t *Task) { t.Done = 1 })
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/jobs/"+j.ID()+"/events", nil)
+	served := make(chan struct{})
+	go func() {
+		j.ServeEvents(rec, req)
+		close(served)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event stream did not end with the job")
+	}
+
+	body, _ := io.ReadAll(rec.Body)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	if !strings.HasPrefix(string(body), "event: progress\ndata: {") || !strings.Contains(string(body), "event: done\n") ||
+		!strings.Contains(string(body), `"state":"done"`) {
+		t.Errorf("event stream = %s", body)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "zinc_ids_AG.txt")
+	os.WriteFile(out, []byte("ZINC000000000001\n"), 0o644)
+	m := NewManager()
+	j := m.Start("scrape", []string{"AG"}, func(ctx context.Context, j *Job) error {
+		j.Update(0, func(t *Task) { t.Output, t.Count, t.Finished = out, 1, true })
+		return nil
+	})
+	j.Wait()
+	mux := http.NewServeMux()
+	m.Handle(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	var list []Snapshot
+	if code, body := get("/jobs"); code != 200 || json.Unmarshal([]byte(body), &list) != nil || len(list) != 1 || list[0].State != Done {
+		t.Errorf("GET /jobs = %d %s", code, body)
+	}
+	if code, _ := get("/jobs/nope"); code != http.StatusNotFound {
+		t.Errorf("unknown job = %d", code)
+	}
+	if code, body := get("/jobs/" + j.ID() + "/output/zinc_ids_AG.txt"); code != 200 || body != "ZINC000000000001\n" {
+		t.Errorf("output = %d %q", code, body)
+	}
+	// 只能下載工作記錄中的檔案
+	if code, _ := get("/jobs/" + j.ID() + "/output/jobs.go"); code != http.StatusNotFound {
+		t.Errorf("unlisted file = %d", code)
+	}
+	resp, err := http.Post(srv.URL+"/jobs/"+j.ID()+"/cancel", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || j.Snapshot().State != Done {
+		t.Errorf("cancelling a finished job = %d, state %s", resp.StatusCode, j.Snapshot().State)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 兩個工作階段各自的工作不會互相覆寫
+	a, _ := s.Create("sessionA", "sample")
+	b, _ := s.Create("sessionB", "sample")
+	for _, rec := range []*Record{a, b} {
+		os.WriteFile(s.Path(rec.ID, "zinc_ids.txt"), []byte(rec.Session+"\n"), 0o644)
+		rec.Files, rec.Summary = []string{"zinc_ids.txt"}, "1 ID"
+		if err := s.Save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a2, _ := s.Create("sessionA", "sample")
+	if list, _ := s.List("sessionA"); len(list) != 2 || list[1].ID != a.ID || list[0].ID != a2.ID {
+		t.Errorf("sessionA history = %+v", list)
+	}
+	if list, _ := s.List(""); len(list) != 3 {
+		t.Errorf("%d jobs in total", len(list))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}/{file}", func(w http.ResponseWriter, r *http.Request) {
+		s.ServeFile(w, r, r.PathValue("id"), r.PathValue("file"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	for _, tc := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/jobs/" + b.ID + "/zinc_ids.txt", "sessionB\n", http.StatusOK},
+		{"/jobs/" + b.ID + "/job.json", "", http.StatusNotFound},
+		{"/jobs/" + a2.ID + "/zinc_ids.txt", "", http.StatusNotFound},
+		{"/jobs/0123456789abcdef/zinc_ids.txt", "", http.StatusNotFound},
+		{"/jobs/..%2f..%2fetc/passwd", "", http.StatusNotFound},
+	} {
+		resp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || (tc.body != "" && string(body) != tc.body) {
+			t.Errorf("GET %s: %d %q", tc.path, resp.StatusCode, body)
+		}
+	}
+
+	// 第一次來的瀏覽器得到新的工作階段，之後沿用 cookie
+	rec := httptest.NewRecorder()
+	session := Session(rec, httptest.NewRequest("GET", "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != session || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	if again := Session(rec, req); again != session || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("session %s, want %s", again, session)
+	}
+
+	// 過期的工作與沒有記錄檔的舊目錄被刪除
+	old := filepath.Join(dir, "fedcba9876543210")
+	os.Mkdir(old, 0o755)
+	os.Chtimes(old, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour))
+	removed, err := s.Cleanup(a.Created.Add(90 * time.Minute))
+	if err != nil || removed != 4 {
+		t.Errorf("Cleanup removed %d, %v", removed, err)
+	}
+	if removed, _ := s.Cleanup(time.Now()); removed != 0 {
+		t.Errorf("second Cleanup removed %d", removed)
+	}
+	if _, err := s.Get(a.ID); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired job: %v", err)
+	}
+
+	keep, _ := OpenStore(t.TempDir(), -1)
+	keep.Create("s", "sample")
+	if removed, _ := keep.Cleanup(time.Now().Add(1000 * time.Hour)); removed != 0 {
+		t.Errorf("store without retention removed %d jobs", removed)
+	}
+}
@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionCookie 是記錄瀏覽器工作階段的 cookie 名稱
+const SessionCookie = "zinc_session"
+
+// DefaultRetention 是 Store 保留已完成工作的預設期限
+const DefaultRetention = 7 * 24 * time.Hour
+
+// recordFile 是工作目錄中記錄工作內容的檔案
+const recordFile = "job.json"
+
+// Session 回傳請求所屬的瀏覽器工作階段；第一次來的瀏覽器會得到新的編號與 cookie
+func Session(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(SessionCookie); err == nil && validID(c.Value) {
+		return c.Value
+	}
+	id := newID()
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	return id
+}
+
+// Record 是 Store 中的一個工作，寫在 <dir>/<id>/job.json
+type Record struct {
+	ID      string    `json:"id"`
+	Session string    `json:"session"`
+	Kind    string    `json:"kind"`
+	Created time.Time `json:"created"`
+	Summary string    `json:"summary,omitempty"` // 顯示在歷史記錄中的說明，例如 ID 數與種子
+	Files   []string  `json:"files"`             // 可以下載的檔案，相對於工作目錄
+}
+
+// Store 把每個工作的輸出放在各自的目錄 <dir>/<id>，不同的使用者或瀏覽器分頁不會互相覆寫。
+// 與 Manager 不同，Store 的內容在磁碟上，伺服器重新啟動後仍然可以下載；
+// 超過保留期限的工作由 Cleanup 刪除。工作編號無法猜測，知道網址的人都可以下載，
+// 歷史記錄則只列出同一個工作階段的工作。
+type Store struct {
+	dir       string
+	retention time.Duration
+	mu        sync.Mutex // 讓 Cleanup 不會刪除正在建立的工作
+}
+
+// OpenStore 開啟（必要時建立）dir 中的工作；retention 為 0 時使用 DefaultRetention，負值表示永久保留
+func OpenStore(dir string, retention time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if retention == 0 {
+		retention = DefaultRetention
+	}
+	return &Store{dir: dir, retention: retention}, nil
+}
+
+// Retention 回傳工作的保留期限，負值表示永久保留
+func (s *Store) Retention() time.Duration { return s.retention }
+
+// Create 為 session 建立新的工作與它的目錄；輸出寫到 Path 之後以 Save 記錄檔案
+func (s *Store) Create(session, kind string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := &Record{ID: newID(), Session: session, Kind: kind, Created: time.Now().UTC(), Files: []string{}}
+	if err := os.Mkdir(filepath.Join(s.dir, rec.ID), 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.write(rec); err != nil {
+		os.RemoveAll(filepath.Join(s.dir, rec.ID))
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Path 回傳工作 id 中檔案 name 的位置
+func (s *Store) Path(id, name string) string {
+	return filepath.Join(s.dir, id, name)
+}
+
+// Save 更新工作的記錄，例如加入輸出的檔案與說明
+func (s *Store) Save(rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(rec)
+}
+
+func (s *Store) write(rec *Record) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.Path(rec.ID, recordFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Remove 刪除工作與它的輸出，例如產生輸出失敗時
+func (s *Store) Remove(id string) error {
+	if !validID(id) {
+		return fmt.Errorf("invalid job id %q", id)
+	}
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+// Get 讀取工作的記錄；不存在時回傳的錯誤符合 os.ErrNotExist
+func (s *Store) Get(id string) (*Record, error) {
+	if !validID(id) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(s.Path(id, recordFile))
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("job %s: %v", id, err)
+	}
+	return &rec, nil
+}
+
+// List 回傳 session 的工作，最新的在前；session 為空字串時回傳所有工作
+func (s *Store) List(session string) ([]Record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	list := []Record{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		rec, err := s.Get(e.Name())
+		if err != nil || (session != "" && rec.Session != session) {
+			continue
+		}
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Created.After(list[b].Created) })
+	return list, nil
+}
+
+// Cleanup 刪除建立時間早於 now 減去保留期限的工作，以及沒有記錄檔、修改時間同樣過期的目錄，
+// 回傳刪除的工作數
+func (s *Store) Cleanup(now time.Time) (int, error) {
+	if s.retention < 0 {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := now.Add(-s.retention)
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() || !validID(e.Name()) {
+			continue
+		}
+		created := time.Time{}
+		if rec, err := s.Get(e.Name()); err == nil {
+			created = rec.Created
+		} else if info, err := e.Info(); err == nil {
+			created = info.ModTime()
+		}
+		if created.IsZero() || !created.Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, e.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// ServeFile 以附件下載工作 id 的檔案 name；只允許記錄中列出的檔案
+func (s *Store) ServeFile(w http.ResponseWriter, r *http.Request, id, name string) {
+	rec, err := s.Get(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, f := range rec.Files {
+		if f == name {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+			http.ServeFile(w, r, s.Path(id, name))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// validID 判斷 id 是否是 newID 產生的編號，避免路徑中出現 .. 或斜線
+func validID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	return strings.Trim(id, "0123456789abcdef") == ""
+}
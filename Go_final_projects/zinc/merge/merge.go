@@ -0,0 +1,164 @@
+// Package merge 把下載目錄中的單一分子 SD 檔合併成一個 SD 檔。
+// 每筆紀錄都會先經過結構驗證，並依 <zinc_id> 去除重複。
+package merge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+// Rejection 記錄一個被拒絕的檔案或紀錄
+type Rejection struct {
+	File   string `json:"file"`
+	Record int    `json:"record,omitempty"` // 檔案中第幾筆紀錄（1 起始），0 表示整個檔案
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Duplicate 記錄因 ZINC ID 重複而被略過的紀錄
+type Duplicate struct {
+	ZincID string `json:"zinc_id"`
+	File   string `json:"file"`
+	KeptIn string `json:"kept_in"`
+}
+
+// Report 是一次合併的結果摘要
+type Report struct {
+	Files      int         `json:"files"`
+	Records    int         `json:"records"`
+	Written    int         `json:"written"`
+	Duplicates []Duplicate `json:"duplicates"`
+	Rejected   []Rejection `json:"rejected"`
+}
+
+// WriteJSON 把報告以 JSON 格式寫到 w
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ListSDFFiles 回傳目錄中所有 .sdf 檔的路徑，依檔名排序
+func ListSDFFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".sdf") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Directory 合併 dir 中所有 .sdf 檔並寫到 out
+func Directory(dir string, out io.Writer) (*Report, error) {
+	files, err := ListSDFFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Files(files, out)
+}
+
+// Files 依序串流讀取每個檔案，通過驗證且 ZINC ID 未出現過的紀錄寫到 out。
+// 單一檔案的錯誤只會記錄在報告中；寫入 out 失敗才會回傳 error。
+func Files(files []string, out io.Writer) (*Report, error) {
+	report := &Report{Duplicates: []Duplicate{}, Rejected: []Rejection{}}
+	seen := make(map[string]string)
+	w := sdf.NewWriter(out)
+
+	for _, path := range files {
+		report.Files++
+		mols, rejections := readFile(path)
+		report.Rejected = append(report.Rejected, rejections...)
+
+		for _, m := range mols {
+			report.Records++
+			id := m.ZincID()
+			if id != "" {
+				if first, ok := seen[id]; ok {
+					report.Duplicates = append(report.Duplicates, Duplicate{ZincID: id, File: path, KeptIn: first})
+					continue
+				}
+				seen[id] = path
+			}
+			if err := w.Write(m); err != nil {
+				return report, err
+			}
+			report.Written++
+		}
+	}
+	return report, w.Flush()
+}
+
+// readFile 讀取並驗證一個檔案。只要檔案中有任何一筆紀錄不合格，整個檔案都視為損壞，
+// 因為這通常代表下載被截斷或伺服器回傳了錯誤頁面。
+func readFile(path string) ([]*mol.Molecule, []Rejection) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, []Rejection{{File: path, Reason: err.Error()}}
+	}
+	defer file.Close()
+
+	r := sdf.NewReader(file)
+	var mols []*mol.Molecule
+	for record := 1; ; record++ {
+		m, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rej := Rejection{File: path, Record: record, Reason: err.Error()}
+			var perr *sdf.ParseError
+			if errors.As(err, &perr) {
+				rej.Line = perr.Line
+				rej.Reason = perr.Msg
+			}
+			return nil, []Rejection{rej}
+		}
+		if reason := validate(m); reason != "" {
+			return nil, []Rejection{{File: path, Record: record, Line: r.Line(), Reason: reason}}
+		}
+		if !r.Terminated() {
+			return nil, []Rejection{{File: path, Record: record, Line: r.Line(), Reason: "record is not terminated by $$$$ (truncated download?)"}}
+		}
+		mols = append(mols, m)
+	}
+	if len(mols) == 0 {
+		return nil, []Rejection{{File: path, Reason: "no records"}}
+	}
+	return mols, nil
+}
+
+// validate 檢查解析器沒有涵蓋到的結構問題
+func validate(m *mol.Molecule) string {
+	if len(m.Atoms) == 0 {
+		return "molecule has no atoms"
+	}
+	for i, a := range m.Atoms {
+		if a.Symbol == "" {
+			return fmt.Sprintf("atom %d has no symbol", i+1)
+		}
+	}
+	seen := make(map[[2]int]bool)
+	for i, b := range m.Bonds {
+		key := [2]int{min(b.Begin, b.End), max(b.Begin, b.End)}
+		if seen[key] {
+			return fmt.Sprintf("bond %d duplicates an earlier bond between atoms %d and %d", i+1, key[0]+1, key[1]+1)
+		}
+		seen[key] = true
+	}
+	return ""
+}
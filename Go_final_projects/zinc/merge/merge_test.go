@@ -0,0 +1,72 @@
+package merge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zinc/sdf"
+)
+
+func TestDirectory(t *testing.T) {
+	fixture, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := bytes.Replace(fixture, []byte("ZINC000014418328"), []byte("ZINC000000000001"), 1)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ZINC000014418328.sdf": fixture,
+		"ZINC000000000001.sdf": other,
+		"copy.sdf":             fixture,                            // 重複的 ZINC ID
+		"ZINC000000000002.sdf": fixture[:len(fixture)-40],          // 截斷在資料欄位中
+		"ZINC000000000003.sdf": fixture[:200],                      // 截斷在 atom block 中
+		"ZINC000000000004.sdf": []byte("<html>Not Found</html>\n"), // 錯誤頁面
+		"ZINC000000000005.sdf": nil,                                // 空檔案
+		"notes.txt":            []byte("ignored"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	report, err := Directory(dir, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 7 || report.Written != 2 {
+		t.Errorf("files=%d written=%d, want 7 and 2", report.Files, report.Written)
+	}
+	if len(report.Duplicates) != 1 || report.Duplicates[0].ZincID != "ZINC000014418328" {
+		t.Errorf("duplicates = %+v", report.Duplicates)
+	}
+	rejected := make(map[string]string)
+	for _, r := range report.Rejected {
+		rejected[filepath.Base(r.File)] = r.Reason
+	}
+	for _, name := range []string{"ZINC000000000002.sdf", "ZINC000000000003.sdf", "ZINC000000000004.sdf", "ZINC000000000005.sdf"} {
+		if _, ok := rejected[name]; !ok {
+			t.Errorf("%s was not rejected", name)
+		}
+	}
+	if len(report.Rejected) != 4 {
+		t.Errorf("rejected = %+v", report.Rejected)
+	}
+
+	// 輸出依檔名排序，且可以被讀回
+	mols, err := sdf.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mols) != 2 || mols[0].ZincID() != "ZINC000000000001" || mols[1].ZincID() != "ZINC000014418328" {
+		t.Errorf("merged order = %v", mols)
+	}
+	if !strings.Contains(rejected["ZINC000000000002.sdf"], "$$$$") {
+		t.Errorf("truncated reason = %q", rejected["ZINC000000000002.sdf"])
+	}
+}
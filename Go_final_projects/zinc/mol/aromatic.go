@@ -0,0 +1,208 @@
+package mol
+
+// Aromaticity 判斷哪些原子與鍵屬於芳香環。已標成 Aromatic 的鍵直接視為芳香，
+// 其餘的環以 Hückel 4n+2 規則判斷；單一環不成立時，再試著與相鄰環合併（例如薁）。
+func (m *Molecule) Aromaticity() (atoms, bonds []bool) {
+	atoms = make([]bool, len(m.Atoms))
+	bonds = make([]bool, len(m.Bonds))
+	for i, b := range m.Bonds {
+		if b.Order == Aromatic {
+			bonds[i] = true
+			atoms[b.Begin] = true
+			atoms[b.End] = true
+		}
+	}
+
+	rings := m.Rings()
+	if len(rings) == 0 {
+		return atoms, bonds
+	}
+	inRing := m.RingBonds()
+	ringBonds := make([][]int, len(rings))
+	for k, ring := range rings {
+		for i := range ring {
+			ringBonds[k] = append(ringBonds[k], m.BondBetween(ring[i], ring[(i+1)%len(ring)]))
+		}
+	}
+
+	mark := func(ringAtoms, rb []int) {
+		for _, a := range ringAtoms {
+			atoms[a] = true
+		}
+		for _, b := range rb {
+			bonds[b] = true
+		}
+	}
+
+	aromatic := make([]bool, len(rings))
+	for k, ring := range rings {
+		if m.isHuckel(ring, inRing) {
+			aromatic[k] = true
+			mark(ring, ringBonds[k])
+		}
+	}
+	for k := range rings {
+		if aromatic[k] {
+			continue
+		}
+		for l := range rings {
+			if l == k || !sharesBond(ringBonds[k], ringBonds[l]) {
+				continue
+			}
+			union := unionAtoms(rings[k], rings[l])
+			if m.isHuckel(union, inRing) {
+				mark(rings[k], ringBonds[k])
+				mark(rings[l], ringBonds[l])
+				break
+			}
+		}
+	}
+	return atoms, bonds
+}
+
+// Aromatize 把芳香環上的鍵改成 Aromatic。改變鍵級之前先把每個原子的氫數固定下來，
+// 否則像吡咯 N-H 這樣的原子在芳香表示法下會被推算成沒有氫。
+func (m *Molecule) Aromatize() {
+	_, aromaticBonds := m.Aromaticity()
+	for i := range m.Atoms {
+		if !m.Atoms[i].NoImplicit {
+			m.Atoms[i].ExplicitH += m.ImplicitHydrogens(i)
+			m.Atoms[i].NoImplicit = true
+		}
+	}
+	for i, ok := range aromaticBonds {
+		if ok {
+			m.Bonds[i].Order = Aromatic
+		}
+	}
+}
+
+func (m *Molecule) isHuckel(ring []int, inRing []bool) bool {
+	total := 0
+	for _, a := range ring {
+		n := m.piElectrons(a, inRing)
+		if n < 0 {
+			return false
+		}
+		total += n
+	}
+	return total%4 == 2
+}
+
+// piElectrons 回傳原子 i 貢獻給環的 π 電子數，-1 表示這個原子不能參與芳香環
+func (m *Molecule) piElectrons(i int, inRing []bool) int {
+	a := &m.Atoms[i]
+	endo, exo, exoHetero, aromatic := 0, 0, false, 0
+	for bi, b := range m.Bonds {
+		if b.Begin != i && b.End != i {
+			continue
+		}
+		other := b.End
+		if other == i {
+			other = b.Begin
+		}
+		switch b.Order {
+		case Triple:
+			return -1
+		case Aromatic:
+			aromatic++
+		case Double:
+			// 環上的雙鍵都算環內，包含萘這種指向相鄰稠合環的雙鍵
+			if inRing[bi] {
+				endo++
+			} else {
+				exo++
+				switch m.Atoms[other].Symbol {
+				case "O", "N", "S":
+					exoHetero = true
+				}
+			}
+		}
+	}
+	connections := len(m.Neighbors(i)) + m.ImplicitHydrogens(i) + a.ExplicitH
+
+	if aromatic > 0 && endo == 0 && exo == 0 {
+		// 已經是芳香表示法（例如來自 SMILES），依元素判斷貢獻
+		switch a.Symbol {
+		case "C":
+			if a.Charge == -1 {
+				return 2
+			}
+			if a.Charge == 1 {
+				return 0
+			}
+			return 1
+		case "N", "P":
+			if connections == 3 && a.Charge == 0 {
+				return 2
+			}
+			return 1
+		case "O", "S", "Se", "Te":
+			if a.Charge == 1 {
+				return 1
+			}
+			return 2
+		case "B":
+			return 0
+		}
+		return -1
+	}
+
+	switch a.Symbol {
+	case "C", "Si":
+		switch {
+		case endo == 1:
+			return 1
+		case exo == 1 && exoHetero:
+			return 0
+		case endo == 0 && exo == 0 && a.Charge == -1:
+			return 2
+		case endo == 0 && exo == 0 && a.Charge == 1:
+			return 0
+		}
+	case "N", "P", "As":
+		switch {
+		case endo == 1 && exo == 0:
+			return 1
+		case endo == 0 && exo == 0 && a.Charge == 0 && connections == 3:
+			return 2
+		case endo == 0 && exo == 0 && a.Charge == -1 && connections == 2:
+			return 2
+		}
+	case "O", "S", "Se", "Te":
+		switch {
+		case endo == 0 && exo == 0 && a.Charge == 0 && connections == 2:
+			return 2
+		case endo == 1 && a.Charge == 1:
+			return 1
+		}
+	case "B":
+		if endo == 0 && exo == 0 && connections == 3 {
+			return 0
+		}
+	}
+	return -1
+}
+
+func sharesBond(a, b []int) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unionAtoms(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	var out []int
+	for _, x := range append(append([]int(nil), a...), b...) {
+		if !seen[x] {
+			seen[x] = true
+			out = append(out, x)
+		}
+	}
+	return out
+}
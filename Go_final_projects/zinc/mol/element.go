@@ -0,0 +1,139 @@
+package mol
+
+import "math"
+
+// Element 是週期表中一個元素的基本資料
+type Element struct {
+	Symbol   string
+	Number   int
+	Mass     float64 // 平均原子量
+	MonoMass float64 // 最高豐度同位素的精確質量
+	Valences []int   // 預設價數，由小到大；空白表示不補隱含氫
+}
+
+var elements = []Element{
+	{"H", 1, 1.008, 1.00782503, []int{1}},
+	{"He", 2, 4.002602, 4.00260325, nil},
+	{"Li", 3, 6.94, 7.01600344, nil},
+	{"Be", 4, 9.0121831, 9.0121831, nil},
+	{"B", 5, 10.81, 11.0093054, []int{3}},
+	{"C", 6, 12.011, 12.0, []int{4}},
+	{"N", 7, 14.007, 14.0030740, []int{3, 5}},
+	{"O", 8, 15.999, 15.9949146, []int{2}},
+	{"F", 9, 18.998403163, 18.9984032, []int{1}},
+	{"Ne", 10, 20.1797, 19.9924402, nil},
+	{"Na", 11, 22.98976928, 22.9897693, nil},
+	{"Mg", 12, 24.305, 23.9850417, nil},
+	{"Al", 13, 26.9815385, 26.9815385, nil},
+	{"Si", 14, 28.085, 27.9769265, []int{4}},
+	{"P", 15, 30.973761998, 30.9737620, []int{3, 5}},
+	{"S", 16, 32.06, 31.9720711, []int{2, 4, 6}},
+	{"Cl", 17, 35.45, 34.9688527, []int{1}},
+	{"Ar", 18, 39.948, 39.9623831, nil},
+	{"K", 19, 39.0983, 38.9637065, nil},
+	{"Ca", 20, 40.078, 39.9625909, nil},
+	{"Sc", 21, 44.955908, 44.9559083, nil},
+	{"Ti", 22, 47.867, 47.9479409, nil},
+	{"V", 23, 50.9415, 50.9439570, nil},
+	{"Cr", 24, 51.9961, 51.9405062, nil},
+	{"Mn", 25, 54.938044, 54.9380439, nil},
+	{"Fe", 26, 55.845, 55.9349363, nil},
+	{"Co", 27, 58.933194, 58.9331943, nil},
+	{"Ni", 28, 58.6934, 57.9353424, nil},
+	{"Cu", 29, 63.546, 62.9295977, nil},
+	{"Zn", 30, 65.38, 63.9291420, nil},
+	{"Ga", 31, 69.723, 68.9255735, nil},
+	{"Ge", 32, 72.630, 73.9211778, []int{4}},
+	{"As", 33, 74.921595, 74.9215946, []int{3, 5}},
+	{"Se", 34, 78.971, 79.9165218, []int{2, 4, 6}},
+	{"Br", 35, 79.904, 78.9183376, []int{1}},
+	{"Kr", 36, 83.798, 83.9114977, nil},
+	{"Rb", 37, 85.4678, 84.9117897, nil},
+	{"Sr", 38, 87.62, 87.9056125, nil},
+	{"Y", 39, 88.90584, 88.9058403, nil},
+	{"Zr", 40, 91.224, 89.9046977, nil},
+	{"Nb", 41, 92.90637, 92.9063730, nil},
+	{"Mo", 42, 95.95, 97.9054048, nil},
+	{"Tc", 43, 98, 97.9072124, nil},
+	{"Ru", 44, 101.07, 101.9043441, nil},
+	{"Rh", 45, 102.90550, 102.9054980, nil},
+	{"Pd", 46, 106.42, 105.9034804, nil},
+	{"Ag", 47, 107.8682, 106.9050916, nil},
+	{"Cd", 48, 112.414, 113.9033651, nil},
+	{"In", 49, 114.818, 114.9038788, nil},
+	{"Sn", 50, 118.710, 119.9022016, nil},
+	{"Sb", 51, 121.760, 120.9038120, nil},
+	{"Te", 52, 127.60, 129.9062228, []int{2, 4, 6}},
+	{"I", 53, 126.90447, 126.9044719, []int{1, 3, 5}},
+	{"Xe", 54, 131.293, 131.9041551, nil},
+	{"Cs", 55, 132.90545196, 132.9054520, nil},
+	{"Ba", 56, 137.327, 137.9052470, nil},
+	{"Gd", 64, 157.25, 157.9241123, nil},
+	{"Pt", 78, 195.084, 194.9647917, nil},
+	{"Au", 79, 196.966569, 196.9665688, nil},
+	{"Hg", 80, 200.592, 201.9706434, nil},
+	{"Tl", 81, 204.38, 204.9744278, nil},
+	{"Pb", 82, 207.2, 207.9766525, nil},
+	{"Bi", 83, 208.98040, 208.9803991, nil},
+}
+
+// 常見同位素的精確質量，其餘同位素以質量數近似
+var isotopeMasses = map[string]map[int]float64{
+	"H":  {1: 1.00782503, 2: 2.01410178, 3: 3.01604928},
+	"C":  {12: 12.0, 13: 13.00335484, 14: 14.00324199},
+	"N":  {14: 14.0030740, 15: 15.0001089},
+	"O":  {16: 15.9949146, 17: 16.9991317, 18: 17.9991596},
+	"F":  {18: 18.0009380, 19: 18.9984032},
+	"P":  {31: 30.9737620, 32: 31.9739077},
+	"S":  {32: 31.9720711, 34: 33.9678669, 35: 34.9690322},
+	"Cl": {35: 34.9688527, 36: 35.9683069, 37: 36.9659026},
+	"Br": {79: 78.9183376, 81: 80.9162906},
+	"I":  {123: 122.9055898, 125: 124.9046294, 127: 126.9044719, 131: 130.9061246},
+}
+
+var elementIndex = func() map[string]*Element {
+	idx := make(map[string]*Element, len(elements))
+	for i := range elements {
+		idx[elements[i].Symbol] = &elements[i]
+	}
+	return idx
+}()
+
+// LookupElement 依元素符號查詢元素資料
+func LookupElement(symbol string) (*Element, bool) {
+	e, ok := elementIndex[symbol]
+	return e, ok
+}
+
+// IsotopeMass 回傳指定同位素的精確質量
+func IsotopeMass(symbol string, massNumber int) float64 {
+	if m, ok := isotopeMasses[symbol][massNumber]; ok {
+		return m
+	}
+	return float64(massNumber)
+}
+
+// AtomicNumber 回傳原子序，未知元素（例如 R#、*）回傳 0
+func (a *Atom) AtomicNumber() int {
+	if e, ok := LookupElement(a.Symbol); ok {
+		return e.Number
+	}
+	return 0
+}
+
+// IsHeavy 判斷原子是否為氫以外的原子
+func (a *Atom) IsHeavy() bool {
+	return a.Symbol != "H"
+}
+
+// adjustValence 依電荷調整預設價數：硼帶負電時多一價，
+// 碳族帶電時少一價，氮族、氧族與鹵素則隨正電荷增加
+func adjustValence(symbol string, valence, charge int) int {
+	switch symbol {
+	case "B":
+		return valence - charge
+	case "C", "Si", "Ge", "H":
+		return valence - int(math.Abs(float64(charge)))
+	}
+	return valence + charge
+}
@@ -0,0 +1,326 @@
+package mol
+
+import "sort"
+
+// Edge 是鄰接表中的一個項目
+type Edge struct {
+	Atom int // 相鄰原子
+	Bond int // 連接的鍵索引
+}
+
+// Adjacency 建立鄰接表，邊的順序與 Bonds 中出現的順序一致
+func (m *Molecule) Adjacency() [][]Edge {
+	adj := make([][]Edge, len(m.Atoms))
+	for i, b := range m.Bonds {
+		adj[b.Begin] = append(adj[b.Begin], Edge{Atom: b.End, Bond: i})
+		adj[b.End] = append(adj[b.End], Edge{Atom: b.Begin, Bond: i})
+	}
+	return adj
+}
+
+// ImplicitHydrogens 依預設價數推算原子 i 的隱含氫數。
+// 芳香鍵（Aromatic）每個算一價，再額外加一價給 π 電子，
+// 所以 SMILES 的 c1ccccc1 每個碳有一個氫，而 n 不帶氫。
+func (m *Molecule) ImplicitHydrogens(i int) int {
+	a := &m.Atoms[i]
+	if a.NoImplicit || a.Valence == 15 {
+		return 0
+	}
+	e, ok := LookupElement(a.Symbol)
+	if !ok || (len(e.Valences) == 0 && a.Valence == 0) {
+		return 0
+	}
+
+	used, aromatic := a.ExplicitH, 0
+	for _, b := range m.Bonds {
+		if b.Begin != i && b.End != i {
+			continue
+		}
+		switch b.Order {
+		case Single, Double, Triple:
+			used += b.Order
+		case Aromatic:
+			aromatic++
+		case 9, 10: // 配位鍵與氫鍵不佔價數
+		default:
+			used++
+		}
+	}
+	if aromatic > 0 {
+		used += aromatic + 1
+	}
+	switch a.Radical {
+	case 2:
+		used++
+	case 1, 3:
+		used += 2
+	}
+
+	if a.Valence > 0 {
+		return max(a.Valence-used, 0)
+	}
+	for _, v := range e.Valences {
+		if v = adjustValence(a.Symbol, v, a.Charge); v >= used {
+			return v - used
+		}
+	}
+	return 0
+}
+
+// HydrogenCount 回傳原子 i 上的氫總數：隱含氫、ExplicitH 與圖中相連的氫原子
+func (m *Molecule) HydrogenCount(i int) int {
+	n := m.ImplicitHydrogens(i) + m.Atoms[i].ExplicitH
+	for _, j := range m.Neighbors(i) {
+		if m.Atoms[j].Symbol == "H" {
+			n++
+		}
+	}
+	return n
+}
+
+// HeavyDegree 回傳原子 i 的非氫鄰居數
+func (m *Molecule) HeavyDegree(i int) int {
+	n := 0
+	for _, j := range m.Neighbors(i) {
+		if m.Atoms[j].IsHeavy() {
+			n++
+		}
+	}
+	return n
+}
+
+// Components 回傳每個原子所屬的連通分量編號與分量數
+func (m *Molecule) Components() ([]int, int) {
+	adj := m.Adjacency()
+	comp := make([]int, len(m.Atoms))
+	for i := range comp {
+		comp[i] = -1
+	}
+	n := 0
+	for start := range m.Atoms {
+		if comp[start] >= 0 {
+			continue
+		}
+		stack := []int{start}
+		comp[start] = n
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range adj[i] {
+				if comp[e.Atom] < 0 {
+					comp[e.Atom] = n
+					stack = append(stack, e.Atom)
+				}
+			}
+		}
+		n++
+	}
+	return comp, n
+}
+
+// RingBonds 標記位於環上的鍵（也就是不是橋的鍵）
+func (m *Molecule) RingBonds() []bool {
+	adj := m.Adjacency()
+	inRing := make([]bool, len(m.Bonds))
+	for i := range inRing {
+		inRing[i] = true
+	}
+	order := make([]int, len(m.Atoms))
+	low := make([]int, len(m.Atoms))
+	counter := 0
+
+	// Tarjan 找橋，為了避免深度遞迴改用明確的堆疊
+	type frame struct{ atom, parentBond, next int }
+	for root := range m.Atoms {
+		if order[root] != 0 {
+			continue
+		}
+		counter++
+		order[root], low[root] = counter, counter
+		stack := []frame{{root, -1, 0}}
+		for len(stack) > 0 {
+			f := &stack[len(stack)-1]
+			if f.next < len(adj[f.atom]) {
+				e := adj[f.atom][f.next]
+				f.next++
+				if e.Bond == f.parentBond {
+					continue
+				}
+				if order[e.Atom] == 0 {
+					counter++
+					order[e.Atom], low[e.Atom] = counter, counter
+					stack = append(stack, frame{e.Atom, e.Bond, 0})
+				} else {
+					low[f.atom] = min(low[f.atom], order[e.Atom])
+				}
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1].atom
+				low[parent] = min(low[parent], low[f.atom])
+				if low[f.atom] > order[parent] {
+					inRing[f.parentBond] = false
+				}
+			}
+		}
+	}
+	return inRing
+}
+
+// RingAtoms 標記位於環上的原子
+func (m *Molecule) RingAtoms() []bool {
+	atoms := make([]bool, len(m.Atoms))
+	for i, in := range m.RingBonds() {
+		if in {
+			atoms[m.Bonds[i].Begin] = true
+			atoms[m.Bonds[i].End] = true
+		}
+	}
+	return atoms
+}
+
+// NumRings 回傳環的數目（cyclomatic number：鍵數 - 原子數 + 連通分量數）
+func (m *Molecule) NumRings() int {
+	_, n := m.Components()
+	return len(m.Bonds) - len(m.Atoms) + n
+}
+
+// Rings 回傳最小環集合（SSSR）。每個環是沿著環走一圈的原子索引，
+// 環依大小排序。作法是對每個環鍵找出經過它的最短環，
+// 再以 GF(2) 高斯消去法挑出線性獨立的最小環。
+func (m *Molecule) Rings() [][]int {
+	need := m.NumRings()
+	if need == 0 {
+		return nil
+	}
+	adj := m.Adjacency()
+	inRing := m.RingBonds()
+
+	type candidate struct {
+		atoms []int
+		bonds []int
+	}
+	var candidates []candidate
+	seen := make(map[string]bool)
+	for bi, ok := range inRing {
+		if !ok {
+			continue
+		}
+		b := m.Bonds[bi]
+		path := shortestPath(adj, inRing, b.Begin, b.End, bi)
+		if path == nil {
+			continue
+		}
+		var bonds []int
+		for k := range path {
+			next := path[(k+1)%len(path)]
+			for _, e := range adj[path[k]] {
+				if e.Atom == next && inRing[e.Bond] {
+					bonds = append(bonds, e.Bond)
+					break
+				}
+			}
+		}
+		sorted := append([]int(nil), bonds...)
+		sort.Ints(sorted)
+		key := intsKey(sorted)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, candidate{atoms: path, bonds: sorted})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].atoms) < len(candidates[j].atoms)
+	})
+
+	words := (len(m.Bonds) + 63) / 64
+	var basis [][]uint64
+	var pivots []int
+	var rings [][]int
+	for _, c := range candidates {
+		if len(rings) == need {
+			break
+		}
+		vec := make([]uint64, words)
+		for _, b := range c.bonds {
+			vec[b/64] |= 1 << (b % 64)
+		}
+		for k, row := range basis {
+			p := pivots[k]
+			if vec[p/64]&(1<<(p%64)) != 0 {
+				for w := range vec {
+					vec[w] ^= row[w]
+				}
+			}
+		}
+		pivot := -1
+		for w, x := range vec {
+			if x != 0 {
+				for bit := 0; bit < 64; bit++ {
+					if x&(1<<bit) != 0 {
+						pivot = w*64 + bit
+						break
+					}
+				}
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		// 保持基底為簡化形式，讓之後的消去只需比對 pivot 位元
+		for k, row := range basis {
+			if row[pivot/64]&(1<<(pivot%64)) != 0 {
+				for w := range row {
+					basis[k][w] ^= vec[w]
+				}
+			}
+		}
+		basis = append(basis, vec)
+		pivots = append(pivots, pivot)
+		rings = append(rings, c.atoms)
+	}
+	return rings
+}
+
+// shortestPath 在環鍵構成的子圖中，不經過 skip 這個鍵，找出 from 到 to 的最短路徑
+func shortestPath(adj [][]Edge, inRing []bool, from, to, skip int) []int {
+	prev := make([]int, len(adj))
+	for i := range prev {
+		prev[i] = -2
+	}
+	prev[from] = -1
+	queue := []int{from}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if i == to {
+			break
+		}
+		for _, e := range adj[i] {
+			if e.Bond == skip || !inRing[e.Bond] || prev[e.Atom] != -2 {
+				continue
+			}
+			prev[e.Atom] = i
+			queue = append(queue, e.Atom)
+		}
+	}
+	if prev[to] == -2 {
+		return nil
+	}
+	var path []int
+	for i := to; i != -1; i = prev[i] {
+		path = append(path, i)
+	}
+	return path
+}
+
+func intsKey(xs []int) string {
+	b := make([]byte, 0, len(xs)*3)
+	for _, x := range xs {
+		b = append(b, byte(x), byte(x>>8), byte(x>>16))
+	}
+	return string(b)
+}
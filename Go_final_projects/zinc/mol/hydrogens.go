@@ -0,0 +1,182 @@
+package mol
+
+import "math"
+
+// 加氫時使用的鍵長（Å）與四面體角
+const (
+	hydrogenBondLength = 1.0
+	tetrahedralAngle   = 109.47 * math.Pi / 180
+)
+
+// AddHydrogens 把隱含氫與 ExplicitH 都變成圖中的氫原子，接在原本的原子之後，
+// 座標依鄰居的方向放在空出來的位置（二維分子放在平面內，三維分子依四面體或平面三角形幾何）。
+// 立體化學中代表隱含氫的 -1 改成新加入的氫原子；之後所有重原子都設為 NoImplicit，
+// 回傳加入的氫原子數。
+func (m *Molecule) AddHydrogens() int {
+	n := len(m.Atoms)
+	counts := make([]int, n)
+	total := 0
+	for i := range m.Atoms {
+		if m.Atoms[i].Symbol == "H" && m.Atoms[i].ExplicitH == 0 {
+			continue
+		}
+		counts[i] = m.ImplicitHydrogens(i) + m.Atoms[i].ExplicitH
+		total += counts[i]
+	}
+	is3D := false
+	for _, a := range m.Atoms {
+		if a.Z != 0 {
+			is3D = true
+			break
+		}
+	}
+
+	adj := m.Adjacency()
+	for i := 0; i < n; i++ {
+		if counts[i] == 0 {
+			m.Atoms[i].NoImplicit = m.Atoms[i].NoImplicit || m.Atoms[i].IsHeavy()
+			continue
+		}
+		a := &m.Atoms[i]
+		center := [3]float64{a.X, a.Y, a.Z}
+		var nbrs [][3]float64
+		double := false
+		for _, e := range adj[i] {
+			b := m.Atoms[e.Atom]
+			nbrs = append(nbrs, unit([3]float64{b.X - a.X, b.Y - a.Y, b.Z - a.Z}))
+			if o := m.Bonds[e.Bond].Order; o == Double || o == Aromatic {
+				double = true
+			}
+		}
+		dirs := hydrogenDirections(nbrs, counts[i], is3D, double)
+		for _, d := range dirs {
+			h := len(m.Atoms)
+			m.Atoms = append(m.Atoms, Atom{
+				Symbol: "H",
+				X:      center[0] + hydrogenBondLength*d[0],
+				Y:      center[1] + hydrogenBondLength*d[1],
+				Z:      center[2] + hydrogenBondLength*d[2],
+			})
+			m.Bonds = append(m.Bonds, Bond{Begin: i, End: h, Order: Single})
+			a = &m.Atoms[i]
+			if a.Chirality != ChiralNone {
+				for k, ref := range a.StereoRefs {
+					if ref == -1 {
+						a.StereoRefs[k] = h
+						break
+					}
+				}
+			}
+		}
+		a.ExplicitH = 0
+		a.NoImplicit = true
+	}
+	return total
+}
+
+// hydrogenDirections 回傳 n 個氫相對於中心原子的單位方向。
+// nbrs 是既有鄰居的單位方向，double 表示中心原子有雙鍵或芳香鍵（平面三角形）。
+func hydrogenDirections(nbrs [][3]float64, n int, is3D, double bool) [][3]float64 {
+	var sum [3]float64
+	for _, v := range nbrs {
+		sum = add(sum, v)
+	}
+	d := unit(scale(sum, -1))
+	if dot(d, d) < 1e-6 {
+		switch {
+		case len(nbrs) >= 2 && is3D:
+			// 鄰居在同一平面上且互相抵消：往平面的法線方向
+			d = unit(cross(nbrs[0], nbrs[1]))
+			if dot(d, d) < 1e-6 {
+				d = perpendicular(nbrs[0])
+			}
+		case len(nbrs) >= 1:
+			d = perpendicular(nbrs[0])
+			if !is3D {
+				d = [3]float64{-nbrs[0][1], nbrs[0][0], 0}
+			}
+		default:
+			d = [3]float64{1, 0, 0}
+		}
+	}
+	if n == 1 {
+		return [][3]float64{d}
+	}
+
+	// p 是與 d 垂直的軸：二維分子取平面內的垂直方向，三維分子取與鄰居所在平面垂直的方向
+	var p [3]float64
+	switch {
+	case !is3D:
+		p = [3]float64{-d[1], d[0], 0}
+	case len(nbrs) > 0:
+		p = unit(cross(d, nbrs[0]))
+	}
+	if dot(p, p) < 1e-6 {
+		p = perpendicular(d)
+	}
+	q := cross(d, p)
+
+	switch n {
+	case 2:
+		half := tetrahedralAngle / 2
+		axis := q
+		if double || !is3D {
+			// 平面三角形（=CH2、-NH2 接在共軛系統上）或二維座標：兩個氫在平面內
+			half, axis = math.Pi/3, p
+		}
+		if len(nbrs) == 0 {
+			half = math.Pi / 2
+		}
+		return [][3]float64{
+			add(scale(d, math.Cos(half)), scale(axis, math.Sin(half))),
+			add(scale(d, math.Cos(half)), scale(axis, -math.Sin(half))),
+		}
+	case 3:
+		tilt := math.Pi - tetrahedralAngle
+		if len(nbrs) == 0 {
+			tilt = math.Pi / 2 // 例如 BH3：平面三角形
+		}
+		var out [][3]float64
+		for k := 0; k < 3; k++ {
+			phi := float64(k) * 2 * math.Pi / 3
+			side := add(scale(p, math.Cos(phi)), scale(q, math.Sin(phi)))
+			if !is3D && k > 0 {
+				// 二維：一個氫在平面內，另外兩個向紙面上下傾斜
+				side = add(scale(p, math.Cos(phi)), [3]float64{0, 0, math.Sin(phi)})
+			}
+			out = append(out, unit(add(scale(d, math.Cos(tilt)), scale(side, math.Sin(tilt)))))
+		}
+		return out
+	}
+	// 四個以上：正四面體的頂點，多出來的重複排列
+	tetra := [][3]float64{
+		unit([3]float64{1, 1, 1}), unit([3]float64{1, -1, -1}),
+		unit([3]float64{-1, 1, -1}), unit([3]float64{-1, -1, 1}),
+	}
+	out := make([][3]float64, n)
+	for k := range out {
+		out[k] = tetra[k%4]
+	}
+	return out
+}
+
+func add(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func scale(a [3]float64, f float64) [3]float64 {
+	return [3]float64{a[0] * f, a[1] * f, a[2] * f}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// perpendicular 回傳任一個與 v 垂直的單位向量
+func perpendicular(v [3]float64) [3]float64 {
+	axis := [3]float64{1, 0, 0}
+	if math.Abs(v[0]) > 0.9 {
+		axis = [3]float64{0, 1, 0}
+	}
+	return unit(cross(v, axis))
+}
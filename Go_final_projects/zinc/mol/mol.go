@@ -0,0 +1,150 @@
+// Package mol 定義 SDF 與 SMILES 讀取器共用的分子圖模型。
+package mol
+
+import "strings"
+
+// 鍵級常數，與 V2000 bond block 的 bond type 欄位一致
+const (
+	Single   = 1
+	Double   = 2
+	Triple   = 3
+	Aromatic = 4
+)
+
+// 鍵的立體標記，與 V2000 bond block 的 stereo 欄位一致
+const (
+	StereoNone     = 0
+	StereoUp       = 1 // 楔形（wedge）
+	StereoEither   = 4
+	StereoDown     = 6 // 虛線（hash）
+	StereoCisTrans = 3 // 雙鍵 cis/trans 未定
+)
+
+// Atom 表示分子中的一個原子
+type Atom struct {
+	Symbol   string
+	X, Y, Z  float64
+	Charge   int
+	Isotope  int // 質量數，0 表示自然豐度
+	MassDiff int // V2000 atom block 的質量差欄位
+	Radical  int // 0 無、1 singlet、2 doublet、3 triplet
+	Parity   int // V2000 atom stereo parity：0 無、1 奇、2 偶、3 未定
+	HCount   int // V2000 查詢用 hydrogen count 欄位（原樣保留）
+	Valence  int // V2000 valence 欄位，0 表示預設，15 表示零價
+	MapNum   int // 原子映射編號（V3000 aamap）
+
+	// ExplicitH 是不以原子出現在圖中、但明確指定的氫數（例如 SMILES 的 [NH2+]）。
+	// NoImplicit 為 true 時不再依價數補隱含氫。
+	ExplicitH  int
+	NoImplicit bool
+
+	// Chirality 是四面體立體化學（ChiralCCW/ChiralCW），方向相對於 StereoRefs 的順序，
+	// 與 SMILES 的 @/@@ 相同；StereoRefs 中的 -1 代表隱含氫或孤對電子
+	Chirality  int
+	StereoRefs [4]int
+}
+
+// Bond 表示兩個原子之間的鍵，Begin 與 End 為 0 起始的原子索引
+type Bond struct {
+	Begin, End int
+	Order      int
+	Stereo     int
+
+	// CisTrans 是雙鍵的幾何（Cis/Trans），相對於 StereoRefs：
+	// StereoRefs[0] 連在 Begin 上、StereoRefs[1] 連在 End 上
+	CisTrans   int
+	StereoRefs [2]int
+}
+
+// Field 是 SD 檔中的一個資料欄位，例如 <zinc_id>
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Collection 是 V3000 的原子集合，例如增強立體化學的 MDLV30/STEABS、MDLV30/STERAC1
+type Collection struct {
+	Name  string
+	Atoms []int
+}
+
+// Molecule 是一筆分子紀錄
+type Molecule struct {
+	Name        string // 標頭第一行
+	Program     string // 標頭第二行（程式/時間戳記）
+	Comment     string // 標頭第三行
+	Chiral      bool   // counts line 的 chiral flag
+	Atoms       []Atom
+	Bonds       []Bond
+	Collections []Collection
+	Fields      []Field
+}
+
+// Field 回傳指定名稱的資料欄位值
+func (m *Molecule) Field(name string) (string, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetField 設定資料欄位；已存在時覆蓋原值，否則附加在最後
+func (m *Molecule) SetField(name, value string) {
+	for i := range m.Fields {
+		if m.Fields[i].Name == name {
+			m.Fields[i].Value = value
+			return
+		}
+	}
+	m.Fields = append(m.Fields, Field{Name: name, Value: value})
+}
+
+// ZincID 回傳分子的 ZINC ID，優先使用 <zinc_id> 欄位，其次是標頭名稱
+func (m *Molecule) ZincID() string {
+	if id, ok := m.Field("zinc_id"); ok {
+		return strings.TrimSpace(id)
+	}
+	if strings.HasPrefix(m.Name, "ZINC") {
+		return strings.TrimSpace(m.Name)
+	}
+	return ""
+}
+
+// Clone 回傳分子的深層複本
+func (m *Molecule) Clone() *Molecule {
+	c := *m
+	c.Atoms = append([]Atom(nil), m.Atoms...)
+	c.Bonds = append([]Bond(nil), m.Bonds...)
+	c.Fields = append([]Field(nil), m.Fields...)
+	c.Collections = make([]Collection, len(m.Collections))
+	for i, col := range m.Collections {
+		c.Collections[i] = Collection{Name: col.Name, Atoms: append([]int(nil), col.Atoms...)}
+	}
+	return &c
+}
+
+// Neighbors 回傳與原子 i 相連的原子索引
+func (m *Molecule) Neighbors(i int) []int {
+	var out []int
+	for _, b := range m.Bonds {
+		switch i {
+		case b.Begin:
+			out = append(out, b.End)
+		case b.End:
+			out = append(out, b.Begin)
+		}
+	}
+	return out
+}
+
+// BondBetween 回傳連接原子 a 與 b 的鍵索引，不存在時回傳 -1
+func (m *Molecule) BondBetween(a, b int) int {
+	for i, bond := range m.Bonds {
+		if (bond.Begin == a && bond.End == b) || (bond.Begin == b && bond.End == a) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,355 @@
+package mol
+
+import (
+	"math"
+	"sort"
+)
+
+// 四面體立體化學
+const (
+	ChiralNone = 0
+	ChiralCCW  = 1 // SMILES @：從 StereoRefs[0] 看過去，其餘三個鄰居逆時針排列
+	ChiralCW   = 2 // SMILES @@：順時針
+)
+
+// 雙鍵幾何
+const (
+	CisTransNone = 0
+	Cis          = 1
+	Trans        = 2
+)
+
+// InvertChirality 回傳相反方向的 Chirality
+func InvertChirality(c int) int {
+	switch c {
+	case ChiralCCW:
+		return ChiralCW
+	case ChiralCW:
+		return ChiralCCW
+	}
+	return c
+}
+
+// PermutationIsOdd 判斷 to 是否為 from 的奇置換，兩者必須包含相同的元素
+func PermutationIsOdd(from, to []int) bool {
+	p := append([]int(nil), to...)
+	odd := false
+	for i := range from {
+		if p[i] == from[i] {
+			continue
+		}
+		for j := i + 1; j < len(p); j++ {
+			if p[j] == from[i] {
+				p[i], p[j] = p[j], p[i]
+				odd = !odd
+				break
+			}
+		}
+	}
+	return odd
+}
+
+// ChiralityFor 回傳原子 i 的立體方向換算到鄰居順序 order 之後的值
+func (m *Molecule) ChiralityFor(i int, order [4]int) int {
+	a := &m.Atoms[i]
+	if a.Chirality == ChiralNone {
+		return ChiralNone
+	}
+	if PermutationIsOdd(a.StereoRefs[:], order[:]) {
+		return InvertChirality(a.Chirality)
+	}
+	return a.Chirality
+}
+
+// HasStereo 判斷分子是否已帶有立體化學資訊
+func (m *Molecule) HasStereo() bool {
+	for _, a := range m.Atoms {
+		if a.Chirality != ChiralNone {
+			return true
+		}
+	}
+	for _, b := range m.Bonds {
+		if b.CisTrans != CisTransNone {
+			return true
+		}
+	}
+	return false
+}
+
+// PerceiveStereo 從 molfile 的資訊推得 Chirality 與 CisTrans：
+// 四面體中心優先使用 3D 座標或楔形/虛線鍵，其次使用 atom block 的 parity；
+// 雙鍵幾何則由座標判斷（標成 either 的雙鍵除外）。
+func (m *Molecule) PerceiveStereo() {
+	adj := m.Adjacency()
+	wedged := make([]bool, len(m.Atoms))
+	for _, b := range m.Bonds {
+		if b.Order == Single && (b.Stereo == StereoUp || b.Stereo == StereoDown) {
+			wedged[b.Begin] = true
+		}
+	}
+	hasCoords, is3D := false, false
+	for _, a := range m.Atoms {
+		if a.X != 0 || a.Y != 0 || a.Z != 0 {
+			hasCoords = true
+		}
+		if a.Z != 0 {
+			is3D = true
+		}
+	}
+
+	for i := range m.Atoms {
+		if !m.isStereoCenter(i, adj[i]) {
+			continue
+		}
+		a := &m.Atoms[i]
+		refs := [4]int{-1, -1, -1, -1}
+		for k, e := range adj[i] {
+			refs[k] = e.Atom
+		}
+		switch {
+		case hasCoords && (wedged[i] || is3D):
+			if c := m.chiralityFromCoords(i, adj[i], refs, is3D); c != ChiralNone {
+				a.Chirality, a.StereoRefs = c, refs
+			}
+		case a.Parity == 1 || a.Parity == 2:
+			// parity 1：編號最大的鄰居（氫視為最大）朝後，其餘鄰居依編號遞增為順時針，
+			// 等同於以遞增順序列出鄰居時的 SMILES @@
+			sort.Slice(refs[:len(adj[i])], func(x, y int) bool { return refs[x] < refs[y] })
+			a.StereoRefs = refs
+			a.Chirality = ChiralCW
+			if a.Parity == 2 {
+				a.Chirality = ChiralCCW
+			}
+		}
+	}
+
+	if !hasCoords {
+		return
+	}
+	inRing := m.RingBonds()
+	for bi := range m.Bonds {
+		b := &m.Bonds[bi]
+		if b.Order != Double || b.Stereo == StereoCisTrans || (inRing[bi] && !m.inLargeRing(bi)) {
+			continue
+		}
+		ref0, ok0 := m.cisTransRef(b.Begin, b.End, adj)
+		ref1, ok1 := m.cisTransRef(b.End, b.Begin, adj)
+		if !ok0 || !ok1 {
+			continue
+		}
+		// 取兩個參考原子垂直於雙鍵軸的分量，同向為 cis
+		p, q := m.Atoms[b.Begin], m.Atoms[b.End]
+		axis := unit([3]float64{q.X - p.X, q.Y - p.Y, q.Z - p.Z})
+		perp := func(from Atom, r int) [3]float64 {
+			s := m.Atoms[r]
+			v := [3]float64{s.X - from.X, s.Y - from.Y, s.Z - from.Z}
+			d := dot(v, axis)
+			return [3]float64{v[0] - d*axis[0], v[1] - d*axis[1], v[2] - d*axis[2]}
+		}
+		v0, v1 := perp(p, ref0), perp(q, ref1)
+		cos := dot(unit(v0), unit(v1))
+		if math.Abs(cos) < 0.1 {
+			continue
+		}
+		b.StereoRefs = [2]int{ref0, ref1}
+		b.CisTrans = Trans
+		if cos > 0 {
+			b.CisTrans = Cis
+		}
+	}
+}
+
+// isStereoCenter 判斷原子 i 是否可能是四面體立體中心：
+// 四個單鍵取代基（最多一個氫），或是帶孤對電子的三配位 S、Se、P
+func (m *Molecule) isStereoCenter(i int, edges []Edge) bool {
+	a := &m.Atoms[i]
+	h := m.ImplicitHydrogens(i) + a.ExplicitH
+	switch {
+	case len(edges)+h == 4 && h <= 1:
+		for _, e := range edges {
+			if m.Bonds[e.Bond].Order != Single {
+				return false
+			}
+		}
+		return true
+	case len(edges) == 3 && h == 0:
+		switch a.Symbol {
+		case "S", "Se", "P":
+			return true
+		}
+	}
+	return false
+}
+
+// cisTransRef 回傳雙鍵 from=to 在 from 端用來描述幾何的鄰居；
+// 沒有鄰居或鄰接鍵標成 either（波浪鍵）時回傳 false
+func (m *Molecule) cisTransRef(from, to int, adj [][]Edge) (int, bool) {
+	ref := -1
+	for _, e := range adj[from] {
+		if e.Atom == to {
+			continue
+		}
+		if b := m.Bonds[e.Bond]; b.Stereo == StereoEither {
+			return -1, false
+		}
+		if ref < 0 {
+			ref = e.Atom
+		}
+	}
+	return ref, ref >= 0
+}
+
+// inLargeRing 判斷鍵是否只在八元以上的環中，這樣的環內雙鍵才可能有 cis/trans
+func (m *Molecule) inLargeRing(bond int) bool {
+	b := m.Bonds[bond]
+	path := shortestPath(m.Adjacency(), m.RingBonds(), b.Begin, b.End, bond)
+	return path != nil && len(path) >= 8
+}
+
+// chiralityFromCoords 依鄰居的空間位置判斷 refs 順序下的方向。
+// 2D 結構中楔形鍵的鄰居往觀察者方向抬高，虛線鍵的鄰居往後壓低；
+// 隱含氫或孤對電子放在其他鄰居單位向量和的反方向。
+func (m *Molecule) chiralityFromCoords(i int, edges []Edge, refs [4]int, is3D bool) int {
+	c := m.Atoms[i]
+	pos := make(map[int][3]float64, 4)
+	var sum [3]float64
+	for _, e := range edges {
+		a := m.Atoms[e.Atom]
+		v := [3]float64{a.X - c.X, a.Y - c.Y, a.Z - c.Z}
+		if b := m.Bonds[e.Bond]; !is3D && b.Begin == i {
+			switch b.Stereo {
+			case StereoUp:
+				v[2] = 0.8 * math.Hypot(v[0], v[1])
+			case StereoDown:
+				v[2] = -0.8 * math.Hypot(v[0], v[1])
+			}
+		}
+		pos[e.Atom] = v
+		u := unit(v)
+		for k := range sum {
+			sum[k] += u[k]
+		}
+	}
+	pos[-1] = [3]float64{-sum[0], -sum[1], -sum[2]}
+
+	a, b, cc, d := pos[refs[0]], pos[refs[1]], pos[refs[2]], pos[refs[3]]
+	ba := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	ca := [3]float64{cc[0] - a[0], cc[1] - a[1], cc[2] - a[2]}
+	da := [3]float64{d[0] - a[0], d[1] - a[1], d[2] - a[2]}
+	vol := dot(ba, [3]float64{
+		ca[1]*da[2] - ca[2]*da[1],
+		ca[2]*da[0] - ca[0]*da[2],
+		ca[0]*da[1] - ca[1]*da[0],
+	})
+	switch {
+	case vol < -1e-6:
+		return ChiralCCW
+	case vol > 1e-6:
+		return ChiralCW
+	}
+	return ChiralNone
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func unit(v [3]float64) [3]float64 {
+	n := math.Sqrt(dot(v, v))
+	if n == 0 {
+		return v
+	}
+	return [3]float64{v[0] / n, v[1] / n, v[2] / n}
+}
+
+// RemoveHydrogens 把圖中一般的氫原子（無同位素、無電荷、只連一個重原子）
+// 併入相連原子的 ExplicitH，並更新所有的原子索引
+func (m *Molecule) RemoveHydrogens() {
+	remove := make([]bool, len(m.Atoms))
+	adj := m.Adjacency()
+	for i, a := range m.Atoms {
+		if a.Symbol != "H" || a.Isotope != 0 || a.Charge != 0 || len(adj[i]) != 1 {
+			continue
+		}
+		parent := adj[i][0].Atom
+		if m.Atoms[parent].Symbol == "H" || m.Bonds[adj[i][0].Bond].Order != Single {
+			continue
+		}
+		remove[i] = true
+		m.Atoms[parent].ExplicitH++
+	}
+
+	newIndex := make([]int, len(m.Atoms))
+	var atoms []Atom
+	for i, a := range m.Atoms {
+		if remove[i] {
+			newIndex[i] = -1
+			continue
+		}
+		newIndex[i] = len(atoms)
+		atoms = append(atoms, a)
+	}
+	remap := func(i int) int {
+		if i < 0 {
+			return -1
+		}
+		return newIndex[i]
+	}
+	for i := range atoms {
+		implicit := 0
+		for k := range atoms[i].StereoRefs {
+			atoms[i].StereoRefs[k] = remap(atoms[i].StereoRefs[k])
+			if atoms[i].StereoRefs[k] < 0 {
+				implicit++
+			}
+		}
+		if implicit > 1 {
+			// 兩個以上的氫不可能是立體中心
+			atoms[i].Chirality = ChiralNone
+		}
+	}
+	var bonds []Bond
+	for _, b := range m.Bonds {
+		if remove[b.Begin] || remove[b.End] {
+			continue
+		}
+		b.Begin, b.End = newIndex[b.Begin], newIndex[b.End]
+		b.StereoRefs = [2]int{remap(b.StereoRefs[0]), remap(b.StereoRefs[1])}
+		bonds = append(bonds, b)
+	}
+	for k := range m.Collections {
+		var kept []int
+		for _, a := range m.Collections[k].Atoms {
+			if newIndex[a] >= 0 {
+				kept = append(kept, newIndex[a])
+			}
+		}
+		m.Collections[k].Atoms = kept
+	}
+	m.Atoms, m.Bonds = atoms, bonds
+
+	// 雙鍵的參考原子被移除時改用同一端的另一個鄰居，幾何隨之反轉
+	adj = m.Adjacency()
+	for bi := range m.Bonds {
+		b := &m.Bonds[bi]
+		if b.CisTrans == CisTransNone {
+			continue
+		}
+		for k, end := range [2]int{b.Begin, b.End} {
+			if b.StereoRefs[k] >= 0 {
+				continue
+			}
+			other := b.End
+			if k == 1 {
+				other = b.Begin
+			}
+			ref, ok := m.cisTransRef(end, other, adj)
+			if !ok {
+				b.CisTrans = CisTransNone
+				break
+			}
+			b.StereoRefs[k] = ref
+			b.CisTrans = 3 - b.CisTrans
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package pipeline 在同一個行程中依序執行處理步驟（例如挑選 → 下載 → 合併），
+// 前一步的輸出直接作為下一步的輸入。每一步完成後把輸出寫入檢查點檔，
+// 中途失敗時再次執行會從最後一個成功的步驟之後繼續。
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// CheckpointVersion 是檢查點檔格式的版本
+const CheckpointVersion = 1
+
+// Stage 是管線中的一個步驟，以 NewStage 建立
+type Stage struct {
+	name string
+	in   reflect.Type
+	out  reflect.Type
+	run  func(ctx context.Context, in any) (any, error)
+}
+
+// NewStage 建立一個步驟。In 與 Out 必須能編碼成 JSON：輸入的 SHA-256 用來比對檢查點，
+// 輸出保存在檢查點中，續跑時解碼後交給下一步。
+func NewStage[In, Out any](name string, run func(ctx context.Context, in In) (Out, error)) Stage {
+	return Stage{
+		name: name,
+		in:   reflect.TypeFor[In](),
+		out:  reflect.TypeFor[Out](),
+		run: func(ctx context.Context, in any) (any, error) {
+			v, ok := in.(In)
+			if !ok {
+				return nil, fmt.Errorf("input is %T, want %v", in, reflect.TypeFor[In]())
+			}
+			return run(ctx, v)
+		},
+	}
+}
+
+// Name 回傳步驟名稱
+func (s Stage) Name() string { return s.name }
+
+// EventKind 是步驟事件的種類
+type EventKind string
+
+const (
+	Started  EventKind = "started"
+	Resumed  EventKind = "resumed" // 輸入與檢查點相同，沿用上次的輸出
+	Finished EventKind = "finished"
+	Failed   EventKind = "failed"
+)
+
+// Event 是一個步驟的狀態變化
+type Event struct {
+	Stage  string
+	Kind   EventKind
+	Output any   // Resumed 與 Finished 時的輸出
+	Err    error // Failed 時的錯誤
+}
+
+// Pipeline 依序執行一組步驟
+type Pipeline struct {
+	stages     []Stage
+	checkpoint string
+
+	// Notify 不為 nil 時在每個步驟開始、沿用、完成或失敗時呼叫
+	Notify func(Event)
+}
+
+// New 建立管線，並確認每一步的輸出型別與下一步的輸入型別相同。
+// checkpoint 是檢查點檔的路徑，空字串表示不保存檢查點。
+func New(checkpoint string, stages ...Stage) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("pipeline has no stages")
+	}
+	seen := make(map[string]bool, len(stages))
+	for i, s := range stages {
+		if seen[s.name] {
+			return nil, fmt.Errorf("duplicate stage %q", s.name)
+		}
+		seen[s.name] = true
+		if i > 0 && stages[i-1].out != s.in {
+			return nil, fmt.Errorf("stage %q takes %v, but %q returns %v", s.name, s.in, stages[i-1].name, stages[i-1].out)
+		}
+	}
+	return &Pipeline{stages: stages, checkpoint: checkpoint}, nil
+}
+
+// Checkpoint 記錄每個完成的步驟
+type Checkpoint struct {
+	Version int               `json:"version"`
+	Stages  map[string]Record `json:"stages"`
+}
+
+// Record 是一個步驟最後一次成功執行的結果
+type Record struct {
+	InputSHA256 string          `json:"input_sha256"`
+	Output      json.RawMessage `json:"output"`
+	Finished    time.Time       `json:"finished"`
+}
+
+// ReadCheckpoint 讀取檢查點檔；檔案不存在時回傳空的檢查點
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	cp := &Checkpoint{Version: CheckpointVersion, Stages: map[string]Record{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("%s: unsupported checkpoint version %d", path, cp.Version)
+	}
+	if cp.Stages == nil {
+		cp.Stages = map[string]Record{}
+	}
+	return cp, nil
+}
+
+// Reset 刪除檢查點檔，下次執行時每一步都重新執行
+func (p *Pipeline) Reset() error {
+	if p.checkpoint == "" {
+		return nil
+	}
+	if err := os.Remove(p.checkpoint); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Run 以 input 作為第一步的輸入依序執行每一步，回傳最後一步的輸出。
+// 某一步的輸入與檢查點中記錄的相同時沿用記錄的輸出，不再執行；
+// 前面的步驟重新執行而輸出改變時，後面的步驟也會因為輸入不同而重新執行。
+func (p *Pipeline) Run(ctx context.Context, input any) (any, error) {
+	cp := &Checkpoint{Version: CheckpointVersion, Stages: map[string]Record{}}
+	if p.checkpoint != "" {
+		var err error
+		if cp, err = ReadCheckpoint(p.checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	cur := input
+	for _, s := range p.stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		in, err := json.Marshal(cur)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: encoding input: %v", s.name, err)
+		}
+		sum := sha256.Sum256(in)
+		inSum := hex.EncodeToString(sum[:])
+
+		if rec, ok := cp.Stages[s.name]; ok && rec.InputSHA256 == inSum {
+			out := reflect.New(s.out)
+			if err := json.Unmarshal(rec.Output, out.Interface()); err == nil {
+				cur = out.Elem().Interface()
+				p.notify(Event{Stage: s.name, Kind: Resumed, Output: cur})
+				continue
+			}
+		}
+
+		p.notify(Event{Stage: s.name, Kind: Started})
+		out, err := s.run(ctx, cur)
+		if err != nil {
+			p.notify(Event{Stage: s.name, Kind: Failed, Err: err})
+			return nil, fmt.Errorf("stage %s: %w", s.name, err)
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: encoding output: %v", s.name, err)
+		}
+		if p.checkpoint != "" {
+			cp.Stages[s.name] = Record{InputSHA256: inSum, Output: data, Finished: time.Now()}
+			if err := writeCheckpoint(p.checkpoint, cp); err != nil {
+				return nil, fmt.Errorf("stage %s: saving checkpoint: %v", s.name, err)
+			}
+		}
+		p.notify(Event{Stage: s.name, Kind: Finished, Output: out})
+		cur = out
+	}
+	return cur, nil
+}
+
+func (p *Pipeline) notify(e Event) {
+	if p.Notify != nil {
+		p.Notify(e)
+	}
+}
+
+func writeCheckpoint(path string, cp *Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, append(data, '\n'))
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type list struct {
+	IDs []string `json:"ids"`
+}
+
+type total struct {
+	Count int `json:"count"`
+}
+
+func TestNewChecksTypes(t *testing.T) {
+	split := NewStage("split", func(ctx context.Context, s string) (list, error) { return list{strings.Fields(s)}, nil })
+	count := NewStage("count", func(ctx context.Context, l list) (total, error) { return total{len(l.IDs)}, nil })
+	if _, err := New("", split, count); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("", count, split); err == nil {
+		t.Error("New accepted stages whose types do not match")
+	}
+	if _, err := New("", split, split); err == nil {
+		t.Error("New accepted duplicate stage names")
+	}
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "pipeline.json")
+	runs := map[string]int{}
+	fail := true
+	split := NewStage("split", func(ctx context.Context, s string) (list, error) {
+		runs["split"]++
+		return list{strings.Fields(s)}, nil
+	})
+	count := NewStage("count", func(ctx context.Context, l list) (total, error) {
+		runs["count"]++
+		if fail {
+			return total{}, errors.New("network down")
+		}
+		return total{len(l.IDs)}, nil
+	})
+	format := NewStage("format", func(ctx context.Context, n total) (string, error) {
+		runs["format"]++
+		return strconv.Itoa(n.Count) + " IDs", nil
+	})
+	p, err := New(checkpoint, split, count, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	p.Notify = func(e Event) { events = append(events, e.Stage+" "+string(e.Kind)) }
+
+	if _, err := p.Run(context.Background(), "ZINC1 ZINC2"); err == nil || !strings.Contains(err.Error(), "stage count") {
+		t.Fatalf("Run error = %v, want a count failure", err)
+	}
+	fail = false
+	events = nil
+	out, err := p.Run(context.Background(), "ZINC1 ZINC2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "2 IDs" {
+		t.Errorf("output = %v", out)
+	}
+	if runs["split"] != 1 || runs["count"] != 2 || runs["format"] != 1 {
+		t.Errorf("runs = %v, want split resumed from the checkpoint", runs)
+	}
+	want := "split resumed,count started,count finished,format started,format finished"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+
+	// 輸入不同時從第一步重新執行
+	if out, err := p.Run(context.Background(), "ZINC1 ZINC2 ZINC3"); err != nil || out != "3 IDs" {
+		t.Fatalf("Run = %v, %v", out, err)
+	}
+	if runs["split"] != 2 || runs["count"] != 3 {
+		t.Errorf("runs = %v, want every stage to run again", runs)
+	}
+
+	cp, err := ReadCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n total
+	if err := json.Unmarshal(cp.Stages["count"].Output, &n); err != nil || len(cp.Stages) != 3 || n.Count != 3 {
+		t.Errorf("checkpoint = %+v (%v)", cp, err)
+	}
+	if err := p.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint still exists after Reset: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "zinc_ids.txt")
+	fired := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- Watch(ctx, path, func() { fired <- struct{}{} }) }()
+	time.Sleep(100 * time.Millisecond) // 等待監看開始
+
+	expect := func(what string, want bool) {
+		t.Helper()
+		select {
+		case <-fired:
+			if !want {
+				t.Errorf("%s: Watch fired", what)
+			}
+		case <-time.After(300 * time.Millisecond):
+			if want {
+				t.Errorf("%s: Watch did not fire", what)
+			}
+		}
+	}
+
+	// 分段寫入不觸發
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		f.WriteString("ZINC" + strconv.Itoa(i) + "\n")
+		f.Sync()
+	}
+	f.Close()
+	expect("chunked write", false)
+
+	if err := WriteFile(path, []byte("ZINC1\nZINC2\n")); err != nil {
+		t.Fatal(err)
+	}
+	expect("atomic replace", true)
+
+	if err := os.WriteFile(MarkerPath(path), []byte("ok\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("marker file", true)
+	expect("marker file, second event", false)
+	if _, err := os.Stat(MarkerPath(path)); !os.IsNotExist(err) {
+		t.Errorf("marker file was not removed: %v", err)
+	}
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch = %v, want context.Canceled", err)
+	}
+}
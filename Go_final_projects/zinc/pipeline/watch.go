@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// MarkerSuffix 是標記檔的副檔名：寫完 zinc_ids.txt 後建立 zinc_ids.txt.done 表示檔案已完整
+const MarkerSuffix = ".done"
+
+// MarkerPath 回傳 path 的標記檔路徑
+func MarkerPath(path string) string { return path + MarkerSuffix }
+
+// WriteFile 先把 data 寫入同目錄的暫存檔，完整寫完才改名為 path。
+// 讀取者不會看到寫到一半的檔案，Watch 也只會在改名時觸發一次。
+func WriteFile(path string, data []byte) error {
+	return WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteAtomic 與 WriteFile 相同，內容由 write 分次寫出
+func WriteAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Watch 監看 path，在它「完整寫入」時呼叫 fn，直到 ctx 結束。完整寫入是指：
+//   - 同目錄中的暫存檔改名為 path（WriteFile 與 WriteAtomic 的做法），或
+//   - 寫完 path 之後建立或寫入標記檔 MarkerPath(path)；標記檔處理後即刪除。
+//
+// 直接建立或分段寫入 path 不會觸發，因為無法得知最後一段何時寫完；
+// 從其他目錄搬進來的檔案也需要標記檔。fn 執行期間的觸發會合併，在 fn 結束後再呼叫一次。
+func Watch(ctx context.Context, path string, fn func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	trigger := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-wctx.Done():
+				return
+			case <-trigger:
+				fn()
+			}
+		}
+	}()
+	fire := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+
+	target := filepath.Clean(path)
+	marker := MarkerPath(target)
+	// renamed 表示上一個事件是目錄中某個檔案被改名；inotify 接著送出新名稱的 Create
+	renamed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			name := filepath.Clean(ev.Name)
+			switch {
+			case name == target && ev.Has(fsnotify.Create) && renamed:
+				fire()
+			case name == marker && (ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write)):
+				// 只有刪除標記檔成功的那一次觸發，同一次建立標記檔的後續 Write 不會重複觸發
+				if _, err := os.Stat(target); err == nil && os.Remove(marker) == nil {
+					fire()
+				}
+			}
+			renamed = ev.Has(fsnotify.Rename) && name != target
+		}
+	}
+}
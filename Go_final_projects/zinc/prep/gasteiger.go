@@ -0,0 +1,102 @@
+package prep
+
+import "zinc/mol"
+
+// gasteigerIterations 是 PEOE 的迭代次數，與原論文相同；第 k 次轉移的電荷乘上 0.5^k
+const gasteigerIterations = 6
+
+// gasteigerParam 是電負度多項式 χ = a + b·q + c·q² 的係數
+type gasteigerParam struct{ a, b, c float64 }
+
+// gasteigerParams 依元素與混成（sp3、sp2、sp）列出 Gasteiger 與 Marsili (1980) 的參數，
+// S 與 P 的 sp2/sp3 參數沿用 RDKit 的延伸值
+var gasteigerParams = map[string]map[int]gasteigerParam{
+	"H":  {3: {7.17, 6.24, -0.56}},
+	"C":  {3: {7.98, 9.18, 1.88}, 2: {8.79, 9.32, 1.51}, 1: {10.39, 9.45, 0.73}},
+	"N":  {3: {11.54, 10.82, 1.36}, 2: {12.87, 11.15, 0.85}, 1: {15.68, 11.70, -0.27}},
+	"O":  {3: {14.18, 12.92, 1.39}, 2: {17.07, 13.79, 0.47}},
+	"F":  {3: {14.66, 13.85, 2.31}},
+	"Cl": {3: {11.00, 9.69, 1.35}},
+	"Br": {3: {10.08, 8.47, 1.16}},
+	"I":  {3: {9.90, 7.96, 0.96}},
+	"S":  {3: {10.14, 9.13, 1.38}, 2: {10.88, 9.49, 1.33}},
+	"P":  {3: {8.90, 8.24, 0.96}},
+}
+
+// hydrogenCation 是氫原子帶一個正電荷時的電負度；其他元素用 a + b + c
+const hydrogenCation = 20.02
+
+// hybridization 回傳計算電荷時使用的混成：1 為 sp、2 為 sp2、3 為 sp3。
+// 醯胺與共軛胺的氮視為 sp2，與 Tripos 的 N.am、N.pl3 一致。
+func (l *Ligand) hybridization(i int) int {
+	double, triple, aromatic := l.bondCounts(i)
+	switch {
+	case triple > 0 || double >= 2:
+		return 1
+	case double > 0 || aromatic > 0:
+		return 2
+	}
+	switch l.Sybyl[i] {
+	case "N.am", "N.pl3", "C.cat", "C.2", "O.co2":
+		return 2
+	}
+	return 3
+}
+
+// gasteiger 以 Gasteiger-Marsili 的部分等化軌域電負度法（PEOE）計算部分電荷。
+// 初始電荷是形式電荷，每次迭代沿著每個鍵把電子從電負度低的原子移向高的原子，
+// 所以總電荷保持不變。沒有參數的元素保持形式電荷，也不參與轉移。
+func (l *Ligand) gasteiger() []float64 {
+	m := l.Molecule
+	q := make([]float64, len(m.Atoms))
+	params := make([]*gasteigerParam, len(m.Atoms))
+	cation := make([]float64, len(m.Atoms))
+	for i, a := range m.Atoms {
+		q[i] = float64(a.Charge)
+		byHyb, ok := gasteigerParams[a.Symbol]
+		if !ok {
+			continue
+		}
+		p, ok := byHyb[l.hybridization(i)]
+		if !ok {
+			p = byHyb[3]
+		}
+		params[i] = &p
+		cation[i] = p.a + p.b + p.c
+		if a.Symbol == "H" {
+			cation[i] = hydrogenCation
+		}
+	}
+
+	chi := make([]float64, len(m.Atoms))
+	damping := 1.0
+	for iter := 0; iter < gasteigerIterations; iter++ {
+		for i, p := range params {
+			if p != nil {
+				chi[i] = p.a + p.b*q[i] + p.c*q[i]*q[i]
+			}
+		}
+		damping *= 0.5
+		dq := make([]float64, len(m.Atoms))
+		for _, b := range m.Bonds {
+			i, j := b.Begin, b.End
+			if params[i] == nil || params[j] == nil || b.Order > mol.Aromatic {
+				continue
+			}
+			// 電子從電負度低的一端移向高的一端，以較低那一端的陽離子電負度正規化
+			if chi[j] > chi[i] {
+				t := (chi[j] - chi[i]) / cation[i] * damping
+				dq[i] += t
+				dq[j] -= t
+			} else {
+				t := (chi[i] - chi[j]) / cation[j] * damping
+				dq[j] += t
+				dq[i] -= t
+			}
+		}
+		for i := range q {
+			q[i] += dq[i]
+		}
+	}
+	return q
+}
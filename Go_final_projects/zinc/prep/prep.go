@@ -0,0 +1,342 @@
+// Package prep 把解析後的分子準備成對接程式可以直接讀取的檔案：補上氫原子、
+// 指定 Tripos（Sybyl）與 AutoDock 原子類型、計算 Gasteiger 部分電荷，
+// 並寫成 PDB、Tripos MOL2 或帶有扭轉樹的 AutoDock PDBQT。
+package prep
+
+import (
+	"fmt"
+	"strings"
+
+	"zinc/mol"
+)
+
+// Ligand 是準備好輸出的配體。Molecule 中所有的氫都是圖中的原子，
+// 其餘的切片都以原子索引對應。
+type Ligand struct {
+	Name     string
+	Molecule *mol.Molecule
+	Sybyl    []string  // Tripos 原子類型，例如 C.ar、N.am、O.co2
+	AutoDock []string  // AutoDock 4 原子類型，例如 A、NA、OA、HD
+	Charges  []float64 // Gasteiger-Marsili 部分電荷
+
+	aromaticAtoms []bool
+	aromaticBonds []bool
+	adj           [][]mol.Edge
+}
+
+// Prepare 複製分子，只保留重原子最多的片段（去掉鹽類的相對離子），
+// 把隱含氫加成圖中的原子，再指定原子類型與部分電荷
+func Prepare(m *mol.Molecule) (*Ligand, error) {
+	if len(m.Atoms) == 0 {
+		return nil, fmt.Errorf("molecule has no atoms")
+	}
+	c := largestFragment(m)
+	c.AddHydrogens()
+
+	l := &Ligand{Name: m.ZincID(), Molecule: c, adj: c.Adjacency()}
+	if l.Name == "" {
+		l.Name = strings.TrimSpace(m.Name)
+	}
+	if l.Name == "" {
+		l.Name = "LIG"
+	}
+	l.aromaticAtoms, l.aromaticBonds = c.Aromaticity()
+	l.Sybyl = make([]string, len(c.Atoms))
+	for i := range c.Atoms {
+		l.Sybyl[i] = l.sybylType(i)
+	}
+	l.AutoDock = make([]string, len(c.Atoms))
+	for i := range c.Atoms {
+		l.AutoDock[i] = l.autoDockType(i)
+	}
+	l.Charges = l.gasteiger()
+	return l, nil
+}
+
+// Flat 判斷配體是否只有二維座標（所有 z 都是 0）；這樣的檔案格式正確，但不適合直接對接
+func (l *Ligand) Flat() bool {
+	for _, a := range l.Molecule.Atoms {
+		if a.Z != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// largestFragment 回傳只含重原子最多的連通分量的複本
+func largestFragment(m *mol.Molecule) *mol.Molecule {
+	comp, n := m.Components()
+	c := m.Clone()
+	if n <= 1 {
+		return c
+	}
+	heavy := make([]int, n)
+	for i, a := range m.Atoms {
+		if a.IsHeavy() {
+			heavy[comp[i]]++
+		}
+	}
+	best := 0
+	for k := range heavy {
+		if heavy[k] > heavy[best] {
+			best = k
+		}
+	}
+	newIndex := make([]int, len(m.Atoms))
+	c.Atoms = c.Atoms[:0]
+	for i, a := range m.Atoms {
+		newIndex[i] = -1
+		if comp[i] == best {
+			newIndex[i] = len(c.Atoms)
+			c.Atoms = append(c.Atoms, a)
+		}
+	}
+	for i := range c.Atoms {
+		for k, ref := range c.Atoms[i].StereoRefs {
+			if ref >= 0 {
+				c.Atoms[i].StereoRefs[k] = newIndex[ref]
+			}
+		}
+	}
+	c.Bonds = c.Bonds[:0]
+	for _, b := range m.Bonds {
+		if comp[b.Begin] != best {
+			continue
+		}
+		b.Begin, b.End = newIndex[b.Begin], newIndex[b.End]
+		for k, ref := range b.StereoRefs {
+			if ref >= 0 {
+				b.StereoRefs[k] = newIndex[ref]
+			}
+		}
+		c.Bonds = append(c.Bonds, b)
+	}
+	c.Collections = nil
+	return c
+}
+
+// bondCounts 回傳原子 i 的雙鍵、參鍵與芳香鍵數
+func (l *Ligand) bondCounts(i int) (double, triple, aromatic int) {
+	for _, e := range l.adj[i] {
+		switch {
+		case l.aromaticBonds[e.Bond]:
+			aromatic++
+		case l.Molecule.Bonds[e.Bond].Order == mol.Double:
+			double++
+		case l.Molecule.Bonds[e.Bond].Order == mol.Triple:
+			triple++
+		}
+	}
+	return
+}
+
+// hydrogens 回傳與原子 i 相連的氫原子數
+func (l *Ligand) hydrogens(i int) int {
+	n := 0
+	for _, e := range l.adj[i] {
+		if l.Molecule.Atoms[e.Atom].Symbol == "H" {
+			n++
+		}
+	}
+	return n
+}
+
+// doubleBondedTo 判斷原子 i 是否以雙鍵連到 symbols 中的任一元素
+func (l *Ligand) doubleBondedTo(i int, symbols ...string) bool {
+	for _, e := range l.adj[i] {
+		if l.Molecule.Bonds[e.Bond].Order != mol.Double || l.aromaticBonds[e.Bond] {
+			continue
+		}
+		for _, s := range symbols {
+			if l.Molecule.Atoms[e.Atom].Symbol == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAmideN 判斷原子 i 是否為醯胺氮：非芳香的氮以單鍵連在 C=O 或 C=S 的碳上
+func (l *Ligand) isAmideN(i int) bool {
+	m := l.Molecule
+	if m.Atoms[i].Symbol != "N" || l.aromaticAtoms[i] || m.Atoms[i].Charge != 0 {
+		return false
+	}
+	for _, e := range l.adj[i] {
+		if m.Bonds[e.Bond].Order == mol.Single && m.Atoms[e.Atom].Symbol == "C" && l.doubleBondedTo(e.Atom, "O", "S") {
+			return true
+		}
+	}
+	return false
+}
+
+// conjugated 判斷原子 i 是否接在芳香原子或帶雙鍵、參鍵的原子上
+func (l *Ligand) conjugated(i int) bool {
+	for _, e := range l.adj[i] {
+		if l.aromaticAtoms[e.Atom] {
+			return true
+		}
+		if d, t, _ := l.bondCounts(e.Atom); d+t > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isCarboxylateO 判斷末端氧 i 是否屬於羧酸根、磷酸根或硝基這類共振的氧：
+// 中心原子上至少有兩個末端氧，其中一個帶負電
+func (l *Ligand) isCarboxylateO(i int) bool {
+	m := l.Molecule
+	if len(l.adj[i]) != 1 {
+		return false
+	}
+	center := l.adj[i][0].Atom
+	switch m.Atoms[center].Symbol {
+	case "C", "P", "N", "S":
+	default:
+		return false
+	}
+	terminal, anion := 0, false
+	for _, e := range l.adj[center] {
+		if o := m.Atoms[e.Atom]; o.Symbol == "O" && len(l.adj[e.Atom]) == 1 {
+			terminal++
+			anion = anion || o.Charge < 0
+		}
+	}
+	return terminal >= 2 && anion
+}
+
+// sybylType 依元素、鍵級、芳香性與官能基指定 Tripos 原子類型
+func (l *Ligand) sybylType(i int) string {
+	a := l.Molecule.Atoms[i]
+	double, triple, aromatic := l.bondCounts(i)
+	degree := len(l.adj[i])
+	switch a.Symbol {
+	case "C":
+		switch {
+		case l.aromaticAtoms[i] && aromatic > 0:
+			return "C.ar"
+		case triple > 0 || double >= 2:
+			return "C.1"
+		case l.isGuanidiniumC(i):
+			return "C.cat"
+		case double > 0 || aromatic > 0:
+			return "C.2"
+		case a.Charge != 0 && degree == 3:
+			return "C.2" // 碳正離子與碳負離子
+		}
+		return "C.3"
+	case "N":
+		switch {
+		case l.aromaticAtoms[i] && aromatic > 0:
+			return "N.ar"
+		case triple > 0 || double >= 2:
+			return "N.1"
+		case l.isAmideN(i):
+			return "N.am"
+		case double > 0 && degree == 3:
+			return "N.pl3" // 硝基、亞胺鹽
+		case double > 0:
+			return "N.2"
+		case a.Charge > 0 && degree == 4:
+			return "N.4"
+		case degree == 3 && l.conjugated(i):
+			return "N.pl3" // 苯胺、烯胺與磺醯胺這類共軛的胺
+		}
+		return "N.3"
+	case "O":
+		switch {
+		case l.isCarboxylateO(i):
+			return "O.co2"
+		case double > 0 || aromatic > 0:
+			return "O.2"
+		}
+		return "O.3"
+	case "S":
+		oxo := 0
+		for _, e := range l.adj[i] {
+			if l.Molecule.Atoms[e.Atom].Symbol == "O" && l.Molecule.Bonds[e.Bond].Order == mol.Double {
+				oxo++
+			}
+		}
+		switch {
+		case oxo == 1 && degree == 3:
+			return "S.O"
+		case oxo >= 2:
+			return "S.O2"
+		case double > 0 || aromatic > 0:
+			return "S.2"
+		}
+		return "S.3"
+	case "P":
+		return "P.3"
+	case "H", "F", "Cl", "Br", "I", "Si", "Se", "Li", "Na", "K", "Ca", "Mg", "Al", "Zn", "Fe", "Mn", "Co", "Cu":
+		return a.Symbol
+	}
+	return "Du" // Tripos 的 dummy 類型
+}
+
+// isGuanidiniumC 判斷原子 i 是否為帶正電的胍基或脒基中心碳：連著三個（或兩個）氮，
+// 其中雙鍵連接的氮帶正電
+func (l *Ligand) isGuanidiniumC(i int) bool {
+	m := l.Molecule
+	nitrogens, cation := 0, false
+	for _, e := range l.adj[i] {
+		if m.Atoms[e.Atom].Symbol != "N" || l.aromaticAtoms[e.Atom] {
+			continue
+		}
+		nitrogens++
+		if m.Bonds[e.Bond].Order == mol.Double && m.Atoms[e.Atom].Charge > 0 {
+			cation = true
+		}
+	}
+	return nitrogens >= 2 && cation
+}
+
+// autoDockType 指定 AutoDock 4 原子類型：芳香碳為 A，能接受氫鍵的氮為 NA，
+// 氧與硫一律視為受體（OA、SA），接在氮或氧上的極性氫為 HD
+func (l *Ligand) autoDockType(i int) string {
+	m := l.Molecule
+	a := m.Atoms[i]
+	switch a.Symbol {
+	case "C":
+		if l.Sybyl[i] == "C.ar" {
+			return "A"
+		}
+		return "C"
+	case "N":
+		if a.Charge <= 0 && l.hydrogens(i) == 0 {
+			switch l.Sybyl[i] {
+			case "N.1", "N.2", "N.3":
+				return "NA"
+			case "N.ar":
+				if len(l.adj[i]) == 2 {
+					return "NA" // 吡啶型的氮；吡咯型的氮有三個連接，孤對電子在環上
+				}
+			}
+		}
+		return "N"
+	case "O":
+		return "OA"
+	case "S":
+		return "SA"
+	case "H":
+		if l.polarHydrogen(i) {
+			return "HD"
+		}
+		return "H"
+	}
+	return a.Symbol // 鹵素、P 與金屬的類型名稱與元素符號相同
+}
+
+// polarHydrogen 判斷氫原子 i 是否接在氮或氧上；PDBQT 只保留這些氫，其餘的氫併入相連的碳
+func (l *Ligand) polarHydrogen(i int) bool {
+	if l.Molecule.Atoms[i].Symbol != "H" || len(l.adj[i]) != 1 {
+		return false
+	}
+	switch l.Molecule.Atoms[l.adj[i][0].Atom].Symbol {
+	case "N", "O":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package prep
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zinc/merge"
+	"zinc/mol"
+	"zinc/sdf"
+	"zinc/smiles"
+)
+
+func prepareSMILES(t *testing.T, s string) *Ligand {
+	t.Helper()
+	m, err := smiles.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Prepare(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func prepareFixture(t *testing.T) *Ligand {
+	t.Helper()
+	mols, err := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Prepare(mols[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// types 回傳重原子的類型，以空白分隔
+func types(l *Ligand, ts []string) string {
+	var out []string
+	for i, a := range l.Molecule.Atoms {
+		if a.IsHeavy() {
+			out = append(out, ts[i])
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestAtomTypes(t *testing.T) {
+	tests := []struct {
+		smiles, sybyl, autodock string
+	}{
+		{"CC(=O)Nc1ccc(O)cc1", "C.3 C.2 O.2 N.am C.ar C.ar C.ar C.ar O.3 C.ar C.ar", "C C OA N A A A A OA A A"},
+		{"CC(=O)[O-]", "C.3 C.2 O.co2 O.co2", "C C OA OA"},
+		{"c1ccncc1", "C.ar C.ar C.ar N.ar C.ar C.ar", "A A A NA A A"},
+		{"c1cc[nH]c1", "C.ar C.ar C.ar N.ar C.ar", "A A A N A"},
+		{"CCN(CC)CC", "C.3 C.3 N.3 C.3 C.3 C.3 C.3", "C C NA C C C C"},
+		{"C[NH3+]", "C.3 N.4", "C N"},
+		{"CC#N", "C.3 C.1 N.1", "C C NA"},
+		{"Nc1ccccc1", "N.pl3 C.ar C.ar C.ar C.ar C.ar C.ar", "N A A A A A A"},
+		{"C[N+](=O)[O-]", "C.3 N.pl3 O.co2 O.co2", "C N OA OA"},
+		{"CS(=O)(=O)C", "C.3 S.O2 O.2 O.2 C.3", "C SA OA OA C"},
+		{"NC(=[NH2+])N", "N.pl3 C.cat N.pl3 N.pl3", "N C N N"},
+	}
+	for _, tt := range tests {
+		l := prepareSMILES(t, tt.smiles)
+		if got := types(l, l.Sybyl); got != tt.sybyl {
+			t.Errorf("%s: Sybyl types %q, want %q", tt.smiles, got, tt.sybyl)
+		}
+		if got := types(l, l.AutoDock); got != tt.autodock {
+			t.Errorf("%s: AutoDock types %q, want %q", tt.smiles, got, tt.autodock)
+		}
+	}
+}
+
+func TestAddHydrogens(t *testing.T) {
+	l := prepareSMILES(t, "[C@H](F)(Cl)Br")
+	m := l.Molecule
+	if len(m.Atoms) != 5 || m.Atoms[4].Symbol != "H" || m.HydrogenCount(0) != 1 {
+		t.Fatalf("atoms = %+v", m.Atoms)
+	}
+	// 代表隱含氫的立體參考換成新加入的氫原子
+	for _, ref := range m.Atoms[0].StereoRefs {
+		if ref == -1 {
+			t.Errorf("stereo refs still contain an implicit hydrogen: %v", m.Atoms[0].StereoRefs)
+		}
+	}
+
+	fixture := prepareFixture(t)
+	m = fixture.Molecule
+	if len(m.Atoms) != 25 {
+		t.Errorf("%d atoms after adding hydrogens, want 25", len(m.Atoms))
+	}
+	for i, a := range m.Atoms {
+		if a.Symbol != "H" {
+			continue
+		}
+		p := m.Atoms[m.Neighbors(i)[0]]
+		if d := math.Hypot(math.Hypot(a.X-p.X, a.Y-p.Y), a.Z-p.Z); math.Abs(d-1) > 1e-9 {
+			t.Errorf("H%d is %.3f Å from its heavy atom", i, d)
+		}
+	}
+	if !fixture.Flat() {
+		t.Error("fixture with 2D coordinates is not flat")
+	}
+}
+
+func TestGasteigerCharges(t *testing.T) {
+	sum := func(l *Ligand) float64 {
+		s := 0.0
+		for _, q := range l.Charges {
+			s += q
+		}
+		return s
+	}
+	acetate := prepareSMILES(t, "CC(=O)[O-]")
+	if s := sum(acetate); math.Abs(s+1) > 1e-9 {
+		t.Errorf("acetate total charge %.4f, want -1", s)
+	}
+	ethanol := prepareSMILES(t, "CCO")
+	q := ethanol.Charges
+	// O 最負、羥基氫最正，接 O 的碳比甲基碳正
+	if !(q[2] < q[0] && q[0] < q[1] && q[len(q)-1] > 0.2) {
+		t.Errorf("ethanol charges = %v", q)
+	}
+	if s := sum(ethanol); math.Abs(s) > 1e-9 {
+		t.Errorf("ethanol total charge %.4f", s)
+	}
+	methane := prepareSMILES(t, "C")
+	for _, h := range methane.Charges[1:] {
+		if math.Abs(h-methane.Charges[1]) > 1e-12 || h <= 0 {
+			t.Errorf("methane charges = %v", methane.Charges)
+		}
+	}
+}
+
+func TestWritePDBQT(t *testing.T) {
+	l := prepareFixture(t)
+	var b bytes.Buffer
+	if err := l.WritePDBQT(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	var atoms, branches, ends int
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "ATOM  "):
+			atoms++
+			if len(line) != 79 {
+				t.Errorf("ATOM record is %d columns: %q", len(line), line)
+			} else if typ := strings.TrimSpace(line[77:]); typ == "H" {
+				t.Errorf("non-polar hydrogen written: %q", line)
+			}
+		case strings.HasPrefix(line, "BRANCH"):
+			branches++
+		case strings.HasPrefix(line, "ENDBRANCH"):
+			ends++
+		}
+	}
+	// 12 個重原子加 6 個接在 N、O 上的氫；7 個可旋轉鍵中有 5 個只轉動氫
+	if atoms != 18 || branches != 7 || ends != 7 {
+		t.Errorf("%d atoms, %d branches, %d ends", atoms, branches, ends)
+	}
+	if !strings.Contains(out, "TORSDOF 2\n") || !strings.Contains(out, "REMARK  7 active torsions:") {
+		t.Errorf("pdbqt:\n%s", out)
+	}
+	// 根是糖環，而不是只有一個碳的片段
+	if root := out[strings.Index(out, "ROOT\n"):strings.Index(out, "ENDROOT")]; strings.Count(root, "ATOM") != 5 {
+		t.Errorf("root:\n%s", root)
+	}
+
+	// 醯胺 C–N 不可旋轉；芳香 C–N 與 C–OH 可以
+	l = prepareSMILES(t, "CC(=O)Nc1ccc(O)cc1")
+	if n := len(l.RotatableBonds()); n != 2 {
+		t.Errorf("acetaminophen: %d rotatable bonds, want 2", n)
+	}
+}
+
+func TestWritePDBAndMOL2(t *testing.T) {
+	l := prepareSMILES(t, "CC(=O)Nc1ccc(O)cc1")
+	var b bytes.Buffer
+	if err := l.WriteMOL2(&b); err != nil {
+		t.Fatal(err)
+	}
+	mol2 := b.String()
+	for _, want := range []string{"@<TRIPOS>MOLECULE\nLIG\n   20    20", "GASTEIGER", " N.am ", " am\n", " ar\n"} {
+		if !strings.Contains(mol2, want) {
+			t.Errorf("mol2 lacks %q:\n%s", want, mol2)
+		}
+	}
+
+	b.Reset()
+	if err := l.WritePDB(&b); err != nil {
+		t.Fatal(err)
+	}
+	pdb := b.String()
+	if n := strings.Count(pdb, "HETATM"); n != 20 {
+		t.Errorf("%d HETATM records", n)
+	}
+	if !strings.Contains(pdb, "HETATM    4  N1  LIG A   1 ") || !strings.HasSuffix(pdb, "END\n") {
+		t.Errorf("pdb:\n%s", pdb)
+	}
+	if !strings.Contains(pdb, "CONECT    2    1    3    4\n") {
+		t.Errorf("CONECT records:\n%s", pdb)
+	}
+
+	m := &mol.Molecule{Atoms: []mol.Atom{{Symbol: "N", Charge: 1}}}
+	l, _ = Prepare(m)
+	b.Reset()
+	l.WritePDB(&b)
+	if !strings.Contains(b.String(), "           N1+\n") {
+		t.Errorf("charged atom:\n%s", b.String())
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "set_1")
+	os.Mkdir(in, 0o755)
+	data, err := os.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(in, "ZINC000014418328.sdf"), data, 0o644)
+	os.WriteFile(filepath.Join(in, "broken.sdf"), []byte("not a molfile\n"), 0o644)
+	files, _ := merge.ListSDFFiles(in)
+
+	formats, err := ParseFormats("pdbqt, .MOL2,pdbqt")
+	if err != nil || len(formats) != 2 {
+		t.Fatalf("formats = %v, %v", formats, err)
+	}
+	if _, err := ParseFormats("sdf"); err == nil {
+		t.Error("ParseFormats(sdf) succeeded")
+	}
+	out := filepath.Join(dir, "set_1_pdbqt")
+	report, err := Run(files, out, formats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Prepared != 1 || len(report.Rejected) != 1 || len(report.Flat) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	for _, name := range []string{"ZINC000014418328.pdbqt", "ZINC000014418328.mol2"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := Run(files, in, formats); err == nil {
+		t.Error("preparing into the input directory succeeded")
+	}
+}
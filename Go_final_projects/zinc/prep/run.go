@@ -0,0 +1,169 @@
+package prep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zinc/merge"
+	"zinc/sdf"
+)
+
+// Format 是輸出格式，同時也是輸出檔的副檔名
+type Format string
+
+const (
+	PDB   Format = "pdb"
+	MOL2  Format = "mol2"
+	PDBQT Format = "pdbqt"
+)
+
+// ParseFormat 解析格式名稱，也接受帶點的副檔名
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "."))); f {
+	case PDB, MOL2, PDBQT:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown ligand format %q (want pdbqt, mol2 or pdb)", s)
+}
+
+// ParseFormats 解析以逗號分隔的格式清單，例如 pdbqt,mol2
+func ParseFormats(s string) ([]Format, error) {
+	var out []Format
+	seen := make(map[Format]bool)
+	for _, name := range strings.Split(s, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		f, err := ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no ligand formats given")
+	}
+	return out, nil
+}
+
+// Write 以指定格式寫出配體
+func (l *Ligand) Write(w io.Writer, f Format) error {
+	switch f {
+	case PDB:
+		return l.WritePDB(w)
+	case MOL2:
+		return l.WriteMOL2(w)
+	case PDBQT:
+		return l.WritePDBQT(w)
+	}
+	return fmt.Errorf("unknown ligand format %q", f)
+}
+
+// Report 是一次準備的結果
+type Report struct {
+	Output   string            `json:"output"`
+	Formats  []Format          `json:"formats"`
+	Prepared int               `json:"prepared"`
+	Flat     []string          `json:"flat"`     // 只有二維座標的分子，對接前需要先產生三維構形
+	Rejected []merge.Rejection `json:"rejected"` // 無法讀取、解析或準備的檔案與紀錄
+}
+
+// Run 讀取 files 中的每個分子，在 out 目錄中為每種格式寫一個 <zinc_id>.<副檔名>。
+// 與 filter.Run 一樣先寫到暫存目錄，完成後才取代舊的輸出。
+func Run(files []string, out string, formats []Format) (*Report, error) {
+	report := &Report{Output: out, Formats: formats, Flat: []string{}, Rejected: []merge.Rejection{}}
+	for _, f := range files {
+		if filepath.Clean(filepath.Dir(f)) == filepath.Clean(out) {
+			return nil, fmt.Errorf("output directory %s is also the input directory", out)
+		}
+	}
+	tmp := out + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	if err := prepareFiles(files, tmp, formats, report); err != nil {
+		os.RemoveAll(tmp)
+		return report, err
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return report, err
+	}
+	return report, os.Rename(tmp, out)
+}
+
+func prepareFiles(files []string, dir string, formats []Format, report *Report) error {
+	seen := make(map[string]bool)
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			report.Rejected = append(report.Rejected, merge.Rejection{File: path, Reason: err.Error()})
+			continue
+		}
+		sr := sdf.NewReader(file)
+		for record := 1; ; record++ {
+			m, err := sr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rej := merge.Rejection{File: path, Record: record, Reason: err.Error()}
+				var perr *sdf.ParseError
+				if errors.As(err, &perr) {
+					rej.Line, rej.Reason = perr.Line, perr.Msg
+					report.Rejected = append(report.Rejected, rej)
+					continue
+				}
+				report.Rejected = append(report.Rejected, rej)
+				break
+			}
+			id := m.ZincID()
+			if id == "" {
+				id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			l, err := Prepare(m)
+			if err != nil {
+				report.Rejected = append(report.Rejected, merge.Rejection{File: path, Record: record, Reason: err.Error()})
+				continue
+			}
+			if l.Flat() {
+				report.Flat = append(report.Flat, id)
+			}
+			for _, f := range formats {
+				if err := writeLigand(filepath.Join(dir, id+"."+string(f)), l, f); err != nil {
+					file.Close()
+					return err
+				}
+			}
+			report.Prepared++
+		}
+		file.Close()
+	}
+	return nil
+}
+
+func writeLigand(path string, l *Ligand, f Format) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = l.Write(out, f)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
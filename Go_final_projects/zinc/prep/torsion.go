@@ -0,0 +1,184 @@
+package prep
+
+import (
+	"sort"
+
+	"zinc/mol"
+)
+
+// branch 是扭轉樹的一個節點：一組彼此剛性連接的原子。
+// 根節點的 from 為 -1；其他節點經由 from–to 這個可旋轉鍵接在父節點上，atoms 的第一個原子是 to。
+type branch struct {
+	from, to int
+	atoms    []int
+	children []*branch
+}
+
+// hydrogenOnly 判斷旋轉這個分支是否只會移動氫原子（例如 -OH、-NH2），
+// 這樣的扭轉寫進 PDBQT 但不計入 TORSDOF
+func (b *branch) hydrogenOnly(m *mol.Molecule) bool {
+	if len(b.children) > 0 {
+		return false
+	}
+	for _, a := range b.atoms[1:] {
+		if m.Atoms[a].Symbol != "H" {
+			return false
+		}
+	}
+	return true
+}
+
+// kept 判斷原子 i 是否寫進 PDBQT：重原子與極性氫，非極性氫併入相連的碳
+func (l *Ligand) kept(i int) bool {
+	return l.Molecule.Atoms[i].IsHeavy() || l.polarHydrogen(i)
+}
+
+// keptDegree 回傳原子 i 在 PDBQT 中的鄰居數
+func (l *Ligand) keptDegree(i int) int {
+	n := 0
+	for _, e := range l.adj[i] {
+		if l.kept(e.Atom) {
+			n++
+		}
+	}
+	return n
+}
+
+// RotatableBonds 回傳扭轉樹使用的可旋轉鍵索引：不在環上的單鍵，兩端在 PDBQT 中都還有其他鄰居，
+// 排除醯胺 C–N 鍵與接在參鍵（直線形）原子上的鍵
+func (l *Ligand) RotatableBonds() []int {
+	m := l.Molecule
+	ring := m.RingBonds()
+	var out []int
+	for k, b := range m.Bonds {
+		if b.Order != mol.Single || l.aromaticBonds[k] || ring[k] {
+			continue
+		}
+		if !l.kept(b.Begin) || !l.kept(b.End) || l.keptDegree(b.Begin) < 2 || l.keptDegree(b.End) < 2 {
+			continue
+		}
+		if l.hybridization(b.Begin) == 1 || l.hybridization(b.End) == 1 {
+			continue
+		}
+		if l.isAmideBond(k) {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// isAmideBond 判斷鍵 k 是否為醯胺的 C–N 鍵
+func (l *Ligand) isAmideBond(k int) bool {
+	b := l.Molecule.Bonds[k]
+	for _, pair := range [][2]int{{b.Begin, b.End}, {b.End, b.Begin}} {
+		if l.Sybyl[pair[0]] == "N.am" && l.Molecule.Atoms[pair[1]].Symbol == "C" && l.doubleBondedTo(pair[1], "O", "S") {
+			return true
+		}
+	}
+	return false
+}
+
+// torsionTree 以可旋轉鍵把 PDBQT 中的原子切成剛性片段，與 AutoDock Tools 一樣選擇
+// 使最大子樹原子數最少的片段為根（相同時取原子較多的），回傳以根為起點的扭轉樹
+func (l *Ligand) torsionTree() *branch {
+	m := l.Molecule
+	rotatable := make(map[int]bool)
+	for _, k := range l.RotatableBonds() {
+		rotatable[k] = true
+	}
+
+	frag := make([]int, len(m.Atoms))
+	for i := range frag {
+		frag[i] = -1
+	}
+	var frags [][]int
+	for i := range m.Atoms {
+		if frag[i] >= 0 || !l.kept(i) {
+			continue
+		}
+		id := len(frags)
+		frag[i] = id
+		members := []int{i}
+		for q := 0; q < len(members); q++ {
+			for _, e := range l.adj[members[q]] {
+				if frag[e.Atom] < 0 && l.kept(e.Atom) && !rotatable[e.Bond] {
+					frag[e.Atom] = id
+					members = append(members, e.Atom)
+				}
+			}
+		}
+		sort.Ints(members)
+		frags = append(frags, members)
+	}
+
+	// 片段之間的連接；可旋轉鍵不在環上，所以片段圖是一棵樹
+	links := make([][]int, len(frags))
+	for k := range rotatable {
+		b := m.Bonds[k]
+		fa, fb := frag[b.Begin], frag[b.End]
+		links[fa] = append(links[fa], k)
+		links[fb] = append(links[fb], k)
+	}
+	for _, ks := range links {
+		sort.Ints(ks)
+	}
+	other := func(k, f int) int {
+		b := m.Bonds[k]
+		if frag[b.Begin] == f {
+			return frag[b.End]
+		}
+		return frag[b.Begin]
+	}
+	// subtree 回傳經由鍵 k 離開片段 f 之後那一側的原子數
+	var subtree func(f, k int) int
+	subtree = func(f, k int) int {
+		g := other(k, f)
+		n := len(frags[g])
+		for _, next := range links[g] {
+			if next != k {
+				n += subtree(g, next)
+			}
+		}
+		return n
+	}
+	root, best := 0, -1
+	for f := range frags {
+		largest := 0
+		for _, k := range links[f] {
+			largest = max(largest, subtree(f, k))
+		}
+		if best < 0 || largest < best || (largest == best && len(frags[f]) > len(frags[root])) {
+			root, best = f, largest
+		}
+	}
+
+	var build func(f, from, to int) *branch
+	build = func(f, from, to int) *branch {
+		br := &branch{from: from, to: to}
+		if to >= 0 {
+			br.atoms = append(br.atoms, to)
+		}
+		for _, a := range frags[f] {
+			if a != to {
+				br.atoms = append(br.atoms, a)
+			}
+		}
+		for _, k := range links[f] {
+			b := m.Bonds[k]
+			parent, child := b.Begin, b.End
+			if frag[parent] != f {
+				parent, child = child, parent
+			}
+			if child == from {
+				continue // 通往父節點的鍵
+			}
+			br.children = append(br.children, build(frag[child], parent, child))
+		}
+		return br
+	}
+	if len(frags) == 0 {
+		return &branch{from: -1, to: -1}
+	}
+	return build(root, -1, -1)
+}
@@ -0,0 +1,186 @@
+package prep
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zinc/mol"
+)
+
+// residueName 是寫進 PDB、MOL2 與 PDBQT 的殘基名稱
+const residueName = "LIG"
+
+// atomNames 依元素各自編號產生原子名稱，例如 C1、C2、N1、CL1
+func (l *Ligand) atomNames() []string {
+	counts := make(map[string]int)
+	names := make([]string, len(l.Molecule.Atoms))
+	for i, a := range l.Molecule.Atoms {
+		sym := strings.ToUpper(a.Symbol)
+		counts[sym]++
+		names[i] = sym + strconv.Itoa(counts[sym])
+	}
+	return names
+}
+
+// pdbName 把原子名稱排進 PDB 的 13–16 欄：單字母元素從第 14 欄開始
+func pdbName(name, symbol string) string {
+	if len(symbol) == 1 && len(name) < 4 {
+		name = " " + name
+	}
+	return fmt.Sprintf("%-4s", name)
+}
+
+// pdbCharge 回傳 PDB 79–80 欄的形式電荷，例如 1+、2-
+func pdbCharge(c int) string {
+	switch {
+	case c > 0:
+		return strconv.Itoa(c) + "+"
+	case c < 0:
+		return strconv.Itoa(-c) + "-"
+	}
+	return ""
+}
+
+// WritePDB 把配體寫成 PDB：每個原子一筆 HETATM，鍵以 CONECT 紀錄
+func (l *Ligand) WritePDB(w io.Writer) error {
+	m := l.Molecule
+	bw := bufio.NewWriter(w)
+	names := l.atomNames()
+	fmt.Fprintf(bw, "COMPND    %s\n", l.Name)
+	for i, a := range m.Atoms {
+		fmt.Fprintf(bw, "HETATM%5d %s %3s A   1    %8.3f%8.3f%8.3f  1.00  0.00          %2s%-2s\n",
+			i+1, pdbName(names[i], a.Symbol), residueName, a.X, a.Y, a.Z, strings.ToUpper(a.Symbol), pdbCharge(a.Charge))
+	}
+	for i := range m.Atoms {
+		var serials []int
+		for _, e := range l.adj[i] {
+			serials = append(serials, e.Atom+1)
+		}
+		for len(serials) > 0 {
+			n := min(len(serials), 4)
+			fmt.Fprintf(bw, "CONECT%5d", i+1)
+			for _, s := range serials[:n] {
+				fmt.Fprintf(bw, "%5d", s)
+			}
+			fmt.Fprintln(bw)
+			serials = serials[n:]
+		}
+	}
+	fmt.Fprintln(bw, "END")
+	return bw.Flush()
+}
+
+// mol2BondType 回傳 Tripos 鍵類型：1、2、3、ar（芳香）或 am（醯胺 C–N）
+func (l *Ligand) mol2BondType(k int) string {
+	switch {
+	case l.aromaticBonds[k]:
+		return "ar"
+	case l.isAmideBond(k):
+		return "am"
+	}
+	switch l.Molecule.Bonds[k].Order {
+	case mol.Double:
+		return "2"
+	case mol.Triple:
+		return "3"
+	case mol.Single:
+		return "1"
+	}
+	return "un"
+}
+
+// WriteMOL2 把配體寫成 Tripos MOL2，原子帶 Sybyl 類型與 Gasteiger 電荷
+func (l *Ligand) WriteMOL2(w io.Writer) error {
+	m := l.Molecule
+	bw := bufio.NewWriter(w)
+	names := l.atomNames()
+	fmt.Fprintf(bw, "@<TRIPOS>MOLECULE\n%s\n%5d %5d     1     0     0\nSMALL\nGASTEIGER\n\n", l.Name, len(m.Atoms), len(m.Bonds))
+	fmt.Fprintln(bw, "@<TRIPOS>ATOM")
+	for i, a := range m.Atoms {
+		fmt.Fprintf(bw, "%7d %-8s %10.4f %10.4f %10.4f %-6s %4d  %-7s %9.4f\n",
+			i+1, names[i], a.X, a.Y, a.Z, l.Sybyl[i], 1, residueName+"1", l.Charges[i])
+	}
+	fmt.Fprintln(bw, "@<TRIPOS>BOND")
+	for k, b := range m.Bonds {
+		fmt.Fprintf(bw, "%6d %5d %5d %s\n", k+1, b.Begin+1, b.End+1, l.mol2BondType(k))
+	}
+	return bw.Flush()
+}
+
+// WritePDBQT 把配體寫成 AutoDock PDBQT：只保留重原子與極性氫，非極性氫的電荷併入相連的原子，
+// 可旋轉鍵寫成 ROOT/BRANCH 扭轉樹。只移動氫原子的扭轉（例如 -OH）不計入 TORSDOF。
+func (l *Ligand) WritePDBQT(w io.Writer) error {
+	m := l.Molecule
+	names := l.atomNames()
+	charges := make([]float64, len(m.Atoms))
+	for i := range m.Atoms {
+		if !l.kept(i) {
+			continue
+		}
+		charges[i] += l.Charges[i]
+		for _, e := range l.adj[i] {
+			if !l.kept(e.Atom) {
+				charges[i] += l.Charges[e.Atom]
+			}
+		}
+	}
+
+	root := l.torsionTree()
+	serial := make([]int, len(m.Atoms))
+	next := 1
+	var torsions []*branch
+	var number func(b *branch)
+	number = func(b *branch) {
+		if b.from >= 0 {
+			torsions = append(torsions, b)
+		}
+		for _, a := range b.atoms {
+			serial[a] = next
+			next++
+		}
+		for _, c := range b.children {
+			number(c)
+		}
+	}
+	number(root)
+	dof := 0
+	for _, t := range torsions {
+		if !t.hydrogenOnly(m) {
+			dof++
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "REMARK  Name = %s\n", l.Name)
+	fmt.Fprintf(bw, "REMARK  %d active torsions:\n", len(torsions))
+	fmt.Fprintln(bw, "REMARK  status: ('A' for Active; 'I' for Inactive)")
+	for k, t := range torsions {
+		fmt.Fprintf(bw, "REMARK  %3d  A    between atoms: %s_%d  and  %s_%d\n",
+			k+1, names[t.from], serial[t.from], names[t.to], serial[t.to])
+	}
+	atoms := func(b *branch) {
+		for _, i := range b.atoms {
+			a := m.Atoms[i]
+			fmt.Fprintf(bw, "ATOM  %5d %s %3s A   1    %8.3f%8.3f%8.3f  1.00  0.00    %6.3f %-2s\n",
+				serial[i], pdbName(names[i], a.Symbol), residueName, a.X, a.Y, a.Z, charges[i], l.AutoDock[i])
+		}
+	}
+	var branches func(b *branch)
+	branches = func(b *branch) {
+		for _, c := range b.children {
+			fmt.Fprintf(bw, "BRANCH %3d %3d\n", serial[c.from], serial[c.to])
+			atoms(c)
+			branches(c)
+			fmt.Fprintf(bw, "ENDBRANCH %3d %3d\n", serial[c.from], serial[c.to])
+		}
+	}
+	fmt.Fprintln(bw, "ROOT")
+	atoms(root)
+	fmt.Fprintln(bw, "ENDROOT")
+	branches(root)
+	fmt.Fprintf(bw, "TORSDOF %d\n", dof)
+	return bw.Flush()
+}
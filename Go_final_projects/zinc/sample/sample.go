@@ -0,0 +1,305 @@
+// Package sample 從 zinc_ids_XX.txt tranche 清單挑選配體。每次挑選都以一個種子決定，
+// 並寫成 manifest（種子、條件、tranche 檔的 SHA-256 與選出的 ID），之後可以重建完全相同的清單。
+package sample
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zinc/catalog"
+	"zinc/fingerprint"
+)
+
+// ManifestVersion 是 manifest 格式的版本
+const ManifestVersion = 1
+
+// Condition 是表單上的一組條件
+type Condition struct {
+	MolecularWeight string                `json:"molecular_weight"` // 分子量字母 A–K
+	LogP            string                `json:"logp"`             // logP 字母 A–K
+	Quantity        int                   `json:"quantity"`
+	Selection       fingerprint.Selection `json:"selection"`
+}
+
+// FileName 回傳條件對應的 tranche 檔名，例如 zinc_ids_AG.txt
+func (c Condition) FileName() string {
+	return fmt.Sprintf("zinc_ids_%s%s.txt", c.MolecularWeight, c.LogP)
+}
+
+// String 以命令列的 TRANCHE:QUANTITY[:SELECTION] 格式回傳條件，例如 AG:10:maxmin
+func (c Condition) String() string {
+	s := fmt.Sprintf("%s%s:%d", c.MolecularWeight, c.LogP, c.Quantity)
+	if c.Selection != "" && c.Selection != fingerprint.Random {
+		s += ":" + string(c.Selection)
+	}
+	return s
+}
+
+// Pick 是一組條件的挑選結果
+type Pick struct {
+	Condition
+	File   string                `json:"file"`
+	SHA256 string                `json:"sha256"`
+	Method fingerprint.Selection `json:"method"` // 實際使用的方法；已下載結構不足時退回 random
+	// Candidates 是多樣性挑選時參與挑選（已下載結構）的 ID，依 tranche 檔中的順序
+	Candidates []string `json:"candidates,omitempty"`
+	Selected   []string `json:"selected"`
+}
+
+// Manifest 記錄一次挑選
+type Manifest struct {
+	Version    int       `json:"version"`
+	Created    time.Time `json:"created"`
+	Seed       int64     `json:"seed"`
+	TrancheDir string    `json:"tranche_dir"`
+	LigandDir  string    `json:"ligand_dir,omitempty"`
+	Catalog    string    `json:"catalog,omitempty"` // 讀取 tranche 的資料庫
+	Picks      []Pick    `json:"conditions"`
+}
+
+// IDs 依條件順序回傳所有選出的 ID
+func (m *Manifest) IDs() []string {
+	var ids []string
+	for _, p := range m.Picks {
+		ids = append(ids, p.Selected...)
+	}
+	return ids
+}
+
+// WriteIDs 以每行一個 ID 的格式寫出選出的 ID，與 zinc_ids.txt 相同
+func (m *Manifest) WriteIDs(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, id := range m.IDs() {
+		bw.WriteString(id + "\n")
+	}
+	return bw.Flush()
+}
+
+// ManifestPath 回傳結果檔旁的 manifest 位置，例如 zinc_ids.txt 對應 zinc_ids.manifest.json
+func ManifestPath(resultPath string) string {
+	return strings.TrimSuffix(resultPath, filepath.Ext(resultPath)) + ".manifest.json"
+}
+
+// WriteManifest 把 manifest 寫成縮排的 JSON
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadManifest 讀取 WriteManifest 寫出的檔案
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported manifest version %d", path, m.Version)
+	}
+	return &m, nil
+}
+
+// NewSeed 在使用者沒有指定種子時產生一個
+func NewSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// Sampler 從 TrancheDir 中的 tranche 檔挑選配體
+type Sampler struct {
+	TrancheDir string
+	LigandDir  string // 只用於記錄在 manifest 中
+
+	// Catalog 不為 nil 時 tranche 的 ID 從資料庫讀取，資料庫中沒有的 tranche 才讀 TrancheDir 中的檔案
+	Catalog *catalog.Catalog
+
+	// Fingerprints 回傳已下載配體的指紋（以 ZINC ID 為索引），只在需要多樣性挑選時呼叫一次；
+	// 為 nil 時所有條件都以隨機方式挑選
+	Fingerprints func() map[string]fingerprint.Fingerprint
+	// Logf 記錄退回隨機挑選等訊息，可以為 nil
+	Logf func(format string, args ...any)
+
+	fps map[string]fingerprint.Fingerprint
+}
+
+func (s *Sampler) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+func (s *Sampler) fingerprints() map[string]fingerprint.Fingerprint {
+	if s.fps == nil && s.Fingerprints != nil {
+		s.fps = s.Fingerprints()
+	}
+	return s.fps
+}
+
+// Run 以 seed 依序處理每組條件。第 i 組條件使用由 seed+i 初始化的亂數產生器，
+// 因此同樣的種子、條件與 tranche 檔一定得到同樣的結果。
+func (s *Sampler) Run(seed int64, conds []Condition) (*Manifest, error) {
+	m := &Manifest{
+		Version:    ManifestVersion,
+		Created:    time.Now().UTC(),
+		Seed:       seed,
+		TrancheDir: s.TrancheDir,
+		LigandDir:  s.LigandDir,
+	}
+	if s.Catalog != nil {
+		m.Catalog = s.Catalog.Path()
+	}
+	for i, c := range conds {
+		if c.Quantity < 1 {
+			return nil, fmt.Errorf("%s: quantity must be at least 1", c.FileName())
+		}
+		if c.Selection == "" {
+			c.Selection = fingerprint.Random
+		}
+		ids, sum, err := s.readTranche(c.FileName())
+		if err != nil {
+			return nil, err
+		}
+		p := Pick{Condition: c, File: c.FileName(), SHA256: sum, Method: c.Selection}
+		if p.Method != fingerprint.Random {
+			fps := s.fingerprints()
+			for _, id := range ids {
+				if _, ok := fps[id]; ok {
+					p.Candidates = append(p.Candidates, id)
+				}
+			}
+			if len(p.Candidates) < c.Quantity {
+				s.logf("%s: %d structures downloaded but %d requested, using random selection instead of %s",
+					p.File, len(p.Candidates), c.Quantity, p.Method)
+				p.Method, p.Candidates = fingerprint.Random, nil
+			}
+		}
+		if p.Selected, err = s.choose(&p, ids, seed+int64(i)); err != nil {
+			return nil, err
+		}
+		m.Picks = append(m.Picks, p)
+	}
+	return m, nil
+}
+
+// Replay 依 manifest 重建挑選結果。tranche 檔內容改變、多樣性挑選所需的結構已不存在，
+// 或重建的結果與 manifest 不同時回傳錯誤。
+func (s *Sampler) Replay(old *Manifest) (*Manifest, error) {
+	m := *old
+	m.Picks = nil
+	for i, op := range old.Picks {
+		ids, sum, err := s.readTranche(op.File)
+		if err != nil {
+			return nil, err
+		}
+		if sum != op.SHA256 {
+			return nil, fmt.Errorf("%s has changed since the manifest was written (sha256 %s, want %s)", op.File, sum, op.SHA256)
+		}
+		p := op
+		if p.Selected, err = s.choose(&p, ids, old.Seed+int64(i)); err != nil {
+			return nil, err
+		}
+		if !equal(p.Selected, op.Selected) {
+			return nil, fmt.Errorf("condition %d (%s): replayed selection does not match the manifest", i+1, op.File)
+		}
+		m.Picks = append(m.Picks, p)
+	}
+	return &m, nil
+}
+
+// choose 依 p.Method 從 ids（或多樣性挑選時的 p.Candidates）選出 p.Quantity 個 ID
+func (s *Sampler) choose(p *Pick, ids []string, seed int64) ([]string, error) {
+	rng := rand.New(rand.NewSource(seed))
+	if p.Method == fingerprint.Random {
+		if len(ids) < p.Quantity {
+			return nil, fmt.Errorf("not enough ZINC IDs in %s: have %d, want %d", p.File, len(ids), p.Quantity)
+		}
+		shuffled := append([]string(nil), ids...)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		return shuffled[:p.Quantity], nil
+	}
+
+	fps := s.fingerprints()
+	vecs := make([]fingerprint.Fingerprint, len(p.Candidates))
+	for k, id := range p.Candidates {
+		fp, ok := fps[id]
+		if !ok {
+			return nil, fmt.Errorf("%s: no downloaded structure for %s", p.File, id)
+		}
+		vecs[k] = fp
+	}
+	var picked []int
+	switch p.Method {
+	case fingerprint.MaxMin:
+		picked = fingerprint.PickMaxMin(vecs, p.Quantity, rng)
+	case fingerprint.SphereExclusion:
+		picked = fingerprint.PickSphereExclusion(vecs, p.Quantity, fingerprint.DefaultSphereSimilarity, rng)
+	default:
+		return nil, fmt.Errorf("%s: unknown selection method %q", p.File, p.Method)
+	}
+	selected := make([]string, len(picked))
+	for k, i := range picked {
+		selected[k] = p.Candidates[i]
+	}
+	return selected, nil
+}
+
+// readTranche 讀取 tranche 的 ID 與清單的 SHA-256。從資料庫讀取時，
+// 雜湊與把同樣的清單寫成 tranche 檔相同。
+func (s *Sampler) readTranche(file string) ([]string, string, error) {
+	if s.Catalog != nil {
+		name := strings.TrimSuffix(strings.TrimPrefix(file, "zinc_ids_"), ".txt")
+		ids, err := s.Catalog.TrancheIDs(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(ids) > 0 {
+			return ids, catalog.TrancheSHA256(ids), nil
+		}
+		s.logf("%s: tranche %s is not in the catalog, reading %s", s.Catalog.Path(), name, file)
+	}
+	return readTrancheFile(filepath.Join(s.TrancheDir, file))
+}
+
+// readTrancheFile 讀取 tranche 檔中的 ID（略過空行）與整個檔案的 SHA-256
+func readTrancheFile(path string) ([]string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, hex.EncodeToString(sum[:]), scanner.Err()
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
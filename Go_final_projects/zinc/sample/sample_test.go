@@ -0,0 +1,160 @@
+package sample
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zinc/catalog"
+	"zinc/fingerprint"
+	"zinc/smiles"
+)
+
+func writeTranche(t *testing.T, dir, name string, n int) {
+	t.Helper()
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "ZINC%012d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunIsReproducible(t *testing.T) {
+	dir := t.TempDir()
+	writeTranche(t, dir, "zinc_ids_AA.txt", 50)
+	writeTranche(t, dir, "zinc_ids_BC.txt", 20)
+	conds := []Condition{
+		{MolecularWeight: "A", LogP: "A", Quantity: 5},
+		{MolecularWeight: "B", LogP: "C", Quantity: 3, Selection: fingerprint.Random},
+	}
+
+	s := &Sampler{TrancheDir: dir}
+	a, err := s.Run(42, conds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := s.Run(42, conds)
+	c, _ := s.Run(43, conds)
+	if got := a.IDs(); len(got) != 8 || !equal(got, b.IDs()) {
+		t.Fatalf("same seed gave %v and %v", got, b.IDs())
+	}
+	if equal(a.IDs(), c.IDs()) {
+		t.Errorf("different seeds gave the same selection %v", a.IDs())
+	}
+	if a.Picks[0].SHA256 == "" || a.Picks[1].File != "zinc_ids_BC.txt" {
+		t.Errorf("pick metadata = %+v", a.Picks)
+	}
+
+	// manifest 寫出再讀回後可以重建相同的清單
+	path := ManifestPath(filepath.Join(dir, "zinc_ids.txt"))
+	if filepath.Base(path) != "zinc_ids.manifest.json" {
+		t.Errorf("ManifestPath = %s", path)
+	}
+	if err := WriteManifest(path, a); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := s.Replay(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(replayed.IDs(), a.IDs()) {
+		t.Errorf("replay = %v, want %v", replayed.IDs(), a.IDs())
+	}
+
+	// tranche 檔改變後重建必須失敗
+	writeTranche(t, dir, "zinc_ids_BC.txt", 21)
+	if _, err := s.Replay(m); err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Errorf("replay after editing a tranche file: %v", err)
+	}
+
+	if _, err := s.Run(1, []Condition{{MolecularWeight: "A", LogP: "A", Quantity: 51}}); err == nil {
+		t.Error("Run accepted a quantity larger than the tranche")
+	}
+}
+
+func TestRunFromCatalog(t *testing.T) {
+	dir := t.TempDir()
+	writeTranche(t, dir, "zinc_ids_AA.txt", 30)
+	cat, err := catalog.Open(filepath.Join(dir, "zinc.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cat.Close()
+	if _, err := cat.ImportDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	conds := []Condition{{MolecularWeight: "A", LogP: "A", Quantity: 4}}
+
+	// 資料庫的內容與 tranche 檔相同時，結果與雜湊也相同
+	fromFile, err := (&Sampler{TrancheDir: dir}).Run(7, conds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Sampler{TrancheDir: t.TempDir(), Catalog: cat}
+	fromCatalog, err := s.Run(7, conds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(fromFile.IDs(), fromCatalog.IDs()) || fromFile.Picks[0].SHA256 != fromCatalog.Picks[0].SHA256 {
+		t.Errorf("catalog pick %+v differs from file pick %+v", fromCatalog.Picks[0], fromFile.Picks[0])
+	}
+	if fromCatalog.Catalog != cat.Path() {
+		t.Errorf("manifest catalog = %q, want %q", fromCatalog.Catalog, cat.Path())
+	}
+
+	// 之後抓到新的 ID 會改變 tranche，重建必須失敗
+	if _, err := cat.Observe("AA", []string{"ZINC000000000999"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Replay(fromCatalog); err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Errorf("replay after the catalog grew: %v", err)
+	}
+}
+
+func TestDiversityFallback(t *testing.T) {
+	dir := t.TempDir()
+	writeTranche(t, dir, "zinc_ids_AA.txt", 10)
+	// 只有前三個分子有下載的結構
+	fps := map[string]fingerprint.Fingerprint{}
+	for i, s := range []string{"CCc1ccccc1", "CCCc1ccccc1", "OC(=O)CN"} {
+		fps[fmt.Sprintf("ZINC%012d", i+1)] = fingerprint.Compute(smiles.MustParse(s), fingerprint.Morgan)
+	}
+	var logged []string
+	s := &Sampler{
+		TrancheDir:   dir,
+		Fingerprints: func() map[string]fingerprint.Fingerprint { return fps },
+		Logf:         func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) },
+	}
+
+	m, err := s.Run(7, []Condition{
+		{MolecularWeight: "A", LogP: "A", Quantity: 2, Selection: fingerprint.MaxMin},
+		{MolecularWeight: "A", LogP: "A", Quantity: 5, Selection: fingerprint.SphereExclusion},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.Picks[0]; p.Method != fingerprint.MaxMin || len(p.Candidates) != 3 || len(p.Selected) != 2 {
+		t.Errorf("maxmin pick = %+v", p)
+	}
+	if p := m.Picks[1]; p.Method != fingerprint.Random || len(p.Selected) != 5 || len(logged) != 1 {
+		t.Errorf("fallback pick = %+v, log %v", p, logged)
+	}
+	if _, err := s.Replay(m); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+
+	// 多樣性挑選用到的結構不見時無法重建
+	delete(fps, "ZINC000000000003")
+	if _, err := s.Replay(m); err == nil {
+		t.Error("replay succeeded without the downloaded structures")
+	}
+}
@@ -0,0 +1,309 @@
+// Package scrape 從 ZINC20 的 tranche 子集頁面（/substances/subsets/XX/?page=N）抓取 ZINC ID。
+// 頁數由分頁連結與第一個空白頁決定，同一個主機的同時請求數有上限，
+// 失敗的頁面會記錄下來，之後可以只重抓這些頁面。
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 預設參數
+const (
+	DefaultBaseURL  = "https://zinc20.docking.org"
+	DefaultPerHost  = 4
+	DefaultTimeout  = 60 * time.Second
+	DefaultMaxPages = 1000
+)
+
+// Options 設定抓取方式
+type Options struct {
+	BaseURL  string
+	Client   *http.Client
+	PerHost  int           // 同一個主機同時進行的請求數上限
+	Timeout  time.Duration // 單一頁面的逾時
+	MaxPages int           // 沒有分頁資訊時最多探測的頁數
+	// Logf 記錄每一頁的結果，可以為 nil
+	Logf func(format string, args ...any)
+}
+
+// PageError 是抓取失敗的一頁
+type PageError struct {
+	Tranche string `json:"tranche"`
+	Page    int    `json:"page"`
+	URL     string `json:"url"`
+	Err     string `json:"error"`
+}
+
+// Progress 是抓完一頁時回報的進度
+type Progress struct {
+	Tranche  string
+	Page     int
+	IDs      int   // 這一頁的 ID 數
+	LastPage int   // 目前由分頁連結得知的最後一頁，0 表示還不知道
+	Err      error // 這一頁失敗的原因
+}
+
+// Result 是一個 tranche 的抓取結果
+type Result struct {
+	Tranche string      `json:"tranche"`
+	IDs     []string    `json:"ids"`   // 已補足 12 位數、依數字排序且不重複
+	Pages   int         `json:"pages"` // 有資料的最後一頁
+	Failed  []PageError `json:"failed,omitempty"`
+}
+
+// Scraper 抓取 tranche 頁面；同一個 Scraper 可以同時抓取多個 tranche，
+// 每個主機的請求數上限由所有 tranche 共用
+type Scraper struct {
+	opt   Options
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// New 建立 Scraper，未設定的選項使用預設值
+func New(opt Options) *Scraper {
+	if opt.BaseURL == "" {
+		opt.BaseURL = DefaultBaseURL
+	}
+	if opt.Client == nil {
+		opt.Client = http.DefaultClient
+	}
+	if opt.PerHost <= 0 {
+		opt.PerHost = DefaultPerHost
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultTimeout
+	}
+	if opt.MaxPages <= 0 {
+		opt.MaxPages = DefaultMaxPages
+	}
+	if opt.Logf == nil {
+		opt.Logf = func(string, ...any) {}
+	}
+	return &Scraper{opt: opt, hosts: make(map[string]chan struct{})}
+}
+
+// PageURL 回傳 tranche 第 page 頁的網址
+func (s *Scraper) PageURL(tranche string, page int) string {
+	return fmt.Sprintf("%s/substances/subsets/%s/?page=%d", strings.TrimRight(s.opt.BaseURL, "/"), tranche, page)
+}
+
+// page 是一頁的抓取結果，由 worker 經 channel 交給彙整者
+type page struct {
+	n        int
+	ids      []string
+	lastLink int // 頁面上分頁連結指向的最大頁碼
+	err      error
+}
+
+// Tranche 抓取一個 tranche 的所有頁面。頁面以每批 PerHost 頁的方式並行抓取，
+// 直到遇到第一個空白頁，或已超過分頁連結所指的最後一頁；沒有任何分頁資訊時
+// 最多探測 MaxPages 頁。只有 ctx 被取消時才回傳錯誤，個別頁面的失敗記在 Result.Failed。
+// progress 不為 nil 時每抓完一頁呼叫一次（在同一個 goroutine 中依序呼叫）。
+func (s *Scraper) Tranche(ctx context.Context, tranche string, progress func(Progress)) (*Result, error) {
+	res := &Result{Tranche: tranche}
+	seen := make(map[string]bool)
+	lastLink, firstEmpty := 0, 0
+
+	for next := 1; next <= s.opt.MaxPages; {
+		if firstEmpty > 0 || (lastLink > 0 && next > lastLink) {
+			break
+		}
+		batch := s.opt.PerHost
+		if lastLink >= next && lastLink-next+1 < batch {
+			batch = lastLink - next + 1
+		}
+		if next+batch-1 > s.opt.MaxPages {
+			batch = s.opt.MaxPages - next + 1
+		}
+
+		pages := make(chan page)
+		for n := next; n < next+batch; n++ {
+			go func(n int) { pages <- s.fetch(ctx, tranche, n) }(n)
+		}
+		// 只有這個迴圈會修改結果，不需要加鎖
+		for i := 0; i < batch; i++ {
+			p := <-pages
+			switch {
+			case p.err != nil:
+				res.Failed = append(res.Failed, PageError{Tranche: tranche, Page: p.n, URL: s.PageURL(tranche, p.n), Err: p.err.Error()})
+				s.opt.Logf("Error scraping page %d for %s: %v", p.n, tranche, p.err)
+			case len(p.ids) == 0:
+				if firstEmpty == 0 || p.n < firstEmpty {
+					firstEmpty = p.n
+				}
+			default:
+				res.add(p.ids, seen)
+				if p.n > res.Pages {
+					res.Pages = p.n
+				}
+			}
+			if p.lastLink > lastLink {
+				lastLink = p.lastLink
+			}
+			if progress != nil {
+				progress(Progress{Tranche: tranche, Page: p.n, IDs: len(p.ids), LastPage: lastLink, Err: p.err})
+			}
+		}
+		next += batch
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+	}
+	res.finish()
+	return res, nil
+}
+
+// Retry 重新抓取 res.Failed 中的頁面，成功的頁面併入結果，仍然失敗的留在 Failed；
+// progress 的用法與 Tranche 相同
+func (s *Scraper) Retry(ctx context.Context, res *Result, progress func(Progress)) error {
+	failed := res.Failed
+	res.Failed = nil
+	seen := make(map[string]bool, len(res.IDs))
+	for _, id := range res.IDs {
+		seen[id] = true
+	}
+
+	pages := make(chan page)
+	for _, f := range failed {
+		go func(n int) { pages <- s.fetch(ctx, res.Tranche, n) }(f.Page)
+	}
+	for range failed {
+		p := <-pages
+		if progress != nil {
+			progress(Progress{Tranche: res.Tranche, Page: p.n, IDs: len(p.ids), Err: p.err})
+		}
+		if p.err != nil {
+			res.Failed = append(res.Failed, PageError{Tranche: res.Tranche, Page: p.n, URL: s.PageURL(res.Tranche, p.n), Err: p.err.Error()})
+			continue
+		}
+		res.add(p.ids, seen)
+		if len(p.ids) > 0 && p.n > res.Pages {
+			res.Pages = p.n
+		}
+	}
+	res.finish()
+	return ctx.Err()
+}
+
+func (r *Result) add(ids []string, seen map[string]bool) {
+	for _, id := range ids {
+		if id = FormatZincID(id); id != "" && !seen[id] {
+			seen[id] = true
+			r.IDs = append(r.IDs, id)
+		}
+	}
+}
+
+// finish 依數字排序 ID 與失敗的頁面
+func (r *Result) finish() {
+	// 補足 12 位數後字串順序與數字順序相同
+	sort.Strings(r.IDs)
+	sort.Slice(r.Failed, func(i, j int) bool { return r.Failed[i].Page < r.Failed[j].Page })
+}
+
+// fetch 在主機的請求數上限內抓取一頁
+func (s *Scraper) fetch(ctx context.Context, tranche string, n int) page {
+	pageURL := s.PageURL(tranche, n)
+	slot := s.slot(pageURL)
+	select {
+	case slot <- struct{}{}:
+		defer func() { <-slot }()
+	case <-ctx.Done():
+		return page{n: n, err: ctx.Err()}
+	}
+	s.opt.Logf("URL = %s", pageURL)
+
+	ctx, cancel := context.WithTimeout(ctx, s.opt.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return page{n: n, err: err}
+	}
+	resp, err := s.opt.Client.Do(req)
+	if err != nil {
+		return page{n: n, err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// 超過最後一頁時 ZINC 可能回應 404，視為空白頁
+		return page{n: n}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return page{n: n, err: fmt.Errorf("%s", resp.Status)}
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return page{n: n, err: fmt.Errorf("parse HTML: %v", err)}
+	}
+	return page{n: n, ids: ParseIDs(doc), lastLink: LastPageLink(doc)}
+}
+
+// slot 回傳網址所屬主機的號誌
+func (s *Scraper) slot(rawURL string) chan struct{} {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.hosts[host]
+	if !ok {
+		c = make(chan struct{}, s.opt.PerHost)
+		s.hosts[host] = c
+	}
+	return c
+}
+
+// ParseIDs 取出頁面上的 ZINC ID（.zinc-id.caption 元素，去掉後面的描述）
+func ParseIDs(doc *goquery.Document) []string {
+	var ids []string
+	doc.Find(".zinc-id.caption").Each(func(i int, s *goquery.Selection) {
+		id := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(id, "ZINC") {
+			ids = append(ids, strings.Fields(id)[0])
+		}
+	})
+	return ids
+}
+
+// LastPageLink 回傳頁面上帶有 page 參數的連結中最大的頁碼，沒有分頁連結時回傳 0
+func LastPageLink(doc *goquery.Document) int {
+	last := 0
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		if n, err := strconv.Atoi(u.Query().Get("page")); err == nil && n > last {
+			last = n
+		}
+	})
+	return last
+}
+
+// FormatZincID 把 ZINC ID 的數字部分補足為 12 位數，不是 ZINC ID 時回傳空字串
+func FormatZincID(id string) string {
+	id = strings.TrimSpace(id)
+	if !strings.HasPrefix(id, "ZINC") {
+		return ""
+	}
+	num := id[4:]
+	if num == "" || strings.Trim(num, "0123456789") != "" {
+		return ""
+	}
+	if len(num) < 12 {
+		num = strings.Repeat("0", 12-len(num)) + num
+	}
+	return "ZINC" + num
+}
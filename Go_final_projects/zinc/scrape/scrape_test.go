@@ -0,0 +1,129 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSubsets 模擬 ZINC20 的子集頁面：每頁 3 個 ID，分頁連結只列出目前頁的前後兩頁
+type fakeSubsets struct {
+	pages      map[string]int // tranche -> 頁數
+	pagination bool
+	failOnce   map[int]bool // 第一次請求回應 500 的頁碼
+
+	mu       sync.Mutex
+	requests map[int]int
+	inFlight int32
+	peak     int32
+}
+
+func (f *fakeSubsets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		p := atomic.LoadInt32(&f.peak)
+		if n <= p || atomic.CompareAndSwapInt32(&f.peak, p, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	tranche := strings.Trim(strings.TrimPrefix(r.URL.Path, "/substances/subsets/"), "/")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	f.mu.Lock()
+	f.requests[page]++
+	count := f.requests[page]
+	f.mu.Unlock()
+	if f.failOnce[page] && count == 1 {
+		http.Error(w, "busy", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "<html><body>")
+	if page <= f.pages[tranche] {
+		for k := 0; k < 3; k++ {
+			// ZINC 頁面上的 ID 沒有補零
+			fmt.Fprintf(w, `<h4 class="zinc-id caption">ZINC%d <small>in stock</small></h4>`, page*100+k)
+		}
+		if f.pagination {
+			for p := page - 2; p <= page+2 && p <= f.pages[tranche]; p++ {
+				if p >= 1 {
+					fmt.Fprintf(w, `<a href="?page=%d">%d</a>`, p, p)
+				}
+			}
+		}
+	}
+	fmt.Fprintln(w, "</body></html>")
+}
+
+func TestTranche(t *testing.T) {
+	for _, pagination := range []bool{true, false} {
+		f := &fakeSubsets{
+			pages:      map[string]int{"AG": 7},
+			pagination: pagination,
+			failOnce:   map[int]bool{4: true},
+			requests:   map[int]int{},
+		}
+		srv := httptest.NewServer(f)
+		s := New(Options{BaseURL: srv.URL, PerHost: 2})
+
+		var reported []Progress
+		res, err := s.Tranche(context.Background(), "AG", func(p Progress) { reported = append(reported, p) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Pages != 7 || len(res.IDs) != 18 || len(res.Failed) != 1 || res.Failed[0].Page != 4 {
+			t.Fatalf("pagination=%v: pages %d, %d IDs, failed %+v", pagination, res.Pages, len(res.IDs), res.Failed)
+		}
+		if res.IDs[0] != "ZINC000000000100" {
+			t.Errorf("first ID = %s, want zero-padded ZINC000000000100", res.IDs[0])
+		}
+		requested := 0
+		for _, n := range f.requests {
+			requested += n
+		}
+		if len(reported) != requested {
+			t.Errorf("pagination=%v: progress reported %d pages, %d were requested", pagination, len(reported), requested)
+		}
+		if f.peak > 2 {
+			t.Errorf("%d concurrent requests, want at most 2 per host", f.peak)
+		}
+		// 有分頁連結時不需要探測第 8 頁之後的頁面
+		if pagination && (f.requests[8] != 0 || f.requests[9] != 0) {
+			t.Errorf("requested pages past the last pagination link: %v", f.requests)
+		}
+		if !pagination && f.requests[10] != 0 {
+			t.Errorf("kept probing after the first empty page: %v", f.requests)
+		}
+
+		if err := s.Retry(context.Background(), res, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.IDs) != 21 || len(res.Failed) != 0 || res.IDs[9] != "ZINC000000000400" {
+			t.Errorf("after retry: %d IDs, failed %+v", len(res.IDs), res.Failed)
+		}
+		srv.Close()
+	}
+}
+
+func TestFormatZincID(t *testing.T) {
+	for in, want := range map[string]string{
+		"ZINC1084":          "ZINC000000001084",
+		" ZINC000000001084": "ZINC000000001084",
+		"ZINC":              "",
+		"ZINCabc":           "",
+		"CHEMBL25":          "",
+	} {
+		if got := FormatZincID(in); got != want {
+			t.Errorf("FormatZincID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+// Package sdf 讀寫 MDL molfile 與 SD 檔（V2000/V3000 connection table 加上資料欄位）。
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"zinc/mol"
+)
+
+// ParseError 記錄解析失敗的行號與原因
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Reader 逐筆讀取 SD 檔中的分子紀錄
+type Reader struct {
+	sc   *bufio.Scanner
+	line int
+	eof  bool
+	term bool // 最後讀到的一行是 $$$$
+}
+
+// NewReader 建立一個從 r 串流讀取的 Reader
+func NewReader(r io.Reader) *Reader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &Reader{sc: sc}
+}
+
+// Line 回傳目前已讀取到的行號
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Read 讀取下一筆紀錄，沒有更多紀錄時回傳 io.EOF。
+// 紀錄格式錯誤時回傳 *ParseError，並跳到下一個 $$$$ 之後，呼叫端可以繼續讀取。
+func (r *Reader) Read() (*mol.Molecule, error) {
+	m, err := r.readRecord()
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*ParseError); ok && !r.term {
+			r.skipRecord()
+		}
+	}
+	return m, err
+}
+
+// Terminated 回報上一筆讀到的紀錄是否以 $$$$ 結尾；
+// 最後一筆紀錄缺少 $$$$ 通常代表檔案在下載時被截斷
+func (r *Reader) Terminated() bool {
+	return r.term
+}
+
+// ReadAll 讀取剩下的所有紀錄，遇到第一個錯誤就停止
+func (r *Reader) ReadAll() ([]*mol.Molecule, error) {
+	var mols []*mol.Molecule
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			return mols, nil
+		}
+		if err != nil {
+			return mols, err
+		}
+		mols = append(mols, m)
+	}
+}
+
+// ReadFile 讀取整個 SD 檔
+func ReadFile(path string) ([]*mol.Molecule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mols, err := NewReader(file).ReadAll()
+	if err != nil {
+		return mols, fmt.Errorf("%s: %w", path, err)
+	}
+	return mols, nil
+}
+
+func (r *Reader) next() (string, bool, error) {
+	if r.eof {
+		return "", false, nil
+	}
+	if !r.sc.Scan() {
+		r.eof = true
+		return "", false, r.sc.Err()
+	}
+	r.line++
+	line := strings.TrimSuffix(r.sc.Text(), "\r")
+	r.term = strings.HasPrefix(line, "$$$$")
+	return line, true, nil
+}
+
+func (r *Reader) errorf(format string, args ...any) error {
+	return &ParseError{Line: r.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (r *Reader) unexpectedEOF(where string) error {
+	return &ParseError{Line: r.line, Msg: "unexpected end of file in " + where}
+}
+
+// skipRecord 丟棄目前紀錄剩下的行，直到 $$$$ 或檔案結尾
+func (r *Reader) skipRecord() {
+	for {
+		line, ok, _ := r.next()
+		if !ok || strings.HasPrefix(line, "$$$$") {
+			return
+		}
+	}
+}
+
+func (r *Reader) readRecord() (*mol.Molecule, error) {
+	m := &mol.Molecule{}
+
+	// 標頭三行，第一行可以是空白
+	name, ok, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, io.EOF
+	}
+	program, ok, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if strings.TrimSpace(name) == "" {
+			return nil, io.EOF
+		}
+		return nil, r.unexpectedEOF("header")
+	}
+	comment, ok, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, r.unexpectedEOF("header")
+	}
+	m.Name = strings.TrimSpace(name)
+	m.Program = program
+	m.Comment = comment
+
+	counts, ok, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, r.unexpectedEOF("counts line")
+	}
+	version := strings.TrimSpace(column(counts, 33, 39))
+	switch version {
+	case "V2000", "":
+		err = r.readV2000(m, counts)
+	case "V3000":
+		err = r.readV3000(m)
+	default:
+		err = r.errorf("unsupported connection table version %q", version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.readData(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (r *Reader) readV2000(m *mol.Molecule, counts string) error {
+	numAtoms, err := atoi(column(counts, 0, 3))
+	if err != nil {
+		return r.errorf("bad atom count %q", column(counts, 0, 3))
+	}
+	numBonds, err := atoi(column(counts, 3, 6))
+	if err != nil {
+		return r.errorf("bad bond count %q", column(counts, 3, 6))
+	}
+	if numAtoms < 0 || numBonds < 0 {
+		return r.errorf("negative count in counts line %q", counts)
+	}
+	chiral, _ := atoi(column(counts, 12, 15))
+	m.Chiral = chiral == 1
+
+	m.Atoms = make([]mol.Atom, 0, prealloc(numAtoms))
+	for i := 0; i < numAtoms; i++ {
+		line, ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return r.unexpectedEOF("atom block")
+		}
+		atom, err := r.parseAtom(line)
+		if err != nil {
+			return err
+		}
+		m.Atoms = append(m.Atoms, atom)
+	}
+
+	m.Bonds = make([]mol.Bond, 0, prealloc(numBonds))
+	for i := 0; i < numBonds; i++ {
+		line, ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return r.unexpectedEOF("bond block")
+		}
+		bond, err := r.parseBond(line, numAtoms)
+		if err != nil {
+			return err
+		}
+		m.Bonds = append(m.Bonds, bond)
+	}
+
+	return r.readProperties(m)
+}
+
+// parseAtom 解析 V2000 atom block 的一行：
+// xxxxx.xxxxyyyyy.yyyyzzzzz.zzzz aaaddcccssshhhbbbvvv
+func (r *Reader) parseAtom(line string) (mol.Atom, error) {
+	var atom mol.Atom
+	if len(line) < 34 {
+		return atom, r.errorf("atom line too short")
+	}
+	var err error
+	if atom.X, err = strconv.ParseFloat(strings.TrimSpace(column(line, 0, 10)), 64); err != nil {
+		return atom, r.errorf("bad x coordinate %q", column(line, 0, 10))
+	}
+	if atom.Y, err = strconv.ParseFloat(strings.TrimSpace(column(line, 10, 20)), 64); err != nil {
+		return atom, r.errorf("bad y coordinate %q", column(line, 10, 20))
+	}
+	if atom.Z, err = strconv.ParseFloat(strings.TrimSpace(column(line, 20, 30)), 64); err != nil {
+		return atom, r.errorf("bad z coordinate %q", column(line, 20, 30))
+	}
+	atom.Symbol = strings.TrimSpace(column(line, 31, 34))
+	if atom.Symbol == "" {
+		return atom, r.errorf("missing atom symbol")
+	}
+
+	// 質量差、電荷、stereo parity、氫數、stereo care、價數
+	var fields [6]int
+	spans := [6][2]int{{34, 36}, {36, 39}, {39, 42}, {42, 45}, {45, 48}, {48, 51}}
+	for i, span := range spans {
+		if fields[i], err = atoi(column(line, span[0], span[1])); err != nil {
+			return atom, r.errorf("bad atom field %q", column(line, span[0], span[1]))
+		}
+	}
+	atom.MassDiff = fields[0]
+	switch fields[1] {
+	case 1, 2, 3, 5, 6, 7:
+		atom.Charge = 4 - fields[1]
+	case 4:
+		atom.Radical = 2
+	}
+	atom.Parity = fields[2]
+	atom.HCount = fields[3]
+	atom.Valence = fields[5]
+	return atom, nil
+}
+
+// parseBond 解析 V2000 bond block 的一行：111222tttsss
+func (r *Reader) parseBond(line string, numAtoms int) (mol.Bond, error) {
+	var bond mol.Bond
+	if len(line) < 9 {
+		return bond, r.errorf("bond line too short")
+	}
+	begin, err1 := atoi(column(line, 0, 3))
+	end, err2 := atoi(column(line, 3, 6))
+	order, err3 := atoi(column(line, 6, 9))
+	stereo, err4 := atoi(column(line, 9, 12))
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return bond, r.errorf("bad bond line %q", line)
+	}
+	if begin < 1 || begin > numAtoms || end < 1 || end > numAtoms {
+		return bond, r.errorf("bond references atom outside 1..%d", numAtoms)
+	}
+	if begin == end {
+		return bond, r.errorf("bond connects atom %d to itself", begin)
+	}
+	if order < 1 || order > 8 {
+		return bond, r.errorf("bad bond type %d", order)
+	}
+	bond.Begin = begin - 1
+	bond.End = end - 1
+	bond.Order = order
+	bond.Stereo = stereo
+	return bond, nil
+}
+
+// readProperties 讀取 properties block，直到 M  END
+func (r *Reader) readProperties(m *mol.Molecule) error {
+	chargesReset := false
+	for {
+		line, ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return r.unexpectedEOF("properties block")
+		}
+		if strings.HasPrefix(line, "M  END") {
+			return nil
+		}
+		if strings.HasPrefix(line, "$$$$") {
+			return r.errorf("record ended before M  END")
+		}
+
+		switch {
+		case strings.HasPrefix(line, "M  CHG"), strings.HasPrefix(line, "M  RAD"):
+			// 依規格，出現 M  CHG 或 M  RAD 時，atom block 的電荷與自由基全部作廢
+			if !chargesReset {
+				for i := range m.Atoms {
+					m.Atoms[i].Charge = 0
+					m.Atoms[i].Radical = 0
+				}
+				chargesReset = true
+			}
+			pairs, err := r.parsePairs(line, len(m.Atoms))
+			if err != nil {
+				return err
+			}
+			for _, p := range pairs {
+				if strings.HasPrefix(line, "M  CHG") {
+					m.Atoms[p[0]].Charge = p[1]
+				} else {
+					m.Atoms[p[0]].Radical = p[1]
+				}
+			}
+		case strings.HasPrefix(line, "M  ISO"):
+			pairs, err := r.parsePairs(line, len(m.Atoms))
+			if err != nil {
+				return err
+			}
+			for _, p := range pairs {
+				m.Atoms[p[0]].Isotope = p[1]
+			}
+		case strings.HasPrefix(line, "A  "), strings.HasPrefix(line, "G  "):
+			// 原子別名與群組縮寫後面還有一行內容，一併略過
+			if _, ok, err := r.next(); err != nil || !ok {
+				return r.unexpectedEOF("properties block")
+			}
+		}
+	}
+}
+
+// parsePairs 解析 M  CHG/ISO/RAD 行的 (原子, 值) 組，原子索引轉為 0 起始
+func (r *Reader) parsePairs(line string, numAtoms int) ([][2]int, error) {
+	fields := strings.Fields(line[6:])
+	if len(fields) == 0 {
+		return nil, r.errorf("missing entry count in %q", line[:6])
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 || n > 8 || len(fields) != 1+2*n {
+		return nil, r.errorf("bad entry count in %q", line)
+	}
+	pairs := make([][2]int, n)
+	for i := 0; i < n; i++ {
+		atom, err1 := strconv.Atoi(fields[1+2*i])
+		value, err2 := strconv.Atoi(fields[2+2*i])
+		if err1 != nil || err2 != nil {
+			return nil, r.errorf("bad entry in %q", line)
+		}
+		if atom < 1 || atom > numAtoms {
+			return nil, r.errorf("property references atom %d outside 1..%d", atom, numAtoms)
+		}
+		pairs[i] = [2]int{atom - 1, value}
+	}
+	return pairs, nil
+}
+
+// readData 讀取 M  END 之後的資料欄位，直到 $$$$ 或檔案結尾
+func (r *Reader) readData(m *mol.Molecule) error {
+	for {
+		line, ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok || strings.HasPrefix(line, "$$$$") {
+			return nil
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ">") {
+			return r.errorf("expected data header, got %q", line)
+		}
+		start := strings.Index(line, "<")
+		end := -1
+		if start >= 0 {
+			end = strings.Index(line[start:], ">") + start
+		}
+		if start < 0 || end <= start {
+			return r.errorf("data header without <name>: %q", line)
+		}
+		name := line[start+1 : end]
+
+		var values []string
+		for {
+			line, ok, err := r.next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if strings.HasPrefix(line, "$$$$") {
+				m.Fields = append(m.Fields, mol.Field{Name: name, Value: strings.Join(values, "\n")})
+				return nil
+			}
+			if strings.TrimSpace(line) == "" {
+				break
+			}
+			values = append(values, line)
+		}
+		m.Fields = append(m.Fields, mol.Field{Name: name, Value: strings.Join(values, "\n")})
+	}
+}
+
+// column 回傳 line[start:end]，超出長度的部分視為空白
+func column(line string, start, end int) string {
+	if start >= len(line) {
+		return ""
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return line[start:end]
+}
+
+// maxPrealloc 限制依檔案宣告的數量預先配置的大小；數量由不可信的檔案決定，超過的部分由 append 擴充
+const maxPrealloc = 1 << 16
+
+func prealloc(n int) int { return min(n, maxPrealloc) }
+
+// atoi 解析固定寬度欄位中的整數，空白欄位視為 0
+func atoi(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,134 @@
+package sdf
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFileZincFixture(t *testing.T) {
+	mols, err := ReadFile("testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mols) != 1 {
+		t.Fatalf("got %d records, want 1", len(mols))
+	}
+	m := mols[0]
+	if len(m.Atoms) != 12 || len(m.Bonds) != 12 {
+		t.Fatalf("got %d atoms / %d bonds, want 12 / 12", len(m.Atoms), len(m.Bonds))
+	}
+	if a := m.Atoms[0]; a.Symbol != "N" || a.X != 2.4128 || a.Y != -1.5170 || a.Z != 0 {
+		t.Errorf("atom 1 = %+v", a)
+	}
+	if b := m.Bonds[0]; b.Begin != 1 || b.End != 0 || b.Order != 1 || b.Stereo != 1 {
+		t.Errorf("bond 1 = %+v", b)
+	}
+	if b := m.Bonds[4]; b.Stereo != 6 {
+		t.Errorf("bond 5 stereo = %d, want 6", b.Stereo)
+	}
+	if got := m.ZincID(); got != "ZINC000014418328" {
+		t.Errorf("ZincID() = %q", got)
+	}
+	if got, _ := m.Field("smiles"); got != "N[C@H](CO)[C@H]1O[C@@H](O)[C@@H](O)[C@@H]1O" {
+		t.Errorf("smiles = %q", got)
+	}
+	if !strings.Contains(m.Program, "RDKit") {
+		t.Errorf("program line = %q", m.Program)
+	}
+}
+
+const chargedRecord = `ammonium acetate
+  test
+
+  6  4  0  0  0  0  0  0  0  0999 V2000
+    0.0000    0.0000    0.0000 N   0  3  0  0  0  0  0  0  0  0  0  0
+    1.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+    2.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+    2.5000    0.8660    0.0000 O   0  0  0  0  0  0  0  0  0  0  0  0
+    2.5000   -0.8660    0.0000 O   0  0  0  0  0  0  0  0  0  0  0  0
+    4.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+  1  2  1  0
+  2  3  1  0
+  3  4  2  0
+  3  5  1  0
+M  CHG  2   1   1   5  -1
+M  ISO  1   6  13
+M  END
+> <note>
+first line
+second line
+
+$$$$
+`
+
+func TestReadProperties(t *testing.T) {
+	m, err := NewReader(strings.NewReader(chargedRecord)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "ammonium acetate" {
+		t.Errorf("name = %q", m.Name)
+	}
+	if m.Atoms[0].Charge != 1 || m.Atoms[4].Charge != -1 {
+		t.Errorf("charges = %d, %d", m.Atoms[0].Charge, m.Atoms[4].Charge)
+	}
+	if m.Atoms[5].Isotope != 13 {
+		t.Errorf("isotope = %d, want 13", m.Atoms[5].Isotope)
+	}
+	if got, _ := m.Field("note"); got != "first line\nsecond line" {
+		t.Errorf("note = %q", got)
+	}
+}
+
+func TestReaderRecoversAfterBadRecord(t *testing.T) {
+	bad := strings.Replace(chargedRecord, "  3  5  1  0", "  3  9  1  0", 1)
+	input := chargedRecord + bad + chargedRecord
+
+	r := NewReader(strings.NewReader(input))
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("record 1: %v", err)
+	}
+	_, err := r.Read()
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("record 2: got %v, want *ParseError", err)
+	}
+	// 每筆紀錄 22 行，錯誤的鍵在第二筆紀錄的第 14 行
+	if perr.Line != 36 {
+		t.Errorf("error line = %d, want 36", perr.Line)
+	}
+	if _, err := r.Read(); err != nil {
+		t.Fatalf("record 3: %v", err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+}
+
+func TestReaderTruncatedRecord(t *testing.T) {
+	lines := strings.Split(chargedRecord, "\n")
+	truncated := strings.Join(lines[:8], "\n") + "\n"
+
+	_, err := NewReader(strings.NewReader(truncated)).Read()
+	var perr *ParseError
+	if !errors.As(err, &perr) || !strings.Contains(perr.Msg, "atom block") {
+		t.Fatalf("got %v, want unexpected end of file in atom block", err)
+	}
+}
+
+func TestReaderNegativeCounts(t *testing.T) {
+	for _, counts := range []string{" -1  4", "  6 -4"} {
+		input := strings.Replace(chargedRecord, "  6  4", counts, 1) + chargedRecord
+		r := NewReader(strings.NewReader(input))
+		_, err := r.Read()
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != 4 {
+			t.Fatalf("%q: got %v, want *ParseError on line 4", counts, err)
+		}
+		if _, err := r.Read(); err != nil {
+			t.Errorf("%q: record after the bad one: %v", counts, err)
+		}
+	}
+}
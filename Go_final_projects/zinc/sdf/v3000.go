@@ -0,0 +1,427 @@
+package sdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"zinc/mol"
+)
+
+const v30Prefix = "M  V30 "
+
+// V3000 鍵的 CFG 值與 V2000 stereo 欄位的對應
+var (
+	v30BondCfgToStereo = map[int]int{1: mol.StereoUp, 2: mol.StereoEither, 3: mol.StereoDown}
+	stereoToV30BondCfg = map[int]int{mol.StereoUp: 1, mol.StereoEither: 2, mol.StereoDown: 3, mol.StereoCisTrans: 2}
+)
+
+// nextV30 讀取下一個 V30 邏輯行，行尾為 - 時與下一行合併
+func (r *Reader) nextV30(where string) (string, error) {
+	var sb strings.Builder
+	for {
+		line, ok, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", r.unexpectedEOF(where)
+		}
+		if !strings.HasPrefix(line, v30Prefix) {
+			return "", r.errorf("expected %q line in %s, got %q", strings.TrimSpace(v30Prefix), where, line)
+		}
+		body := strings.TrimRight(line[len(v30Prefix):], " ")
+		if strings.HasSuffix(body, "-") {
+			sb.WriteString(body[:len(body)-1])
+			continue
+		}
+		sb.WriteString(body)
+		return sb.String(), nil
+	}
+}
+
+// readV3000 讀取 M  V30 BEGIN CTAB 到 M  END 之間的 connection table
+func (r *Reader) readV3000(m *mol.Molecule) error {
+	line, err := r.nextV30("ctab")
+	if err != nil {
+		return err
+	}
+	if line != "BEGIN CTAB" {
+		return r.errorf("expected BEGIN CTAB, got %q", line)
+	}
+
+	numAtoms, numBonds := -1, -1
+	for {
+		line, err := r.nextV30("ctab")
+		if err != nil {
+			return err
+		}
+		tokens := tokenizeV30(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		switch {
+		case tokens[0] == "COUNTS":
+			if len(tokens) < 3 {
+				return r.errorf("bad COUNTS line %q", line)
+			}
+			numAtoms, err = strconv.Atoi(tokens[1])
+			if err != nil {
+				return r.errorf("bad atom count %q", tokens[1])
+			}
+			numBonds, err = strconv.Atoi(tokens[2])
+			if err != nil {
+				return r.errorf("bad bond count %q", tokens[2])
+			}
+			if numAtoms < 0 || numBonds < 0 {
+				return r.errorf("negative count in COUNTS line %q", line)
+			}
+			if len(tokens) > 5 {
+				m.Chiral = tokens[5] == "1"
+			}
+		case line == "BEGIN ATOM":
+			if numAtoms < 0 {
+				return r.errorf("atom block before COUNTS line")
+			}
+			if err := r.readV30Atoms(m, numAtoms); err != nil {
+				return err
+			}
+		case line == "BEGIN BOND":
+			if err := r.readV30Bonds(m, numBonds); err != nil {
+				return err
+			}
+		case line == "BEGIN COLLECTION":
+			if err := r.readV30Collections(m); err != nil {
+				return err
+			}
+		case tokens[0] == "BEGIN" && len(tokens) > 1:
+			// SGROUP、OBJ3D 等區塊目前不使用，略過到對應的 END
+			if err := r.skipV30Block(tokens[1]); err != nil {
+				return err
+			}
+		case line == "END CTAB":
+			if len(m.Atoms) != max(numAtoms, 0) {
+				return r.errorf("COUNTS declares %d atoms, found %d", numAtoms, len(m.Atoms))
+			}
+			if len(m.Bonds) != max(numBonds, 0) {
+				return r.errorf("COUNTS declares %d bonds, found %d", numBonds, len(m.Bonds))
+			}
+			return r.readProperties(m)
+		default:
+			return r.errorf("unexpected V30 line %q", line)
+		}
+	}
+}
+
+func (r *Reader) skipV30Block(name string) error {
+	for {
+		line, err := r.nextV30(name + " block")
+		if err != nil {
+			return err
+		}
+		if line == "END "+name {
+			return nil
+		}
+	}
+}
+
+// readV30Atoms 解析 index type x y z aamap [KEY=value ...]
+func (r *Reader) readV30Atoms(m *mol.Molecule, numAtoms int) error {
+	m.Atoms = make([]mol.Atom, 0, prealloc(numAtoms))
+	for {
+		line, err := r.nextV30("atom block")
+		if err != nil {
+			return err
+		}
+		if line == "END ATOM" {
+			return nil
+		}
+		tokens := tokenizeV30(line)
+		if len(tokens) < 6 {
+			return r.errorf("atom line too short: %q", line)
+		}
+		index, err := strconv.Atoi(tokens[0])
+		if err != nil || index != len(m.Atoms)+1 {
+			return r.errorf("atom index %q out of order", tokens[0])
+		}
+		var atom mol.Atom
+		atom.Symbol = strings.Trim(tokens[1], `"`)
+		coords := [3]*float64{&atom.X, &atom.Y, &atom.Z}
+		for i, c := range coords {
+			if *c, err = strconv.ParseFloat(tokens[2+i], 64); err != nil {
+				return r.errorf("bad coordinate %q", tokens[2+i])
+			}
+		}
+		if atom.MapNum, err = strconv.Atoi(tokens[5]); err != nil {
+			return r.errorf("bad atom map %q", tokens[5])
+		}
+		for _, kv := range tokens[6:] {
+			key, value, ok := strings.Cut(kv, "=")
+			if !ok {
+				return r.errorf("bad atom property %q", kv)
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				// 清單型屬性（例如 RGROUPS=(...)）不轉成整數，直接略過
+				continue
+			}
+			switch key {
+			case "CHG":
+				atom.Charge = n
+			case "RAD":
+				atom.Radical = n
+			case "CFG":
+				atom.Parity = n
+			case "MASS":
+				atom.Isotope = n
+			case "VAL":
+				atom.Valence = n
+				if n == -1 {
+					atom.Valence = 15
+				}
+			case "HCOUNT":
+				atom.HCount = n
+			}
+		}
+		if len(m.Atoms) >= numAtoms {
+			return r.errorf("more atoms than the %d declared in COUNTS", numAtoms)
+		}
+		m.Atoms = append(m.Atoms, atom)
+	}
+}
+
+// readV30Bonds 解析 index type atom1 atom2 [KEY=value ...]
+func (r *Reader) readV30Bonds(m *mol.Molecule, numBonds int) error {
+	m.Bonds = make([]mol.Bond, 0, prealloc(max(numBonds, 0)))
+	for {
+		line, err := r.nextV30("bond block")
+		if err != nil {
+			return err
+		}
+		if line == "END BOND" {
+			return nil
+		}
+		tokens := tokenizeV30(line)
+		if len(tokens) < 4 {
+			return r.errorf("bond line too short: %q", line)
+		}
+		var ints [4]int
+		for i := range ints {
+			if ints[i], err = strconv.Atoi(tokens[i]); err != nil {
+				return r.errorf("bad bond field %q", tokens[i])
+			}
+		}
+		if ints[0] != len(m.Bonds)+1 {
+			return r.errorf("bond index %d out of order", ints[0])
+		}
+		begin, end := ints[2], ints[3]
+		if begin < 1 || begin > len(m.Atoms) || end < 1 || end > len(m.Atoms) {
+			return r.errorf("bond references atom outside 1..%d", len(m.Atoms))
+		}
+		if begin == end {
+			return r.errorf("bond connects atom %d to itself", begin)
+		}
+		if ints[1] < 1 || ints[1] > 10 {
+			return r.errorf("bad bond type %d", ints[1])
+		}
+		bond := mol.Bond{Begin: begin - 1, End: end - 1, Order: ints[1]}
+		for _, kv := range tokens[4:] {
+			key, value, _ := strings.Cut(kv, "=")
+			if key != "CFG" {
+				continue
+			}
+			cfg, err := strconv.Atoi(value)
+			if err != nil {
+				return r.errorf("bad bond CFG %q", value)
+			}
+			bond.Stereo = v30BondCfgToStereo[cfg]
+			if bond.Order == mol.Double && cfg == 2 {
+				bond.Stereo = mol.StereoCisTrans
+			}
+		}
+		if len(m.Bonds) >= numBonds {
+			return r.errorf("more bonds than the %d declared in COUNTS", numBonds)
+		}
+		m.Bonds = append(m.Bonds, bond)
+	}
+}
+
+// readV30Collections 解析 MDLV30/STEABS ATOMS=(n a1 a2 ...) 這類集合
+func (r *Reader) readV30Collections(m *mol.Molecule) error {
+	for {
+		line, err := r.nextV30("collection block")
+		if err != nil {
+			return err
+		}
+		if line == "END COLLECTION" {
+			return nil
+		}
+		tokens := tokenizeV30(line)
+		if len(tokens) < 2 {
+			return r.errorf("bad collection line %q", line)
+		}
+		c := mol.Collection{Name: tokens[0]}
+		for _, kv := range tokens[1:] {
+			key, value, _ := strings.Cut(kv, "=")
+			if key != "ATOMS" {
+				continue
+			}
+			list, err := parseV30List(value)
+			if err != nil {
+				return r.errorf("bad ATOMS list %q", value)
+			}
+			for _, a := range list {
+				if a < 1 || a > len(m.Atoms) {
+					return r.errorf("collection references atom %d outside 1..%d", a, len(m.Atoms))
+				}
+				c.Atoms = append(c.Atoms, a-1)
+			}
+		}
+		m.Collections = append(m.Collections, c)
+	}
+}
+
+// tokenizeV30 以空白切開 V30 行，保留括號清單與引號字串的完整性
+func tokenizeV30(line string) []string {
+	var tokens []string
+	var sb strings.Builder
+	depth, quoted := 0, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+		case c == ')' && !quoted && depth > 0:
+			depth--
+		case c == ' ' && !quoted && depth == 0:
+			if sb.Len() > 0 {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+			}
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	if sb.Len() > 0 {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens
+}
+
+// parseV30List 解析 (n v1 v2 ...) 形式的清單
+func parseV30List(s string) ([]int, error) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("not a list")
+	}
+	fields := strings.Fields(s[1 : len(s)-1])
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty list")
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n != len(fields)-1 {
+		return nil, fmt.Errorf("list count mismatch")
+	}
+	out := make([]int, n)
+	for i := range out {
+		if out[i], err = strconv.Atoi(fields[1+i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// writeV3000 寫出 V3000 connection table（從 counts line 到 M  END）
+func writeV3000(w io.Writer, m *mol.Molecule) error {
+	lw := &v30Writer{w: w}
+	fmt.Fprintf(w, "  0  0  0     0  0            999 V3000\n")
+	lw.line("BEGIN CTAB")
+	chiral := 0
+	if m.Chiral {
+		chiral = 1
+	}
+	lw.line(fmt.Sprintf("COUNTS %d %d 0 0 %d", len(m.Atoms), len(m.Bonds), chiral))
+
+	lw.line("BEGIN ATOM")
+	for i, a := range m.Atoms {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d %s %s %s %s %d", i+1, a.Symbol,
+			formatCoord(a.X), formatCoord(a.Y), formatCoord(a.Z), a.MapNum)
+		if a.Charge != 0 {
+			fmt.Fprintf(&sb, " CHG=%d", a.Charge)
+		}
+		if a.Radical != 0 {
+			fmt.Fprintf(&sb, " RAD=%d", a.Radical)
+		}
+		if a.Parity != 0 {
+			fmt.Fprintf(&sb, " CFG=%d", a.Parity)
+		}
+		if a.Isotope != 0 {
+			fmt.Fprintf(&sb, " MASS=%d", a.Isotope)
+		}
+		if a.Valence == 15 {
+			sb.WriteString(" VAL=-1")
+		} else if a.Valence != 0 {
+			fmt.Fprintf(&sb, " VAL=%d", a.Valence)
+		}
+		if a.HCount != 0 {
+			fmt.Fprintf(&sb, " HCOUNT=%d", a.HCount)
+		}
+		lw.line(sb.String())
+	}
+	lw.line("END ATOM")
+
+	if len(m.Bonds) > 0 {
+		lw.line("BEGIN BOND")
+		for i, b := range m.Bonds {
+			s := fmt.Sprintf("%d %d %d %d", i+1, b.Order, b.Begin+1, b.End+1)
+			if cfg, ok := stereoToV30BondCfg[b.Stereo]; ok {
+				s += fmt.Sprintf(" CFG=%d", cfg)
+			}
+			lw.line(s)
+		}
+		lw.line("END BOND")
+	}
+
+	if len(m.Collections) > 0 {
+		lw.line("BEGIN COLLECTION")
+		for _, c := range m.Collections {
+			atoms := make([]string, len(c.Atoms))
+			for i, a := range c.Atoms {
+				atoms[i] = strconv.Itoa(a + 1)
+			}
+			lw.line(fmt.Sprintf("%s ATOMS=(%d %s)", c.Name, len(atoms), strings.Join(atoms, " ")))
+		}
+		lw.line("END COLLECTION")
+	}
+
+	lw.line("END CTAB")
+	if lw.err != nil {
+		return lw.err
+	}
+	_, err := fmt.Fprintf(w, "M  END\n")
+	return err
+}
+
+// v30Writer 寫出 M  V30 行，超過 80 字元時以 - 接續到下一行
+type v30Writer struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *v30Writer) line(s string) {
+	const width = 80 - len(v30Prefix) - 1
+	for lw.err == nil {
+		if len(s) <= width+1 {
+			_, lw.err = fmt.Fprintf(lw.w, "%s%s\n", v30Prefix, s)
+			return
+		}
+		_, lw.err = fmt.Fprintf(lw.w, "%s%s-\n", v30Prefix, s[:width])
+		s = s[width:]
+	}
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
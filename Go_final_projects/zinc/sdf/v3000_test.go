@@ -0,0 +1,177 @@
+package sdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zinc/mol"
+)
+
+const enhancedStereoRecord = `
+  test
+
+  0  0  0     0  0            999 V3000
+M  V30 BEGIN CTAB
+M  V30 COUNTS 4 3 0 0 1
+M  V30 BEGIN ATOM
+M  V30 1 C 0.0000 0.0000 0.0000 0 CFG=1
+M  V30 2 N 1.0000 0.0000 0.0000 0 CHG=1
+M  V30 3 O -1.0000 0.0000 0.0000 0 MASS=18
+M  V30 4 Cl 0.0000 1.0000 0.0000 0
+M  V30 END ATOM
+M  V30 BEGIN BOND
+M  V30 1 1 1 2 CFG=1
+M  V30 2 1 1 3
+M  V30 3 1 1 -
+M  V30 4
+M  V30 END BOND
+M  V30 BEGIN COLLECTION
+M  V30 MDLV30/STERAC1 ATOMS=(1 1)
+M  V30 END COLLECTION
+M  V30 END CTAB
+M  END
+$$$$
+`
+
+func TestReadV3000(t *testing.T) {
+	m, err := NewReader(strings.NewReader(enhancedStereoRecord)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Atoms) != 4 || len(m.Bonds) != 3 || !m.Chiral {
+		t.Fatalf("got %d atoms, %d bonds, chiral=%v", len(m.Atoms), len(m.Bonds), m.Chiral)
+	}
+	if m.Atoms[0].Parity != 1 || m.Atoms[1].Charge != 1 || m.Atoms[2].Isotope != 18 {
+		t.Errorf("atoms = %+v", m.Atoms)
+	}
+	if b := m.Bonds[2]; b.Begin != 0 || b.End != 3 {
+		t.Errorf("continued bond = %+v", b)
+	}
+	if m.Bonds[0].Stereo != mol.StereoUp {
+		t.Errorf("bond 1 stereo = %d", m.Bonds[0].Stereo)
+	}
+	want := []mol.Collection{{Name: "MDLV30/STERAC1", Atoms: []int{0}}}
+	if !reflect.DeepEqual(m.Collections, want) {
+		t.Errorf("collections = %+v", m.Collections)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	src := chargedRecord + enhancedStereoRecord
+	orig, err := NewReader(strings.NewReader(src)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v3, v2 bytes.Buffer
+	if n, err := Convert(&v3, strings.NewReader(src), V3000); err != nil || n != 2 {
+		t.Fatalf("to V3000: n=%d err=%v", n, err)
+	}
+	if n, err := Convert(&v2, bytes.NewReader(v3.Bytes()), V2000); err != nil || n != 2 {
+		t.Fatalf("to V2000: n=%d err=%v", n, err)
+	}
+	back, err := NewReader(&v2).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range orig {
+		if !reflect.DeepEqual(orig[i].Atoms, back[i].Atoms) {
+			t.Errorf("record %d atoms changed:\n%+v\n%+v", i, orig[i].Atoms, back[i].Atoms)
+		}
+		if !reflect.DeepEqual(orig[i].Bonds, back[i].Bonds) {
+			t.Errorf("record %d bonds changed:\n%+v\n%+v", i, orig[i].Bonds, back[i].Bonds)
+		}
+		if !reflect.DeepEqual(orig[i].Fields, back[i].Fields) {
+			t.Errorf("record %d fields changed: %+v", i, back[i].Fields)
+		}
+	}
+	// 增強立體化學集合無法以 V2000 表示
+	if len(back[1].Collections) != 0 {
+		t.Errorf("V2000 output kept collections: %+v", back[1].Collections)
+	}
+}
+
+func TestAutoFormatLargeMolecule(t *testing.T) {
+	m := &mol.Molecule{Name: "chain"}
+	for i := 0; i < 1200; i++ {
+		m.Atoms = append(m.Atoms, mol.Atom{Symbol: "C", X: float64(i)})
+		if i > 0 {
+			m.Bonds = append(m.Bonds, mol.Bond{Begin: i - 1, End: i, Order: 1})
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if !strings.Contains(buf.String(), "V3000") {
+		t.Fatal("auto format did not choose V3000 for 1200 atoms")
+	}
+	back, err := NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Atoms) != 1200 || len(back.Bonds) != 1199 {
+		t.Fatalf("got %d atoms / %d bonds", len(back.Atoms), len(back.Bonds))
+	}
+
+	w = NewWriter(&buf)
+	w.Format = V2000
+	if err := w.Write(m); err == nil {
+		t.Fatal("V2000 accepted 1200 atoms")
+	}
+}
+
+func TestV30LongLinesAreContinued(t *testing.T) {
+	m := &mol.Molecule{Name: "long"}
+	var atoms []int
+	for i := 0; i < 40; i++ {
+		m.Atoms = append(m.Atoms, mol.Atom{Symbol: "C"})
+		atoms = append(atoms, i)
+	}
+	m.Collections = []mol.Collection{{Name: "MDLV30/STEABS", Atoms: atoms}}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(m)
+	w.Flush()
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > 80 {
+			t.Fatalf("line longer than 80 characters: %q", line)
+		}
+	}
+	back, err := NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(back.Collections[0].Atoms); got != fmt.Sprint(atoms) {
+		t.Errorf("collection atoms = %s", got)
+	}
+}
+
+func TestV3000Counts(t *testing.T) {
+	tests := []struct {
+		counts string
+		want   string
+	}{
+		{"COUNTS -4 3 0 0 1", "negative count"},
+		{"COUNTS 4 -3 0 0 1", "negative count"},
+		// 宣告的數量只用來預先配置，不會依它配置整個陣列
+		{"COUNTS 900000000000 3 0 0 1", "COUNTS declares 900000000000 atoms, found 4"},
+	}
+	for _, tt := range tests {
+		input := strings.Replace(enhancedStereoRecord, "COUNTS 4 3 0 0 1", tt.counts, 1)
+		_, err := NewReader(strings.NewReader(input)).Read()
+		var perr *ParseError
+		if !errors.As(err, &perr) || !strings.Contains(perr.Msg, tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.counts, err, tt.want)
+		}
+	}
+}
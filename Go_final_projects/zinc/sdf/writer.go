@@ -0,0 +1,175 @@
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"zinc/mol"
+)
+
+// Format 指定 connection table 的版本
+type Format int
+
+const (
+	// Auto 在 V2000 放得下時寫 V2000，否則（超過 999 個原子/鍵、或有增強立體化學集合）寫 V3000
+	Auto Format = iota
+	V2000
+	V3000
+)
+
+// ParseFormat 把 "auto"、"v2000"、"v3000" 轉成 Format
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return Auto, nil
+	case "v2000", "2000":
+		return V2000, nil
+	case "v3000", "3000":
+		return V3000, nil
+	}
+	return Auto, fmt.Errorf("unknown molfile format %q (choose auto, v2000 or v3000)", s)
+}
+
+func (f Format) String() string {
+	switch f {
+	case V2000:
+		return "V2000"
+	case V3000:
+		return "V3000"
+	}
+	return "auto"
+}
+
+// Writer 把分子逐筆寫成 SD 檔
+type Writer struct {
+	w      *bufio.Writer
+	Format Format
+}
+
+// NewWriter 建立寫到 w 的 Writer，預設格式為 Auto
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write 寫出一筆紀錄（molfile、資料欄位與 $$$$）
+func (w *Writer) Write(m *mol.Molecule) error {
+	if err := w.WriteMolfile(m); err != nil {
+		return err
+	}
+	for _, f := range m.Fields {
+		fmt.Fprintf(w.w, ">  <%s>\n%s\n\n", f.Name, f.Value)
+	}
+	_, err := w.w.WriteString("$$$$\n")
+	return err
+}
+
+// WriteMolfile 只寫出 molfile 部分（標頭到 M  END），不含資料欄位
+func (w *Writer) WriteMolfile(m *mol.Molecule) error {
+	format := w.Format
+	if format == Auto {
+		format = V2000
+		if len(m.Atoms) > 999 || len(m.Bonds) > 999 || len(m.Collections) > 0 {
+			format = V3000
+		}
+	}
+	if format == V2000 && (len(m.Atoms) > 999 || len(m.Bonds) > 999) {
+		return fmt.Errorf("%s: %d atoms / %d bonds do not fit in a V2000 connection table", m.Name, len(m.Atoms), len(m.Bonds))
+	}
+
+	fmt.Fprintf(w.w, "%s\n%s\n%s\n", m.Name, m.Program, m.Comment)
+	if format == V3000 {
+		return writeV3000(w.w, m)
+	}
+	return writeV2000(w.w, m)
+}
+
+// Flush 把緩衝區內容寫出
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// V2000 atom block 的電荷代碼
+var chargeCodes = map[int]int{3: 1, 2: 2, 1: 3, -1: 5, -2: 6, -3: 7}
+
+func writeV2000(w io.Writer, m *mol.Molecule) error {
+	chiral := 0
+	if m.Chiral {
+		chiral = 1
+	}
+	fmt.Fprintf(w, "%3d%3d  0  0%3d  0  0  0  0  0999 V2000\n", len(m.Atoms), len(m.Bonds), chiral)
+
+	var charges, isotopes, radicals [][2]int
+	for i, a := range m.Atoms {
+		code := chargeCodes[a.Charge]
+		if a.Radical == 2 && a.Charge == 0 {
+			code = 4
+		}
+		symbol := a.Symbol
+		if len(symbol) > 3 {
+			symbol = symbol[:3]
+		}
+		fmt.Fprintf(w, "%10.4f%10.4f%10.4f %-3s%2d%3d%3d%3d  0%3d  0  0  0  0  0  0\n",
+			a.X, a.Y, a.Z, symbol, a.MassDiff, code, a.Parity, a.HCount, a.Valence)
+		if a.Charge != 0 {
+			charges = append(charges, [2]int{i + 1, a.Charge})
+		}
+		if a.Isotope != 0 {
+			isotopes = append(isotopes, [2]int{i + 1, a.Isotope})
+		}
+		if a.Radical != 0 {
+			radicals = append(radicals, [2]int{i + 1, a.Radical})
+		}
+	}
+
+	for _, b := range m.Bonds {
+		stereo := b.Stereo
+		if b.Order == mol.Double && stereo == mol.StereoEither {
+			stereo = mol.StereoCisTrans
+		}
+		fmt.Fprintf(w, "%3d%3d%3d%3d\n", b.Begin+1, b.End+1, b.Order, stereo)
+	}
+
+	writePairs(w, "CHG", charges)
+	writePairs(w, "RAD", radicals)
+	writePairs(w, "ISO", isotopes)
+	_, err := fmt.Fprintf(w, "M  END\n")
+	return err
+}
+
+// writePairs 寫出 M  CHG/RAD/ISO 行，每行最多 8 組
+func writePairs(w io.Writer, tag string, pairs [][2]int) {
+	for len(pairs) > 0 {
+		n := min(len(pairs), 8)
+		fmt.Fprintf(w, "M  %s%3d", tag, n)
+		for _, p := range pairs[:n] {
+			fmt.Fprintf(w, " %3d %3d", p[0], p[1])
+		}
+		fmt.Fprintln(w)
+		pairs = pairs[n:]
+	}
+}
+
+// Convert 從 src 讀取所有紀錄並以指定格式寫到 dst，回傳轉換的紀錄數。
+// V3000 的增強立體化學集合無法以 V2000 表示，轉成 V2000 時會被捨棄。
+func Convert(dst io.Writer, src io.Reader, format Format) (int, error) {
+	r := NewReader(src)
+	w := NewWriter(dst)
+	w.Format = format
+	n := 0
+	for {
+		m, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := w.Write(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, w.Flush()
+}
@@ -0,0 +1,264 @@
+package smarts
+
+import (
+	"sort"
+
+	"zinc/mol"
+)
+
+// Target 是準備好供比對的分子：芳香鍵已標出，並預先計算氫數、環資訊等原子性質。
+// 氫原子不參與比對，查詢中的 H 條件一律以氫數表示。
+type Target struct {
+	m *mol.Molecule // 芳香化後的副本，原子索引與原分子相同
+
+	aromatic         []bool
+	hcount           []int // 氫總數（隱含氫、ExplicitH 與圖中的氫原子）
+	implicitH        []int
+	heavyDegree      []int
+	valence          []int // Kekulé 結構的鍵級總和加上氫數
+	ringBond         []bool
+	ringCount        []int // 原子所在的 SSSR 環數
+	ringConnectivity []int // 原子的環鍵數
+	ringSizes        [][]int
+	adj              [][]mol.Edge
+}
+
+// NewTarget 為分子 m 建立比對目標，不會修改 m
+func NewTarget(m *mol.Molecule) *Target {
+	n := len(m.Atoms)
+	t := &Target{
+		hcount:           make([]int, n),
+		implicitH:        make([]int, n),
+		heavyDegree:      make([]int, n),
+		valence:          make([]int, n),
+		ringCount:        make([]int, n),
+		ringConnectivity: make([]int, n),
+		ringSizes:        make([][]int, n),
+	}
+	adj := m.Adjacency()
+	for i := range m.Atoms {
+		t.hcount[i] = m.HydrogenCount(i)
+		t.implicitH[i] = m.ImplicitHydrogens(i)
+		t.heavyDegree[i] = m.HeavyDegree(i)
+		t.valence[i] = m.ImplicitHydrogens(i) + m.Atoms[i].ExplicitH
+		aromatic := 0
+		for _, e := range adj[i] {
+			if o := m.Bonds[e.Bond].Order; o == mol.Aromatic {
+				aromatic++
+			} else {
+				t.valence[i] += o
+			}
+		}
+		if aromatic > 0 {
+			t.valence[i] += aromatic + 1
+		}
+	}
+
+	t.m = m.Clone()
+	t.m.Aromatize()
+	t.aromatic, _ = t.m.Aromaticity()
+	t.adj = t.m.Adjacency()
+	t.ringBond = t.m.RingBonds()
+	for i := range t.m.Atoms {
+		for _, e := range t.adj[i] {
+			if t.ringBond[e.Bond] {
+				t.ringConnectivity[i]++
+			}
+		}
+	}
+	for _, ring := range t.m.Rings() {
+		for _, a := range ring {
+			t.ringCount[a]++
+			t.ringSizes[a] = append(t.ringSizes[a], len(ring))
+		}
+	}
+	return t
+}
+
+func (t *Target) inRingOfSize(i, n int) bool {
+	for _, s := range t.ringSizes[i] {
+		if s == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Molecule 回傳比對用的分子（芳香化後的副本）
+func (t *Target) Molecule() *mol.Molecule { return t.m }
+
+// matcher 是一次比對的狀態：core[k] 是查詢原子 k 對應的目標原子
+type matcher struct {
+	q     *Query
+	t     *Target
+	order []int  // 查詢原子的走訪順序，每個原子（除各分量起點外）都與前面的原子相連
+	from  []int  // order 中每個位置相連的前一個查詢原子，-1 表示沒有
+	core  []int  // 查詢原子 -> 目標原子
+	used  []bool // 目標原子是否已被對應
+	visit func([]int) bool
+}
+
+func newMatcher(q *Query, t *Target, root int) *matcher {
+	mt := &matcher{
+		q:    q,
+		t:    t,
+		core: make([]int, len(q.atoms)),
+		used: make([]bool, len(t.m.Atoms)),
+	}
+	for i := range mt.core {
+		mt.core[i] = -1
+	}
+	// 以廣度優先排定查詢原子的順序，讓每個新原子都能從已對應的鄰居找候選
+	seen := make([]bool, len(q.atoms))
+	starts := []int{root}
+	for i := range q.atoms {
+		if i != root {
+			starts = append(starts, i)
+		}
+	}
+	for _, s := range starts {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		mt.order = append(mt.order, s)
+		mt.from = append(mt.from, -1)
+		for k := len(mt.order) - 1; k < len(mt.order); k++ {
+			a := mt.order[k]
+			for _, bi := range q.adj[a] {
+				b := q.other(bi, a)
+				if !seen[b] {
+					seen[b] = true
+					mt.order = append(mt.order, b)
+					mt.from = append(mt.from, a)
+				}
+			}
+		}
+	}
+	return mt
+}
+
+func (q *Query) other(bond, atom int) int {
+	if q.bonds[bond].begin == atom {
+		return q.bonds[bond].end
+	}
+	return q.bonds[bond].begin
+}
+
+// run 從 order 的第 k 個位置開始回溯；visit 回傳 false 時停止搜尋
+func (mt *matcher) run(k int) bool {
+	if k == len(mt.order) {
+		return mt.visit(mt.core)
+	}
+	qa := mt.order[k]
+	try := func(ta int) bool {
+		if mt.used[ta] || !mt.feasible(qa, ta) {
+			return true
+		}
+		mt.core[qa], mt.used[ta] = ta, true
+		cont := mt.run(k + 1)
+		mt.core[qa], mt.used[ta] = -1, false
+		return cont
+	}
+	if mt.core[qa] >= 0 {
+		// 事先固定的原子（遞迴 SMARTS 的根）
+		ta := mt.core[qa]
+		mt.core[qa], mt.used[ta] = -1, false
+		cont := try(ta)
+		mt.core[qa], mt.used[ta] = ta, true
+		return cont
+	}
+	if f := mt.from[k]; f >= 0 {
+		for _, e := range mt.t.adj[mt.core[f]] {
+			if !try(e.Atom) {
+				return false
+			}
+		}
+		return true
+	}
+	for ta := range mt.t.m.Atoms {
+		if !try(ta) {
+			return false
+		}
+	}
+	return true
+}
+
+// feasible 檢查查詢原子 qa 能否對應到目標原子 ta：原子條件、連到已對應原子的鍵條件，
+// 以及目標原子的鄰居數不少於查詢原子（VF2 的前瞻剪枝）
+func (mt *matcher) feasible(qa, ta int) bool {
+	t := mt.t
+	if t.m.Atoms[ta].Symbol == "H" || t.heavyDegree[ta] < len(mt.q.adj[qa]) {
+		return false
+	}
+	if !mt.q.atoms[qa](t, ta) {
+		return false
+	}
+	for _, bi := range mt.q.adj[qa] {
+		other := mt.core[mt.q.other(bi, qa)]
+		if other < 0 {
+			continue
+		}
+		tb := t.m.BondBetween(ta, other)
+		if tb < 0 || !mt.q.bonds[bi].pred(t, tb) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAt 判斷查詢的第一個原子能否對應到目標原子 i，用於遞迴 SMARTS
+func (q *Query) matchesAt(t *Target, i int) bool {
+	if len(q.atoms) == 0 {
+		return false
+	}
+	mt := newMatcher(q, t, 0)
+	mt.core[0], mt.used[i] = i, true
+	found := false
+	mt.visit = func([]int) bool {
+		found = true
+		return false
+	}
+	mt.run(0)
+	return found
+}
+
+// Matches 判斷查詢是否出現在目標中
+func (q *Query) Matches(t *Target) bool {
+	found := false
+	mt := newMatcher(q, t, 0)
+	mt.visit = func([]int) bool {
+		found = true
+		return false
+	}
+	mt.run(0)
+	return found
+}
+
+// FindAll 回傳所有不重複的對應：每個對應是查詢原子依序對應到的目標原子索引（0 起始），
+// 涵蓋相同原子集合的對應只保留第一個。max 大於 0 時最多回傳 max 個。
+func (q *Query) FindAll(t *Target, max int) [][]int {
+	var out [][]int
+	seen := make(map[string]bool)
+	mt := newMatcher(q, t, 0)
+	mt.visit = func(core []int) bool {
+		key := append([]int(nil), core...)
+		sort.Ints(key)
+		k := intsKey(key)
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, append([]int(nil), core...))
+		}
+		return max <= 0 || len(out) < max
+	}
+	mt.run(0)
+	return out
+}
+
+func intsKey(xs []int) string {
+	b := make([]byte, 0, len(xs)*3)
+	for _, x := range xs {
+		b = append(b, byte(x>>16), byte(x>>8), byte(x))
+	}
+	return string(b)
+}
@@ -0,0 +1,610 @@
+// Package smarts 解析 SMARTS 子結構查詢，並以 VF2 風格的回溯法在分子中尋找子圖同構。
+package smarts
+
+import (
+	"fmt"
+	"strings"
+
+	"zinc/mol"
+)
+
+// SyntaxError 是 SMARTS 字串中的語法錯誤，Pos 為 0 起始的字元位置
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("smarts: position %d: %s", e.Pos, e.Msg)
+}
+
+// atomPred 與 bondPred 是查詢原子與查詢鍵的條件
+type (
+	atomPred func(t *Target, i int) bool
+	bondPred func(t *Target, b int) bool
+)
+
+// queryBond 是查詢圖中的一個鍵
+type queryBond struct {
+	begin, end int
+	pred       bondPred
+}
+
+// Query 是解析後的 SMARTS 查詢
+type Query struct {
+	source string
+	atoms  []atomPred
+	bonds  []queryBond
+	adj    [][]int // 每個查詢原子相連的查詢鍵
+}
+
+// String 回傳原始的 SMARTS 字串
+func (q *Query) String() string { return q.source }
+
+// NumAtoms 回傳查詢原子數
+func (q *Query) NumAtoms() int { return len(q.atoms) }
+
+// parser 保存解析過程的狀態
+type parser struct {
+	s   string
+	pos int
+	q   *Query
+}
+
+// Parse 解析 SMARTS 字串
+func Parse(s string) (*Query, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, &SyntaxError{0, "empty SMARTS"}
+	}
+	p := &parser{s: s, q: &Query{source: s}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.q, nil
+}
+
+// MustParse 與 Parse 相同，但解析失敗時 panic，用於測試與常數
+func MustParse(s string) *Query {
+	q, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek(c byte) bool {
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+func (p *parser) parse() error {
+	type ring struct {
+		atom int
+		bond bondPred
+		pos  int
+	}
+	rings := make(map[int]ring)
+	prev := -1
+	var stack []int
+	var bond bondPred
+	dot := false
+
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '(':
+			if prev < 0 || bond != nil {
+				return p.errorf("unexpected '('")
+			}
+			stack = append(stack, prev)
+			p.pos++
+		case c == ')':
+			if len(stack) == 0 {
+				return p.errorf("unmatched ')'")
+			}
+			if bond != nil {
+				return p.errorf("bond before ')'")
+			}
+			prev = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.pos++
+		case c == '.':
+			if bond != nil {
+				return p.errorf("bond before '.'")
+			}
+			dot = true
+			p.pos++
+		case isBondChar(c):
+			if bond != nil {
+				return p.errorf("consecutive bonds")
+			}
+			if prev < 0 {
+				return p.errorf("bond without a preceding atom")
+			}
+			var err error
+			if bond, err = p.bondExpr(); err != nil {
+				return err
+			}
+		case isDigit(c) || c == '%':
+			if prev < 0 {
+				return p.errorf("ring closure without a preceding atom")
+			}
+			start := p.pos
+			digit := int(c - '0')
+			if c == '%' {
+				if p.pos+2 >= len(p.s) || !isDigit(p.s[p.pos+1]) || !isDigit(p.s[p.pos+2]) {
+					return p.errorf("'%%' must be followed by two digits")
+				}
+				digit = int(p.s[p.pos+1]-'0')*10 + int(p.s[p.pos+2]-'0')
+				p.pos += 2
+			}
+			p.pos++
+			if r, ok := rings[digit]; ok {
+				delete(rings, digit)
+				b := bond
+				if b == nil {
+					b = r.bond
+				}
+				if r.atom == prev {
+					p.pos = start
+					return p.errorf("ring closure %d on the same atom", digit)
+				}
+				p.addBond(r.atom, prev, b)
+			} else {
+				rings[digit] = ring{atom: prev, bond: bond, pos: start}
+			}
+			bond = nil
+		default:
+			atom, err := p.atom()
+			if err != nil {
+				return err
+			}
+			if prev >= 0 && !dot {
+				p.addBond(prev, atom, bond)
+			}
+			prev, dot, bond = atom, false, nil
+		}
+	}
+	switch {
+	case len(stack) > 0:
+		return p.errorf("unclosed '('")
+	case bond != nil:
+		return p.errorf("bond at end of SMARTS")
+	case dot:
+		return p.errorf("'.' at end of SMARTS")
+	}
+	for digit, r := range rings {
+		p.pos = r.pos
+		return p.errorf("unclosed ring %d", digit)
+	}
+	return nil
+}
+
+func (p *parser) addBond(a, b int, pred bondPred) {
+	if pred == nil {
+		pred = defaultBond
+	}
+	q := p.q
+	q.bonds = append(q.bonds, queryBond{begin: a, end: b, pred: pred})
+	q.adj[a] = append(q.adj[a], len(q.bonds)-1)
+	q.adj[b] = append(q.adj[b], len(q.bonds)-1)
+}
+
+func (p *parser) addAtom(pred atomPred) int {
+	p.q.atoms = append(p.q.atoms, pred)
+	p.q.adj = append(p.q.adj, nil)
+	return len(p.q.atoms) - 1
+}
+
+// atom 讀取一個查詢原子：方括號運算式，或有機子集、*、a、A
+func (p *parser) atom() (int, error) {
+	if p.peek('[') {
+		p.pos++
+		pred, err := p.atomExpr()
+		if err != nil {
+			return 0, err
+		}
+		if !p.peek(']') {
+			return 0, p.errorf("expected ']'")
+		}
+		p.pos++
+		return p.addAtom(pred), nil
+	}
+	rest := p.s[p.pos:]
+	for _, sym := range []string{"Cl", "Br"} {
+		if strings.HasPrefix(rest, sym) {
+			p.pos += 2
+			return p.addAtom(element(sym, aliphatic)), nil
+		}
+	}
+	c := rest[0]
+	p.pos++
+	switch c {
+	case '*':
+		return p.addAtom(anyAtom), nil
+	case 'a':
+		return p.addAtom(func(t *Target, i int) bool { return t.aromatic[i] }), nil
+	case 'A':
+		return p.addAtom(func(t *Target, i int) bool { return !t.aromatic[i] }), nil
+	case 'B', 'C', 'N', 'O', 'P', 'S', 'F', 'I':
+		return p.addAtom(element(string(c), aliphatic)), nil
+	case 'b', 'c', 'n', 'o', 'p', 's':
+		return p.addAtom(element(strings.ToUpper(string(c)), aromatic)), nil
+	}
+	p.pos--
+	return 0, p.errorf("unexpected character %q", c)
+}
+
+// 芳香性的限制
+const (
+	either = iota
+	aliphatic
+	aromatic
+)
+
+func element(symbol string, arom int) atomPred {
+	return func(t *Target, i int) bool {
+		if t.m.Atoms[i].Symbol != symbol {
+			return false
+		}
+		switch arom {
+		case aliphatic:
+			return !t.aromatic[i]
+		case aromatic:
+			return t.aromatic[i]
+		}
+		return true
+	}
+}
+
+func anyAtom(*Target, int) bool { return true }
+
+// atomExpr 解析方括號內的運算式，優先順序由低到高為 ;、,、&（或省略）、!
+func (p *parser) atomExpr() (atomPred, error) {
+	return p.lowAnd()
+}
+
+func (p *parser) lowAnd() (atomPred, error) {
+	left, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(';') {
+		p.pos++
+		right, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, i int) bool { return l(t, i) && right(t, i) }
+	}
+	return left, nil
+}
+
+func (p *parser) or() (atomPred, error) {
+	left, err := p.highAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(',') {
+		p.pos++
+		right, err := p.highAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, i int) bool { return l(t, i) || right(t, i) }
+	}
+	return left, nil
+}
+
+func (p *parser) highAnd() (atomPred, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.s) && !strings.ContainsRune(";,]", rune(p.s[p.pos])) && p.s[p.pos] != ')' {
+		if p.peek('&') {
+			p.pos++
+		}
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, i int) bool { return l(t, i) && right(t, i) }
+	}
+	return left, nil
+}
+
+func (p *parser) not() (atomPred, error) {
+	if p.peek('!') {
+		p.pos++
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(t *Target, i int) bool { return !inner(t, i) }, nil
+	}
+	return p.primitive()
+}
+
+// primitive 解析一個原子條件。方括號開頭（同位素之後）的 H 代表氫原子而不是氫數。
+func (p *parser) primitive() (atomPred, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end of SMARTS")
+	}
+	c := p.s[p.pos]
+	rest := p.s[p.pos:]
+	switch {
+	case isDigit(c):
+		n := p.number()
+		return func(t *Target, i int) bool { return t.m.Atoms[i].Isotope == n }, nil
+	case c == '$':
+		if !strings.HasPrefix(rest, "$(") {
+			return nil, p.errorf("expected '(' after '$'")
+		}
+		end := matchingParen(p.s, p.pos+1)
+		if end < 0 {
+			return nil, p.errorf("unclosed recursive SMARTS")
+		}
+		inner, err := Parse(p.s[p.pos+2 : end])
+		if err != nil {
+			se := err.(*SyntaxError)
+			return nil, &SyntaxError{p.pos + 2 + se.Pos, se.Msg}
+		}
+		p.pos = end + 1
+		return func(t *Target, i int) bool { return inner.matchesAt(t, i) }, nil
+	case c == '#':
+		p.pos++
+		if p.pos >= len(p.s) || !isDigit(p.s[p.pos]) {
+			return nil, p.errorf("'#' must be followed by an atomic number")
+		}
+		n := p.number()
+		return func(t *Target, i int) bool { return t.m.Atoms[i].AtomicNumber() == n }, nil
+	case c == '*':
+		p.pos++
+		return anyAtom, nil
+	case c == '+' || c == '-':
+		p.pos++
+		n := 1
+		if p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+			n = p.number()
+		} else {
+			for p.peek(c) {
+				p.pos++
+				n++
+			}
+		}
+		if c == '-' {
+			n = -n
+		}
+		return func(t *Target, i int) bool { return t.m.Atoms[i].Charge == n }, nil
+	case c == '@':
+		// 掌性條件只做語法上的接受，比對時不檢查
+		p.pos++
+		for p.peek('@') || p.peek('?') {
+			p.pos++
+		}
+		return anyAtom, nil
+	case c == 'H' && p.atBracketStart() && (len(rest) == 1 || strings.ContainsRune("]+-;,&", rune(rest[1]))):
+		p.pos++
+		return element("H", either), nil
+	}
+
+	// 兩個字母的元素優先，例如 [Cl]、[Br]、[Se]、[se]
+	if len(rest) >= 2 {
+		two := rest[:2]
+		if (isUpper(two[0]) && isLower(two[1]) && known(two)) || two == "se" || two == "as" {
+			p.pos += 2
+			if isLower(two[0]) {
+				return element(strings.ToUpper(two[:1])+two[1:], aromatic), nil
+			}
+			return element(two, aliphatic), nil
+		}
+	}
+
+	switch c {
+	case 'a':
+		p.pos++
+		return func(t *Target, i int) bool { return t.aromatic[i] }, nil
+	case 'A':
+		p.pos++
+		return func(t *Target, i int) bool { return !t.aromatic[i] }, nil
+	case 'D':
+		return p.count(func(t *Target, i int) int { return t.heavyDegree[i] }, 1), nil
+	case 'X':
+		return p.count(func(t *Target, i int) int { return t.heavyDegree[i] + t.hcount[i] }, 1), nil
+	case 'H':
+		return p.count(func(t *Target, i int) int { return t.hcount[i] }, 1), nil
+	case 'h':
+		return p.count(func(t *Target, i int) int { return t.implicitH[i] }, 1), nil
+	case 'v':
+		return p.count(func(t *Target, i int) int { return t.valence[i] }, 1), nil
+	case 'x':
+		return p.count(func(t *Target, i int) int { return t.ringConnectivity[i] }, -1), nil
+	case 'R':
+		// R 不帶數字表示在環上，R0 表示不在環上
+		return p.count(func(t *Target, i int) int { return t.ringCount[i] }, -1), nil
+	case 'r':
+		p.pos++
+		if p.pos >= len(p.s) || !isDigit(p.s[p.pos]) {
+			return func(t *Target, i int) bool { return t.ringCount[i] > 0 }, nil
+		}
+		n := p.number()
+		return func(t *Target, i int) bool { return t.inRingOfSize(i, n) }, nil
+	}
+	if isUpper(c) && known(rest[:1]) {
+		p.pos++
+		return element(rest[:1], aliphatic), nil
+	}
+	if strings.ContainsRune("bcnops", rune(c)) {
+		p.pos++
+		return element(strings.ToUpper(rest[:1]), aromatic), nil
+	}
+	return nil, p.errorf("unexpected %q in atom expression", c)
+}
+
+// count 解析 D、X、H 這類帶數字的條件。沒有數字時以 def 為預設值，
+// def 為 -1 時表示「至少一個」。
+func (p *parser) count(f func(t *Target, i int) int, def int) atomPred {
+	p.pos++
+	if p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+		n := p.number()
+		return func(t *Target, i int) bool { return f(t, i) == n }
+	}
+	if def < 0 {
+		return func(t *Target, i int) bool { return f(t, i) > 0 }
+	}
+	return func(t *Target, i int) bool { return f(t, i) == def }
+}
+
+func (p *parser) number() int {
+	n := 0
+	for p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+		n = n*10 + int(p.s[p.pos]-'0')
+		p.pos++
+	}
+	return n
+}
+
+// bondExpr 解析鍵運算式，支援 - = # : ~ @ / \ 與 ! & , ;
+func (p *parser) bondExpr() (bondPred, error) {
+	return p.bondLowAnd()
+}
+
+func (p *parser) bondLowAnd() (bondPred, error) {
+	left, err := p.bondOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(';') {
+		p.pos++
+		right, err := p.bondOr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, b int) bool { return l(t, b) && right(t, b) }
+	}
+	return left, nil
+}
+
+func (p *parser) bondOr() (bondPred, error) {
+	left, err := p.bondAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(',') {
+		p.pos++
+		right, err := p.bondAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, b int) bool { return l(t, b) || right(t, b) }
+	}
+	return left, nil
+}
+
+func (p *parser) bondAnd() (bondPred, error) {
+	left, err := p.bondNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.s) && (isBondChar(p.s[p.pos]) || p.s[p.pos] == '&') {
+		if p.peek('&') {
+			p.pos++
+		}
+		right, err := p.bondNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(t *Target, b int) bool { return l(t, b) && right(t, b) }
+	}
+	return left, nil
+}
+
+func (p *parser) bondNot() (bondPred, error) {
+	if p.peek('!') {
+		p.pos++
+		inner, err := p.bondNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(t *Target, b int) bool { return !inner(t, b) }, nil
+	}
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end of SMARTS")
+	}
+	c := p.s[p.pos]
+	p.pos++
+	order := func(o int) bondPred {
+		return func(t *Target, b int) bool { return t.m.Bonds[b].Order == o }
+	}
+	switch c {
+	case '-', '/', '\\':
+		return order(mol.Single), nil
+	case '=':
+		return order(mol.Double), nil
+	case '#':
+		return order(mol.Triple), nil
+	case ':':
+		return order(mol.Aromatic), nil
+	case '~':
+		return func(*Target, int) bool { return true }, nil
+	case '@':
+		return func(t *Target, b int) bool { return t.ringBond[b] }, nil
+	}
+	p.pos--
+	return nil, p.errorf("unexpected %q in bond expression", c)
+}
+
+// defaultBond 是未寫出鍵符號時的條件：單鍵或芳香鍵
+func defaultBond(t *Target, b int) bool {
+	o := t.m.Bonds[b].Order
+	return o == mol.Single || o == mol.Aromatic
+}
+
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isBondChar(c byte) bool {
+	return strings.IndexByte("-=#:~@/\\!", c) >= 0
+}
+
+// atBracketStart 判斷目前位置之前是否只有 '[' 與同位素數字
+func (p *parser) atBracketStart() bool {
+	i := p.pos - 1
+	for i >= 0 && isDigit(p.s[i]) {
+		i--
+	}
+	return i >= 0 && p.s[i] == '['
+}
+
+func known(symbol string) bool {
+	_, ok := mol.LookupElement(symbol)
+	return ok
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
@@ -0,0 +1,62 @@
+package smarts
+
+import (
+	"path/filepath"
+	"strings"
+
+	"zinc/sdf"
+)
+
+// Hit 是子結構搜尋中命中的一個分子。Matches 中的原子編號從 1 開始，
+// 與 molfile atom block 的順序一致，方便對照原始檔案。
+type Hit struct {
+	ZincID  string  `json:"zinc_id"`
+	File    string  `json:"file"`
+	Record  int     `json:"record"` // 檔案中的第幾筆紀錄，從 1 開始
+	Matches [][]int `json:"matches"`
+}
+
+// FileError 是搜尋時無法讀取的檔案
+type FileError struct {
+	File string `json:"file"`
+	Err  string `json:"error"`
+}
+
+// Result 是在多個 SD 檔中搜尋的結果
+type Result struct {
+	Query    string      `json:"query"`
+	Searched int         `json:"searched"` // 檢查過的分子數
+	Hits     []Hit       `json:"hits"`
+	Errors   []FileError `json:"errors,omitempty"`
+}
+
+// SearchFiles 在 files 的所有分子中搜尋 q。maxMatches 限制每個分子回報的對應數，
+// 0 表示不限制。讀取失敗的檔案記在 Result.Errors，不會中止搜尋。
+func SearchFiles(q *Query, files []string, maxMatches int) *Result {
+	res := &Result{Query: q.String(), Hits: []Hit{}}
+	for _, path := range files {
+		mols, err := sdf.ReadFile(path)
+		if err != nil {
+			res.Errors = append(res.Errors, FileError{File: path, Err: err.Error()})
+			continue
+		}
+		for k, m := range mols {
+			res.Searched++
+			matches := q.FindAll(NewTarget(m), maxMatches)
+			if len(matches) == 0 {
+				continue
+			}
+			for _, mapping := range matches {
+				for j := range mapping {
+					mapping[j]++
+				}
+			}
+			id := m.ZincID()
+			if id == "" {
+				id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			}
+			res.Hits = append(res.Hits, Hit{ZincID: id, File: path, Record: k + 1, Matches: matches})
+		}
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package smarts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"zinc/smiles"
+)
+
+func TestMatches(t *testing.T) {
+	const sulfonamide = "[#16X4](=[OX1])(=[OX1])[NX3]"
+	tests := []struct {
+		smarts, smiles string
+		want           bool
+	}{
+		{sulfonamide, "Cc1ccc(cc1)S(=O)(=O)N", true},
+		{sulfonamide, "CS(=O)(=O)O", false},
+		{"c1ccccc1", "OC1=CC=CC=C1", true},
+		{"C=C", "c1ccccc1", false},
+		{"[OH]c", "Oc1ccccc1", true},
+		{"[OH]C", "Oc1ccccc1", false},
+		{"[NX3;H2]", "CCN", true},
+		{"[NX3;H2]", "CCNC", false},
+		{"[#7+,#8-]", "CC(=O)[O-]", true},
+		{"[R]", "CCCC", false},
+		{"[r5]", "C1CCCC1C", true},
+		{"[r6]", "C1CCCC1C", false},
+		{"C@C", "C1CCCC1C", true},
+		{"C!@C", "C1CCCC1", false},
+		{"[$(C(=O)O)]", "CC(=O)O", true},
+		{"[C;!$(C=O)]O", "CC(=O)O", false},
+		{"[C;!$(C=O)]O", "CCO", true},
+		{"[Cl,Br]c", "Clc1ccccc1", true},
+		{"[13C]", "[13CH4]", true},
+		{"*~*~*", "CC", false},
+		{"C.C", "CC", true},
+		{"[D3]", "CC(C)C", true},
+		{"[X4]", "CC(C)C", true},
+		{"[v4]", "CC=O", true},
+	}
+	for _, tt := range tests {
+		q := MustParse(tt.smarts)
+		if got := q.Matches(NewTarget(smiles.MustParse(tt.smiles))); got != tt.want {
+			t.Errorf("%s in %s = %v, want %v", tt.smarts, tt.smiles, got, tt.want)
+		}
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	target := NewTarget(smiles.MustParse("OCC(O)CO"))
+	got := MustParse("[OX2H]").FindAll(target, 0)
+	want := [][]int{{0}, {3}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll = %v, want %v", got, want)
+	}
+	if got := MustParse("CO").FindAll(target, 2); len(got) != 2 {
+		t.Errorf("FindAll with max 2 returned %d matches", len(got))
+	}
+	// 苯環的 12 個自同構對應只算一次
+	if got := MustParse("c1ccccc1").FindAll(NewTarget(smiles.MustParse("c1ccccc1")), 0); len(got) != 1 {
+		t.Errorf("benzene in benzene: %d unique matches, want 1", len(got))
+	}
+}
+
+func TestSearchFiles(t *testing.T) {
+	res := SearchFiles(MustParse("[OX2H][CX4]"), []string{"../sdf/testdata/ZINC000014418328.sdf", "missing.sdf"}, 0)
+	if res.Searched != 1 || len(res.Hits) != 1 || len(res.Errors) != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	hit := res.Hits[0]
+	if hit.ZincID != "ZINC000014418328" || len(hit.Matches) != 4 {
+		t.Errorf("hit = %+v, want 4 hydroxyl matches in ZINC000014418328", hit)
+	}
+	for _, m := range hit.Matches {
+		if m[0] < 1 || m[0] > 12 {
+			t.Errorf("atom numbers should be 1-based molfile indices, got %v", m)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{"", "C(", "[C", "[C;]", "C1CC", "[$(C]", "C=", "[Q]", "[C&]"} {
+		_, err := Parse(s)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) error = %v, want SyntaxError", s, err)
+		}
+	}
+}
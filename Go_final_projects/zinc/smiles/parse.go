@@ -0,0 +1,458 @@
+// Package smiles 讀寫 SMILES 字串，使用與 SDF 讀取器相同的 mol.Molecule 模型。
+package smiles
+
+import (
+	"fmt"
+	"strings"
+
+	"zinc/mol"
+)
+
+// SyntaxError 是 SMILES 字串中的語法錯誤，Pos 為 0 起始的字元位置
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("smiles: position %d: %s", e.Pos, e.Msg)
+}
+
+// organic 是不需要方括號的元素
+var organic = map[string]bool{
+	"B": true, "C": true, "N": true, "O": true, "P": true, "S": true,
+	"F": true, "Cl": true, "Br": true, "I": true,
+}
+
+// aromaticSymbols 是可以用小寫表示芳香的元素
+var aromaticSymbols = map[string]bool{
+	"b": true, "c": true, "n": true, "o": true, "p": true, "s": true,
+	"se": true, "as": true, "te": true,
+}
+
+// ringBond 是尚未閉合的環
+type ringBond struct {
+	atom  int
+	slot  int // 在開環原子鄰居順序中的位置
+	order int
+	dir   byte
+	pos   int
+}
+
+// parser 保存解析過程的狀態
+type parser struct {
+	s   string
+	pos int
+	m   *mol.Molecule
+
+	aromatic []bool
+	nbrs     [][]int // 每個原子的鄰居，依字串中出現的順序；-1 為隱含氫
+	hSlot    []int   // 隱含氫或孤對電子在鄰居順序中的位置
+	dirs     []byte  // 鍵的方向符號 '/'、'\' 或 0，方向由 Begin 指向 End
+	rings    map[int]ringBond
+}
+
+// Parse 解析一個 SMILES 字串。字串後以空白分隔的文字視為分子名稱，
+// 與 .smi 檔的格式相同。
+func Parse(s string) (*mol.Molecule, error) {
+	s = strings.TrimSpace(s)
+	name := ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		s, name = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	if s == "" {
+		return nil, &SyntaxError{0, "empty SMILES"}
+	}
+	p := &parser{s: s, m: &mol.Molecule{Name: name}, rings: make(map[int]ringBond)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	p.finish()
+	return p.m, nil
+}
+
+// MustParse 與 Parse 相同，但解析失敗時 panic，用於測試與常數
+func MustParse(s string) *mol.Molecule {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parse() error {
+	prev := -1
+	var stack []int
+	bondOrder, bondDir, bondPos := 0, byte(0), -1
+	dot := false
+
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '(':
+			if prev < 0 || bondOrder != 0 || bondDir != 0 {
+				return p.errorf("unexpected '('")
+			}
+			stack = append(stack, prev)
+			p.pos++
+		case c == ')':
+			if len(stack) == 0 {
+				return p.errorf("unmatched ')'")
+			}
+			if bondOrder != 0 || bondDir != 0 {
+				return p.errorf("bond before ')'")
+			}
+			prev = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.pos++
+		case c == '.':
+			if bondOrder != 0 || bondDir != 0 {
+				return p.errorf("bond before '.'")
+			}
+			dot = true
+			p.pos++
+		case strings.IndexByte("-=#$:/\\", c) >= 0:
+			if bondOrder != 0 || bondDir != 0 {
+				return p.errorf("consecutive bond symbols")
+			}
+			if prev < 0 {
+				return p.errorf("bond without a preceding atom")
+			}
+			bondPos = p.pos
+			switch c {
+			case '-':
+				bondOrder = mol.Single
+			case '=':
+				bondOrder = mol.Double
+			case '#':
+				bondOrder = mol.Triple
+			case '$':
+				return p.errorf("quadruple bonds are not supported")
+			case ':':
+				bondOrder = mol.Aromatic
+			default:
+				bondOrder, bondDir = mol.Single, c
+			}
+			p.pos++
+		case c >= '0' && c <= '9' || c == '%':
+			if prev < 0 {
+				return p.errorf("ring closure without a preceding atom")
+			}
+			start := p.pos
+			digit, err := p.ringNumber()
+			if err != nil {
+				return err
+			}
+			if err := p.ring(prev, digit, bondOrder, bondDir, start); err != nil {
+				return err
+			}
+			bondOrder, bondDir = 0, 0
+		default:
+			atom, err := p.atom()
+			if err != nil {
+				return err
+			}
+			if prev >= 0 && !dot {
+				p.bond(prev, atom, bondOrder, bondDir)
+			} else if bondOrder != 0 {
+				p.pos = bondPos
+				return p.errorf("bond without a preceding atom")
+			}
+			p.hSlot[atom] = len(p.nbrs[atom])
+			prev, dot = atom, false
+			bondOrder, bondDir = 0, 0
+		}
+	}
+	switch {
+	case len(stack) > 0:
+		return p.errorf("unclosed '('")
+	case bondOrder != 0 || bondDir != 0:
+		return p.errorf("bond at end of SMILES")
+	case dot:
+		return p.errorf("'.' at end of SMILES")
+	}
+	for digit, r := range p.rings {
+		p.pos = r.pos
+		return p.errorf("unclosed ring %d", digit)
+	}
+	return nil
+}
+
+// ringNumber 讀取一位數字或 %nn
+func (p *parser) ringNumber() (int, error) {
+	if p.s[p.pos] != '%' {
+		d := int(p.s[p.pos] - '0')
+		p.pos++
+		return d, nil
+	}
+	if p.pos+2 >= len(p.s) || !isDigit(p.s[p.pos+1]) || !isDigit(p.s[p.pos+2]) {
+		return 0, p.errorf("'%%' must be followed by two digits")
+	}
+	d := int(p.s[p.pos+1]-'0')*10 + int(p.s[p.pos+2]-'0')
+	p.pos += 3
+	return d, nil
+}
+
+// ring 開啟或閉合環號 digit
+func (p *parser) ring(atom, digit, order int, dir byte, pos int) error {
+	r, open := p.rings[digit]
+	if !open {
+		p.rings[digit] = ringBond{atom: atom, slot: len(p.nbrs[atom]), order: order, dir: dir, pos: pos}
+		p.nbrs[atom] = append(p.nbrs[atom], -2) // 閉合時填入
+		return nil
+	}
+	delete(p.rings, digit)
+	if r.atom == atom || p.m.BondBetween(r.atom, atom) >= 0 {
+		p.pos = pos
+		return p.errorf("ring closure %d duplicates a bond", digit)
+	}
+	if order != 0 && r.order != 0 && order != r.order {
+		p.pos = pos
+		return p.errorf("conflicting bond orders for ring closure %d", digit)
+	}
+	if order == 0 {
+		order = r.order
+	}
+	// 閉合端寫的方向符號是從閉合原子看出去，換成由開環原子（Begin）出發的方向
+	if dir == 0 {
+		dir = r.dir
+	} else {
+		dir = flip(dir)
+	}
+	p.nbrs[r.atom][r.slot] = atom
+	p.nbrs[atom] = append(p.nbrs[atom], r.atom)
+	p.addBond(r.atom, atom, order, dir)
+	return nil
+}
+
+// bond 連接 from 與 to，to 是剛讀到的原子
+func (p *parser) bond(from, to, order int, dir byte) {
+	p.nbrs[from] = append(p.nbrs[from], to)
+	p.nbrs[to] = append(p.nbrs[to], from)
+	p.addBond(from, to, order, dir)
+}
+
+func (p *parser) addBond(from, to, order int, dir byte) {
+	if order == 0 {
+		order = mol.Single
+		if p.aromatic[from] && p.aromatic[to] {
+			order = mol.Aromatic
+		}
+	}
+	p.m.Bonds = append(p.m.Bonds, mol.Bond{Begin: from, End: to, Order: order})
+	p.dirs = append(p.dirs, dir)
+}
+
+func flip(dir byte) byte {
+	if dir == '/' {
+		return '\\'
+	}
+	return '/'
+}
+
+// atom 讀取一個原子（有機子集或方括號原子），回傳原子索引
+func (p *parser) atom() (int, error) {
+	var a mol.Atom
+	aromatic := false
+	if p.s[p.pos] == '[' {
+		var err error
+		a, aromatic, err = p.bracketAtom()
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		sym := ""
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], "Cl"), strings.HasPrefix(p.s[p.pos:], "Br"):
+			sym = p.s[p.pos : p.pos+2]
+		case organic[p.s[p.pos:p.pos+1]]:
+			sym = p.s[p.pos : p.pos+1]
+		case aromaticSymbols[p.s[p.pos:p.pos+1]]:
+			sym = strings.ToUpper(p.s[p.pos : p.pos+1])
+			aromatic = true
+		default:
+			return 0, p.errorf("unexpected character %q", p.s[p.pos])
+		}
+		p.pos += len(sym)
+		a.Symbol = sym
+	}
+	p.m.Atoms = append(p.m.Atoms, a)
+	p.aromatic = append(p.aromatic, aromatic)
+	p.nbrs = append(p.nbrs, nil)
+	p.hSlot = append(p.hSlot, 0)
+	return len(p.m.Atoms) - 1, nil
+}
+
+// bracketAtom 解析 [同位素 元素 掌性 氫數 電荷 :類別]
+func (p *parser) bracketAtom() (mol.Atom, bool, error) {
+	var a mol.Atom
+	a.NoImplicit = true
+	p.pos++ // '['
+	a.Isotope = p.number()
+
+	aromatic := false
+	rest := p.s[p.pos:]
+	switch {
+	case len(rest) >= 2 && aromaticSymbols[rest[:2]]:
+		a.Symbol = strings.ToUpper(rest[:1]) + rest[1:2]
+		aromatic = true
+	case len(rest) >= 1 && aromaticSymbols[rest[:1]]:
+		a.Symbol = strings.ToUpper(rest[:1])
+		aromatic = true
+	case len(rest) >= 2 && isUpper(rest[0]) && isLower(rest[1]) && known(rest[:2]):
+		a.Symbol = rest[:2]
+	case len(rest) >= 1 && isUpper(rest[0]) && known(rest[:1]):
+		a.Symbol = rest[:1]
+	default:
+		return a, false, p.errorf("unknown element in bracket atom")
+	}
+	p.pos += len(a.Symbol)
+
+	if p.peek('@') {
+		p.pos++
+		a.Chirality = mol.ChiralCCW
+		switch {
+		case p.peek('@'):
+			p.pos++
+			a.Chirality = mol.ChiralCW
+		case strings.HasPrefix(p.s[p.pos:], "TH1"):
+			p.pos += 3
+		case strings.HasPrefix(p.s[p.pos:], "TH2"):
+			p.pos += 3
+			a.Chirality = mol.ChiralCW
+		case hasAnyPrefix(p.s[p.pos:], "TH", "AL", "SP", "TB", "OH"):
+			return a, false, p.errorf("unsupported chirality class")
+		}
+	}
+	if p.peek('H') {
+		p.pos++
+		a.ExplicitH = 1
+		if p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+			a.ExplicitH = p.number()
+		}
+	}
+	if p.peek('+') || p.peek('-') {
+		sign := 1
+		if p.s[p.pos] == '-' {
+			sign = -1
+		}
+		c := p.s[p.pos]
+		p.pos++
+		n := 1
+		if p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+			n = p.number()
+		} else {
+			for p.peek(c) {
+				p.pos++
+				n++
+			}
+		}
+		a.Charge = sign * n
+	}
+	if p.peek(':') {
+		p.pos++
+		if p.pos >= len(p.s) || !isDigit(p.s[p.pos]) {
+			return a, false, p.errorf("atom class must be a number")
+		}
+		a.MapNum = p.number()
+	}
+	if !p.peek(']') {
+		return a, false, p.errorf("expected ']'")
+	}
+	p.pos++
+	return a, aromatic, nil
+}
+
+func (p *parser) peek(c byte) bool {
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+func (p *parser) number() int {
+	n := 0
+	for p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+		n = n*10 + int(p.s[p.pos]-'0')
+		p.pos++
+	}
+	return n
+}
+
+// finish 補上立體化學的鄰居順序與雙鍵幾何
+func (p *parser) finish() {
+	m := p.m
+	for i := range m.Atoms {
+		a := &m.Atoms[i]
+		if a.Chirality == mol.ChiralNone {
+			continue
+		}
+		refs := p.nbrs[i]
+		if a.ExplicitH == 1 || (a.ExplicitH == 0 && len(refs) == 3) {
+			// 隱含氫（或孤對電子）緊接在前一個原子之後
+			refs = append(append(append([]int(nil), refs[:p.hSlot[i]]...), -1), refs[p.hSlot[i]:]...)
+		}
+		if len(refs) != 4 {
+			a.Chirality = mol.ChiralNone
+			continue
+		}
+		copy(a.StereoRefs[:], refs)
+	}
+
+	adj := m.Adjacency()
+	for bi := range m.Bonds {
+		b := &m.Bonds[bi]
+		if b.Order != mol.Double {
+			continue
+		}
+		ref0, side0 := p.directional(b.Begin, b.End, adj)
+		ref1, side1 := p.directional(b.End, b.Begin, adj)
+		if side0 == 0 || side1 == 0 {
+			continue
+		}
+		b.StereoRefs = [2]int{ref0, ref1}
+		b.CisTrans = mol.Trans
+		if side0 == side1 {
+			b.CisTrans = mol.Cis
+		}
+	}
+}
+
+// directional 找出雙鍵 atom=other 在 atom 端帶方向符號的鍵，
+// 回傳該鄰居以及它在 atom 的上方（1）或下方（-1）
+func (p *parser) directional(atom, other int, adj [][]mol.Edge) (int, int) {
+	for _, e := range adj[atom] {
+		if e.Atom == other || p.dirs[e.Bond] == 0 {
+			continue
+		}
+		// "A/B" 表示 B 在 A 的上方
+		side := 1
+		if p.dirs[e.Bond] == '\\' {
+			side = -1
+		}
+		if p.m.Bonds[e.Bond].End == atom {
+			side = -side
+		}
+		return e.Atom, side
+	}
+	return -1, 0
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func known(symbol string) bool {
+	_, ok := mol.LookupElement(symbol)
+	return ok
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
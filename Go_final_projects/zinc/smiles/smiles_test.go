@@ -0,0 +1,153 @@
+package smiles
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"zinc/mol"
+	"zinc/sdf"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		smiles       string
+		atoms, bonds int
+		hydrogens    int
+	}{
+		{"CCO", 3, 2, 6},
+		{"c1ccccc1", 6, 6, 6},
+		{"c1cc[nH]c1", 5, 5, 5},
+		{"C1CC%10CC1.C%10", 6, 6, 12},
+		{"[13CH3][N+](C)(C)C", 5, 4, 12},
+		{"CC(=O)[O-].[Na+]", 5, 3, 3},
+		{"N[C@H](CO)[C@H]1O[C@@H](O)[C@@H](O)[C@@H]1O", 12, 12, 13},
+	}
+	for _, tt := range tests {
+		m, err := Parse(tt.smiles)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.smiles, err)
+			continue
+		}
+		h := 0
+		for i := range m.Atoms {
+			h += m.HydrogenCount(i)
+		}
+		if len(m.Atoms) != tt.atoms || len(m.Bonds) != tt.bonds || h != tt.hydrogens {
+			t.Errorf("Parse(%q): %d atoms, %d bonds, %d H; want %d, %d, %d",
+				tt.smiles, len(m.Atoms), len(m.Bonds), h, tt.atoms, tt.bonds, tt.hydrogens)
+		}
+	}
+
+	m := MustParse("[13CH3:7][NH3+] methylamine")
+	if m.Name != "methylamine" || m.Atoms[0].Isotope != 13 || m.Atoms[0].MapNum != 7 || m.Atoms[1].Charge != 1 {
+		t.Errorf("bracket atoms parsed as %+v (name %q)", m.Atoms, m.Name)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{"", "C(", "C)", "C1CC", "C==C", "C[Xx]", "C%1", "=C", "CC."} {
+		_, err := Parse(s)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) error = %v, want SyntaxError", s, err)
+		}
+	}
+}
+
+func TestCanonicalZincFixture(t *testing.T) {
+	mols, err := sdf.ReadFile("../sdf/testdata/ZINC000014418328.sdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, _ := mols[0].Field("smiles")
+	fromSDF := Canonical(mols[0])
+	fromSMILES := Canonical(MustParse(field))
+	if fromSDF != fromSMILES {
+		t.Errorf("SDF gives %s, SMILES field gives %s", fromSDF, fromSMILES)
+	}
+}
+
+func TestCanonicalEquivalence(t *testing.T) {
+	groups := [][]string{
+		{"Oc1ccccc1", "c1ccccc1O", "OC1=CC=CC=C1", "C1=CC=C(O)C=C1"},
+		{"F/C=C/F", "F\\C=C\\F", "C(\\F)=C/F"},
+		{"F/C=C\\F", "F\\C=C/F", "C(/F)=C/F"},
+		{"C[C@H](N)O", "C[C@@H](O)N", "N[C@@H](C)O", "O[C@H](C)N", "[C@H](C)(O)N"},
+		{"CC(=O)[O-].[Na+]", "[Na+].[O-]C(C)=O"},
+		{"c1cc[nH]c1", "C1=CNC=C1", "[nH]1cccc1"},
+		{"C[C@H]1CC[C@@H](C)CC1", "C1C[C@@H](C)CC[C@H]1C"},
+		{"[2H]C([2H])([2H])Cl", "ClC([2H])([2H])[2H]"},
+	}
+	for _, g := range groups {
+		want := Canonical(MustParse(g[0]))
+		for _, s := range g[1:] {
+			if got := Canonical(MustParse(s)); got != want {
+				t.Errorf("Canonical(%q) = %s, Canonical(%q) = %s", g[0], want, s, got)
+			}
+		}
+	}
+
+	// 不同的立體異構物不能得到相同的字串
+	distinct := [][2]string{
+		{"F/C=C/F", "F/C=C\\F"},
+		{"C[C@H](N)O", "C[C@@H](N)O"},
+		{"C[C@H]1CC[C@@H](C)CC1", "C[C@H]1CC[C@H](C)CC1"},
+	}
+	for _, d := range distinct {
+		if Canonical(MustParse(d[0])) == Canonical(MustParse(d[1])) {
+			t.Errorf("%s and %s canonicalize to the same string", d[0], d[1])
+		}
+	}
+}
+
+// TestCanonicalAtomOrder 打亂原子順序後正規 SMILES 不變，且可以讀回同一個字串
+func TestCanonicalAtomOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, s := range []string{
+		"N[C@H](CO)[C@H]1O[C@@H](O)[C@@H](O)[C@@H]1O",
+		"CC(C)C[C@H](NC(=O)[C@@H](Cc1ccccc1)NC(=O)c1cnccn1)B(O)O",
+		"C/C=C/C=C\\c1ccc2[nH]ccc2c1",
+		"O=C([O-])c1ccccc1C(=O)N1CC[NH+](C)CC1",
+	} {
+		m := MustParse(s)
+		want := Canonical(m)
+		if again := Canonical(MustParse(want)); again != want {
+			t.Errorf("%s: canonical %s reparses to %s", s, want, again)
+		}
+		for k := 0; k < 5; k++ {
+			if got := Canonical(shuffle(m, r)); got != want {
+				t.Errorf("%s: shuffled atoms give %s, want %s", s, got, want)
+			}
+		}
+	}
+}
+
+// shuffle 回傳原子與鍵順序隨機重排後的分子
+func shuffle(m *mol.Molecule, r *rand.Rand) *mol.Molecule {
+	perm := r.Perm(len(m.Atoms))
+	remap := func(i int) int {
+		if i < 0 {
+			return i
+		}
+		return perm[i]
+	}
+	out := &mol.Molecule{Atoms: make([]mol.Atom, len(m.Atoms))}
+	for i, a := range m.Atoms {
+		for k := range a.StereoRefs {
+			a.StereoRefs[k] = remap(a.StereoRefs[k])
+		}
+		out.Atoms[perm[i]] = a
+	}
+	for _, k := range r.Perm(len(m.Bonds)) {
+		b := m.Bonds[k]
+		b.Begin, b.End = perm[b.Begin], perm[b.End]
+		b.StereoRefs = [2]int{remap(b.StereoRefs[0]), remap(b.StereoRefs[1])}
+		if r.Intn(2) == 0 {
+			b.Begin, b.End = b.End, b.Begin
+			b.StereoRefs[0], b.StereoRefs[1] = b.StereoRefs[1], b.StereoRefs[0]
+		}
+		out.Bonds = append(out.Bonds, b)
+	}
+	return out
+}
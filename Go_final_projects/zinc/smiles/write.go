@@ -0,0 +1,730 @@
+package smiles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"zinc/mol"
+)
+
+// Write 依原子在 m 中的順序輸出 SMILES，不做正規化
+func Write(m *mol.Molecule) string {
+	c := prepare(m)
+	order := make([]int, len(c.Atoms))
+	for i := range order {
+		order[i] = i
+	}
+	return newWriter(c, order).write()
+}
+
+// Canonical 輸出正規化的 SMILES：同一個分子不論來源（SDF 的 Kekulé 結構與楔形鍵，
+// 或任意寫法的 SMILES）都會得到相同的字串。氫原子併入重原子、芳香環以小寫表示，
+// 對稱鄰居使立體標記失去意義時會省略該標記。
+func Canonical(m *mol.Molecule) string {
+	c := prepare(m)
+	c.Aromatize()
+	adj := c.Adjacency()
+	classes := symmetryClasses(c, adj)
+	dropSymmetricStereo(c, classes)
+	return newWriter(c, canonicalRanks(c, adj, classes)).write()
+}
+
+// prepare 複製分子、由座標或 parity 推得立體化學並移除氫原子
+func prepare(m *mol.Molecule) *mol.Molecule {
+	c := m.Clone()
+	if !c.HasStereo() {
+		c.PerceiveStereo()
+	}
+	c.RemoveHydrogens()
+	return c
+}
+
+// invariant 是用於初始排序的原子不變量
+type invariant struct {
+	degree, number, isotope, charge, hydrogens int
+	aromatic, ring                             bool
+}
+
+func (a invariant) less(b invariant) bool {
+	switch {
+	case a.degree != b.degree:
+		return a.degree < b.degree
+	case a.number != b.number:
+		return a.number < b.number
+	case a.isotope != b.isotope:
+		return a.isotope < b.isotope
+	case a.charge != b.charge:
+		return a.charge < b.charge
+	case a.hydrogens != b.hydrogens:
+		return a.hydrogens < b.hydrogens
+	case a.aromatic != b.aromatic:
+		return !a.aromatic
+	}
+	return !a.ring && b.ring
+}
+
+// symmetryClasses 以原子不變量與鄰居反覆細分，回傳每個原子的對稱類別
+func symmetryClasses(m *mol.Molecule, adj [][]mol.Edge) []int {
+	n := len(m.Atoms)
+	inRing := m.RingAtoms()
+	inv := make([]invariant, n)
+	for i, a := range m.Atoms {
+		inv[i] = invariant{
+			degree:    len(adj[i]),
+			number:    a.AtomicNumber(),
+			isotope:   a.Isotope,
+			charge:    a.Charge,
+			hydrogens: m.ImplicitHydrogens(i) + a.ExplicitH,
+			ring:      inRing[i],
+		}
+		for _, e := range adj[i] {
+			if m.Bonds[e.Bond].Order == mol.Aromatic {
+				inv[i].aromatic = true
+			}
+		}
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(x, y int) bool { return inv[idx[x]].less(inv[idx[y]]) })
+	ranks := make([]int, n)
+	for k := 1; k < n; k++ {
+		ranks[idx[k]] = ranks[idx[k-1]]
+		if inv[idx[k-1]].less(inv[idx[k]]) {
+			ranks[idx[k]]++
+		}
+	}
+	return refine(ranks, adj, m)
+}
+
+// canonicalRanks 從對稱類別開始逐一打破平手，得到每個原子唯一的排名。
+// 沒有立體化學時選哪個原子都會寫出相同的字串；有立體化學時（例如 cis-1,4-二甲基環己烷）
+// 不同的選擇會寫出互為鏡像的 @/@@，因此逐一嘗試並保留字串最小的選擇。
+func canonicalRanks(m *mol.Molecule, adj [][]mol.Edge, classes []int) []int {
+	ranks := append([]int(nil), classes...)
+	stereo := m.HasStereo()
+	for {
+		tie := firstTie(ranks)
+		if tie < 0 {
+			return ranks
+		}
+		var best []int
+		bestSMILES := ""
+		for i, r := range ranks {
+			if r != tie {
+				continue
+			}
+			next := breakTie(ranks, i, adj, m)
+			if !stereo {
+				best = next
+				break
+			}
+			s := newWriter(m, completeRanks(next, adj, m)).write()
+			if best == nil || s < bestSMILES {
+				best, bestSMILES = next, s
+			}
+		}
+		ranks = best
+	}
+}
+
+// completeRanks 以每個平手類別中的第一個原子打破剩下的平手
+func completeRanks(ranks []int, adj [][]mol.Edge, m *mol.Molecule) []int {
+	for {
+		tie := firstTie(ranks)
+		if tie < 0 {
+			return ranks
+		}
+		for i, r := range ranks {
+			if r == tie {
+				ranks = breakTie(ranks, i, adj, m)
+				break
+			}
+		}
+	}
+}
+
+// firstTie 回傳排名最小的平手類別，沒有平手時回傳 -1
+func firstTie(ranks []int) int {
+	count := make(map[int]int)
+	for _, r := range ranks {
+		count[r]++
+	}
+	tie := -1
+	for _, r := range ranks {
+		if count[r] > 1 && (tie < 0 || r < tie) {
+			tie = r
+		}
+	}
+	return tie
+}
+
+// breakTie 把原子 atom 排在同類別的其他原子之前，再重新細分
+func breakTie(ranks []int, atom int, adj [][]mol.Edge, m *mol.Molecule) []int {
+	next := make([]int, len(ranks))
+	for i, r := range ranks {
+		next[i] = 2 * r
+		if r == ranks[atom] && i != atom {
+			next[i]++
+		}
+	}
+	return refine(next, adj, m)
+}
+
+// refine 以鄰居的排名與鍵級反覆細分排名，直到類別數不再增加
+func refine(ranks []int, adj [][]mol.Edge, m *mol.Molecule) []int {
+	n := len(ranks)
+	classes := countClasses(ranks)
+	for {
+		keys := make([][]int, n)
+		for i := range keys {
+			var nb []int
+			for _, e := range adj[i] {
+				nb = append(nb, ranks[e.Atom]*8+m.Bonds[e.Bond].Order)
+			}
+			sort.Ints(nb)
+			keys[i] = append([]int{ranks[i]}, nb...)
+		}
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(x, y int) bool { return lessInts(keys[idx[x]], keys[idx[y]]) })
+		next := make([]int, n)
+		for k := 1; k < n; k++ {
+			next[idx[k]] = next[idx[k-1]]
+			if lessInts(keys[idx[k-1]], keys[idx[k]]) {
+				next[idx[k]]++
+			}
+		}
+		c := countClasses(next)
+		if c == classes {
+			return next
+		}
+		ranks, classes = next, c
+	}
+}
+
+func countClasses(ranks []int) int {
+	seen := make(map[int]bool)
+	for _, r := range ranks {
+		seen[r] = true
+	}
+	return len(seen)
+}
+
+func lessInts(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// dropSymmetricStereo 移除因對稱鄰居而沒有意義的立體標記。
+// 環上的中心只要同一環系中還有其他立體中心就保留（例如 cis-1,4-二甲基環己烷）。
+func dropSymmetricStereo(m *mol.Molecule, classes []int) {
+	adj := m.Adjacency()
+	ringBond := m.RingBonds()
+	inRing := m.RingAtoms()
+	system := ringSystems(m, adj, ringBond)
+	stereoInSystem := make(map[int]int)
+	for i, a := range m.Atoms {
+		if a.Chirality != mol.ChiralNone && inRing[i] {
+			stereoInSystem[system[i]]++
+		}
+	}
+
+	for i := range m.Atoms {
+		a := &m.Atoms[i]
+		if a.Chirality == mol.ChiralNone {
+			continue
+		}
+		if !sameNeighbors(a.StereoRefs[:], adj[i]) {
+			a.Chirality = mol.ChiralNone
+			continue
+		}
+		if symmetric(adj[i], nil, classes) && !(inRing[i] && stereoInSystem[system[i]] > 1) {
+			a.Chirality = mol.ChiralNone
+		}
+	}
+	for bi := range m.Bonds {
+		b := &m.Bonds[bi]
+		if b.CisTrans == mol.CisTransNone {
+			continue
+		}
+		if b.Order != mol.Double ||
+			m.BondBetween(b.Begin, b.StereoRefs[0]) < 0 || m.BondBetween(b.End, b.StereoRefs[1]) < 0 ||
+			symmetric(adj[b.Begin], []int{b.End}, classes) || symmetric(adj[b.End], []int{b.Begin}, classes) {
+			b.CisTrans = mol.CisTransNone
+		}
+	}
+}
+
+// sameNeighbors 判斷 refs 是否恰好是原子的鄰居（加上一個 -1）
+func sameNeighbors(refs []int, edges []mol.Edge) bool {
+	want := []int{}
+	for _, e := range edges {
+		want = append(want, e.Atom)
+	}
+	for len(want) < 4 {
+		want = append(want, -1)
+	}
+	got := append([]int(nil), refs...)
+	sort.Ints(want)
+	sort.Ints(got)
+	for k := range want {
+		if want[k] != got[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// symmetric 判斷鄰居（排除 skip）中是否有兩個屬於同一對稱類別
+func symmetric(edges []mol.Edge, skip []int, classes []int) bool {
+	seen := make(map[int]bool)
+outer:
+	for _, e := range edges {
+		for _, s := range skip {
+			if e.Atom == s {
+				continue outer
+			}
+		}
+		if seen[classes[e.Atom]] {
+			return true
+		}
+		seen[classes[e.Atom]] = true
+	}
+	return false
+}
+
+// ringSystems 回傳每個原子所屬的環系編號（以環鍵相連的原子為同一環系）
+func ringSystems(m *mol.Molecule, adj [][]mol.Edge, ringBond []bool) []int {
+	system := make([]int, len(m.Atoms))
+	for i := range system {
+		system[i] = -1
+	}
+	next := 0
+	for i := range m.Atoms {
+		if system[i] >= 0 {
+			continue
+		}
+		stack := []int{i}
+		system[i] = next
+		for len(stack) > 0 {
+			a := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range adj[a] {
+				if ringBond[e.Bond] && system[e.Atom] < 0 {
+					system[e.Atom] = next
+					stack = append(stack, e.Atom)
+				}
+			}
+		}
+		next++
+	}
+	return system
+}
+
+// writer 依排名做深度優先走訪並輸出 SMILES
+type writer struct {
+	m     *mol.Molecule
+	adj   [][]mol.Edge
+	ranks []int
+
+	visited  []bool
+	children [][]int     // 走訪樹中的子原子，依輸出順序
+	parent   []int       // 走訪樹中的父原子，起點為 -1
+	closures [][]int     // 每個原子上的環閉合鍵，依輸出順序
+	written  [][]int     // 每個原子的鄰居依 SMILES 中出現的順序，-1 為隱含氫
+	seen     []bool      // 鍵是否已走訪
+	first    []int       // 每個鍵在字串中先出現的原子
+	digits   map[int]int // 環閉合鍵 -> 環號
+	dirs     []byte      // 每個鍵的方向符號，方向由 first 指向另一端
+}
+
+func newWriter(m *mol.Molecule, ranks []int) *writer {
+	return &writer{
+		m:        m,
+		adj:      m.Adjacency(),
+		ranks:    ranks,
+		visited:  make([]bool, len(m.Atoms)),
+		children: make([][]int, len(m.Atoms)),
+		parent:   make([]int, len(m.Atoms)),
+		closures: make([][]int, len(m.Atoms)),
+		written:  make([][]int, len(m.Atoms)),
+		seen:     make([]bool, len(m.Bonds)),
+		first:    make([]int, len(m.Bonds)),
+		digits:   make(map[int]int),
+		dirs:     make([]byte, len(m.Bonds)),
+	}
+}
+
+func (w *writer) write() string {
+	// 各連通分量從排名最小的原子開始，分量依起點排名排列
+	var starts []int
+	for {
+		start := -1
+		for i := range w.m.Atoms {
+			if !w.visited[i] && (start < 0 || w.ranks[i] < w.ranks[start]) {
+				start = i
+			}
+		}
+		if start < 0 {
+			break
+		}
+		starts = append(starts, start)
+		w.parent[start] = -1
+		w.visit(start)
+	}
+	w.assignDigits(starts)
+	w.assignDirections(starts)
+
+	var sb strings.Builder
+	for k, s := range starts {
+		if k > 0 {
+			sb.WriteByte('.')
+		}
+		w.emit(&sb, s)
+	}
+	return sb.String()
+}
+
+// visit 建立走訪樹，鄰居依排名順序走訪
+func (w *writer) visit(i int) {
+	w.visited[i] = true
+	nbrs := append([]mol.Edge(nil), w.adj[i]...)
+	sort.Slice(nbrs, func(x, y int) bool { return w.ranks[nbrs[x].Atom] < w.ranks[nbrs[y].Atom] })
+	for _, e := range nbrs {
+		if w.seen[e.Bond] {
+			continue
+		}
+		w.seen[e.Bond] = true
+		if !w.visited[e.Atom] {
+			w.parent[e.Atom] = i
+			w.first[e.Bond] = i
+			w.children[i] = append(w.children[i], e.Atom)
+			w.visit(e.Atom)
+			continue
+		}
+		// 回到已走訪的祖先原子：環閉合，環號寫在兩端
+		w.first[e.Bond] = e.Atom
+		w.closures[e.Atom] = append(w.closures[e.Atom], e.Bond)
+		w.closures[i] = append(w.closures[i], e.Bond)
+	}
+}
+
+// assignDigits 依輸出順序分配環號，閉合後的環號可以重複使用
+func (w *writer) assignDigits(starts []int) {
+	inUse := make(map[int]bool)
+	var walk func(i int)
+	walk = func(i int) {
+		// 先閉合，再開新的環
+		for _, b := range w.closures[i] {
+			if w.first[b] != i {
+				delete(inUse, w.digits[b])
+			}
+		}
+		for _, b := range w.closures[i] {
+			if w.first[b] == i {
+				d := 1
+				for inUse[d] {
+					d++
+				}
+				inUse[d] = true
+				w.digits[b] = d
+			}
+		}
+		for _, c := range w.children[i] {
+			walk(c)
+		}
+	}
+	for _, s := range starts {
+		walk(s)
+	}
+	// 每個原子上的環號依實際寫出的順序排列
+	for i := range w.closures {
+		cl := w.closures[i]
+		sort.SliceStable(cl, func(x, y int) bool {
+			cx, cy := w.first[cl[x]] != i, w.first[cl[y]] != i
+			if cx != cy {
+				return cx
+			}
+			return w.digits[cl[x]] < w.digits[cl[y]]
+		})
+	}
+	for i := range w.m.Atoms {
+		var order []int
+		if w.parent[i] >= 0 {
+			order = append(order, w.parent[i])
+		}
+		if w.hasImplicitRef(i) {
+			order = append(order, -1)
+		}
+		for _, b := range w.closures[i] {
+			order = append(order, w.other(b, i))
+		}
+		order = append(order, w.children[i]...)
+		w.written[i] = order
+	}
+}
+
+// hasImplicitRef 判斷立體中心的鄰居順序中是否包含隱含氫或孤對電子
+func (w *writer) hasImplicitRef(i int) bool {
+	a := w.m.Atoms[i]
+	if a.Chirality == mol.ChiralNone {
+		return false
+	}
+	for _, r := range a.StereoRefs {
+		if r < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *writer) other(bond, atom int) int {
+	b := w.m.Bonds[bond]
+	if b.Begin == atom {
+		return b.End
+	}
+	return b.Begin
+}
+
+// assignDirections 為有幾何的雙鍵在兩端各挑一個相鄰單鍵標上 / 或 \。
+// 雙鍵依輸出順序處理，共用的單鍵（共軛雙鍵）沿用先前決定的方向。
+func (w *writer) assignDirections(starts []int) {
+	var order []int
+	var walk func(i int)
+	walk = func(i int) {
+		order = append(order, i)
+		for _, c := range w.children[i] {
+			walk(c)
+		}
+	}
+	for _, s := range starts {
+		walk(s)
+	}
+	pos := make([]int, len(w.m.Atoms))
+	for k, i := range order {
+		pos[i] = k
+	}
+
+	var doubles []int
+	for bi, b := range w.m.Bonds {
+		if b.CisTrans != mol.CisTransNone {
+			doubles = append(doubles, bi)
+		}
+	}
+	sort.Slice(doubles, func(x, y int) bool {
+		return pos[w.first[doubles[x]]] < pos[w.first[doubles[y]]]
+	})
+
+	for _, bi := range doubles {
+		b := w.m.Bonds[bi]
+		a, z := w.first[bi], w.other(bi, w.first[bi])
+		x, bx := w.directionRef(a, z)
+		y, by := w.directionRef(z, a)
+		if bx < 0 || by < 0 {
+			continue
+		}
+		// 換算成以 x、y 為參考的幾何
+		cis := b.CisTrans == mol.Cis
+		refA, refZ := b.StereoRefs[0], b.StereoRefs[1]
+		if b.Begin != a {
+			refA, refZ = refZ, refA
+		}
+		if refA != x {
+			cis = !cis
+		}
+		if refZ != y {
+			cis = !cis
+		}
+
+		if w.dirs[bx] == 0 {
+			w.dirs[bx] = '/'
+		}
+		sideX := w.side(bx, a)
+		sideY := sideX
+		if !cis {
+			sideY = -sideX
+		}
+		switch w.side(by, z) {
+		case 0:
+			w.setSide(by, z, sideY)
+		case sideY:
+		default:
+			// 共軛系統中無法同時滿足，放棄這個雙鍵的標記
+		}
+	}
+}
+
+// directionRef 回傳雙鍵 atom=other 在 atom 端用來標方向的鄰居與鍵：
+// 優先使用已經有方向的鍵，否則取輸出順序中的第一個單鍵鄰居
+func (w *writer) directionRef(atom, other int) (int, int) {
+	ref, bond := -1, -1
+	for _, n := range w.written[atom] {
+		if n < 0 || n == other {
+			continue
+		}
+		bi := w.m.BondBetween(atom, n)
+		if w.m.Bonds[bi].Order != mol.Single && w.m.Bonds[bi].Order != mol.Aromatic {
+			continue
+		}
+		if w.dirs[bi] != 0 {
+			return n, bi
+		}
+		if bond < 0 {
+			ref, bond = n, bi
+		}
+	}
+	return ref, bond
+}
+
+// side 回傳鍵 bond 的另一端在 atom 的上方（1）、下方（-1）或尚未決定（0）
+func (w *writer) side(bond, atom int) int {
+	if w.dirs[bond] == 0 {
+		return 0
+	}
+	s := 1
+	if w.dirs[bond] == '\\' {
+		s = -1
+	}
+	if w.first[bond] != atom {
+		s = -s
+	}
+	return s
+}
+
+func (w *writer) setSide(bond, atom, side int) {
+	if w.first[bond] != atom {
+		side = -side
+	}
+	w.dirs[bond] = '/'
+	if side < 0 {
+		w.dirs[bond] = '\\'
+	}
+}
+
+// emit 輸出以 i 為根的子樹
+func (w *writer) emit(sb *strings.Builder, i int) {
+	w.atom(sb, i)
+	for _, b := range w.closures[i] {
+		if w.first[b] == i {
+			sb.WriteString(w.bondSymbol(b))
+		}
+		if d := w.digits[b]; d < 10 {
+			fmt.Fprint(sb, d)
+		} else {
+			fmt.Fprintf(sb, "%%%d", d)
+		}
+	}
+	for k, c := range w.children[i] {
+		last := k == len(w.children[i])-1
+		if !last {
+			sb.WriteByte('(')
+		}
+		sb.WriteString(w.bondSymbol(w.m.BondBetween(i, c)))
+		w.emit(sb, c)
+		if !last {
+			sb.WriteByte(')')
+		}
+	}
+}
+
+func (w *writer) isAromatic(i int) bool {
+	for _, e := range w.adj[i] {
+		if w.m.Bonds[e.Bond].Order == mol.Aromatic {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *writer) bondSymbol(bond int) string {
+	b := w.m.Bonds[bond]
+	switch b.Order {
+	case mol.Double:
+		return "="
+	case mol.Triple:
+		return "#"
+	case mol.Aromatic:
+		return ""
+	}
+	if w.dirs[bond] != 0 {
+		return string(w.dirs[bond])
+	}
+	if w.isAromatic(b.Begin) && w.isAromatic(b.End) {
+		return "-"
+	}
+	return ""
+}
+
+// atom 輸出原子；有機子集中價數與氫數都是預設值的原子不加方括號
+func (w *writer) atom(sb *strings.Builder, i int) {
+	a := w.m.Atoms[i]
+	aromatic := w.isAromatic(i)
+	symbol := a.Symbol
+	if aromatic {
+		symbol = strings.ToLower(symbol)
+	}
+	hydrogens := w.m.ImplicitHydrogens(i) + a.ExplicitH
+
+	var chirality int
+	if a.Chirality != mol.ChiralNone && len(w.written[i]) == 4 && sameNeighbors(a.StereoRefs[:], w.adj[i]) {
+		var order [4]int
+		copy(order[:], w.written[i])
+		chirality = w.m.ChiralityFor(i, order)
+	}
+
+	if organic[a.Symbol] && a.Isotope == 0 && a.Charge == 0 && a.MapNum == 0 && a.Radical == 0 &&
+		chirality == mol.ChiralNone && hydrogens == w.defaultHydrogens(i) {
+		sb.WriteString(symbol)
+		return
+	}
+	sb.WriteByte('[')
+	if a.Isotope != 0 {
+		fmt.Fprint(sb, a.Isotope)
+	}
+	sb.WriteString(symbol)
+	switch chirality {
+	case mol.ChiralCCW:
+		sb.WriteString("@")
+	case mol.ChiralCW:
+		sb.WriteString("@@")
+	}
+	if hydrogens > 0 {
+		sb.WriteByte('H')
+		if hydrogens > 1 {
+			fmt.Fprint(sb, hydrogens)
+		}
+	}
+	switch {
+	case a.Charge == 1:
+		sb.WriteByte('+')
+	case a.Charge == -1:
+		sb.WriteByte('-')
+	case a.Charge > 1:
+		fmt.Fprintf(sb, "+%d", a.Charge)
+	case a.Charge < -1:
+		fmt.Fprintf(sb, "-%d", -a.Charge)
+	}
+	if a.MapNum != 0 {
+		fmt.Fprintf(sb, ":%d", a.MapNum)
+	}
+	sb.WriteByte(']')
+}
+
+// defaultHydrogens 回傳 SMILES 讀取器會替不加方括號的原子補上的氫數
+func (w *writer) defaultHydrogens(i int) int {
+	a := &w.m.Atoms[i]
+	saved := *a
+	a.ExplicitH, a.NoImplicit, a.Valence = 0, false, 0
+	n := w.m.ImplicitHydrogens(i)
+	*a = saved
+	return n
+}
@@ -0,0 +1,121 @@
+package tranche
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level 是分類軸（反應性、可購買性、pH、電荷）上的一個等級
+type Level struct {
+	Letter byte
+	Name   string
+	Value  int // 電荷軸上的淨電荷，其他軸不使用
+}
+
+func (l Level) String() string {
+	return fmt.Sprintf("%c (%s)", l.Letter, l.Name)
+}
+
+// Reactivity 是反應性等級，由溫和到高反應性
+var Reactivity = []Level{
+	{Letter: 'A', Name: "anodyne"},
+	{Letter: 'B', Name: "bother"},
+	{Letter: 'C', Name: "clean"},
+	{Letter: 'E', Name: "mild"},
+	{Letter: 'G', Name: "reactive"},
+	{Letter: 'I', Name: "hot"},
+}
+
+// Purchasability 是可購買性等級，由現貨到僅有文獻記錄
+var Purchasability = []Level{
+	{Letter: 'A', Name: "in-stock"},
+	{Letter: 'B', Name: "agent"},
+	{Letter: 'C', Name: "wait-ok"},
+	{Letter: 'D', Name: "boutique"},
+	{Letter: 'E', Name: "annotated"},
+}
+
+// PH 是質子化狀態計算時使用的 pH 模型
+var PH = []Level{
+	{Letter: 'R', Name: "reference"},
+	{Letter: 'M', Name: "mid"},
+	{Letter: 'L', Name: "low"},
+	{Letter: 'H', Name: "high"},
+}
+
+// Charge 是淨電荷
+var Charge = []Level{
+	{Letter: 'L', Name: "-2", Value: -2},
+	{Letter: 'M', Name: "-1", Value: -1},
+	{Letter: 'N', Name: "0", Value: 0},
+	{Letter: 'O', Name: "+1", Value: 1},
+	{Letter: 'P', Name: "+2", Value: 2},
+}
+
+// Code 是完整的六個字母 tranche 代碼，依序為分子量、logP、反應性、可購買性、pH 與電荷，例如 "AGCARN"
+type Code struct {
+	Tranche
+	Reactivity     Level
+	Purchasability Level
+	PH             Level
+	Charge         Level
+}
+
+// String 回傳六個字母的代碼
+func (c Code) String() string {
+	return string([]byte{c.MolecularWeight.Letter, c.LogP.Letter,
+		c.Reactivity.Letter, c.Purchasability.Letter, c.PH.Letter, c.Charge.Letter})
+}
+
+// ParseCode 解析六個字母的 tranche 代碼
+func ParseCode(code string) (Code, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 6 {
+		return Code{}, fmt.Errorf("tranche code %q must be six letters", code)
+	}
+	t, err := Parse(code[:2])
+	if err != nil {
+		return Code{}, fmt.Errorf("tranche code %q: %v", code, err)
+	}
+	c := Code{Tranche: t}
+	axes := []struct {
+		name   string
+		levels []Level
+		dst    *Level
+	}{
+		{"reactivity", Reactivity, &c.Reactivity},
+		{"purchasability", Purchasability, &c.Purchasability},
+		{"pH", PH, &c.PH},
+		{"charge", Charge, &c.Charge},
+	}
+	for i, axis := range axes {
+		l, ok := lookupLevel(axis.levels, code[2+i])
+		if !ok {
+			return Code{}, fmt.Errorf("tranche code %q: unknown %s letter %c", code, axis.name, code[2+i])
+		}
+		*axis.dst = l
+	}
+	return c, nil
+}
+
+func lookupLevel(levels []Level, letter byte) (Level, bool) {
+	for _, l := range levels {
+		if l.Letter == letter {
+			return l, true
+		}
+	}
+	return Level{}, false
+}
+
+// parseLevel 以字母或名稱（不分大小寫）找出等級
+func parseLevel(levels []Level, s string) (Level, bool) {
+	if len(s) == 1 {
+		return lookupLevel(levels, strings.ToUpper(s)[0])
+	}
+	for _, l := range levels {
+		if strings.EqualFold(l.Name, s) {
+			return l, true
+		}
+	}
+	return Level{}, false
+}
@@ -0,0 +1,325 @@
+package tranche
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Range 是數值範圍 [Min, Max]，Min 等於 Max 時代表單一數值
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Any 是不限範圍
+var Any = Range{Min: -inf, Max: inf}
+
+// ParseRange 解析數值範圍："300-400"、"300–400"、"1..3"、"1 to 3"、">500"、"<=200"、
+// 單一數值 "2.5"，或空字串、"*"、"any" 表示不限。單一數值選出包含它的區間，
+// 因此網頁下拉選單上的值（例如 logP "2.5"、分子量 ">500"）仍然對應原本的那一個 tranche。
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "", "*", "any":
+		return Any, nil
+	}
+	// 範圍端點落在區間上限時不算交集（見 Overlaps），所以 ">" 與 ">="、"<" 與 "<=" 選出相同的 tranche
+	for _, prefix := range []string{">=", "<=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			v, err := parseNumber(rest)
+			if err != nil {
+				return Range{}, fmt.Errorf("range %q: %v", s, err)
+			}
+			if prefix[0] == '>' {
+				return Range{v, inf}, nil
+			}
+			return Range{-inf, v}, nil
+		}
+	}
+
+	lo, hi, ok := cutRange(s)
+	if !ok {
+		v, err := parseNumber(s)
+		if err != nil {
+			return Range{}, fmt.Errorf("range %q: %v", s, err)
+		}
+		return Range{v, v}, nil
+	}
+	min, err := parseNumber(lo)
+	if err != nil {
+		return Range{}, fmt.Errorf("range %q: %v", s, err)
+	}
+	max, err := parseNumber(hi)
+	if err != nil {
+		return Range{}, fmt.Errorf("range %q: %v", s, err)
+	}
+	if min > max {
+		return Range{}, fmt.Errorf("range %q: lower bound is greater than upper bound", s)
+	}
+	return Range{min, max}, nil
+}
+
+// cutRange 以 "..", "–", "—", " to " 或不在開頭的 "-" 分開上下限；開頭的 "-" 是負號
+func cutRange(s string) (string, string, bool) {
+	for _, sep := range []string{"..", "–", "—", " to "} {
+		if lo, hi, ok := strings.Cut(s, sep); ok {
+			return lo, hi, true
+		}
+	}
+	if i := strings.Index(s[1:], "-"); i >= 0 {
+		return s[:i+1], s[i+2:], true
+	}
+	return "", "", false
+}
+
+func parseNumber(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, fmt.Errorf("%q is not a number", strings.TrimSpace(s))
+	}
+	return v, nil
+}
+
+// Overlaps 判斷範圍是否與區間 (Low, High] 有交集；單一數值時判斷它是否落在區間內。
+// 範圍的端點剛好是區間的上限時不算交集，例如分子量 300–400 不包含 (250, 300] 的 C。
+func (r Range) Overlaps(b Bin) bool {
+	if r.Min == r.Max {
+		return b.Contains(r.Min)
+	}
+	return b.Low < r.Max && b.High > r.Min
+}
+
+// Bins 回傳與範圍有交集的區間
+func (r Range) Bins(bins []Bin) []Bin {
+	var out []Bin
+	for _, b := range bins {
+		if r.Overlaps(b) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Touching 回傳只在範圍下限一點與範圍相接、因此 Bins 沒有選入的區間，例如分子量 300–400 的 C (250, 300]：
+// 其中只有剛好等於 300 的分子在範圍內。抓取時用來告訴使用者哪些區間被排除了。
+func (r Range) Touching(bins []Bin) []Bin {
+	if r.Min == r.Max {
+		return nil
+	}
+	var out []Bin
+	for _, b := range bins {
+		if b.High == r.Min {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (r Range) String() string {
+	switch {
+	case r == Any:
+		return "any"
+	case r.Min == r.Max:
+		return strconv.FormatFloat(r.Min, 'g', -1, 64)
+	case math.IsInf(r.Min, -1):
+		return "<=" + strconv.FormatFloat(r.Max, 'g', -1, 64)
+	case math.IsInf(r.Max, 1):
+		return ">=" + strconv.FormatFloat(r.Min, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(r.Min, 'g', -1, 64) + "–" + strconv.FormatFloat(r.Max, 'g', -1, 64)
+}
+
+// Query 是對 tranche 網格的查詢；分類軸留空表示不限
+type Query struct {
+	MolecularWeight Range
+	LogP            Range
+	Reactivity      []Level
+	Purchasability  []Level
+	PH              []Level
+	Charge          []Level
+}
+
+// queryAxes 是 ParseQuery 認得的軸名稱
+var queryAxes = map[string]string{
+	"mw":             "mw",
+	"mwt":            "mw",
+	"weight":         "mw",
+	"logp":           "logp",
+	"reactivity":     "reactivity",
+	"react":          "reactivity",
+	"purchasability": "purchasability",
+	"purch":          "purchasability",
+	"ph":             "ph",
+	"charge":         "charge",
+}
+
+// ParseQuery 解析以逗號或分號分隔的條件，例如 "MW 300–400, logP 1–3" 或
+// "mw 250-350; logp <2; reactivity A C; charge -1..1"。分子量與 logP 是數值範圍（見 ParseRange），
+// 其他軸是以空白或 "/" 分隔的字母或名稱，電荷也可以是數值範圍。沒有出現的軸不限。
+func ParseQuery(s string) (Query, error) {
+	q := Query{MolecularWeight: Any, LogP: Any}
+	seen := make(map[string]bool)
+	for _, clause := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ';' }) {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		i := strings.IndexAny(clause, " :=")
+		if i < 0 {
+			return Query{}, fmt.Errorf("query clause %q: want AXIS VALUE, e.g. \"MW 300-400\"", clause)
+		}
+		axis, ok := queryAxes[strings.ToLower(clause[:i])]
+		if !ok {
+			return Query{}, fmt.Errorf("query clause %q: unknown axis %q", clause, clause[:i])
+		}
+		if seen[axis] {
+			return Query{}, fmt.Errorf("query clause %q: %s given more than once", clause, axis)
+		}
+		seen[axis] = true
+		value := strings.TrimLeft(clause[i:], " :=")
+
+		var err error
+		switch axis {
+		case "mw":
+			q.MolecularWeight, err = ParseRange(value)
+		case "logp":
+			q.LogP, err = ParseRange(value)
+		case "reactivity":
+			q.Reactivity, err = parseLevels(Reactivity, value)
+		case "purchasability":
+			q.Purchasability, err = parseLevels(Purchasability, value)
+		case "ph":
+			q.PH, err = parseLevels(PH, value)
+		case "charge":
+			if q.Charge, err = parseLevels(Charge, value); err != nil {
+				if r, rerr := ParseRange(value); rerr == nil {
+					if q.Charge = chargesIn(r); len(q.Charge) > 0 {
+						err = nil
+					} else {
+						err = fmt.Errorf("no charge level in %s", r)
+					}
+				}
+			}
+		}
+		if err != nil {
+			return Query{}, fmt.Errorf("query clause %q: %v", clause, err)
+		}
+	}
+	if len(seen) == 0 {
+		return Query{}, fmt.Errorf("empty tranche query")
+	}
+	return q, nil
+}
+
+func parseLevels(levels []Level, s string) ([]Level, error) {
+	var out []Level
+	for _, tok := range strings.FieldsFunc(s, func(c rune) bool { return c == ' ' || c == '/' }) {
+		l, ok := parseLevel(levels, tok)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", tok)
+		}
+		out = append(out, l)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no levels given")
+	}
+	return out, nil
+}
+
+func chargesIn(r Range) []Level {
+	var out []Level
+	for _, l := range Charge {
+		if v := float64(l.Value); v >= r.Min && v <= r.Max {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Tranches 回傳查詢涵蓋的分子量 × logP tranche，依代碼排序。
+// ZINC20 的清單頁面只依這兩個軸切分，抓取時使用這些 tranche。
+func (q Query) Tranches() []Tranche {
+	var out []Tranche
+	for _, mw := range q.MolecularWeight.Bins(MolecularWeight) {
+		for _, logP := range q.LogP.Bins(LogP) {
+			out = append(out, Tranche{MolecularWeight: mw, LogP: logP})
+		}
+	}
+	return out
+}
+
+// Names 回傳 Tranches 的兩個字母代碼
+func (q Query) Names() []string {
+	ts := q.Tranches()
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.Name()
+	}
+	return names
+}
+
+// Codes 回傳查詢涵蓋的完整六個字母 tranche，依各軸的順序排列
+func (q Query) Codes() []Code {
+	or := func(levels, all []Level) []Level {
+		if len(levels) == 0 {
+			return all
+		}
+		return levels
+	}
+	var out []Code
+	for _, t := range q.Tranches() {
+		for _, react := range or(q.Reactivity, Reactivity) {
+			for _, purch := range or(q.Purchasability, Purchasability) {
+				for _, ph := range or(q.PH, PH) {
+					for _, charge := range or(q.Charge, Charge) {
+						out = append(out, Code{Tranche: t, Reactivity: react, Purchasability: purch, PH: ph, Charge: charge})
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Matches 判斷完整代碼是否在查詢範圍內
+func (q Query) Matches(c Code) bool {
+	in := func(levels []Level, l Level) bool {
+		if len(levels) == 0 {
+			return true
+		}
+		for _, x := range levels {
+			if x.Letter == l.Letter {
+				return true
+			}
+		}
+		return false
+	}
+	return q.MolecularWeight.Overlaps(c.MolecularWeight) && q.LogP.Overlaps(c.LogP) &&
+		in(q.Reactivity, c.Reactivity) && in(q.Purchasability, c.Purchasability) &&
+		in(q.PH, c.PH) && in(q.Charge, c.Charge)
+}
+
+func (q Query) String() string {
+	parts := []string{"MW " + q.MolecularWeight.String(), "logP " + q.LogP.String()}
+	for _, axis := range []struct {
+		name   string
+		levels []Level
+	}{
+		{"reactivity", q.Reactivity},
+		{"purchasability", q.Purchasability},
+		{"pH", q.PH},
+		{"charge", q.Charge},
+	} {
+		if len(axis.levels) == 0 {
+			continue
+		}
+		letters := make([]string, len(axis.levels))
+		for i, l := range axis.levels {
+			letters[i] = string(l.Letter)
+		}
+		parts = append(parts, axis.name+" "+strings.Join(letters, " "))
+	}
+	return strings.Join(parts, ", ")
+}
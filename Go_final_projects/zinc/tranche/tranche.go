@@ -0,0 +1,139 @@
+// Package tranche 描述 ZINC20 的 tranche 網格：分子量與 logP 兩個數值軸（也是清單頁面的切分方式），
+// 以及反應性、可購買性、pH 與電荷四個分類軸，並把數值範圍查詢轉換成要抓取的 tranche。
+package tranche
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Bin 是一個 tranche 區間 (Low, High]，字母對應 ZINC 網址中的代碼
+type Bin struct {
+	Letter byte
+	Label  string // 網頁下拉選單上顯示的值
+	Low    float64
+	High   float64
+}
+
+// Contains 判斷 v 是否落在區間內
+func (b Bin) Contains(v float64) bool {
+	return v > b.Low && v <= b.High
+}
+
+func (b Bin) String() string {
+	switch {
+	case math.IsInf(b.Low, -1):
+		return fmt.Sprintf("%c (<= %g)", b.Letter, b.High)
+	case math.IsInf(b.High, 1):
+		return fmt.Sprintf("%c (> %g)", b.Letter, b.Low)
+	}
+	return fmt.Sprintf("%c (%g, %g]", b.Letter, b.Low, b.High)
+}
+
+var inf = math.Inf(1)
+
+// MolecularWeight 是分子量的 A–K 區間
+var MolecularWeight = []Bin{
+	{'A', "200", -inf, 200},
+	{'B', "250", 200, 250},
+	{'C', "300", 250, 300},
+	{'D', "325", 300, 325},
+	{'E', "350", 325, 350},
+	{'F', "375", 350, 375},
+	{'G', "400", 375, 400},
+	{'H', "425", 400, 425},
+	{'I', "450", 425, 450},
+	{'J', "500", 450, 500},
+	{'K', ">500", 500, inf},
+}
+
+// LogP 是 logP 的 A–K 區間
+var LogP = []Bin{
+	{'A', "-1", -inf, -1},
+	{'B', "0", -1, 0},
+	{'C', "1", 0, 1},
+	{'D', "2", 1, 2},
+	{'E', "2.5", 2, 2.5},
+	{'F', "3", 2.5, 3},
+	{'G', "3.5", 3, 3.5},
+	{'H', "4", 3.5, 4},
+	{'I', "4.5", 4, 4.5},
+	{'J', "5", 4.5, 5},
+	{'K', ">5", 5, inf},
+}
+
+// Tranche 是分子量與 logP 兩個軸組成的 tranche，例如 "AG"
+type Tranche struct {
+	MolecularWeight Bin
+	LogP            Bin
+}
+
+// Name 回傳兩個字母的代碼，分子量在前、logP 在後，與 zinc_ids_XX.txt 的檔名一致
+func (t Tranche) Name() string {
+	return string([]byte{t.MolecularWeight.Letter, t.LogP.Letter})
+}
+
+// Parse 解析兩個字母的 tranche 代碼
+func Parse(name string) (Tranche, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if len(name) != 2 {
+		return Tranche{}, fmt.Errorf("tranche %q must be two letters", name)
+	}
+	mw, ok := lookup(MolecularWeight, name[0])
+	if !ok {
+		return Tranche{}, fmt.Errorf("tranche %q: unknown molecular weight letter %c", name, name[0])
+	}
+	logP, ok := lookup(LogP, name[1])
+	if !ok {
+		return Tranche{}, fmt.Errorf("tranche %q: unknown logP letter %c", name, name[1])
+	}
+	return Tranche{MolecularWeight: mw, LogP: logP}, nil
+}
+
+func lookup(bins []Bin, letter byte) (Bin, bool) {
+	for _, b := range bins {
+		if b.Letter == letter {
+			return b, true
+		}
+	}
+	return Bin{}, false
+}
+
+// FromFileName 從 zinc_ids_XX.txt 這類檔名取出 tranche 代碼
+func FromFileName(name string) (Tranche, error) {
+	base := name[strings.LastIndexAny(name, `/\`)+1:]
+	code := strings.TrimSuffix(strings.TrimPrefix(base, "zinc_ids_"), ".txt")
+	return Parse(code)
+}
+
+// Check 檢查分子量與 logP 是否落在 tranche 內，logP 允許 logPTolerance 的誤差，
+// 因為本地計算的 Crippen logP 與 ZINC 使用的 logP 模型不完全相同
+func (t Tranche) Check(mw, logP, logPTolerance float64) (mwOK, logPOK bool) {
+	mwOK = t.MolecularWeight.Contains(mw)
+	logPOK = logP > t.LogP.Low-logPTolerance && logP <= t.LogP.High+logPTolerance
+	return mwOK, logPOK
+}
+
+// FromLabels 以網頁下拉選單上的值（例如分子量 "350"、logP "2.5"）找出 tranche
+func FromLabels(mwLabel, logPLabel string) (Tranche, error) {
+	mw, ok := lookupLabel(MolecularWeight, mwLabel)
+	if !ok {
+		return Tranche{}, fmt.Errorf("unknown molecular weight %q", mwLabel)
+	}
+	logP, ok := lookupLabel(LogP, logPLabel)
+	if !ok {
+		return Tranche{}, fmt.Errorf("unknown logP %q", logPLabel)
+	}
+	return Tranche{MolecularWeight: mw, LogP: logP}, nil
+}
+
+func lookupLabel(bins []Bin, label string) (Bin, bool) {
+	label = strings.TrimSpace(label)
+	for _, b := range bins {
+		if b.Label == label {
+			return b, true
+		}
+	}
+	return Bin{}, false
+}
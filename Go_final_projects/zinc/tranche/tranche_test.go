@@ -0,0 +1,120 @@
+package tranche
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCode(t *testing.T) {
+	c, err := ParseCode("agcarn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != "AGCARN" || c.Name() != "AG" {
+		t.Errorf("code = %s (%s)", c, c.Name())
+	}
+	if c.Reactivity.Name != "clean" || c.Purchasability.Name != "in-stock" || c.PH.Name != "reference" || c.Charge.Value != 0 {
+		t.Errorf("levels = %v %v %v %v", c.Reactivity, c.Purchasability, c.PH, c.Charge)
+	}
+	for _, bad := range []string{"AG", "AGCARNX", "ZGCARN", "AGDARN", "AGCAXN", "AGCARZ"} {
+		if _, err := ParseCode(bad); err == nil {
+			t.Errorf("ParseCode(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Range
+	}{
+		{"300-400", Range{300, 400}},
+		{"300–400", Range{300, 400}},
+		{"-1..2.5", Range{-1, 2.5}},
+		{"-2 - -1", Range{-2, -1}},
+		{"1 to 3", Range{1, 3}},
+		{"2.5", Range{2.5, 2.5}},
+		{"-1", Range{-1, -1}},
+		{">500", Range{500, inf}},
+		{"<=200", Range{-inf, 200}},
+		{"", Any},
+		{"any", Any},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRange(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"abc", "400-300", ">x", "1-"} {
+		if _, err := ParseRange(bad); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRangeMatchesDropdownLabels(t *testing.T) {
+	// 下拉選單上的每個值都只對應原本的那一個區間
+	for _, axis := range [][]Bin{MolecularWeight, LogP} {
+		for _, b := range axis {
+			r, err := ParseRange(b.Label)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bins := r.Bins(axis); len(bins) != 1 || bins[0].Letter != b.Letter {
+				t.Errorf("label %q selects %v, want %v", b.Label, bins, b)
+			}
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	q, err := ParseQuery("MW 300–400, logP 1–3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分子量 (300, 400] 是 D–G，logP (1, 3] 是 D–F
+	want := "DD DE DF ED EE EF FD FE FF GD GE GF"
+	if got := strings.Join(q.Names(), " "); got != want {
+		t.Errorf("tranches = %s, want %s", got, want)
+	}
+	if codes := q.Codes(); len(codes) != 12*6*5*4*5 {
+		t.Errorf("%d codes", len(codes))
+	}
+	// 下限剛好是 C 與 C 的上限：C 沒有選入，但要能回報
+	if got := q.MolecularWeight.Touching(MolecularWeight); len(got) != 1 || got[0].Letter != 'C' {
+		t.Errorf("MW touching = %v, want C", got)
+	}
+	if got := (Range{2.5, 2.5}).Touching(LogP); len(got) != 0 {
+		t.Errorf("single value touching = %v", got)
+	}
+
+	q, err = ParseQuery("mw: <=200; logp=>5; reactivity A clean; purch in-stock; ph R; charge -1..0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, c := range q.Codes() {
+		codes = append(codes, c.String())
+	}
+	if got := strings.Join(codes, " "); got != "AKAARM AKAARN AKCARM AKCARN" {
+		t.Errorf("codes = %s", got)
+	}
+	c, _ := ParseCode("AKCARN")
+	if !q.Matches(c) {
+		t.Errorf("%s does not match %s", c, q)
+	}
+	c, _ = ParseCode("AKCARO")
+	if q.Matches(c) {
+		t.Errorf("%s matches %s", c, q)
+	}
+	if got := q.String(); got != "MW <=200, logP >=5, reactivity A C, purchasability A, pH R, charge M N" {
+		t.Errorf("String = %s", got)
+	}
+
+	for _, bad := range []string{"", "MW", "size 3", "MW 1-2, mw 3-4", "reactivity Z", "charge 5..9"} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded", bad)
+		}
+	}
+}